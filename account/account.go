@@ -23,6 +23,9 @@ type Account struct {
 	open          bool
 }
 
+// RedactedOwnerID is the owner of accounts whose owner's personal data was erased
+var RedactedOwnerID = OwnerID{}
+
 func NewID() ID {
 	return ID{UUID: uuid.New()}
 }
@@ -54,22 +57,66 @@ func (a *Account) Open(accountID ID, ownerID OwnerID) error {
 }
 
 func (a *Account) Deposit(amount int64) error {
+	if err := a.validateDeposit(amount); err != nil || amount == 0 {
+		return err
+	}
+
+	event := MoneyDepositedEvent{AmountDeposited: amount, Balance: a.balance + amount}
+	a.eventAppender.Append(event, a, a.id)
+	return nil
+}
+
+func (a *Account) Withdraw(amount int64) error {
+	if err := a.validateWithdrawal(amount); err != nil || amount == 0 {
+		return err
+	}
+
+	event := MoneyWithdrawnEvent{AmountWithdrawn: amount, Balance: a.balance - amount}
+	a.eventAppender.Append(event, a, a.id)
+	return nil
+}
+
+func (a *Account) SendTransfer(txId uuid.UUID, targetAccountID ID, amount int64) error {
+	if err := a.validateWithdrawal(amount); err != nil || amount == 0 {
+		return err
+	}
+
+	event := TransferSentEvent{
+		TransactionID:     txId,
+		TargetAccountID:   targetAccountID,
+		AmountTransferred: amount,
+		Balance:           a.balance - amount,
+	}
+	a.eventAppender.Append(event, a, a.id)
+	return nil
+}
+
+func (a *Account) ReceiveTransfer(txId uuid.UUID, sourceAccountID ID, amount int64) error {
+	if err := a.validateDeposit(amount); err != nil || amount == 0 {
+		return err
+	}
+
+	event := TransferReceivedEvent{
+		TransactionID:     txId,
+		SourceAccountID:   sourceAccountID,
+		AmountTransferred: amount,
+		Balance:           a.balance + amount,
+	}
+	a.eventAppender.Append(event, a, a.id)
+	return nil
+}
+
+func (a *Account) validateDeposit(amount int64) error {
 	if amount < 0 {
 		return NegativeDeposit
 	}
 	if !a.open {
 		return NotOpen
 	}
-	if amount == 0 {
-		return nil
-	}
-
-	event := MoneyDepositedEvent{AmountDeposited: amount, Balance: a.balance + amount}
-	a.eventAppender.Append(event, a, a.id)
 	return nil
 }
 
-func (a *Account) Withdraw(amount int64) error {
+func (a *Account) validateWithdrawal(amount int64) error {
 	if amount < 0 {
 		return NegativeWithdrawal
 	}
@@ -79,12 +126,6 @@ func (a *Account) Withdraw(amount int64) error {
 	if amount > a.balance {
 		return InsufficientBalance
 	}
-	if amount == 0 {
-		return nil
-	}
-
-	event := MoneyWithdrawnEvent{AmountWithdrawn: amount, Balance: a.balance - amount}
-	a.eventAppender.Append(event, a, a.id)
 	return nil
 }
 
@@ -120,6 +161,14 @@ func (a *Account) applyMoneyWithdrawn(event MoneyWithdrawnEvent) {
 	a.balance = event.Balance
 }
 
+func (a *Account) applyTransferSent(event TransferSentEvent) {
+	a.balance = event.Balance
+}
+
+func (a *Account) applyTransferReceived(event TransferReceivedEvent) {
+	a.balance = event.Balance
+}
+
 func (a *Account) applyAccountClosed(event AccountClosedEvent) {
 	a.open = false
 }
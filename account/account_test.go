@@ -1,6 +1,7 @@
 package account_test
 
 import (
+	"github.com/google/uuid"
 	"github.com/rieske/event-sourced-account-go/account"
 	"github.com/stretchr/testify/assert"
 	"testing"
@@ -197,3 +198,49 @@ func TestApplyEvents(t *testing.T) {
 	assert.True(t, snapshot.Open)
 	assert.Equal(t, int64(3), snapshot.Balance)
 }
+
+func TestSendTransfer(t *testing.T) {
+	a := newAccount()
+
+	accountID, ownerID := account.NewID(), account.NewOwnerID()
+	_ = a.Open(accountID, ownerID)
+	_ = a.Deposit(10)
+
+	err := a.SendTransfer(uuid.New(), account.NewID(), 4)
+
+	assert.NoError(t, err)
+	snapshot := a.Snapshot()
+	assert.Equal(t, int64(6), snapshot.Balance)
+}
+
+func TestCanNotSendTransferWhenBalanceInsufficient(t *testing.T) {
+	a := newAccount()
+
+	accountID, ownerID := account.NewID(), account.NewOwnerID()
+	_ = a.Open(accountID, ownerID)
+
+	err := a.SendTransfer(uuid.New(), account.NewID(), 4)
+
+	assert.EqualError(t, err, "insufficient balance")
+}
+
+func TestReceiveTransfer(t *testing.T) {
+	a := newAccount()
+
+	accountID, ownerID := account.NewID(), account.NewOwnerID()
+	_ = a.Open(accountID, ownerID)
+
+	err := a.ReceiveTransfer(uuid.New(), account.NewID(), 4)
+
+	assert.NoError(t, err)
+	snapshot := a.Snapshot()
+	assert.Equal(t, int64(4), snapshot.Balance)
+}
+
+func TestRequireOpenAccountToReceiveTransfer(t *testing.T) {
+	a := newAccount()
+
+	err := a.ReceiveTransfer(uuid.New(), account.NewID(), 4)
+
+	assert.EqualError(t, err, "account not open")
+}
@@ -16,4 +16,9 @@ const (
 	InsufficientBalance    Error = "insufficient balance"
 	BalanceOutstanding     Error = "balance outstanding"
 	ConcurrentModification Error = "concurrent modification error"
+	TransactionConflict    Error = "transaction id already used for another operation"
+	TransactionMismatch    Error = "transaction id already used with different parameters"
+	MissingTransactionID   Error = "transaction id required"
+	SelfTransfer           Error = "can not transfer to the same account"
+	NotAuthorized          Error = "operation not authorized"
 )
@@ -1,5 +1,7 @@
 package account
 
+import "github.com/google/uuid"
+
 type Event interface {
 	Apply(account *Account)
 }
@@ -42,6 +44,28 @@ func (e MoneyWithdrawnEvent) Apply(account *Account) {
 	account.applyMoneyWithdrawn(e)
 }
 
+type TransferSentEvent struct {
+	TransactionID     uuid.UUID `json:"transactionId"`
+	TargetAccountID   ID        `json:"targetAccountId"`
+	AmountTransferred int64     `json:"amountTransferred"`
+	Balance           int64     `json:"balance"`
+}
+
+func (e TransferSentEvent) Apply(account *Account) {
+	account.applyTransferSent(e)
+}
+
+type TransferReceivedEvent struct {
+	TransactionID     uuid.UUID `json:"transactionId"`
+	SourceAccountID   ID        `json:"sourceAccountId"`
+	AmountTransferred int64     `json:"amountTransferred"`
+	Balance           int64     `json:"balance"`
+}
+
+func (e TransferReceivedEvent) Apply(account *Account) {
+	account.applyTransferReceived(e)
+}
+
 type AccountClosedEvent struct {
 }
 
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/eventsourcing"
+	"github.com/rieske/event-sourced-account-go/eventstore/postgres"
+	"github.com/rieske/event-sourced-account-go/serialization"
+)
+
+const adminUsage = `usage: account-app [command]
+
+Without a command the account service is started.
+
+commands:
+  forget-owner <ownerId>  deletes the personal data key of the owner, redacting the owner of their accounts
+  verify [accountId...]   verifies the hash chains of the accounts' events, of all accounts if none are given
+  reshard                 moves accounts and command results to the shards of POSTGRES_SHARDS they belong to,
+                          out of the shards of POSTGRES_DRAINING_SHARDS too, after shards were added or removed
+  archive <retention>     moves the events of accounts closed longer than the retention, e.g. 2160h, to the archive`
+
+// runAdminCommand runs a one-off administrative command against the postgres event store and exits
+func runAdminCommand(args []string) {
+	cfg := mustLoadConfig(nil)
+	dbConfig := cfg.Database
+	switch args[0] {
+	case "forget-owner":
+		if len(args) != 2 {
+			exitWithUsage()
+		}
+		ownerID, err := uuid.Parse(args[1])
+		if err != nil {
+			log.Fatalf("invalid owner id '%s': %v", args[1], err)
+		}
+		withAdminDB(dbConfig, func(db *sql.DB) {
+			forgetOwner(db, account.OwnerID{UUID: ownerID})
+		})
+	case "verify":
+		var ids []account.ID
+		for _, arg := range args[1:] {
+			id, err := uuid.Parse(arg)
+			if err != nil {
+				log.Fatalf("invalid account id '%s': %v", arg, err)
+			}
+			ids = append(ids, account.ID{UUID: id})
+		}
+		if shards, ok := shardDataSources(cfg.Sharding.Shards); ok {
+			if !verifyShards(shards, dbConfig, ids) {
+				os.Exit(1)
+			}
+			return
+		}
+		withAdminDB(dbConfig, func(db *sql.DB) {
+			if !verify(postgres.NewEventStore(db), ids) {
+				os.Exit(1)
+			}
+		})
+	case "reshard":
+		shards, ok := shardDataSources(cfg.Sharding.Shards)
+		if !ok {
+			log.Fatalf("resharding requires sharding.shards")
+		}
+		draining, _ := shardDataSources(cfg.Sharding.DrainingShards)
+		// draining shards are not on the ring, so all their accounts move to the shards that are
+		withShardDBs(append(shards, draining...), dbConfig, func(dbs map[string]*sql.DB) {
+			reshard(dbs, shardRing(shards))
+		})
+	case "archive":
+		if len(args) != 2 {
+			exitWithUsage()
+		}
+		retention, err := time.ParseDuration(args[1])
+		if err != nil {
+			log.Fatalf("invalid retention '%s': %v", args[1], err)
+		}
+		cutoff := time.Now().Add(-retention)
+		if shards, ok := shardDataSources(cfg.Sharding.Shards); ok {
+			withShardDBs(shards, dbConfig, func(dbs map[string]*sql.DB) {
+				for name, db := range dbs {
+					fmt.Printf("shard %s: ", name)
+					archiveClosedAccounts(cfg.EventStore, db, cutoff)
+				}
+			})
+			return
+		}
+		withAdminDB(dbConfig, func(db *sql.DB) {
+			archiveClosedAccounts(cfg.EventStore, db, cutoff)
+		})
+	default:
+		exitWithUsage()
+	}
+}
+
+func withAdminDB(c databaseConfig, command func(db *sql.DB)) {
+	psqlInfo, ok := postgresDataSource()
+	if !ok {
+		log.Fatalf("admin commands require the postgres event store, POSTGRES_HOST not specified")
+	}
+	db := initDB("postgres", psqlInfo, "infrastructure/schema/postgres", postgres.MigrateSchema, c)
+	defer closeResource(db)
+	command(db)
+}
+
+func withShardDBs(shards []shardDataSource, c databaseConfig, command func(dbs map[string]*sql.DB)) {
+	dbs := map[string]*sql.DB{}
+	for _, shard := range shards {
+		db := initDB("postgres", shard.dsn, "infrastructure/schema/postgres", postgres.MigrateSchema, c)
+		defer closeResource(db)
+		dbs[shard.name] = db
+	}
+	command(dbs)
+}
+
+// forgetOwner crypto-shreds the personal data of the owner. Events stay in place and still reconstruct balances,
+// but read back with a redacted owner. The owner is never given a key again and running instances drop the keys and
+// aggregates they cached of the owner within forgottenOwnerPollInterval.
+func forgetOwner(db *sql.DB, ownerID account.OwnerID) {
+	deleted, err := postgres.NewOwnerKeyStore(db).DeleteOwnerKey(context.Background(), ownerID)
+	if err != nil {
+		log.Fatalf("could not forget owner %v: %v", ownerID, err)
+	}
+	if !deleted {
+		log.Printf("Owner %v had no personal data key, it will not be given one\n", ownerID)
+		return
+	}
+	log.Printf("Forgot owner %v\n", ownerID)
+}
+
+// verify reports the first broken link of each account whose events were edited and tells whether all were intact
+func verify(store *postgres.EventStore, ids []account.ID) bool {
+	ctx := context.Background()
+	verified, broken := 0, 0
+	check := func(id account.ID) {
+		report, err := store.VerifyIntegrity(ctx, id)
+		if err != nil {
+			log.Fatalf("could not verify account %v: %v", id, err)
+		}
+		verified++
+		if !report.Intact() {
+			broken++
+			fmt.Printf("account %v: %d events, hash chain broken at event %d\n", id, report.Events, report.BrokenAt)
+		}
+	}
+
+	if len(ids) != 0 {
+		for _, id := range ids {
+			check(id)
+		}
+	} else {
+		var last account.ID
+		for {
+			page, err := store.Aggregates(ctx, last, 100)
+			if err != nil {
+				log.Fatalf("could not list accounts: %v", err)
+			}
+			for _, id := range page {
+				check(id)
+			}
+			if len(page) < 100 {
+				break
+			}
+			last = page[len(page)-1]
+		}
+	}
+
+	fmt.Printf("verified %d accounts, %d with broken hash chains\n", verified, broken)
+	return broken == 0
+}
+
+// verifyShards verifies the accounts in the shards they live in, all accounts of all shards if none are given
+func verifyShards(shards []shardDataSource, c databaseConfig, ids []account.ID) bool {
+	ring := shardRing(shards)
+	intact := true
+	withShardDBs(shards, c, func(dbs map[string]*sql.DB) {
+		for name, db := range dbs {
+			var shardIds []account.ID
+			for _, id := range ids {
+				if ring.AccountShard(id) == name {
+					shardIds = append(shardIds, id)
+				}
+			}
+			if len(ids) != 0 && len(shardIds) == 0 {
+				continue
+			}
+			fmt.Printf("shard %s: ", name)
+			intact = verify(postgres.NewEventStore(db), shardIds) && intact
+		}
+	})
+	return intact
+}
+
+// reshard moves the accounts and command results that the ring places in other shards than they are in.
+// Each account is locked while it moves and instances that still route it to its old shard fail to write to it,
+// so the service should be restarted with the new shards once resharding completes.
+func reshard(dbs map[string]*sql.DB, ring *eventsourcing.ShardRing) {
+	ctx := context.Background()
+	accounts, results := 0, 0
+	for name, db := range dbs {
+		store := postgres.NewEventStore(db)
+		var last account.ID
+		for {
+			page, err := store.Aggregates(ctx, last, 100)
+			if err != nil {
+				log.Fatalf("could not list accounts of shard %s: %v", name, err)
+			}
+			for _, id := range page {
+				target := ring.AccountShard(id)
+				if target == name {
+					continue
+				}
+				events, err := postgres.MoveAggregate(ctx, db, dbs[target], id)
+				if err != nil {
+					log.Fatalf("could not move account %v from shard %s to %s: %v", id, name, target, err)
+				}
+				fmt.Printf("moved account %v with %d events from shard %s to %s\n", id, events, name, target)
+				accounts++
+			}
+			if len(page) < 100 {
+				break
+			}
+			last = page[len(page)-1]
+		}
+
+		var lastTxId uuid.UUID
+		for {
+			page, err := postgres.CommandResultTransactions(ctx, db, lastTxId, 100)
+			if err != nil {
+				log.Fatalf("could not list command results of shard %s: %v", name, err)
+			}
+			for _, txId := range page {
+				target := ring.TransactionShard(txId)
+				if target == name {
+					continue
+				}
+				if err := postgres.MoveCommandResult(ctx, db, dbs[target], txId); err != nil {
+					log.Fatalf("could not move command result of transaction %v from shard %s to %s: %v", txId, name, target, err)
+				}
+				results++
+			}
+			if len(page) < 100 {
+				break
+			}
+			lastTxId = page[len(page)-1]
+		}
+	}
+	fmt.Printf("moved %d accounts and %d command results\n", accounts, results)
+}
+
+// archiveClosedAccounts archives the accounts whose closing event was appended before the cutoff.
+// Accounts that were written to since they were listed are left for the next run.
+func archiveClosedAccounts(c eventStoreConfig, db *sql.DB, cutoff time.Time) {
+	ctx := context.Background()
+	service := eventsourcing.NewAccountService(newSerializingEventStores(c, db, nil).store, 0)
+	closed := postgres.NewEventStore(db)
+	archived, skipped := 0, 0
+	var last account.ID
+	for {
+		page, err := closed.ClosedAggregates(ctx, serialization.AccountClosed, cutoff, last, 100)
+		if err != nil {
+			log.Fatalf("could not list closed accounts: %v", err)
+		}
+		for _, id := range page {
+			switch err := service.Archive(ctx, id); err {
+			case nil:
+				archived++
+			case account.ConcurrentModification, eventsourcing.AccountStillOpen:
+				skipped++
+			default:
+				log.Fatalf("could not archive account %v: %v", id, err)
+			}
+		}
+		if len(page) < 100 {
+			break
+		}
+		last = page[len(page)-1]
+	}
+	fmt.Printf("archived %d accounts closed before %v, skipped %d that changed meanwhile\n", archived, cutoff.Format(time.RFC3339), skipped)
+}
+
+func exitWithUsage() {
+	fmt.Fprintln(os.Stderr, adminUsage)
+	os.Exit(2)
+}
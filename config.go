@@ -0,0 +1,446 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rieske/event-sourced-account-go/serialization"
+	"gopkg.in/yaml.v3"
+)
+
+// config tunes the service. Each value is taken from the first of the flags, the environment, the YAML file
+// given by --config or CONFIG_FILE and the defaults that sets it.
+type config struct {
+	Database          databaseConfig       `yaml:"database"`
+	EventStore        eventStoreConfig     `yaml:"eventStore"`
+	Sharding          shardingConfig       `yaml:"sharding"`
+	AggregateCache    aggregateCacheConfig `yaml:"aggregateCache"`
+	HTTP              httpConfig           `yaml:"http"`
+	Health            healthConfig         `yaml:"health"`
+	Tracing           tracingConfig        `yaml:"tracing"`
+	SnapshotFrequency int                  `yaml:"snapshotFrequency"`
+}
+
+type databaseConfig struct {
+	MaxOpenConns    int           `yaml:"maxOpenConns"`
+	MaxIdleConns    int           `yaml:"maxIdleConns"`
+	ConnMaxLifetime time.Duration `yaml:"connMaxLifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"connMaxIdleTime"`
+	// the database is pinged up to ConnectAttempts times at startup, waiting ConnectBackoff after the first failure
+	// and twice as long after each of the following ones, up to MaxConnectBackoff
+	ConnectAttempts   int           `yaml:"connectAttempts"`
+	ConnectBackoff    time.Duration `yaml:"connectBackoff"`
+	MaxConnectBackoff time.Duration `yaml:"maxConnectBackoff"`
+}
+
+// eventStoreConfig tells how the postgres event store writes payloads and reads events
+type eventStoreConfig struct {
+	Serialization string `yaml:"serialization"`
+	Compression   string `yaml:"compression"`
+	// only payloads larger than CompressionThreshold bytes are compressed
+	CompressionThreshold int `yaml:"compressionThreshold"`
+	// EncryptionKeyring is the file of the keys that payloads are encrypted with, payloads are not encrypted when empty
+	EncryptionKeyring string `yaml:"encryptionKeyring"`
+	// payloads are re-encrypted with the current key of the keyring every ReEncryptionInterval
+	ReEncryptionInterval   time.Duration `yaml:"reEncryptionInterval"`
+	PersonalDataEncryption bool          `yaml:"personalDataEncryption"`
+	// PersonalDataKeyCacheTTL is how long the keys of owners are cached for, 0 for not caching them
+	PersonalDataKeyCacheTTL time.Duration `yaml:"personalDataKeyCacheTTL"`
+	// the keys and aggregates cached of owners forgotten by another process are dropped within ForgottenOwnerPollInterval
+	ForgottenOwnerPollInterval time.Duration `yaml:"forgottenOwnerPollInterval"`
+	SingleRoundTrip            bool          `yaml:"singleRoundTrip"`
+	// StrictIntegrity fails the reads of events whose hash chain is broken instead of logging them
+	StrictIntegrity bool `yaml:"strictIntegrity"`
+}
+
+// shardingConfig spreads accounts across postgres databases, listed as comma separated name=host[:port] entries
+type shardingConfig struct {
+	Shards string `yaml:"shards"`
+	// DrainingShards were removed from the ring, resharding moves all their accounts to the Shards
+	DrainingShards string `yaml:"drainingShards"`
+	// SagaShard keeps the state of transfers between shards, the first of the Shards when empty
+	SagaShard string `yaml:"sagaShard"`
+	// TransferTimeout is how long a transfer between shards has to complete, incomplete ones are resumed as often
+	TransferTimeout time.Duration `yaml:"transferTimeout"`
+}
+
+// aggregateCacheConfig keeps up to Size aggregates in memory for TTL, no aggregates are cached when Size is 0
+type aggregateCacheConfig struct {
+	Size int           `yaml:"size"`
+	TTL  time.Duration `yaml:"ttl"`
+}
+
+type httpConfig struct {
+	Port          int           `yaml:"port"`
+	MetricsPort   int           `yaml:"metricsPort"`
+	ProfilingPort int           `yaml:"profilingPort"`
+	ReadTimeout   time.Duration `yaml:"readTimeout"`
+	WriteTimeout  time.Duration `yaml:"writeTimeout"`
+	IdleTimeout   time.Duration `yaml:"idleTimeout"`
+	// ShutdownTimeout is how long requests in flight have to complete once the service is asked to stop
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+}
+
+// healthConfig tunes the checks that the service is ready by
+type healthConfig struct {
+	CheckTimeout  time.Duration `yaml:"checkTimeout"`
+	MaxReplicaLag time.Duration `yaml:"maxReplicaLag"`
+}
+
+const (
+	tracingExporterNone   = "none"
+	tracingExporterOTLP   = "otlp"
+	tracingExporterStdout = "stdout"
+)
+
+// tracingConfig tells where the spans of the service are exported to
+type tracingConfig struct {
+	Exporter string `yaml:"exporter"`
+	// OTLPEndpoint is the URL of the OTLP/HTTP collector, the OTEL_EXPORTER_OTLP_* variables are used when it is empty
+	OTLPEndpoint string `yaml:"otlpEndpoint"`
+	// File that the stdout exporter appends spans to, standard output when empty
+	File        string  `yaml:"file"`
+	SampleRatio float64 `yaml:"sampleRatio"`
+}
+
+func defaultConfig() config {
+	return config{
+		Database: databaseConfig{
+			MaxOpenConns:      5,
+			MaxIdleConns:      5,
+			ConnectAttempts:   30,
+			ConnectBackoff:    time.Second,
+			MaxConnectBackoff: time.Second,
+		},
+		EventStore: eventStoreConfig{
+			Serialization:              serialization.MsgpackFormat,
+			Compression:                serialization.NoCompression,
+			CompressionThreshold:       256,
+			ReEncryptionInterval:       time.Hour,
+			PersonalDataKeyCacheTTL:    time.Minute,
+			ForgottenOwnerPollInterval: 5 * time.Second,
+		},
+		Sharding: shardingConfig{
+			TransferTimeout: time.Minute,
+		},
+		AggregateCache: aggregateCacheConfig{
+			TTL: time.Minute,
+		},
+		HTTP: httpConfig{
+			Port:            8080,
+			MetricsPort:     8081,
+			ProfilingPort:   6060,
+			ReadTimeout:     time.Second,
+			WriteTimeout:    time.Second,
+			IdleTimeout:     20 * time.Second,
+			ShutdownTimeout: 5 * time.Second,
+		},
+		Health: healthConfig{
+			CheckTimeout:  time.Second,
+			MaxReplicaLag: 30 * time.Second,
+		},
+		Tracing: tracingConfig{
+			Exporter:    tracingExporterNone,
+			SampleRatio: 1,
+		},
+		SnapshotFrequency: 50,
+	}
+}
+
+// setting binds a config value to its flag and environment variable, value is an *int, *float64, *bool, *string or
+// *time.Duration
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	value interface{}
+}
+
+func (c *config) settings() []setting {
+	return []setting{
+		{"db-max-open-conns", "DB_MAX_OPEN_CONNS", "maximum number of open connections per database", &c.Database.MaxOpenConns},
+		{"db-max-idle-conns", "DB_MAX_IDLE_CONNS", "maximum number of idle connections per database", &c.Database.MaxIdleConns},
+		{"db-conn-max-lifetime", "DB_CONN_MAX_LIFETIME", "how long a connection is reused, 0 for as long as it works", &c.Database.ConnMaxLifetime},
+		{"db-conn-max-idle-time", "DB_CONN_MAX_IDLE_TIME", "how long a connection stays idle before it is closed, 0 for no limit", &c.Database.ConnMaxIdleTime},
+		{"db-connect-attempts", "DB_CONNECT_ATTEMPTS", "how many times the database is tried at startup", &c.Database.ConnectAttempts},
+		{"db-connect-backoff", "DB_CONNECT_BACKOFF", "wait after the first failed attempt to connect, doubling with each further one", &c.Database.ConnectBackoff},
+		{"db-max-connect-backoff", "DB_MAX_CONNECT_BACKOFF", "longest wait between attempts to connect", &c.Database.MaxConnectBackoff},
+		{"event-serialization", "EVENT_SERIALIZATION", "format new payloads are written in: msgpack, json or protobuf", &c.EventStore.Serialization},
+		{"payload-compression", "PAYLOAD_COMPRESSION", "codec binary payloads are compressed with: none, zstd, gzip or snappy", &c.EventStore.Compression},
+		{"payload-compression-threshold", "PAYLOAD_COMPRESSION_THRESHOLD", "size in bytes that payloads are compressed above", &c.EventStore.CompressionThreshold},
+		{"encryption-keyring", "ENCRYPTION_KEYRING", "keyring file that binary payloads are encrypted with, not encrypted when empty", &c.EventStore.EncryptionKeyring},
+		{"reencryption-interval", "REENCRYPTION_INTERVAL", "time between re-encryptions of stored payloads with the current key", &c.EventStore.ReEncryptionInterval},
+		{"personal-data-encryption", "PERSONAL_DATA_ENCRYPTION", "encrypt the owners of accounts with a key per owner", &c.EventStore.PersonalDataEncryption},
+		{"personal-data-key-cache-ttl", "PERSONAL_DATA_KEY_CACHE_TTL", "time the keys of owners are cached for, 0 for not caching them", &c.EventStore.PersonalDataKeyCacheTTL},
+		{"forgotten-owner-poll-interval", "FORGOTTEN_OWNER_POLL_INTERVAL", "time between polls for owners forgotten by another process", &c.EventStore.ForgottenOwnerPollInterval},
+		{"postgres-single-round-trip", "POSTGRES_SINGLE_ROUND_TRIP", "read and append the events of a command in one call to the database", &c.EventStore.SingleRoundTrip},
+		{"strict-integrity", "STRICT_INTEGRITY", "fail reads of events whose hash chain is broken instead of logging them", &c.EventStore.StrictIntegrity},
+		{"postgres-shards", "POSTGRES_SHARDS", "name=host[:port] list of the databases accounts are sharded across", &c.Sharding.Shards},
+		{"postgres-draining-shards", "POSTGRES_DRAINING_SHARDS", "name=host[:port] list of the databases resharding moves all accounts out of", &c.Sharding.DrainingShards},
+		{"postgres-saga-shard", "POSTGRES_SAGA_SHARD", "shard keeping the transfers between shards, the first shard when empty", &c.Sharding.SagaShard},
+		{"cross-shard-transfer-timeout", "CROSS_SHARD_TRANSFER_TIMEOUT", "time a transfer between shards has to complete", &c.Sharding.TransferTimeout},
+		{"aggregate-cache-size", "AGGREGATE_CACHE_SIZE", "number of aggregates cached in memory, 0 for no cache", &c.AggregateCache.Size},
+		{"aggregate-cache-ttl", "AGGREGATE_CACHE_TTL", "time an aggregate is cached for, 0 for as long as it is not evicted", &c.AggregateCache.TTL},
+		{"http-port", "HTTP_PORT", "port of the account API", &c.HTTP.Port},
+		{"metrics-port", "METRICS_PORT", "port of the prometheus metrics", &c.HTTP.MetricsPort},
+		{"profiling-port", "PROFILING_PORT", "port of the profiling endpoints, served when CPU_PROFILE is set", &c.HTTP.ProfilingPort},
+		{"http-read-timeout", "HTTP_READ_TIMEOUT", "time to read a request of the account API", &c.HTTP.ReadTimeout},
+		{"http-write-timeout", "HTTP_WRITE_TIMEOUT", "time to write a response of the account API", &c.HTTP.WriteTimeout},
+		{"http-idle-timeout", "HTTP_IDLE_TIMEOUT", "time a keep-alive connection of the account API waits for the next request", &c.HTTP.IdleTimeout},
+		{"http-shutdown-timeout", "HTTP_SHUTDOWN_TIMEOUT", "time the requests in flight have to complete when stopping", &c.HTTP.ShutdownTimeout},
+		{"health-check-timeout", "HEALTH_CHECK_TIMEOUT", "time each readiness check has to pass", &c.Health.CheckTimeout},
+		{"health-max-replica-lag", "HEALTH_MAX_REPLICA_LAG", "how far the read replica can lag behind before the service is not ready", &c.Health.MaxReplicaLag},
+		{"tracing-exporter", "TRACING_EXPORTER", "where spans are exported to: none, otlp or stdout", &c.Tracing.Exporter},
+		{"tracing-otlp-endpoint", "TRACING_OTLP_ENDPOINT", "URL of the OTLP/HTTP trace collector, OTEL_EXPORTER_OTLP_* variables apply when empty", &c.Tracing.OTLPEndpoint},
+		{"tracing-file", "TRACING_FILE", "file the stdout exporter appends spans to, standard output when empty", &c.Tracing.File},
+		{"tracing-sample-ratio", "TRACING_SAMPLE_RATIO", "fraction of traces started by the service that are sampled", &c.Tracing.SampleRatio},
+		{"snapshot-frequency", "SNAPSHOT_FREQUENCY", "number of events between snapshots of an account, 0 for no snapshots", &c.SnapshotFrequency},
+	}
+}
+
+// configFlags binds the settings of the config to flags defaulting to their current values
+func configFlags(c *config, configFile *string, printConfig *bool) *flag.FlagSet {
+	flags := flag.NewFlagSet("account-app", flag.ContinueOnError)
+	flags.StringVar(configFile, "config", *configFile, "YAML file to read the configuration from, CONFIG_FILE")
+	flags.BoolVar(printConfig, "print-config", false, "print the configuration in effect as YAML and exit")
+	for _, s := range c.settings() {
+		usage := fmt.Sprintf("%s, %s", s.usage, s.env)
+		switch v := s.value.(type) {
+		case *int:
+			flags.IntVar(v, s.flag, *v, usage)
+		case *float64:
+			flags.Float64Var(v, s.flag, *v, usage)
+		case *bool:
+			flags.BoolVar(v, s.flag, *v, usage)
+		case *string:
+			flags.StringVar(v, s.flag, *v, usage)
+		case *time.Duration:
+			flags.DurationVar(v, s.flag, *v, usage)
+		}
+	}
+	return flags
+}
+
+// loadConfig reads the config from the file, the environment and the command line arguments and validates it.
+// The flags are parsed twice - first to find the config file, then to override what the file and environment set.
+func loadConfig(args []string, lookupEnv func(string) (string, bool)) (config, bool, error) {
+	configFile, _ := lookupEnv("CONFIG_FILE")
+	var printConfig bool
+	c := defaultConfig()
+	if err := configFlags(&c, &configFile, &printConfig).Parse(args); err != nil {
+		return config{}, false, err
+	}
+
+	c = defaultConfig()
+	if configFile != "" {
+		if err := c.readFile(configFile); err != nil {
+			return config{}, false, err
+		}
+	}
+	if err := c.readEnv(lookupEnv); err != nil {
+		return config{}, false, err
+	}
+	if err := configFlags(&c, &configFile, &printConfig).Parse(args); err != nil {
+		return config{}, false, err
+	}
+	return c, printConfig, c.validate()
+}
+
+// mustLoadConfig loads the config from the command line arguments and the environment, printing it and exiting
+// if asked to with --print-config
+func mustLoadConfig(args []string) config {
+	c, printConfig, err := loadConfig(args, os.LookupEnv)
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if printConfig {
+		if err := c.print(os.Stdout); err != nil {
+			log.Fatalf("could not print config: %v", err)
+		}
+		os.Exit(0)
+	}
+	return c
+}
+
+func (c *config) readFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("could not read config file: %w", err)
+	}
+	defer closeResource(f)
+
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && err != io.EOF {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *config) readEnv(lookupEnv func(string) (string, bool)) error {
+	for _, s := range c.settings() {
+		value, ok := lookupEnv(s.env)
+		if !ok {
+			continue
+		}
+		var err error
+		switch v := s.value.(type) {
+		case *int:
+			*v, err = strconv.Atoi(value)
+		case *float64:
+			*v, err = strconv.ParseFloat(value, 64)
+		case *bool:
+			*v, err = strconv.ParseBool(value)
+		case *string:
+			*v = value
+		case *time.Duration:
+			*v, err = time.ParseDuration(value)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", s.env, err)
+		}
+	}
+	return nil
+}
+
+// validate reports all the values that the service can not run with at once
+func (c config) validate() error {
+	var problems []string
+	check := func(valid bool, problem string, args ...interface{}) {
+		if !valid {
+			problems = append(problems, fmt.Sprintf(problem, args...))
+		}
+	}
+
+	db := c.Database
+	check(db.MaxOpenConns > 0, "database.maxOpenConns has to be positive, is %d", db.MaxOpenConns)
+	check(db.MaxIdleConns >= 0 && db.MaxIdleConns <= db.MaxOpenConns,
+		"database.maxIdleConns has to be between 0 and database.maxOpenConns %d, is %d", db.MaxOpenConns, db.MaxIdleConns)
+	check(db.ConnMaxLifetime >= 0, "database.connMaxLifetime can not be negative, is %v", db.ConnMaxLifetime)
+	check(db.ConnMaxIdleTime >= 0, "database.connMaxIdleTime can not be negative, is %v", db.ConnMaxIdleTime)
+	check(db.ConnectAttempts > 0, "database.connectAttempts has to be positive, is %d", db.ConnectAttempts)
+	check(db.ConnectBackoff > 0, "database.connectBackoff has to be positive, is %v", db.ConnectBackoff)
+	check(db.MaxConnectBackoff >= db.ConnectBackoff,
+		"database.maxConnectBackoff can not be shorter than database.connectBackoff %v, is %v", db.ConnectBackoff, db.MaxConnectBackoff)
+
+	s := c.EventStore
+	check(s.Serialization == serialization.MsgpackFormat || s.Serialization == serialization.JsonFormat || s.Serialization == serialization.ProtobufFormat,
+		"eventStore.serialization has to be one of %s, %s or %s, is %q",
+		serialization.MsgpackFormat, serialization.JsonFormat, serialization.ProtobufFormat, s.Serialization)
+	check(s.Compression == serialization.NoCompression || s.Compression == serialization.Zstd || s.Compression == serialization.Gzip || s.Compression == serialization.Snappy,
+		"eventStore.compression has to be one of %s, %s, %s or %s, is %q",
+		serialization.NoCompression, serialization.Zstd, serialization.Gzip, serialization.Snappy, s.Compression)
+	check(s.CompressionThreshold >= 0, "eventStore.compressionThreshold can not be negative, is %d", s.CompressionThreshold)
+	check(s.ReEncryptionInterval > 0, "eventStore.reEncryptionInterval has to be positive, is %v", s.ReEncryptionInterval)
+	check(s.PersonalDataKeyCacheTTL >= 0, "eventStore.personalDataKeyCacheTTL can not be negative, is %v", s.PersonalDataKeyCacheTTL)
+	check(s.ForgottenOwnerPollInterval > 0, "eventStore.forgottenOwnerPollInterval has to be positive, is %v", s.ForgottenOwnerPollInterval)
+	if s.Serialization == serialization.JsonFormat {
+		check(s.Compression == serialization.NoCompression, "json payloads are stored as JSONB and can not be compressed")
+		check(s.EncryptionKeyring == "", "json payloads are stored as JSONB and can not be encrypted")
+		check(!s.PersonalDataEncryption, "json payloads are stored as JSONB and can not carry encrypted personal data")
+		check(!s.SingleRoundTrip, "json payloads are stored as JSONB and can not be appended in a single round trip")
+	}
+
+	sh := c.Sharding
+	shards, err := parseShards(sh.Shards)
+	check(err == nil, "sharding.shards: %v", err)
+	draining, err := parseShards(sh.DrainingShards)
+	check(err == nil, "sharding.drainingShards: %v", err)
+	names := map[string]bool{}
+	for _, shard := range shards {
+		names[shard.name] = true
+	}
+	for _, shard := range draining {
+		check(!names[shard.name], "shard %s can not be both in sharding.shards and sharding.drainingShards", shard.name)
+	}
+	check(sh.SagaShard == "" || names[sh.SagaShard], "sharding.sagaShard has to be one of sharding.shards, is %q", sh.SagaShard)
+	check(sh.TransferTimeout > 0, "sharding.transferTimeout has to be positive, is %v", sh.TransferTimeout)
+	check(len(shards) == 0 || !s.PersonalDataEncryption,
+		"personal data keys are kept per database and can not follow accounts moving between shards")
+
+	check(c.AggregateCache.Size >= 0, "aggregateCache.size can not be negative, is %d", c.AggregateCache.Size)
+	check(c.AggregateCache.TTL >= 0, "aggregateCache.ttl can not be negative, is %v", c.AggregateCache.TTL)
+
+	h := c.HTTP
+	ports := map[int]string{}
+	for _, port := range []struct {
+		name  string
+		value int
+	}{{"http.port", h.Port}, {"http.metricsPort", h.MetricsPort}, {"http.profilingPort", h.ProfilingPort}} {
+		check(port.value > 0 && port.value < 65536, "%s has to be between 1 and 65535, is %d", port.name, port.value)
+		if other, taken := ports[port.value]; taken {
+			check(false, "%s and %s can not both be %d", other, port.name, port.value)
+		}
+		ports[port.value] = port.name
+	}
+	check(h.ReadTimeout > 0, "http.readTimeout has to be positive, is %v", h.ReadTimeout)
+	check(h.WriteTimeout > 0, "http.writeTimeout has to be positive, is %v", h.WriteTimeout)
+	check(h.IdleTimeout > 0, "http.idleTimeout has to be positive, is %v", h.IdleTimeout)
+	check(h.ShutdownTimeout > 0, "http.shutdownTimeout has to be positive, is %v", h.ShutdownTimeout)
+
+	check(c.Health.CheckTimeout > 0, "health.checkTimeout has to be positive, is %v", c.Health.CheckTimeout)
+	check(c.Health.MaxReplicaLag > 0, "health.maxReplicaLag has to be positive, is %v", c.Health.MaxReplicaLag)
+
+	t := c.Tracing
+	check(t.Exporter == tracingExporterNone || t.Exporter == tracingExporterOTLP || t.Exporter == tracingExporterStdout,
+		"tracing.exporter has to be one of %s, %s or %s, is %q", tracingExporterNone, tracingExporterOTLP, tracingExporterStdout, t.Exporter)
+	check(t.SampleRatio >= 0 && t.SampleRatio <= 1, "tracing.sampleRatio has to be between 0 and 1, is %v", t.SampleRatio)
+
+	check(c.SnapshotFrequency >= 0, "snapshotFrequency can not be negative, is %d", c.SnapshotFrequency)
+
+	if len(problems) != 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// shardAddress is an entry of a list of shards, port is empty when the entry does not give one
+type shardAddress struct {
+	name string
+	host string
+	port string
+}
+
+// parseShards reads a comma separated list of name=host[:port] entries with distinct names, empty for no shards
+func parseShards(list string) ([]shardAddress, error) {
+	if list == "" {
+		return nil, nil
+	}
+	var shards []shardAddress
+	names := map[string]bool{}
+	for _, entry := range strings.Split(list, ",") {
+		name, address, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || name == "" || address == "" {
+			return nil, fmt.Errorf("invalid entry '%s', expected name=host[:port]", entry)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("shard %s is listed more than once", name)
+		}
+		names[name] = true
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			host, port = address, ""
+		}
+		shards = append(shards, shardAddress{name: name, host: host, port: port})
+	}
+	return shards, nil
+}
+
+func (c config) print(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rieske/event-sourced-account-go/serialization"
+	"github.com/stretchr/testify/assert"
+)
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	}
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestDefaultConfig(t *testing.T) {
+	c, printConfig, err := loadConfig(nil, env(nil))
+
+	assert.NoError(t, err)
+	assert.False(t, printConfig)
+	assert.Equal(t, defaultConfig(), c)
+}
+
+func TestFlagsOverrideEnvironmentOverridingConfigFile(t *testing.T) {
+	path := writeConfigFile(t, `
+database:
+  maxOpenConns: 20
+  maxIdleConns: 10
+http:
+  port: 9090
+  readTimeout: 3s
+snapshotFrequency: 10
+`)
+
+	c, _, err := loadConfig(
+		[]string{"--http-port", "9999", "--print-config"},
+		env(map[string]string{"CONFIG_FILE": path, "HTTP_PORT": "9191", "DB_MAX_IDLE_CONNS": "2", "HTTP_WRITE_TIMEOUT": "5s"}),
+	)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 20, c.Database.MaxOpenConns)
+	assert.Equal(t, 2, c.Database.MaxIdleConns)
+	assert.Equal(t, 9999, c.HTTP.Port)
+	assert.Equal(t, 3*time.Second, c.HTTP.ReadTimeout)
+	assert.Equal(t, 5*time.Second, c.HTTP.WriteTimeout)
+	assert.Equal(t, 10, c.SnapshotFrequency)
+	assert.Equal(t, defaultConfig().HTTP.MetricsPort, c.HTTP.MetricsPort)
+}
+
+func TestConfigFileFlagTakesPrecedenceOverEnvironment(t *testing.T) {
+	path := writeConfigFile(t, "snapshotFrequency: 7\n")
+
+	c, _, err := loadConfig([]string{"--config", path}, env(map[string]string{"CONFIG_FILE": "missing.yml"}))
+
+	assert.NoError(t, err)
+	assert.Equal(t, 7, c.SnapshotFrequency)
+}
+
+func TestPrintedConfigReadsBack(t *testing.T) {
+	c, printConfig, err := loadConfig([]string{"--print-config", "--db-conn-max-lifetime", "5m"}, env(nil))
+	assert.NoError(t, err)
+	assert.True(t, printConfig)
+	var printed bytes.Buffer
+	assert.NoError(t, c.print(&printed))
+
+	read, _, err := loadConfig([]string{"--config", writeConfigFile(t, printed.String())}, env(nil))
+
+	assert.NoError(t, err)
+	assert.Equal(t, c, read)
+}
+
+func TestConfigFileWithUnknownSettingIsRejected(t *testing.T) {
+	_, _, err := loadConfig([]string{"--config", writeConfigFile(t, "database:\n  maxConns: 5\n")}, env(nil))
+
+	assert.Error(t, err)
+}
+
+func TestInvalidEnvironmentValueIsRejected(t *testing.T) {
+	_, _, err := loadConfig(nil, env(map[string]string{"HTTP_IDLE_TIMEOUT": "20"}))
+
+	assert.EqualError(t, err, `invalid HTTP_IDLE_TIMEOUT: time: missing unit in duration "20"`)
+}
+
+func TestConfigValidationReportsAllProblems(t *testing.T) {
+	_, _, err := loadConfig(
+		[]string{"--db-max-open-conns", "2", "--db-max-idle-conns", "3", "--metrics-port", "8080", "--http-write-timeout", "0s"},
+		env(map[string]string{"SNAPSHOT_FREQUENCY": "-1"}),
+	)
+
+	assert.EqualError(t, err, "invalid configuration: "+
+		"database.maxIdleConns has to be between 0 and database.maxOpenConns 2, is 3; "+
+		"http.port and http.metricsPort can not both be 8080; "+
+		"http.writeTimeout has to be positive, is 0s; "+
+		"snapshotFrequency can not be negative, is -1")
+}
+
+func TestTracingSettings(t *testing.T) {
+	path := writeConfigFile(t, `
+tracing:
+  exporter: otlp
+  otlpEndpoint: http://collector:4318
+  sampleRatio: 0.5
+`)
+
+	c, _, err := loadConfig(
+		[]string{"--tracing-sample-ratio", "0.1"},
+		env(map[string]string{"CONFIG_FILE": path, "TRACING_OTLP_ENDPOINT": "http://jaeger:4318"}),
+	)
+
+	assert.NoError(t, err)
+	assert.Equal(t, tracingConfig{Exporter: "otlp", OTLPEndpoint: "http://jaeger:4318", SampleRatio: 0.1}, c.Tracing)
+}
+
+func TestInvalidTracingIsRejected(t *testing.T) {
+	_, _, err := loadConfig([]string{"--tracing-exporter", "zipkin"}, env(map[string]string{"TRACING_SAMPLE_RATIO": "2"}))
+
+	assert.EqualError(t, err, "invalid configuration: "+
+		`tracing.exporter has to be one of none, otlp or stdout, is "zipkin"; `+
+		"tracing.sampleRatio has to be between 0 and 1, is 2")
+}
+
+func TestEventStoreShardingAndCacheSettings(t *testing.T) {
+	path := writeConfigFile(t, `
+eventStore:
+  serialization: protobuf
+  compression: zstd
+  singleRoundTrip: true
+sharding:
+  shards: one=db1,two=db2:5433
+  sagaShard: two
+aggregateCache:
+  size: 100
+`)
+
+	c, _, err := loadConfig(
+		[]string{"--payload-compression-threshold", "64", "--cross-shard-transfer-timeout", "30s"},
+		env(map[string]string{"CONFIG_FILE": path, "STRICT_INTEGRITY": "true", "AGGREGATE_CACHE_TTL": "5m"}),
+	)
+
+	assert.NoError(t, err)
+	assert.Equal(t, serialization.ProtobufFormat, c.EventStore.Serialization)
+	assert.Equal(t, serialization.Zstd, c.EventStore.Compression)
+	assert.Equal(t, 64, c.EventStore.CompressionThreshold)
+	assert.True(t, c.EventStore.SingleRoundTrip)
+	assert.True(t, c.EventStore.StrictIntegrity)
+	assert.False(t, c.EventStore.PersonalDataEncryption)
+	assert.Equal(t, shardingConfig{Shards: "one=db1,two=db2:5433", SagaShard: "two", TransferTimeout: 30 * time.Second}, c.Sharding)
+	assert.Equal(t, aggregateCacheConfig{Size: 100, TTL: 5 * time.Minute}, c.AggregateCache)
+}
+
+func TestInvalidEventStoreAndShardingAreRejected(t *testing.T) {
+	_, _, err := loadConfig(
+		[]string{"--event-serialization", "json", "--payload-compression", "gzip", "--personal-data-encryption"},
+		env(map[string]string{
+			"POSTGRES_SHARDS":          "one=db1,two=db2",
+			"POSTGRES_DRAINING_SHARDS": "two=db2,three",
+			"POSTGRES_SAGA_SHARD":      "four",
+			"AGGREGATE_CACHE_SIZE":     "-1",
+		}),
+	)
+
+	assert.EqualError(t, err, "invalid configuration: "+
+		"json payloads are stored as JSONB and can not be compressed; "+
+		"json payloads are stored as JSONB and can not carry encrypted personal data; "+
+		"sharding.drainingShards: invalid entry 'three', expected name=host[:port]; "+
+		`sharding.sagaShard has to be one of sharding.shards, is "four"; `+
+		"personal data keys are kept per database and can not follow accounts moving between shards; "+
+		"aggregateCache.size can not be negative, is -1")
+}
+
+func TestShardsInBothListsAreRejected(t *testing.T) {
+	_, _, err := loadConfig(nil, env(map[string]string{"POSTGRES_SHARDS": "one=db1,two=db2", "POSTGRES_DRAINING_SHARDS": "two=db2"}))
+
+	assert.EqualError(t, err, "invalid configuration: shard two can not be both in sharding.shards and sharding.drainingShards")
+}
+
+func TestParseShards(t *testing.T) {
+	shards, err := parseShards("one=db1, two=db2:5433")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []shardAddress{{name: "one", host: "db1"}, {name: "two", host: "db2", port: "5433"}}, shards)
+
+	_, err = parseShards("one=db1,one=db2")
+	assert.EqualError(t, err, "shard one is listed more than once")
+}
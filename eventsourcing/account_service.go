@@ -2,75 +2,207 @@ package eventsourcing
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/rieske/event-sourced-account-go/account"
 	"github.com/rieske/event-sourced-account-go/eventstore"
+	"github.com/rieske/event-sourced-account-go/internal/telemetry"
 )
 
 type AccountService struct {
-	repo *repository
+	repo       *repository
+	queries    *repository
+	dispatcher *Dispatcher
+	// transfers runs transfers between accounts of different shards, nil if the store is not sharded
+	transfers       *ProcessManager
+	transferTimeout time.Duration
 }
 
-func NewAccountService(store EventStore, snapshotFrequency int) *AccountService {
+type serviceConfig struct {
+	cache      *AggregateCache
+	authorizer Authorizer
+	queryStore EventStore
+	sagas      SagaStore
+	timeout    time.Duration
+}
+
+type Option func(*serviceConfig)
+
+func WithAggregateCache(cache *AggregateCache) Option {
+	return func(c *serviceConfig) {
+		c.cache = cache
+	}
+}
+
+func WithAuthorizer(authorizer Authorizer) Option {
+	return func(c *serviceConfig) {
+		c.authorizer = authorizer
+	}
+}
+
+// WithQueryStore makes account queries, events and statements read from the given store, for example one backed by
+// read replicas, while commands keep reading from and appending to the primary store
+func WithQueryStore(store EventStore) Option {
+	return func(c *serviceConfig) {
+		c.queryStore = store
+	}
+}
+
+// WithCrossShardTransfers makes transfers between accounts of different shards of a ShardedEventStore run as sagas
+// recorded in the given store, each of them having to complete within the timeout
+func WithCrossShardTransfers(sagas SagaStore, timeout time.Duration) Option {
+	return func(c *serviceConfig) {
+		c.sagas = sagas
+		c.timeout = timeout
+	}
+}
+
+func NewAccountService(store EventStore, snapshotFrequency int, options ...Option) *AccountService {
+	config := serviceConfig{}
+	for _, option := range options {
+		option(&config)
+	}
+
 	repo := NewAccountRepository(store, snapshotFrequency)
-	return &AccountService{repo: repo}
+	repo.cache = config.cache
+	queries := repo
+	if config.queryStore != nil {
+		queries = NewAccountRepository(config.queryStore, snapshotFrequency)
+		queries.cache = config.cache
+	}
+	s := &AccountService{repo: repo, queries: queries}
+	if config.sagas != nil {
+		s.transfers = NewTransferProcessManager(config.sagas, func(account.ID) *AccountService {
+			return s
+		})
+		s.transferTimeout = config.timeout
+	}
+
+	middleware := []Middleware{TracingMiddleware, LoggingMiddleware, MetricsMiddleware, ValidationMiddleware}
+	if config.authorizer != nil {
+		middleware = append(middleware, AuthorizationMiddleware(config.authorizer))
+	}
+	middleware = append(middleware, IdempotencyMiddleware(repo.store), RetryMiddleware(3))
+	s.dispatcher = NewDispatcher(s.handle, middleware...)
+
+	return s
+}
+
+// NewCachingAccountService creates an AccountService that starts replaying aggregates from the cached state when available.
+func NewCachingAccountService(store EventStore, snapshotFrequency int, cache *AggregateCache) *AccountService {
+	return NewAccountService(store, snapshotFrequency, WithAggregateCache(cache))
+}
+
+func (s AccountService) Dispatch(ctx context.Context, cmd Command) error {
+	return s.dispatcher.Dispatch(ctx, cmd)
 }
 
 func (s AccountService) OpenAccount(ctx context.Context, id account.ID, ownerID account.OwnerID) error {
-	return s.repo.create(ctx, id, func(a *account.Account) error {
-		return a.Open(id, ownerID)
-	})
+	return s.Dispatch(ctx, OpenAccount{AccountID: id, OwnerID: ownerID})
 }
 
 func (s AccountService) Deposit(ctx context.Context, id account.ID, txId uuid.UUID, amount int64) error {
-	return retryOnConcurrentModification(func() error {
-		return s.repo.transact(ctx, id, txId, func(a *account.Account) error {
-			return a.Deposit(amount)
-		})
-	})
+	return s.Dispatch(ctx, Deposit{AccountID: id, TransactionID: txId, Amount: amount})
 }
 
 func (s AccountService) Withdraw(ctx context.Context, id account.ID, txId uuid.UUID, amount int64) error {
-	return retryOnConcurrentModification(func() error {
-		return s.repo.transact(ctx, id, txId, func(a *account.Account) error {
-			return a.Withdraw(amount)
-		})
-	})
+	return s.Dispatch(ctx, Withdraw{AccountID: id, TransactionID: txId, Amount: amount})
 }
 
 func (s AccountService) CloseAccount(ctx context.Context, id account.ID) error {
-	return s.repo.transact(ctx, id, uuid.New(), func(a *account.Account) error {
-		return a.Close()
-	})
+	return s.Dispatch(ctx, CloseAccount{AccountID: id})
 }
 
 func (s AccountService) Transfer(ctx context.Context, sourceAccountId, targetAccountId account.ID, txId uuid.UUID, amount int64) error {
-	return retryOnConcurrentModification(func() error {
-		return s.repo.biTransact(ctx, sourceAccountId, targetAccountId, txId, func(source *account.Account, target *account.Account) error {
-			if err := source.Withdraw(amount); err != nil {
-				return err
-			}
-			return target.Deposit(amount)
-		})
-	})
+	return s.Dispatch(ctx, Transfer{SourceAccountID: sourceAccountId, TargetAccountID: targetAccountId, TransactionID: txId, Amount: amount})
+}
+
+func (s AccountService) QueryAccount(ctx context.Context, id account.ID) (snapshot *account.Snapshot, err error) {
+	ctx, span := tracer.StartSpan(ctx, "QueryAccount", telemetry.AccountAttribute(id))
+	defer func() { telemetry.EndSpan(span, err) }()
+	return s.queries.query(ctx, id)
+}
+
+func (s AccountService) Events(ctx context.Context, id account.ID) (events []eventstore.SequencedEvent, err error) {
+	ctx, span := tracer.StartSpan(ctx, "Events", telemetry.AccountAttribute(id))
+	defer func() { telemetry.EndSpan(span, err) }()
+	return s.queries.store.Events(ctx, id, 0)
+}
+
+// VerifyIntegrity checks that the stored events of the account were not edited
+func (s AccountService) VerifyIntegrity(ctx context.Context, id account.ID) (_ *eventstore.IntegrityReport, err error) {
+	ctx, span := tracer.StartSpan(ctx, "VerifyIntegrity", telemetry.AccountAttribute(id))
+	defer func() { telemetry.EndSpan(span, err) }()
+
+	report, err := s.repo.store.VerifyIntegrity(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if report.Events == 0 {
+		return nil, account.NotFound
+	}
+	return &report, nil
 }
 
-func (s AccountService) QueryAccount(ctx context.Context, id account.ID) (*account.Snapshot, error) {
-	return s.repo.query(ctx, id)
+// ResumeTransfers runs the transfers between shards that were interrupted, for example by a restart, to their end
+func (s AccountService) ResumeTransfers(ctx context.Context) error {
+	if s.transfers == nil {
+		return nil
+	}
+	return s.transfers.Resume(ctx)
 }
 
-func (s AccountService) Events(ctx context.Context, id account.ID) ([]eventstore.SequencedEvent, error) {
-	return s.repo.store.Events(ctx, id, 0)
+// WatchTransfers resumes transfers between shards that did not complete, for example because a step failed,
+// until the context is done
+func (s AccountService) WatchTransfers(ctx context.Context, interval time.Duration) {
+	if s.transfers != nil {
+		s.transfers.Watch(ctx, interval)
+	}
 }
 
-func retryOnConcurrentModification(fn func() error) error {
-	var err error
-	for try := 0; try < 3; try++ {
-		err = fn()
-		if err != account.ConcurrentModification {
-			return err
+func (s AccountService) handle(ctx context.Context, cmd Command) error {
+	switch c := cmd.(type) {
+	case OpenAccount:
+		return s.repo.create(ctx, c.AccountID, func(a *account.Account) error {
+			return a.Open(c.AccountID, c.OwnerID)
+		})
+	case Deposit:
+		return s.repo.transact(ctx, c.AccountID, c.TransactionID, func(a *account.Account) error {
+			return a.Deposit(c.Amount)
+		})
+	case Withdraw:
+		return s.repo.transact(ctx, c.AccountID, c.TransactionID, func(a *account.Account) error {
+			return a.Withdraw(c.Amount)
+		})
+	case Transfer:
+		if s.acrossShards(c.SourceAccountID, c.TargetAccountID) {
+			return s.transferAcrossShards(ctx, c)
 		}
+		return s.repo.biTransact(ctx, c.SourceAccountID, c.TargetAccountID, c.TransactionID, func(source *account.Account, target *account.Account) error {
+			if err := source.SendTransfer(c.TransactionID, c.TargetAccountID, c.Amount); err != nil {
+				return err
+			}
+			return target.ReceiveTransfer(c.TransactionID, c.SourceAccountID, c.Amount)
+		})
+	case SendTransfer:
+		return s.repo.transact(ctx, c.AccountID, c.TransactionID, func(a *account.Account) error {
+			return a.SendTransfer(c.TransferID, c.TargetAccountID, c.Amount)
+		})
+	case ReceiveTransfer:
+		return s.repo.transact(ctx, c.AccountID, c.TransactionID, func(a *account.Account) error {
+			return a.ReceiveTransfer(c.TransferID, c.SourceAccountID, c.Amount)
+		})
+	case CloseAccount:
+		txId := c.TransactionID
+		if txId == uuid.Nil {
+			txId = uuid.New()
+		}
+		return s.repo.transact(ctx, c.AccountID, txId, func(a *account.Account) error {
+			return a.Close()
+		})
+	default:
+		return fmt.Errorf("unsupported command %T", cmd)
 	}
-	return err
 }
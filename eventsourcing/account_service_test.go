@@ -0,0 +1,44 @@
+package eventsourcing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/eventstore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueriesReadFromQueryStore(t *testing.T) {
+	ctx := context.Background()
+	primary, replica := eventstore.NewInMemoryStore(), eventstore.NewInMemoryStore()
+	service := NewAccountService(primary, 0, WithQueryStore(replica))
+	id := account.NewID()
+
+	assert.NoError(t, service.OpenAccount(ctx, id, account.NewOwnerID()))
+	assert.NoError(t, service.Deposit(ctx, id, uuid.New(), 42))
+
+	_, err := service.QueryAccount(ctx, id)
+	assert.Equal(t, account.NotFound, err)
+	events, err := service.Events(ctx, id)
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+
+	primaryEvents, err := primary.Events(ctx, id, 0)
+	assert.NoError(t, err)
+	assert.Len(t, primaryEvents, 2)
+}
+
+func TestQueriesReadFromPrimaryStoreByDefault(t *testing.T) {
+	ctx := context.Background()
+	service := NewAccountService(eventstore.NewInMemoryStore(), 0)
+	id := account.NewID()
+
+	assert.NoError(t, service.OpenAccount(ctx, id, account.NewOwnerID()))
+	assert.NoError(t, service.Deposit(ctx, id, uuid.New(), 42))
+
+	snapshot, err := service.QueryAccount(ctx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), snapshot.Balance)
+}
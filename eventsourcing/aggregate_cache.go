@@ -0,0 +1,154 @@
+package eventsourcing
+
+import (
+	"container/list"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rieske/event-sourced-account-go/account"
+)
+
+var (
+	aggregateCacheHits = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "aggregate_cache_hits_total",
+		Help: "Number of aggregate loads served from the in-process cache",
+	})
+	aggregateCacheMisses = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "aggregate_cache_misses_total",
+		Help: "Number of aggregate loads that required a replay from the latest snapshot",
+	})
+)
+
+// AggregateCache keeps the most recently used account states together with their versions.
+// A cached state is only ever a starting point for replay - events past the cached version are
+// always read from the event store, so the cache stays correct when several instances write
+// to the same store. It is safe for concurrent use.
+type AggregateCache struct {
+	maxSize int
+	ttl     time.Duration
+	now     func() time.Time
+	mutex   sync.Mutex
+	entries map[account.ID]*list.Element
+	lru     *list.List
+}
+
+type cachedAggregate struct {
+	id        account.ID
+	snapshot  account.Snapshot
+	version   int
+	expiresAt time.Time
+}
+
+// NewAggregateCache creates a cache holding at most maxSize aggregates, each for at most ttl.
+// Zero ttl means that entries only leave the cache when evicted or invalidated.
+func NewAggregateCache(maxSize int, ttl time.Duration) *AggregateCache {
+	if maxSize <= 0 {
+		log.Panic("aggregate cache size has to be positive")
+	}
+	if ttl < 0 {
+		log.Panic("aggregate cache ttl can not be negative")
+	}
+	return &AggregateCache{
+		maxSize: maxSize,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: map[account.ID]*list.Element{},
+		lru:     list.New(),
+	}
+}
+
+func (c *AggregateCache) get(id account.ID) (account.Snapshot, int, bool) {
+	if c == nil {
+		return account.Snapshot{}, 0, false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.entries[id]
+	if !ok {
+		aggregateCacheMisses.Inc()
+		return account.Snapshot{}, 0, false
+	}
+	entry := element.Value.(*cachedAggregate)
+	if c.expired(entry) {
+		c.remove(element)
+		aggregateCacheMisses.Inc()
+		return account.Snapshot{}, 0, false
+	}
+	c.lru.MoveToFront(element)
+	aggregateCacheHits.Inc()
+	return entry.snapshot, entry.version, true
+}
+
+// put caches the state of the aggregate at the given version unless a newer version is already cached.
+func (c *AggregateCache) put(id account.ID, snapshot account.Snapshot, version int) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, ok := c.entries[id]; ok {
+		entry := element.Value.(*cachedAggregate)
+		if entry.version > version && !c.expired(entry) {
+			return
+		}
+		entry.snapshot = snapshot
+		entry.version = version
+		entry.expiresAt = c.expiry()
+		c.lru.MoveToFront(element)
+		return
+	}
+
+	c.entries[id] = c.lru.PushFront(&cachedAggregate{id: id, snapshot: snapshot, version: version, expiresAt: c.expiry()})
+	if c.lru.Len() > c.maxSize {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *AggregateCache) invalidate(id account.ID) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, ok := c.entries[id]; ok {
+		c.remove(element)
+	}
+}
+
+// InvalidateOwner drops the cached aggregates of the owner, so that they are read back redacted once the owner was
+// forgotten
+func (c *AggregateCache) InvalidateOwner(owner account.OwnerID) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, element := range c.entries {
+		if element.Value.(*cachedAggregate).snapshot.OwnerID == owner {
+			c.remove(element)
+		}
+	}
+}
+
+func (c *AggregateCache) expiry() time.Time {
+	if c.ttl == 0 {
+		return time.Time{}
+	}
+	return c.now().Add(c.ttl)
+}
+
+func (c *AggregateCache) expired(entry *cachedAggregate) bool {
+	return !entry.expiresAt.IsZero() && !c.now().Before(entry.expiresAt)
+}
+
+func (c *AggregateCache) remove(element *list.Element) {
+	c.lru.Remove(element)
+	delete(c.entries, element.Value.(*cachedAggregate).id)
+}
@@ -0,0 +1,278 @@
+package eventsourcing
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/eventstore"
+	"github.com/rieske/event-sourced-account-go/serialization"
+	"github.com/stretchr/testify/assert"
+)
+
+func snapshotWithBalance(id account.ID, balance int64) account.Snapshot {
+	return account.Snapshot{ID: id, Balance: balance, Open: true}
+}
+
+func TestAggregateCacheMiss(t *testing.T) {
+	cache := NewAggregateCache(10, 0)
+
+	_, _, ok := cache.get(account.NewID())
+
+	assert.False(t, ok)
+}
+
+func TestAggregateCacheHit(t *testing.T) {
+	cache := NewAggregateCache(10, 0)
+	id := account.NewID()
+
+	cache.put(id, snapshotWithBalance(id, 42), 3)
+	snapshot, version, ok := cache.get(id)
+
+	assert.True(t, ok)
+	assert.Equal(t, snapshotWithBalance(id, 42), snapshot)
+	assert.Equal(t, 3, version)
+}
+
+func TestAggregateCacheKeepsNewerVersion(t *testing.T) {
+	cache := NewAggregateCache(10, 0)
+	id := account.NewID()
+
+	cache.put(id, snapshotWithBalance(id, 42), 3)
+	cache.put(id, snapshotWithBalance(id, 10), 2)
+	snapshot, version, _ := cache.get(id)
+
+	assert.Equal(t, snapshotWithBalance(id, 42), snapshot)
+	assert.Equal(t, 3, version)
+}
+
+func TestAggregateCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewAggregateCache(2, 0)
+	first, second, third := account.NewID(), account.NewID(), account.NewID()
+
+	cache.put(first, snapshotWithBalance(first, 1), 1)
+	cache.put(second, snapshotWithBalance(second, 2), 1)
+	cache.get(first)
+	cache.put(third, snapshotWithBalance(third, 3), 1)
+
+	_, _, ok := cache.get(first)
+	assert.True(t, ok)
+	_, _, ok = cache.get(second)
+	assert.False(t, ok)
+	_, _, ok = cache.get(third)
+	assert.True(t, ok)
+}
+
+func TestAggregateCacheEntriesExpire(t *testing.T) {
+	cache := NewAggregateCache(10, time.Minute)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	id := account.NewID()
+
+	cache.put(id, snapshotWithBalance(id, 42), 3)
+	now = now.Add(time.Minute)
+
+	_, _, ok := cache.get(id)
+	assert.False(t, ok)
+}
+
+func TestAggregateCacheInvalidation(t *testing.T) {
+	cache := NewAggregateCache(10, 0)
+	id := account.NewID()
+
+	cache.put(id, snapshotWithBalance(id, 42), 3)
+	cache.invalidate(id)
+
+	_, _, ok := cache.get(id)
+	assert.False(t, ok)
+}
+
+func TestAggregateCacheOwnerInvalidation(t *testing.T) {
+	cache := NewAggregateCache(10, 0)
+	id, otherID, ownerID := account.NewID(), account.NewID(), account.NewOwnerID()
+
+	cache.put(id, account.Snapshot{ID: id, OwnerID: ownerID, Open: true}, 1)
+	cache.put(otherID, account.Snapshot{ID: otherID, OwnerID: account.NewOwnerID(), Open: true}, 1)
+	cache.InvalidateOwner(ownerID)
+
+	_, _, ok := cache.get(id)
+	assert.False(t, ok)
+	_, _, ok = cache.get(otherID)
+	assert.True(t, ok)
+}
+
+func TestCommittedAggregatesAreCached(t *testing.T) {
+	cache := NewAggregateCache(10, 0)
+	service := NewCachingAccountService(eventstore.NewInMemoryStore(), 0, cache)
+	id, ownerID := account.NewID(), account.NewOwnerID()
+
+	assert.NoError(t, service.OpenAccount(context.Background(), id, ownerID))
+	assert.NoError(t, service.Deposit(context.Background(), id, uuid.New(), 42))
+
+	snapshot, version, ok := cache.get(id)
+	assert.True(t, ok)
+	assert.Equal(t, account.Snapshot{ID: id, OwnerID: ownerID, Balance: 42, Open: true}, snapshot)
+	assert.Equal(t, 2, version)
+}
+
+func TestConcurrentModificationInvalidatesCachedAggregate(t *testing.T) {
+	store := eventstore.NewInMemoryStore()
+	cache := NewAggregateCache(10, 0)
+	id, ownerID := account.NewID(), account.NewOwnerID()
+	err := store.Append(context.Background(), []eventstore.SequencedEvent{
+		{AggregateId: id, Seq: 1, Event: account.AccountOpenedEvent{AccountID: id, OwnerID: ownerID}},
+		{AggregateId: id, Seq: 2, Event: account.MoneyDepositedEvent{AmountDeposited: 1, Balance: 1}},
+	}, nil, uuid.New())
+	assert.NoError(t, err)
+
+	es := newEventStream(store, 0)
+	es.cache = cache
+	a, err := es.replay(context.Background(), id)
+	assert.NoError(t, err)
+
+	err = store.Append(context.Background(), []eventstore.SequencedEvent{
+		{AggregateId: id, Seq: 3, Event: account.MoneyDepositedEvent{AmountDeposited: 1, Balance: 2}},
+	}, nil, uuid.New())
+	assert.NoError(t, err)
+
+	assert.NoError(t, a.Deposit(5))
+	err = es.commit(context.Background(), uuid.New())
+
+	assert.Equal(t, account.ConcurrentModification, err)
+	_, _, ok := cache.get(id)
+	assert.False(t, ok)
+}
+
+// wrappingStore fails appends with errors that wrap the errors of the store
+type wrappingStore struct {
+	EventStore
+}
+
+func (s wrappingStore) Append(ctx context.Context, events []eventstore.SequencedEvent, snapshots map[account.ID]eventstore.SequencedEvent, txId uuid.UUID) error {
+	if err := s.EventStore.Append(ctx, events, snapshots, txId); err != nil {
+		return fmt.Errorf("append: %w", err)
+	}
+	return nil
+}
+
+func TestWrappedConcurrentModificationInvalidatesCachedAggregate(t *testing.T) {
+	store := eventstore.NewInMemoryStore()
+	cache := NewAggregateCache(10, 0)
+	id, ownerID := account.NewID(), account.NewOwnerID()
+	err := store.Append(context.Background(), []eventstore.SequencedEvent{
+		{AggregateId: id, Seq: 1, Event: account.AccountOpenedEvent{AccountID: id, OwnerID: ownerID}},
+	}, nil, uuid.New())
+	assert.NoError(t, err)
+
+	es := newEventStream(wrappingStore{store}, 0)
+	es.cache = cache
+	a, err := es.replay(context.Background(), id)
+	assert.NoError(t, err)
+
+	err = store.Append(context.Background(), []eventstore.SequencedEvent{
+		{AggregateId: id, Seq: 2, Event: account.MoneyDepositedEvent{AmountDeposited: 1, Balance: 1}},
+	}, nil, uuid.New())
+	assert.NoError(t, err)
+
+	assert.NoError(t, a.Deposit(5))
+	err = es.commit(context.Background(), uuid.New())
+
+	assert.ErrorIs(t, err, account.ConcurrentModification)
+	_, _, ok := cache.get(id)
+	assert.False(t, ok)
+}
+
+func TestCachingInstancesSharingStoreRemainConsistent(t *testing.T) {
+	store := eventstore.NewInMemoryStore()
+	instances := []*AccountService{
+		NewCachingAccountService(store, 0, NewAggregateCache(10, 0)),
+		NewCachingAccountService(store, 0, NewAggregateCache(10, 0)),
+	}
+	id := account.NewID()
+	assert.NoError(t, instances[0].OpenAccount(context.Background(), id, account.NewOwnerID()))
+
+	operations := 50
+	wg := sync.WaitGroup{}
+	for _, instance := range instances {
+		wg.Add(1)
+		go func(s *AccountService) {
+			defer wg.Done()
+			for i := 0; i < operations; i++ {
+				txId := uuid.New()
+				for s.Deposit(context.Background(), id, txId, 1) == account.ConcurrentModification {
+				}
+			}
+		}(instance)
+	}
+	wg.Wait()
+
+	for _, instance := range instances {
+		snapshot, err := instance.QueryAccount(context.Background(), id)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(operations*len(instances)), snapshot.Balance)
+	}
+}
+
+// personalDataStore stores events and snapshots as they would be read back from a store that serializes them with
+// their owner encrypted
+type personalDataStore struct {
+	EventStore
+	serializer serialization.EventSerializer
+}
+
+func (s personalDataStore) roundTrip(ctx context.Context, e eventstore.SequencedEvent) (eventstore.SequencedEvent, error) {
+	serializedEvent, err := s.serializer.SerializeEvent(ctx, e)
+	if err != nil {
+		return e, err
+	}
+	return s.serializer.DeserializeEvent(ctx, serializedEvent)
+}
+
+func (s personalDataStore) Append(ctx context.Context, events []eventstore.SequencedEvent, snapshots map[account.ID]eventstore.SequencedEvent, txId uuid.UUID) error {
+	var stored []eventstore.SequencedEvent
+	for _, e := range events {
+		e, err := s.roundTrip(ctx, e)
+		if err != nil {
+			return err
+		}
+		stored = append(stored, e)
+	}
+	storedSnapshots := map[account.ID]eventstore.SequencedEvent{}
+	for id, snapshot := range snapshots {
+		snapshot, err := s.roundTrip(ctx, snapshot)
+		if err != nil {
+			return err
+		}
+		storedSnapshots[id] = snapshot
+	}
+	return s.EventStore.Append(ctx, stored, storedSnapshots, txId)
+}
+
+func TestForgottenOwnerOfCachedAggregateStaysRedacted(t *testing.T) {
+	keys := serialization.NewInMemoryOwnerKeyStore()
+	store := personalDataStore{eventstore.NewInMemoryStore(), serialization.NewPersonalDataSerializer(serialization.NewMsgpackEventSerializer(), keys)}
+	cache := NewAggregateCache(10, 0)
+	service := NewCachingAccountService(store, 1, cache)
+	id, ownerID := account.NewID(), account.NewOwnerID()
+	assert.NoError(t, service.OpenAccount(context.Background(), id, ownerID))
+	assert.NoError(t, service.Deposit(context.Background(), id, uuid.New(), 42))
+
+	deleted, err := keys.DeleteOwnerKey(context.Background(), ownerID)
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+	// the snapshot is taken of the cached aggregate that still holds the owner
+	assert.NoError(t, service.Deposit(context.Background(), id, uuid.New(), 8))
+
+	snapshot, err := NewAccountService(store, 1).QueryAccount(context.Background(), id)
+	assert.NoError(t, err)
+	assert.Equal(t, &account.Snapshot{ID: id, OwnerID: account.RedactedOwnerID, Balance: 50, Open: true}, snapshot)
+
+	cache.InvalidateOwner(ownerID)
+	snapshot, err = service.QueryAccount(context.Background(), id)
+	assert.NoError(t, err)
+	assert.Equal(t, &account.Snapshot{ID: id, OwnerID: account.RedactedOwnerID, Balance: 50, Open: true}, snapshot)
+}
@@ -0,0 +1,47 @@
+package eventsourcing
+
+import (
+	"context"
+	"errors"
+
+	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/eventstore"
+	"github.com/rieske/event-sourced-account-go/internal/telemetry"
+)
+
+var (
+	// ArchivalNotSupported is returned when archiving accounts of an event store that does not implement Archiver
+	ArchivalNotSupported = errors.New("event store does not archive events")
+	// AccountStillOpen is returned when archiving an account that was not closed
+	AccountStillOpen = errors.New("only closed accounts can be archived")
+)
+
+// Archiver is implemented by event stores that can move the events of aggregates out of the hot store.
+// Archived events are still read back, only slower.
+type Archiver interface {
+	// Archive moves the events of the aggregate up to the tombstone's sequence number into the archive and keeps
+	// the tombstone as the snapshot of the aggregate, so that replaying it does not need to read the archive
+	Archive(ctx context.Context, tombstone eventstore.SequencedEvent) error
+}
+
+// Archive moves the events of the closed account into the archive of the event store, leaving the final state
+// of the account as a tombstone snapshot
+func (s AccountService) Archive(ctx context.Context, id account.ID) (err error) {
+	ctx, span := tracer.StartSpan(ctx, "Archive", telemetry.AccountAttribute(id))
+	defer func() { telemetry.EndSpan(span, err) }()
+
+	archiver, ok := capability[Archiver](s.repo.store)
+	if !ok {
+		return ArchivalNotSupported
+	}
+	es := s.repo.newEventStream()
+	a, err := es.replay(ctx, id)
+	if err != nil {
+		return err
+	}
+	snapshot := a.Snapshot()
+	if snapshot.Open {
+		return AccountStillOpen
+	}
+	return archiver.Archive(ctx, eventstore.SequencedEvent{AggregateId: id, Seq: es.versions[id], Event: snapshot})
+}
@@ -0,0 +1,66 @@
+package eventsourcing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/eventstore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArchiveLeavesTombstoneSnapshotOfClosedAccount(t *testing.T) {
+	ctx := context.Background()
+	store := eventstore.NewInMemoryStore()
+	service := NewAccountService(store, 0)
+	id, ownerID := account.NewID(), account.NewOwnerID()
+	assert.NoError(t, service.OpenAccount(ctx, id, ownerID))
+	assert.NoError(t, service.Deposit(ctx, id, uuid.New(), 10))
+	assert.NoError(t, service.Withdraw(ctx, id, uuid.New(), 10))
+	assert.NoError(t, service.CloseAccount(ctx, id))
+
+	assert.NoError(t, service.Archive(ctx, id))
+
+	tombstone, err := store.LoadSnapshot(ctx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, eventstore.SequencedEvent{AggregateId: id, Seq: 4, Event: account.Snapshot{ID: id, OwnerID: ownerID}}, tombstone)
+	snapshot, err := service.QueryAccount(ctx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, account.Snapshot{ID: id, OwnerID: ownerID}, *snapshot)
+}
+
+func TestArchiveRejectsOpenAccount(t *testing.T) {
+	ctx := context.Background()
+	store := eventstore.NewInMemoryStore()
+	service := NewAccountService(store, 0)
+	id := account.NewID()
+	assert.NoError(t, service.OpenAccount(ctx, id, account.NewOwnerID()))
+
+	err := service.Archive(ctx, id)
+
+	assert.Equal(t, AccountStillOpen, err)
+	tombstone, err := store.LoadSnapshot(ctx, id)
+	assert.NoError(t, err)
+	assert.Nil(t, tombstone.Event)
+}
+
+func TestArchiveMissingAccount(t *testing.T) {
+	service := NewAccountService(eventstore.NewInMemoryStore(), 0)
+
+	err := service.Archive(context.Background(), account.NewID())
+
+	assert.Equal(t, account.NotFound, err)
+}
+
+func TestArchiveRequiresArchivingStore(t *testing.T) {
+	ctx := context.Background()
+	service := NewAccountService(&unavailableStore{EventStore: eventstore.NewInMemoryStore()}, 0)
+	id := account.NewID()
+	assert.NoError(t, service.OpenAccount(ctx, id, account.NewOwnerID()))
+	assert.NoError(t, service.CloseAccount(ctx, id))
+
+	err := service.Archive(ctx, id)
+
+	assert.Equal(t, ArchivalNotSupported, err)
+}
@@ -0,0 +1,177 @@
+package eventsourcing
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/rieske/event-sourced-account-go/account"
+)
+
+type Command interface {
+	Name() string
+}
+
+// transactionalCommand is implemented by commands that are executed at most once per transaction id.
+// The fingerprint identifies the command parameters.
+type transactionalCommand interface {
+	Command
+	transactionID() uuid.UUID
+	fingerprint() string
+}
+
+type validatable interface {
+	Validate() error
+}
+
+type OpenAccount struct {
+	AccountID account.ID
+	OwnerID   account.OwnerID
+}
+
+func (c OpenAccount) Name() string {
+	return "open"
+}
+
+type Deposit struct {
+	AccountID     account.ID
+	TransactionID uuid.UUID
+	Amount        int64
+}
+
+func (c Deposit) Name() string {
+	return "deposit"
+}
+
+func (c Deposit) Validate() error {
+	return requireTransactionID(c.TransactionID)
+}
+
+func (c Deposit) transactionID() uuid.UUID {
+	return c.TransactionID
+}
+
+func (c Deposit) fingerprint() string {
+	return fmt.Sprintf("%v|%d|", c.AccountID, c.Amount)
+}
+
+type Withdraw struct {
+	AccountID     account.ID
+	TransactionID uuid.UUID
+	Amount        int64
+}
+
+func (c Withdraw) Name() string {
+	return "withdraw"
+}
+
+func (c Withdraw) Validate() error {
+	return requireTransactionID(c.TransactionID)
+}
+
+func (c Withdraw) transactionID() uuid.UUID {
+	return c.TransactionID
+}
+
+func (c Withdraw) fingerprint() string {
+	return fmt.Sprintf("%v|%d|", c.AccountID, c.Amount)
+}
+
+type Transfer struct {
+	SourceAccountID account.ID
+	TargetAccountID account.ID
+	TransactionID   uuid.UUID
+	Amount          int64
+}
+
+func (c Transfer) Name() string {
+	return "transfer"
+}
+
+func (c Transfer) Validate() error {
+	if c.SourceAccountID == c.TargetAccountID {
+		return account.SelfTransfer
+	}
+	return requireTransactionID(c.TransactionID)
+}
+
+func (c Transfer) transactionID() uuid.UUID {
+	return c.TransactionID
+}
+
+func (c Transfer) fingerprint() string {
+	return fmt.Sprintf("%v|%v|%d|", c.SourceAccountID, c.TargetAccountID, c.Amount)
+}
+
+// CloseAccount closes the account in a new transaction unless TransactionID is given
+type CloseAccount struct {
+	AccountID     account.ID
+	TransactionID uuid.UUID
+}
+
+func (c CloseAccount) Name() string {
+	return "close"
+}
+
+func requireTransactionID(txId uuid.UUID) error {
+	if txId == uuid.Nil {
+		return account.MissingTransactionID
+	}
+	return nil
+}
+
+// SendTransfer debits one side of a transfer whose accounts can not be modified in the same transaction.
+// TransferID identifies the whole transfer while TransactionID identifies this step of it.
+type SendTransfer struct {
+	AccountID       account.ID
+	TargetAccountID account.ID
+	TransferID      uuid.UUID
+	TransactionID   uuid.UUID
+	Amount          int64
+}
+
+func (c SendTransfer) Name() string {
+	return "send_transfer"
+}
+
+func (c SendTransfer) Validate() error {
+	if c.AccountID == c.TargetAccountID {
+		return account.SelfTransfer
+	}
+	return requireTransactionID(c.TransactionID)
+}
+
+func (c SendTransfer) transactionID() uuid.UUID {
+	return c.TransactionID
+}
+
+func (c SendTransfer) fingerprint() string {
+	return fmt.Sprintf("%v|%v|%v|%d|", c.AccountID, c.TargetAccountID, c.TransferID, c.Amount)
+}
+
+// ReceiveTransfer credits the other side of a transfer started with SendTransfer
+type ReceiveTransfer struct {
+	AccountID       account.ID
+	SourceAccountID account.ID
+	TransferID      uuid.UUID
+	TransactionID   uuid.UUID
+	Amount          int64
+}
+
+func (c ReceiveTransfer) Name() string {
+	return "receive_transfer"
+}
+
+func (c ReceiveTransfer) Validate() error {
+	if c.AccountID == c.SourceAccountID {
+		return account.SelfTransfer
+	}
+	return requireTransactionID(c.TransactionID)
+}
+
+func (c ReceiveTransfer) transactionID() uuid.UUID {
+	return c.TransactionID
+}
+
+func (c ReceiveTransfer) fingerprint() string {
+	return fmt.Sprintf("%v|%v|%v|%d|", c.AccountID, c.SourceAccountID, c.TransferID, c.Amount)
+}
@@ -1,10 +1,12 @@
 package eventsourcing_test
 
 import (
+	"github.com/rieske/event-sourced-account-go/eventsourcing"
 	"github.com/rieske/event-sourced-account-go/eventstore"
 	"github.com/rieske/event-sourced-account-go/test"
 	"github.com/stretchr/testify/suite"
 	"testing"
+	"time"
 )
 
 func TestConsistencyInMemory(t *testing.T) {
@@ -18,3 +20,23 @@ func TestConsistencyInMemoryWithSnapshotting(t *testing.T) {
 	testSuite := test.NewConsistencyTestSuite(100, 8, 5, store)
 	suite.Run(t, testSuite)
 }
+
+func TestConsistencyInMemoryWithAggregateCache(t *testing.T) {
+	store := eventstore.NewInMemoryStore()
+	service := eventsourcing.NewCachingAccountService(store, 5, eventsourcing.NewAggregateCache(100, time.Minute))
+	testSuite := test.NewServiceConsistencyTestSuite(100, 8, service)
+	suite.Run(t, testSuite)
+}
+
+func BenchmarkConsistencyInMemory(b *testing.B) {
+	test.RunConsistencyBenchmarks(b, 8, eventsourcing.NewAccountService(eventstore.NewInMemoryStore(), 5))
+}
+
+func TestConsistencyAcrossShards(t *testing.T) {
+	store := eventsourcing.NewShardedEventStore(
+		eventsourcing.Shard{Name: "a", Store: eventstore.NewInMemoryStore()},
+		eventsourcing.Shard{Name: "b", Store: eventstore.NewInMemoryStore()},
+	)
+	service := eventsourcing.NewAccountService(store, 5, eventsourcing.WithCrossShardTransfers(eventstore.NewInMemorySagaStore(), time.Minute))
+	suite.Run(t, test.NewServiceConsistencyTestSuite(100, 8, service))
+}
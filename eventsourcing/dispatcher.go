@@ -0,0 +1,24 @@
+package eventsourcing
+
+import "context"
+
+type Handler func(ctx context.Context, cmd Command) error
+
+// Middleware decorates a Handler with a cross-cutting concern
+type Middleware func(next Handler) Handler
+
+type Dispatcher struct {
+	handler Handler
+}
+
+// NewDispatcher wraps the handler in the middleware chain - the first middleware is the outermost one
+func NewDispatcher(handler Handler, middleware ...Middleware) *Dispatcher {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return &Dispatcher{handler: handler}
+}
+
+func (d *Dispatcher) Dispatch(ctx context.Context, cmd Command) error {
+	return d.handler(ctx, cmd)
+}
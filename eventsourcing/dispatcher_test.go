@@ -0,0 +1,152 @@
+package eventsourcing_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/eventsourcing"
+	"github.com/rieske/event-sourced-account-go/eventstore"
+	"github.com/stretchr/testify/assert"
+)
+
+type unknownCommand struct{}
+
+func (c unknownCommand) Name() string {
+	return "unknown"
+}
+
+func recordingMiddleware(name string, calls *[]string) eventsourcing.Middleware {
+	return func(next eventsourcing.Handler) eventsourcing.Handler {
+		return func(ctx context.Context, cmd eventsourcing.Command) error {
+			*calls = append(*calls, name)
+			return next(ctx, cmd)
+		}
+	}
+}
+
+func TestDispatcherAppliesMiddlewareInOrder(t *testing.T) {
+	var calls []string
+	handler := func(ctx context.Context, cmd eventsourcing.Command) error {
+		calls = append(calls, "handler")
+		return nil
+	}
+	dispatcher := eventsourcing.NewDispatcher(handler, recordingMiddleware("first", &calls), recordingMiddleware("second", &calls))
+
+	err := dispatcher.Dispatch(context.Background(), unknownCommand{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"first", "second", "handler"}, calls)
+}
+
+func TestRetryMiddlewareRetriesConcurrentModification(t *testing.T) {
+	attempts := 0
+	handler := func(ctx context.Context, cmd eventsourcing.Command) error {
+		attempts++
+		if attempts < 3 {
+			return account.ConcurrentModification
+		}
+		return nil
+	}
+	dispatcher := eventsourcing.NewDispatcher(handler, eventsourcing.RetryMiddleware(3))
+
+	err := dispatcher.Dispatch(context.Background(), unknownCommand{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+}
+
+func TestRetryMiddlewareGivesUp(t *testing.T) {
+	attempts := 0
+	handler := func(ctx context.Context, cmd eventsourcing.Command) error {
+		attempts++
+		return account.ConcurrentModification
+	}
+	dispatcher := eventsourcing.NewDispatcher(handler, eventsourcing.RetryMiddleware(2))
+
+	err := dispatcher.Dispatch(context.Background(), unknownCommand{})
+
+	assert.Equal(t, account.ConcurrentModification, err)
+	assert.Equal(t, 2, attempts)
+}
+
+func TestValidationMiddlewareRejectsInvalidCommands(t *testing.T) {
+	service := eventsourcing.NewAccountService(eventstore.NewInMemoryStore(), 0)
+	id := account.NewID()
+
+	err := service.Dispatch(context.Background(), eventsourcing.Transfer{SourceAccountID: id, TargetAccountID: id, TransactionID: uuid.New(), Amount: 1})
+	assert.Equal(t, account.SelfTransfer, err)
+
+	err = service.Dispatch(context.Background(), eventsourcing.Deposit{AccountID: id, Amount: 1})
+	assert.Equal(t, account.MissingTransactionID, err)
+}
+
+func TestAuthorizerCanRejectCommands(t *testing.T) {
+	authorizer := eventsourcing.AuthorizerFunc(func(ctx context.Context, cmd eventsourcing.Command) error {
+		if _, ok := cmd.(eventsourcing.Withdraw); ok {
+			return account.NotAuthorized
+		}
+		return nil
+	})
+	service := eventsourcing.NewAccountService(eventstore.NewInMemoryStore(), 0, eventsourcing.WithAuthorizer(authorizer))
+	id := account.NewID()
+	assert.NoError(t, service.OpenAccount(context.Background(), id, account.NewOwnerID()))
+	assert.NoError(t, service.Deposit(context.Background(), id, uuid.New(), 10))
+
+	err := service.Withdraw(context.Background(), id, uuid.New(), 5)
+
+	assert.Equal(t, account.NotAuthorized, err)
+	snapshot, err := service.QueryAccount(context.Background(), id)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), snapshot.Balance)
+}
+
+func TestUnsupportedCommandIsRejected(t *testing.T) {
+	service := eventsourcing.NewAccountService(eventstore.NewInMemoryStore(), 0)
+
+	err := service.Dispatch(context.Background(), unknownCommand{})
+
+	assert.EqualError(t, err, "unsupported command eventsourcing_test.unknownCommand")
+}
+
+// separateResultsStore counts the command results stored apart from the events of the command
+type separateResultsStore struct {
+	eventsourcing.EventStore
+	stored int
+}
+
+func (s *separateResultsStore) StoreCommandResult(ctx context.Context, result eventstore.CommandResult) (eventstore.CommandResult, error) {
+	s.stored++
+	return s.EventStore.StoreCommandResult(ctx, result)
+}
+
+func TestIdempotencyMiddlewareRecordsSuccessWithTheEvents(t *testing.T) {
+	store := &separateResultsStore{EventStore: eventstore.NewInMemoryStore()}
+	service := eventsourcing.NewAccountService(store, 0)
+	id, txId := account.NewID(), uuid.New()
+	assert.NoError(t, service.OpenAccount(context.Background(), id, account.NewOwnerID()))
+
+	assert.NoError(t, service.Deposit(context.Background(), id, txId, 10))
+
+	assert.Equal(t, 0, store.stored)
+	result, err := store.LoadCommandResult(context.Background(), txId)
+	assert.NoError(t, err)
+	if assert.NotNil(t, result) {
+		assert.Equal(t, "", result.Error)
+	}
+	assert.Equal(t, account.TransactionMismatch, service.Deposit(context.Background(), id, txId, 11))
+}
+
+func TestIdempotencyMiddlewareRecordsDomainErrorsOnTheirOwn(t *testing.T) {
+	store := &separateResultsStore{EventStore: eventstore.NewInMemoryStore()}
+	service := eventsourcing.NewAccountService(store, 0)
+	id, txId := account.NewID(), uuid.New()
+	assert.NoError(t, service.OpenAccount(context.Background(), id, account.NewOwnerID()))
+
+	assert.Equal(t, account.InsufficientBalance, service.Withdraw(context.Background(), id, txId, 10))
+
+	assert.Equal(t, 1, store.stored)
+	assert.NoError(t, service.Deposit(context.Background(), id, uuid.New(), 10))
+	assert.Equal(t, account.InsufficientBalance, service.Withdraw(context.Background(), id, txId, 10))
+}
@@ -1,10 +1,12 @@
 package eventsourcing_test
 
 import (
+	"github.com/rieske/event-sourced-account-go/eventsourcing"
 	"github.com/rieske/event-sourced-account-go/eventstore"
 	"github.com/rieske/event-sourced-account-go/test"
 	"github.com/stretchr/testify/suite"
 	"testing"
+	"time"
 )
 
 func TestEventSourcingInMemory(t *testing.T) {
@@ -12,3 +14,9 @@ func TestEventSourcingInMemory(t *testing.T) {
 	testSuite := test.NewEventsourcingTestSuite(store, 0)
 	suite.Run(t, testSuite)
 }
+
+func TestEventSourcingInMemoryWithAggregateCache(t *testing.T) {
+	store := eventstore.NewInMemoryStore()
+	service := eventsourcing.NewCachingAccountService(store, 0, eventsourcing.NewAggregateCache(100, time.Minute))
+	suite.Run(t, test.NewServiceEventsourcingTestSuite(store, service))
+}
@@ -2,24 +2,64 @@ package eventsourcing
 
 import (
 	"context"
+	"errors"
 	"log"
 
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/rieske/event-sourced-account-go/account"
 	"github.com/rieske/event-sourced-account-go/eventstore"
+	"github.com/rieske/event-sourced-account-go/internal/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	replayedEvents = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "account_replayed_events",
+		Help:    "Number of events replayed on top of the cached state or the latest snapshot to load an account",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 10),
+	})
+	snapshotsWritten = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "account_snapshots_written_total",
+		Help: "Number of account snapshots stored together with events",
+	})
+	moneyVolume = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "account_money_volume_total",
+		Help: "Amount of money moved by stored events, by operation",
+	}, []string{"operation"})
 )
 
 type EventStore interface {
 	Events(ctx context.Context, id account.ID, version int) ([]eventstore.SequencedEvent, error)
+	// StreamEvents hands the events following the version to handle one at a time, handle can return
+	// eventstore.StopStreaming to stop reading early
+	StreamEvents(ctx context.Context, id account.ID, version int, handle func(eventstore.SequencedEvent) error) error
+	TimestampedEvents(ctx context.Context, id account.ID, version int) ([]eventstore.TimestampedEvent, error)
 	Append(ctx context.Context, events []eventstore.SequencedEvent, snapshots map[account.ID]eventstore.SequencedEvent, txId uuid.UUID) error
 	LoadSnapshot(ctx context.Context, id account.ID) (eventstore.SequencedEvent, error)
 	TransactionExists(ctx context.Context, id account.ID, txId uuid.UUID) (bool, error)
+	// TransactionParticipants lists the accounts that each of the transactions touched, leaving out transactions that
+	// touched none
+	TransactionParticipants(ctx context.Context, txIds []uuid.UUID) (map[uuid.UUID][]account.ID, error)
+	VerifyIntegrity(ctx context.Context, id account.ID) (eventstore.IntegrityReport, error)
+	LoadCommandResult(ctx context.Context, txId uuid.UUID) (*eventstore.CommandResult, error)
+	StoreCommandResult(ctx context.Context, result eventstore.CommandResult) (eventstore.CommandResult, error)
+}
+
+// AggregateLoader is implemented by event stores that read everything a command on an aggregate needs in one go
+type AggregateLoader interface {
+	// LoadAggregate reads the latest snapshot unless it is not past the version, the events following the snapshot
+	// or the version and whether the transaction already touched the aggregate
+	LoadAggregate(ctx context.Context, id account.ID, version int, txId uuid.UUID) (eventstore.LoadedAggregate, error)
 }
 
 type eventStream struct {
 	eventStore           EventStore
 	snapshotFrequency    int
+	cache                *AggregateCache
 	versions             map[account.ID]int
+	accounts             map[account.ID]*account.Account
 	uncommittedEvents    []eventstore.SequencedEvent
 	uncommittedSnapshots map[account.ID]eventstore.SequencedEvent
 }
@@ -32,12 +72,17 @@ func newEventStream(es EventStore, snapshotFrequency int) *eventStream {
 		eventStore:           es,
 		snapshotFrequency:    snapshotFrequency,
 		versions:             map[account.ID]int{},
+		accounts:             map[account.ID]*account.Account{},
 		uncommittedSnapshots: map[account.ID]eventstore.SequencedEvent{},
 	}
 }
 
 func (s *eventStream) applySnapshot(ctx context.Context, id account.ID) (*account.Account, int, error) {
 	a := account.New(s)
+	if snapshot, version, ok := s.cache.get(id); ok {
+		snapshot.Apply(a)
+		return a, version, nil
+	}
 	snapshot, err := s.eventStore.LoadSnapshot(ctx, id)
 	if err != nil {
 		return nil, 0, err
@@ -49,33 +94,94 @@ func (s *eventStream) applySnapshot(ctx context.Context, id account.ID) (*accoun
 	return a, 0, nil
 }
 
-func (s *eventStream) replay(ctx context.Context, id account.ID) (*account.Account, error) {
+func (s *eventStream) replay(ctx context.Context, id account.ID) (_ *account.Account, err error) {
+	ctx, span := tracer.StartSpan(ctx, "eventStream.replay", telemetry.AccountAttribute(id))
+	defer func() { telemetry.EndSpan(span, err) }()
+
 	a, currentVersion, err := s.applySnapshot(ctx, id)
 	if err != nil {
 		return nil, err
 	}
-	events, err := s.eventStore.Events(ctx, id, currentVersion)
+	replayed := 0
+	err = s.eventStore.StreamEvents(ctx, id, currentVersion, func(e eventstore.SequencedEvent) error {
+		e.Event.Apply(a)
+		currentVersion = e.Seq
+		replayed++
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	replayedEvents.Observe(float64(replayed))
+	span.SetAttributes(attribute.Int("account.replayedEvents", replayed), attribute.Int("account.version", currentVersion))
+
+	if currentVersion == 0 {
+		return nil, account.NotFound
+	}
+
+	s.register(id, a, currentVersion)
+	return a, nil
+}
+
+// replayTransaction replays the aggregate and tells whether the transaction already touched it,
+// in a single read if the store supports it
+func (s *eventStream) replayTransaction(ctx context.Context, id account.ID, txId uuid.UUID) (_ *account.Account, _ bool, err error) {
+	ctx, span := tracer.StartSpan(ctx, "eventStream.replayTransaction", telemetry.AccountAttribute(id), attribute.String("transaction.id", txId.String()))
+	defer func() { telemetry.EndSpan(span, err) }()
+
+	loader, ok := capability[AggregateLoader](s.eventStore)
+	if !ok {
+		a, replayErr := s.replay(ctx, id)
+		transactionExists, err := s.eventStore.TransactionExists(ctx, id, txId)
+		if err != nil || transactionExists {
+			return nil, transactionExists, err
+		}
+		return a, false, replayErr
+	}
 
-	for _, e := range events {
+	a := account.New(s)
+	currentVersion := 0
+	if snapshot, version, ok := s.cache.get(id); ok {
+		snapshot.Apply(a)
+		currentVersion = version
+	}
+	loaded, err := loader.LoadAggregate(ctx, id, currentVersion, txId)
+	if err != nil {
+		return nil, false, err
+	}
+	if loaded.TransactionExists {
+		return nil, true, nil
+	}
+	if loaded.Snapshot.Event != nil {
+		loaded.Snapshot.Event.Apply(a)
+		currentVersion = loaded.Snapshot.Seq
+	}
+	for _, e := range loaded.Events {
 		e.Event.Apply(a)
+		currentVersion = e.Seq
 	}
-	currentVersion += len(events)
+	replayedEvents.Observe(float64(len(loaded.Events)))
+	span.SetAttributes(attribute.Int("account.replayedEvents", len(loaded.Events)), attribute.Int("account.version", currentVersion))
 
 	if currentVersion == 0 {
-		return nil, account.NotFound
+		return nil, false, account.NotFound
 	}
 
-	s.versions[id] = currentVersion
-	return a, nil
+	s.register(id, a, currentVersion)
+	return a, false, nil
+}
+
+func (s *eventStream) register(id account.ID, a *account.Account, version int) {
+	s.versions[id] = version
+	s.accounts[id] = a
+	s.cache.put(id, a.Snapshot(), version)
 }
 
 func (s *eventStream) Append(e account.Event, a *account.Account, id account.ID) {
 	e.Apply(a)
 	version := s.versions[id] + 1
 	s.versions[id] = version
+	s.accounts[id] = a
 	se := eventstore.SequencedEvent{AggregateId: id, Seq: version, Event: e}
 	s.uncommittedEvents = append(s.uncommittedEvents, se)
 	if s.snapshotFrequency != 0 && version%s.snapshotFrequency == 0 {
@@ -83,11 +189,41 @@ func (s *eventStream) Append(e account.Event, a *account.Account, id account.ID)
 	}
 }
 
-func (s *eventStream) commit(ctx context.Context, txId uuid.UUID) error {
-	if err := s.eventStore.Append(ctx, s.uncommittedEvents, s.uncommittedSnapshots, txId); err != nil {
+func (s *eventStream) commit(ctx context.Context, txId uuid.UUID) (err error) {
+	ctx, span := tracer.StartSpan(ctx, "eventStream.commit",
+		attribute.String("transaction.id", txId.String()),
+		attribute.Int("eventStore.events", len(s.uncommittedEvents)),
+		attribute.Int("eventStore.snapshots", len(s.uncommittedSnapshots)))
+	defer func() { telemetry.EndSpan(span, err) }()
+
+	err = s.eventStore.Append(ctx, s.uncommittedEvents, s.uncommittedSnapshots, txId)
+	if err != nil {
+		if errors.Is(err, account.ConcurrentModification) {
+			for _, e := range s.uncommittedEvents {
+				s.cache.invalidate(e.AggregateId)
+			}
+		}
 		return err
 	}
+	for _, e := range s.uncommittedEvents {
+		s.cache.put(e.AggregateId, s.accounts[e.AggregateId].Snapshot(), s.versions[e.AggregateId])
+		observeMoneyMoved(e.Event)
+	}
+	snapshotsWritten.Add(float64(len(s.uncommittedSnapshots)))
 	s.uncommittedEvents = nil
 	s.uncommittedSnapshots = map[account.ID]eventstore.SequencedEvent{}
 	return nil
 }
+
+// observeMoneyMoved counts the money of stored events only, so that retried and repeated commands are counted once.
+// A transfer is counted by the sending side.
+func observeMoneyMoved(e account.Event) {
+	switch e := e.(type) {
+	case account.MoneyDepositedEvent:
+		moneyVolume.WithLabelValues("deposited").Add(float64(e.AmountDeposited))
+	case account.MoneyWithdrawnEvent:
+		moneyVolume.WithLabelValues("withdrawn").Add(float64(e.AmountWithdrawn))
+	case account.TransferSentEvent:
+		moneyVolume.WithLabelValues("transferred").Add(float64(e.AmountTransferred))
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/rieske/event-sourced-account-go/account"
 	"github.com/rieske/event-sourced-account-go/eventstore"
 	"github.com/stretchr/testify/assert"
@@ -262,3 +263,114 @@ func TestCommitOutOfSequence(t *testing.T) {
 		t.Error("Expected concurrent modification error")
 	}
 }
+
+// aggregateLoadingStore assembles loaded aggregates from the separate reads of the wrapped store
+type aggregateLoadingStore struct {
+	EventStore
+	loads int
+}
+
+func (s *aggregateLoadingStore) LoadAggregate(ctx context.Context, id account.ID, version int, txId uuid.UUID) (eventstore.LoadedAggregate, error) {
+	s.loads++
+	loaded := eventstore.LoadedAggregate{}
+	transactionExists, err := s.TransactionExists(ctx, id, txId)
+	if err != nil || transactionExists {
+		loaded.TransactionExists = transactionExists
+		return loaded, err
+	}
+	snapshot, err := s.LoadSnapshot(ctx, id)
+	if err != nil {
+		return loaded, err
+	}
+	if snapshot.Event != nil && snapshot.Seq > version {
+		loaded.Snapshot = snapshot
+		version = snapshot.Seq
+	}
+	loaded.Events, err = s.Events(ctx, id, version)
+	return loaded, err
+}
+
+func TestReplayTransactionLoadsAggregateInOneRead(t *testing.T) {
+	store := &aggregateLoadingStore{EventStore: eventstore.NewInMemoryStore()}
+	fixture := &esTestFixture{t, store}
+	id, ownerID := account.NewID(), account.NewOwnerID()
+	fixture.givenEvents([]eventstore.SequencedEvent{
+		{id, 1, account.AccountOpenedEvent{id, ownerID}},
+		{id, 2, account.MoneyDepositedEvent{10, 10}},
+	})
+	fixture.givenSnapshot(eventstore.SequencedEvent{id, 2, account.Snapshot{id, ownerID, 10, true}})
+	fixture.givenEvents([]eventstore.SequencedEvent{
+		{id, 3, account.MoneyDepositedEvent{5, 15}},
+	})
+
+	es := fixture.makeEventStream()
+	a, transactionExists, err := es.replayTransaction(context.Background(), id, uuid.New())
+
+	assert.NoError(t, err)
+	assert.False(t, transactionExists)
+	assert.Equal(t, int64(15), a.Snapshot().Balance)
+	assert.Equal(t, 3, es.versions[id])
+	assert.Equal(t, 1, store.loads)
+}
+
+func TestReplayTransactionReportsExistingTransaction(t *testing.T) {
+	store := &aggregateLoadingStore{EventStore: eventstore.NewInMemoryStore()}
+	id, txId := account.NewID(), uuid.New()
+	err := store.Append(context.Background(), []eventstore.SequencedEvent{
+		{id, 1, account.AccountOpenedEvent{id, account.NewOwnerID()}},
+	}, map[account.ID]eventstore.SequencedEvent{}, txId)
+	assert.NoError(t, err)
+
+	es := newEventStream(store, 0)
+	a, transactionExists, err := es.replayTransaction(context.Background(), id, txId)
+
+	assert.NoError(t, err)
+	assert.True(t, transactionExists)
+	assert.Nil(t, a)
+}
+
+func TestReplayTransactionOfMissingAggregate(t *testing.T) {
+	es := newEventStream(&aggregateLoadingStore{EventStore: eventstore.NewInMemoryStore()}, 0)
+
+	_, _, err := es.replayTransaction(context.Background(), account.NewID(), uuid.New())
+
+	assert.Equal(t, account.NotFound, err)
+}
+
+func TestCommitCountsMoneyMovedAndSnapshotsWritten(t *testing.T) {
+	fixture := newInMemoryFixture(t)
+	es := fixture.makeSnapshottingEventStream(2)
+	deposited := testutil.ToFloat64(moneyVolume.WithLabelValues("deposited"))
+	withdrawn := testutil.ToFloat64(moneyVolume.WithLabelValues("withdrawn"))
+	snapshots := testutil.ToFloat64(snapshotsWritten)
+
+	id := account.NewID()
+	a := account.Account{}
+	es.Append(account.AccountOpenedEvent{id, account.NewOwnerID()}, &a, id)
+	es.Append(account.MoneyDepositedEvent{42, 42}, &a, id)
+	es.Append(account.MoneyWithdrawnEvent{2, 40}, &a, id)
+	assert.NoError(t, es.commit(context.Background(), uuid.New()))
+
+	assert.Equal(t, deposited+42, testutil.ToFloat64(moneyVolume.WithLabelValues("deposited")))
+	assert.Equal(t, withdrawn+2, testutil.ToFloat64(moneyVolume.WithLabelValues("withdrawn")))
+	assert.Equal(t, snapshots+1, testutil.ToFloat64(snapshotsWritten))
+}
+
+func TestFailedCommitCountsNoMoneyMoved(t *testing.T) {
+	fixture := newInMemoryFixture(t)
+	id := account.NewID()
+	fixture.givenEvents([]eventstore.SequencedEvent{{id, 1, account.AccountOpenedEvent{id, account.NewOwnerID()}}})
+	es1, es2 := fixture.makeEventStream(), fixture.makeEventStream()
+	a1, err := es1.replay(context.Background(), id)
+	assert.NoError(t, err)
+	a2, err := es2.replay(context.Background(), id)
+	assert.NoError(t, err)
+	es1.Append(account.MoneyDepositedEvent{10, 10}, a1, id)
+	assert.NoError(t, es1.commit(context.Background(), uuid.New()))
+	deposited := testutil.ToFloat64(moneyVolume.WithLabelValues("deposited"))
+
+	es2.Append(account.MoneyDepositedEvent{42, 42}, a2, id)
+	assert.Equal(t, account.ConcurrentModification, es2.commit(context.Background(), uuid.New()))
+
+	assert.Equal(t, deposited, testutil.ToFloat64(moneyVolume.WithLabelValues("deposited")))
+}
@@ -0,0 +1,89 @@
+package eventsourcing
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+
+	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/eventstore"
+)
+
+// IdempotencyMiddleware executes transactional commands once per transaction id and records their outcome, together
+// with the events of the command where the store can, so that a command is not left applied without its outcome.
+// Subsequent executions with the same transaction id return the recorded outcome,
+// or a conflict error if they do not match the recorded command.
+func IdempotencyMiddleware(store EventStore) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, cmd Command) error {
+			txCmd, ok := cmd.(transactionalCommand)
+			if !ok {
+				return next(ctx, cmd)
+			}
+
+			stored, err := store.LoadCommandResult(ctx, txCmd.transactionID())
+			if err != nil {
+				return err
+			}
+			if stored != nil {
+				return replay(txCmd, *stored)
+			}
+
+			outcome := eventstore.CommandResult{
+				TransactionId: txCmd.transactionID(),
+				Operation:     txCmd.Name(),
+				Fingerprint:   fingerprint(txCmd),
+			}
+			// a successful outcome is recorded in the same transaction as the events of the command
+			ctx, recorded := eventstore.WithCommandResult(ctx, outcome)
+			err = next(ctx, cmd)
+			if !isFinalOutcome(err) || err == nil && recorded() {
+				return err
+			}
+			// domain errors append no events, nor do commands whose transaction completed before
+			outcome.Error = errorMessage(err)
+			result, storeErr := store.StoreCommandResult(ctx, outcome)
+			if storeErr != nil {
+				return storeErr
+			}
+			// a concurrent execution with the same transaction id might have recorded its result first
+			return replay(txCmd, result)
+		}
+	}
+}
+
+func fingerprint(cmd transactionalCommand) string {
+	h := sha256.Sum256([]byte(cmd.fingerprint()))
+	return hex.EncodeToString(h[:])
+}
+
+func replay(cmd transactionalCommand, result eventstore.CommandResult) error {
+	if result.Operation != cmd.Name() {
+		return account.TransactionConflict
+	}
+	if result.Fingerprint != fingerprint(cmd) {
+		return account.TransactionMismatch
+	}
+	if result.Error != "" {
+		return account.Error(result.Error)
+	}
+	return nil
+}
+
+// isFinalOutcome tells whether the outcome would be the same if the command was retried.
+// Only success and domain errors are final - retrying might get past infrastructure errors and concurrent modifications.
+func isFinalOutcome(err error) bool {
+	if err == nil {
+		return true
+	}
+	var domainErr account.Error
+	return errors.As(err, &domainErr) && domainErr != account.ConcurrentModification
+}
+
+func errorMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
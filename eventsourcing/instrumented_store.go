@@ -0,0 +1,149 @@
+package eventsourcing
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/eventstore"
+)
+
+var eventStoreCallDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name: "event_store_call_duration_seconds",
+	Help: "Time taken by the event store to handle calls by method",
+}, []string{"method"})
+
+// observeStoreCall records how long the store took to handle a call to the method that started at start
+func observeStoreCall(method string, start time.Time) {
+	eventStoreCallDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+// instrumentedStore times each call to the event store that it wraps, so that the stores of the service are observed
+// at their boundary whichever code calls them. It implements the optional interfaces of event stores as well, see
+// capability for telling whether the wrapped store does.
+type instrumentedStore struct {
+	store EventStore
+}
+
+func instrument(store EventStore) EventStore {
+	if _, ok := store.(instrumentedStore); ok {
+		return store
+	}
+	return instrumentedStore{store: store}
+}
+
+// capability returns the store as T if the store, or the store that it instruments, implements T
+func capability[T any](store EventStore) (T, bool) {
+	wrapped := store
+	if s, ok := store.(instrumentedStore); ok {
+		wrapped = s.store
+	}
+	if _, ok := wrapped.(T); !ok {
+		var none T
+		return none, false
+	}
+	capable, ok := store.(T)
+	return capable, ok
+}
+
+func (s instrumentedStore) Events(ctx context.Context, id account.ID, version int) ([]eventstore.SequencedEvent, error) {
+	defer observeStoreCall("Events", time.Now())
+	return s.store.Events(ctx, id, version)
+}
+
+// StreamEvents observes the time taken by the store alone, without the time that handle takes
+func (s instrumentedStore) StreamEvents(ctx context.Context, id account.ID, version int, handle func(eventstore.SequencedEvent) error) error {
+	start := time.Now()
+	var handling time.Duration
+	err := s.store.StreamEvents(ctx, id, version, func(e eventstore.SequencedEvent) error {
+		handleStart := time.Now()
+		defer func() { handling += time.Since(handleStart) }()
+		return handle(e)
+	})
+	eventStoreCallDuration.WithLabelValues("StreamEvents").Observe((time.Since(start) - handling).Seconds())
+	return err
+}
+
+func (s instrumentedStore) TimestampedEvents(ctx context.Context, id account.ID, version int) ([]eventstore.TimestampedEvent, error) {
+	defer observeStoreCall("TimestampedEvents", time.Now())
+	return s.store.TimestampedEvents(ctx, id, version)
+}
+
+func (s instrumentedStore) Append(ctx context.Context, events []eventstore.SequencedEvent, snapshots map[account.ID]eventstore.SequencedEvent, txId uuid.UUID) error {
+	defer observeStoreCall("Append", time.Now())
+	return s.store.Append(ctx, events, snapshots, txId)
+}
+
+func (s instrumentedStore) LoadSnapshot(ctx context.Context, id account.ID) (eventstore.SequencedEvent, error) {
+	defer observeStoreCall("LoadSnapshot", time.Now())
+	return s.store.LoadSnapshot(ctx, id)
+}
+
+func (s instrumentedStore) TransactionExists(ctx context.Context, id account.ID, txId uuid.UUID) (bool, error) {
+	defer observeStoreCall("TransactionExists", time.Now())
+	return s.store.TransactionExists(ctx, id, txId)
+}
+
+func (s instrumentedStore) TransactionParticipants(ctx context.Context, txIds []uuid.UUID) (map[uuid.UUID][]account.ID, error) {
+	defer observeStoreCall("TransactionParticipants", time.Now())
+	return s.store.TransactionParticipants(ctx, txIds)
+}
+
+func (s instrumentedStore) VerifyIntegrity(ctx context.Context, id account.ID) (eventstore.IntegrityReport, error) {
+	defer observeStoreCall("VerifyIntegrity", time.Now())
+	return s.store.VerifyIntegrity(ctx, id)
+}
+
+func (s instrumentedStore) LoadCommandResult(ctx context.Context, txId uuid.UUID) (*eventstore.CommandResult, error) {
+	defer observeStoreCall("LoadCommandResult", time.Now())
+	return s.store.LoadCommandResult(ctx, txId)
+}
+
+func (s instrumentedStore) StoreCommandResult(ctx context.Context, result eventstore.CommandResult) (eventstore.CommandResult, error) {
+	defer observeStoreCall("StoreCommandResult", time.Now())
+	return s.store.StoreCommandResult(ctx, result)
+}
+
+func (s instrumentedStore) LoadAggregate(ctx context.Context, id account.ID, version int, txId uuid.UUID) (eventstore.LoadedAggregate, error) {
+	defer observeStoreCall("LoadAggregate", time.Now())
+	return s.store.(AggregateLoader).LoadAggregate(ctx, id, version, txId)
+}
+
+func (s instrumentedStore) Archive(ctx context.Context, tombstone eventstore.SequencedEvent) error {
+	defer observeStoreCall("Archive", time.Now())
+	return s.store.(Archiver).Archive(ctx, tombstone)
+}
+
+func (s instrumentedStore) SameShard(first, second account.ID) bool {
+	return s.store.(shardedStore).SameShard(first, second)
+}
+
+// instrumentedSagaStore times each call to the saga store that it wraps
+type instrumentedSagaStore struct {
+	store SagaStore
+}
+
+func instrumentSagas(store SagaStore) SagaStore {
+	if _, ok := store.(instrumentedSagaStore); ok {
+		return store
+	}
+	return instrumentedSagaStore{store: store}
+}
+
+func (s instrumentedSagaStore) SagaEvents(ctx context.Context, sagaId uuid.UUID) ([]eventstore.SequencedSagaEvent, error) {
+	defer observeStoreCall("SagaEvents", time.Now())
+	return s.store.SagaEvents(ctx, sagaId)
+}
+
+func (s instrumentedSagaStore) AppendSagaEvents(ctx context.Context, events []eventstore.SequencedSagaEvent) error {
+	defer observeStoreCall("AppendSagaEvents", time.Now())
+	return s.store.AppendSagaEvents(ctx, events)
+}
+
+func (s instrumentedSagaStore) ActiveSagas(ctx context.Context) ([]uuid.UUID, error) {
+	defer observeStoreCall("ActiveSagas", time.Now())
+	return s.store.ActiveSagas(ctx)
+}
@@ -0,0 +1,73 @@
+package eventsourcing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/eventstore"
+	"github.com/stretchr/testify/assert"
+)
+
+func observedStoreCalls(t *testing.T, method string) (uint64, float64) {
+	metric := &dto.Metric{}
+	err := eventStoreCallDuration.WithLabelValues(method).(prometheus.Histogram).Write(metric)
+	assert.NoError(t, err)
+	return metric.GetHistogram().GetSampleCount(), metric.GetHistogram().GetSampleSum()
+}
+
+func TestInstrumentedStore_StreamEventsIsObservedWithoutHandlingTheEvents(t *testing.T) {
+	store := eventstore.NewInMemoryStore()
+	id := account.ID{uuid.New()}
+	err := store.Append(context.Background(), []eventstore.SequencedEvent{
+		{AggregateId: id, Seq: 1, Event: account.AccountOpenedEvent{AccountID: id, OwnerID: account.OwnerID{uuid.New()}}},
+		{AggregateId: id, Seq: 2, Event: account.MoneyDepositedEvent{AmountDeposited: 10, Balance: 10}},
+	}, map[account.ID]eventstore.SequencedEvent{}, uuid.New())
+	assert.NoError(t, err)
+	calls, duration := observedStoreCalls(t, "StreamEvents")
+
+	handled := 0
+	err = instrument(store).StreamEvents(context.Background(), id, 0, func(eventstore.SequencedEvent) error {
+		handled++
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, handled)
+	observedCalls, observedDuration := observedStoreCalls(t, "StreamEvents")
+	assert.Equal(t, calls+1, observedCalls)
+	assert.Less(t, observedDuration-duration, 0.05)
+}
+
+func TestAccountService_QueriesAreObservedAtTheStoreBoundary(t *testing.T) {
+	ctx := context.Background()
+	service := NewAccountService(eventstore.NewInMemoryStore(), 0)
+	id := account.ID{uuid.New()}
+	err := service.OpenAccount(ctx, id, account.OwnerID{uuid.New()})
+	assert.NoError(t, err)
+	calls, _ := observedStoreCalls(t, "Events")
+
+	_, err = service.Events(ctx, id)
+
+	assert.NoError(t, err)
+	observedCalls, _ := observedStoreCalls(t, "Events")
+	assert.Equal(t, calls+1, observedCalls)
+}
+
+func TestInstrumentedStore_HasTheCapabilitiesOfTheStoreItWraps(t *testing.T) {
+	store := instrument(eventstore.NewInMemoryStore())
+
+	archiver, ok := capability[Archiver](store)
+	assert.True(t, ok)
+	assert.Equal(t, store, archiver)
+
+	_, ok = capability[AggregateLoader](store)
+	assert.False(t, ok)
+	_, ok = capability[shardedStore](store)
+	assert.False(t, ok)
+}
@@ -0,0 +1,121 @@
+package eventsourcing
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/internal/telemetry"
+)
+
+var (
+	commandsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "account_commands_total",
+		Help: "Number of dispatched account commands by outcome",
+	}, []string{"command", "outcome"})
+	commandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "account_command_duration_seconds",
+		Help: "Time taken to handle account commands",
+	}, []string{"command"})
+	commandRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "account_command_retries_total",
+		Help: "Number of times account commands were retried after a concurrent modification",
+	}, []string{"command"})
+)
+
+type Authorizer interface {
+	Authorize(ctx context.Context, cmd Command) error
+}
+
+type AuthorizerFunc func(ctx context.Context, cmd Command) error
+
+func (f AuthorizerFunc) Authorize(ctx context.Context, cmd Command) error {
+	return f(ctx, cmd)
+}
+
+func ValidationMiddleware(next Handler) Handler {
+	return func(ctx context.Context, cmd Command) error {
+		if v, ok := cmd.(validatable); ok {
+			if err := v.Validate(); err != nil {
+				return err
+			}
+		}
+		return next(ctx, cmd)
+	}
+}
+
+// LoggingMiddleware logs commands that failed for reasons other than the domain rules
+func LoggingMiddleware(next Handler) Handler {
+	return func(ctx context.Context, cmd Command) error {
+		err := next(ctx, cmd)
+		var domainErr account.Error
+		if err != nil && !errors.As(err, &domainErr) {
+			log.Printf("%s command %+v failed: %v\n", cmd.Name(), cmd, err)
+		}
+		return err
+	}
+}
+
+func MetricsMiddleware(next Handler) Handler {
+	return func(ctx context.Context, cmd Command) error {
+		start := time.Now()
+		err := next(ctx, cmd)
+		commandDuration.WithLabelValues(cmd.Name()).Observe(time.Since(start).Seconds())
+		commandsTotal.WithLabelValues(cmd.Name(), outcome(err)).Inc()
+		return err
+	}
+}
+
+// TracingMiddleware spans the handling of each command, continuing the trace of the context
+func TracingMiddleware(next Handler) Handler {
+	return func(ctx context.Context, cmd Command) error {
+		ctx, span := tracer.StartSpan(ctx, cmd.Name())
+		err := next(ctx, cmd)
+		telemetry.EndSpan(span, err)
+		return err
+	}
+}
+
+func AuthorizationMiddleware(authorizer Authorizer) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, cmd Command) error {
+			if err := authorizer.Authorize(ctx, cmd); err != nil {
+				return err
+			}
+			return next(ctx, cmd)
+		}
+	}
+}
+
+func RetryMiddleware(attempts int) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, cmd Command) error {
+			var err error
+			for try := 0; try < attempts; try++ {
+				if try > 0 {
+					commandRetries.WithLabelValues(cmd.Name()).Inc()
+				}
+				err = next(ctx, cmd)
+				if err != account.ConcurrentModification {
+					return err
+				}
+			}
+			return err
+		}
+	}
+}
+
+func outcome(err error) string {
+	if err == nil {
+		return "success"
+	}
+	var domainErr account.Error
+	if errors.As(err, &domainErr) {
+		return string(domainErr)
+	}
+	return "error"
+}
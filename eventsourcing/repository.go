@@ -5,22 +5,26 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/eventstore"
 )
 
 type repository struct {
 	store             EventStore
 	snapshotFrequency int
+	cache             *AggregateCache
 }
 
 type transaction func(*account.Account) error
 type biTransaction func(*account.Account, *account.Account) error
 
 func NewAccountRepository(es EventStore, snapshotFrequency int) *repository {
-	return &repository{store: es, snapshotFrequency: snapshotFrequency}
+	return &repository{store: instrument(es), snapshotFrequency: snapshotFrequency}
 }
 
 func (r repository) newEventStream() *eventStream {
-	return newEventStream(r.store, r.snapshotFrequency)
+	es := newEventStream(r.store, r.snapshotFrequency)
+	es.cache = r.cache
+	return es
 }
 
 func (r repository) query(ctx context.Context, id account.ID) (*account.Snapshot, error) {
@@ -41,28 +45,23 @@ func (r repository) create(ctx context.Context, id account.ID, tx transaction) e
 }
 
 func (r repository) transact(ctx context.Context, id account.ID, txId uuid.UUID, tx transaction) error {
-	a := r.loadAggregate(ctx, id)
-	if transactionExists, err := r.store.TransactionExists(ctx, id, txId); err != nil || transactionExists {
+	es := r.newEventStream()
+	acc, transactionExists, err := es.replayTransaction(ctx, id, txId)
+	if err != nil || transactionExists {
 		return err
 	}
+	a := aggregate{es: es, acc: acc}
 	return a.transact(ctx, tx, txId)
 }
 
 func (r repository) biTransact(ctx context.Context, sourceId, targetId account.ID, txId uuid.UUID, tx biTransaction) error {
 	es := r.newEventStream()
-	source, err := es.replay(ctx, sourceId)
-	if err != nil {
-		return err
-	}
-	target, err := es.replay(ctx, targetId)
-	if err != nil {
-		return err
-	}
-
-	if transactionExists, err := r.store.TransactionExists(ctx, sourceId, txId); err != nil || transactionExists {
+	source, transactionExists, err := es.replayTransaction(ctx, sourceId, txId)
+	if err != nil || transactionExists {
 		return err
 	}
-	if transactionExists, err := r.store.TransactionExists(ctx, targetId, txId); err != nil || transactionExists {
+	target, transactionExists, err := es.replayTransaction(ctx, targetId, txId)
+	if err != nil || transactionExists {
 		return err
 	}
 
@@ -74,8 +73,12 @@ func (r repository) biTransact(ctx context.Context, sourceId, targetId account.I
 }
 
 func (r repository) aggregateExists(ctx context.Context, id account.ID) (bool, error) {
-	events, err := r.store.Events(ctx, id, 0)
-	return len(events) != 0, err
+	exists := false
+	err := r.store.StreamEvents(ctx, id, 0, func(eventstore.SequencedEvent) error {
+		exists = true
+		return eventstore.StopStreaming
+	})
+	return exists, err
 }
 
 func (r repository) newAggregate(ctx context.Context, id account.ID) (*aggregate, error) {
@@ -0,0 +1,113 @@
+package eventsourcing
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/eventstore"
+)
+
+type SagaStore interface {
+	SagaEvents(ctx context.Context, sagaId uuid.UUID) ([]eventstore.SequencedSagaEvent, error)
+	AppendSagaEvents(ctx context.Context, events []eventstore.SequencedSagaEvent) error
+	ActiveSagas(ctx context.Context) ([]uuid.UUID, error)
+}
+
+// Saga is a long running process that reacts to its own events by issuing commands.
+// The outcome of each command is recorded as the next event so that the process can be resumed from its event stream.
+type Saga interface {
+	// Apply restores the saga state from a recorded event
+	Apply(e eventstore.SagaEvent)
+	// Next performs the next step and returns the event recording its outcome.
+	// An error leaves the saga where it was so that the step is attempted again later.
+	Next(ctx context.Context, now time.Time) (eventstore.SagaEvent, error)
+}
+
+// ProcessManager drives sagas of one kind to completion
+type ProcessManager struct {
+	store   SagaStore
+	newSaga func() Saga
+	now     func() time.Time
+}
+
+func NewProcessManager(store SagaStore, newSaga func() Saga) *ProcessManager {
+	return &ProcessManager{store: instrumentSagas(store), newSaga: newSaga, now: time.Now}
+}
+
+// Start records the first event of a saga and runs it.
+// Starting a saga that has already been started runs the existing one.
+func (pm *ProcessManager) Start(ctx context.Context, sagaId uuid.UUID, started eventstore.SagaEvent) error {
+	err := pm.store.AppendSagaEvents(ctx, []eventstore.SequencedSagaEvent{{SagaId: sagaId, Seq: 1, Event: started}})
+	if err != nil && err != account.ConcurrentModification {
+		return err
+	}
+	return pm.Run(ctx, sagaId)
+}
+
+// Run performs the remaining steps of a saga until it is over or a step fails
+func (pm *ProcessManager) Run(ctx context.Context, sagaId uuid.UUID) error {
+	events, err := pm.store.SagaEvents(ctx, sagaId)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return account.NotFound
+	}
+
+	saga := pm.newSaga()
+	for _, e := range events {
+		saga.Apply(e.Event)
+	}
+	version := len(events)
+	last := events[version-1].Event
+	for !last.Final() {
+		next, err := saga.Next(ctx, pm.now())
+		if err != nil {
+			return err
+		}
+		version++
+		if err := pm.store.AppendSagaEvents(ctx, []eventstore.SequencedSagaEvent{{SagaId: sagaId, Seq: version, Event: next}}); err != nil {
+			return err
+		}
+		saga.Apply(next)
+		last = next
+	}
+	return nil
+}
+
+// Resume runs all sagas that are not over yet, for example after a restart
+func (pm *ProcessManager) Resume(ctx context.Context) error {
+	active, err := pm.store.ActiveSagas(ctx)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, id := range active {
+		if err := pm.Run(ctx, id); err != nil {
+			log.Printf("saga %v did not complete: %v\n", id, err)
+			failed++
+		}
+	}
+	if failed != 0 {
+		return fmt.Errorf("%d of %d sagas did not complete", failed, len(active))
+	}
+	return nil
+}
+
+// Watch resumes active sagas periodically so that their timeouts are noticed until the context is done
+func (pm *ProcessManager) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_ = pm.Resume(ctx)
+		}
+	}
+}
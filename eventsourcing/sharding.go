@@ -0,0 +1,192 @@
+package eventsourcing
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/eventstore"
+)
+
+// CrossShardTransaction is returned when appending events of accounts that live in different shards,
+// such transactions have to be split into steps of a saga
+var CrossShardTransaction = errors.New("transaction spans accounts of more than one shard")
+
+// pointsPerShard is the number of points each shard takes on the ring, the more there are the more evenly
+// accounts are spread across the shards
+const pointsPerShard = 128
+
+// ShardRing locates accounts and transactions in named shards by consistent hashing. Adding a shard to the ring
+// only moves the accounts that the new shard takes over, about one in the number of shards.
+type ShardRing struct {
+	points []uint64
+	shards map[uint64]string
+}
+
+func NewShardRing(names ...string) *ShardRing {
+	if len(names) == 0 {
+		log.Panic("shard ring needs at least one shard")
+	}
+	r := &ShardRing{shards: map[uint64]string{}}
+	for _, name := range names {
+		for i := 0; i < pointsPerShard; i++ {
+			point := ringHash([]byte(name + "#" + strconv.Itoa(i)))
+			if _, taken := r.shards[point]; taken {
+				continue
+			}
+			r.shards[point] = name
+			r.points = append(r.points, point)
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+	return r
+}
+
+func ringHash(key []byte) uint64 {
+	h := sha256.Sum256(key)
+	return binary.BigEndian.Uint64(h[:8])
+}
+
+// locate finds the first point of the ring clockwise from the key's hash
+func (r *ShardRing) locate(key []byte) string {
+	h := ringHash(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.shards[r.points[i]]
+}
+
+// AccountShard names the shard the events and snapshots of the account live in
+func (r *ShardRing) AccountShard(id account.ID) string {
+	return r.locate(id.UUID[:])
+}
+
+// TransactionShard names the shard the command result of the transaction lives in
+func (r *ShardRing) TransactionShard(txId uuid.UUID) string {
+	return r.locate(txId[:])
+}
+
+type Shard struct {
+	Name  string
+	Store EventStore
+}
+
+// ShardedEventStore routes each account to the store of the shard it lives in. Events appended together
+// have to belong to accounts of the same shard - transfers between shards run as sagas, see WithCrossShardTransfers.
+type ShardedEventStore struct {
+	ring   *ShardRing
+	stores map[string]EventStore
+}
+
+func NewShardedEventStore(shards ...Shard) *ShardedEventStore {
+	names := make([]string, 0, len(shards))
+	stores := map[string]EventStore{}
+	for _, shard := range shards {
+		if _, ok := stores[shard.Name]; ok {
+			log.Panicf("duplicate shard %s", shard.Name)
+		}
+		names = append(names, shard.Name)
+		stores[shard.Name] = shard.Store
+	}
+	return &ShardedEventStore{ring: NewShardRing(names...), stores: stores}
+}
+
+// SameShard tells whether both accounts live in the same shard and can take part in the same transaction
+func (s ShardedEventStore) SameShard(first, second account.ID) bool {
+	return s.ring.AccountShard(first) == s.ring.AccountShard(second)
+}
+
+func (s ShardedEventStore) store(id account.ID) EventStore {
+	return s.stores[s.ring.AccountShard(id)]
+}
+
+func (s ShardedEventStore) Events(ctx context.Context, id account.ID, version int) ([]eventstore.SequencedEvent, error) {
+	return s.store(id).Events(ctx, id, version)
+}
+
+func (s ShardedEventStore) StreamEvents(ctx context.Context, id account.ID, version int, handle func(eventstore.SequencedEvent) error) error {
+	return s.store(id).StreamEvents(ctx, id, version, handle)
+}
+
+func (s ShardedEventStore) TimestampedEvents(ctx context.Context, id account.ID, version int) ([]eventstore.TimestampedEvent, error) {
+	return s.store(id).TimestampedEvents(ctx, id, version)
+}
+
+func (s ShardedEventStore) Append(ctx context.Context, events []eventstore.SequencedEvent, snapshots map[account.ID]eventstore.SequencedEvent, txId uuid.UUID) error {
+	shard := ""
+	sameShard := func(id account.ID) bool {
+		if shard == "" {
+			shard = s.ring.AccountShard(id)
+		}
+		return s.ring.AccountShard(id) == shard
+	}
+	for _, e := range events {
+		if !sameShard(e.AggregateId) {
+			return CrossShardTransaction
+		}
+	}
+	for id := range snapshots {
+		if !sameShard(id) {
+			return CrossShardTransaction
+		}
+	}
+	if shard == "" {
+		return nil
+	}
+	if shard != s.ring.TransactionShard(txId) {
+		// the result of the command is kept in the shard of its transaction
+		ctx = eventstore.WithoutCommandResult(ctx)
+	}
+	return s.stores[shard].Append(ctx, events, snapshots, txId)
+}
+
+func (s ShardedEventStore) LoadSnapshot(ctx context.Context, id account.ID) (eventstore.SequencedEvent, error) {
+	return s.store(id).LoadSnapshot(ctx, id)
+}
+
+func (s ShardedEventStore) TransactionExists(ctx context.Context, id account.ID, txId uuid.UUID) (bool, error) {
+	return s.store(id).TransactionExists(ctx, id, txId)
+}
+
+// TransactionParticipants asks every shard as the steps of a cross shard transaction could have touched any of them
+func (s ShardedEventStore) TransactionParticipants(ctx context.Context, txIds []uuid.UUID) (map[uuid.UUID][]account.ID, error) {
+	participants := map[uuid.UUID][]account.ID{}
+	for name, store := range s.stores {
+		shardParticipants, err := store.TransactionParticipants(ctx, txIds)
+		if err != nil {
+			return nil, fmt.Errorf("shard %s: %w", name, err)
+		}
+		for txId, ids := range shardParticipants {
+			participants[txId] = append(participants[txId], ids...)
+		}
+	}
+	return participants, nil
+}
+
+func (s ShardedEventStore) VerifyIntegrity(ctx context.Context, id account.ID) (eventstore.IntegrityReport, error) {
+	return s.store(id).VerifyIntegrity(ctx, id)
+}
+
+func (s ShardedEventStore) Archive(ctx context.Context, tombstone eventstore.SequencedEvent) error {
+	archiver, ok := s.store(tombstone.AggregateId).(Archiver)
+	if !ok {
+		return ArchivalNotSupported
+	}
+	return archiver.Archive(ctx, tombstone)
+}
+
+func (s ShardedEventStore) LoadCommandResult(ctx context.Context, txId uuid.UUID) (*eventstore.CommandResult, error) {
+	return s.stores[s.ring.TransactionShard(txId)].LoadCommandResult(ctx, txId)
+}
+
+func (s ShardedEventStore) StoreCommandResult(ctx context.Context, result eventstore.CommandResult) (eventstore.CommandResult, error) {
+	return s.stores[s.ring.TransactionShard(result.TransactionId)].StoreCommandResult(ctx, result)
+}
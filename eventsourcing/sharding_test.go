@@ -0,0 +1,215 @@
+package eventsourcing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/eventstore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShardRingSpreadsAccountsAcrossShards(t *testing.T) {
+	ring := NewShardRing("a", "b", "c")
+	counts := map[string]int{}
+	for i := 0; i < 3000; i++ {
+		counts[ring.AccountShard(account.NewID())]++
+	}
+
+	assert.Len(t, counts, 3)
+	for shard, count := range counts {
+		assert.Greater(t, count, 600, "shard %s", shard)
+	}
+}
+
+func TestShardRingOnlyMovesAccountsToAddedShard(t *testing.T) {
+	before, after := NewShardRing("a", "b"), NewShardRing("a", "b", "c")
+	moved := 0
+	for i := 0; i < 3000; i++ {
+		id := account.NewID()
+		if before.AccountShard(id) != after.AccountShard(id) {
+			assert.Equal(t, "c", after.AccountShard(id))
+			moved++
+		}
+	}
+
+	assert.Greater(t, moved, 600)
+	assert.Less(t, moved, 1400)
+}
+
+type shardingFixture struct {
+	shards  map[string]EventStore
+	store   *ShardedEventStore
+	service *AccountService
+}
+
+func newShardingFixture(options ...Option) *shardingFixture {
+	f := &shardingFixture{shards: map[string]EventStore{
+		"a": eventstore.NewInMemoryStore(),
+		"b": eventstore.NewInMemoryStore(),
+	}}
+	f.store = NewShardedEventStore(Shard{"a", f.shards["a"]}, Shard{"b", f.shards["b"]})
+	f.service = NewAccountService(f.store, 0, options...)
+	return f
+}
+
+func (f *shardingFixture) openAccount(t *testing.T, balance int64) account.ID {
+	id := account.NewID()
+	assert.NoError(t, f.service.OpenAccount(context.Background(), id, account.NewOwnerID()))
+	if balance != 0 {
+		assert.NoError(t, f.service.Deposit(context.Background(), id, uuid.New(), balance))
+	}
+	return id
+}
+
+// accountsInDifferentShards opens accounts until the second one lands in another shard than the first one
+func (f *shardingFixture) accountsInDifferentShards(t *testing.T, sourceBalance int64) (account.ID, account.ID) {
+	source := f.openAccount(t, sourceBalance)
+	for {
+		target := f.openAccount(t, 0)
+		if !f.store.SameShard(source, target) {
+			return source, target
+		}
+	}
+}
+
+func (f *shardingFixture) assertBalance(t *testing.T, id account.ID, balance int64) {
+	snapshot, err := f.service.QueryAccount(context.Background(), id)
+	assert.NoError(t, err)
+	assert.Equal(t, balance, snapshot.Balance)
+}
+
+func TestShardedStoreKeepsAccountsInTheirShards(t *testing.T) {
+	f := newShardingFixture()
+
+	for i := 0; i < 20; i++ {
+		id := f.openAccount(t, 10)
+
+		for name, shard := range f.shards {
+			events, err := shard.Events(context.Background(), id, 0)
+			assert.NoError(t, err)
+			if name == f.store.ring.AccountShard(id) {
+				assert.Len(t, events, 2)
+			} else {
+				assert.Empty(t, events)
+			}
+		}
+	}
+}
+
+func TestShardedStoreRejectsCrossShardAppend(t *testing.T) {
+	f := newShardingFixture()
+	source, target := f.accountsInDifferentShards(t, 0)
+
+	err := f.store.Append(context.Background(), []eventstore.SequencedEvent{
+		{source, 2, account.MoneyDepositedEvent{1, 1}},
+		{target, 2, account.MoneyDepositedEvent{1, 1}},
+	}, map[account.ID]eventstore.SequencedEvent{}, uuid.New())
+
+	assert.Equal(t, CrossShardTransaction, err)
+}
+
+func TestShardedStoreCollectsTransactionParticipantsOfAllShards(t *testing.T) {
+	f := newShardingFixture()
+	source, target := f.accountsInDifferentShards(t, 0)
+	txId := uuid.New()
+	for _, id := range []account.ID{source, target} {
+		err := f.store.Append(context.Background(), []eventstore.SequencedEvent{
+			{id, 2, account.MoneyDepositedEvent{1, 1}},
+		}, map[account.ID]eventstore.SequencedEvent{}, txId)
+		assert.NoError(t, err)
+	}
+
+	participants, err := f.store.TransactionParticipants(context.Background(), []uuid.UUID{txId, uuid.New()})
+
+	assert.NoError(t, err)
+	assert.Len(t, participants, 1)
+	assert.ElementsMatch(t, []account.ID{source, target}, participants[txId])
+}
+
+func TestTransferAcrossShards(t *testing.T) {
+	f := newShardingFixture(WithCrossShardTransfers(eventstore.NewInMemorySagaStore(), time.Minute))
+	source, target := f.accountsInDifferentShards(t, 100)
+
+	err := f.service.Transfer(context.Background(), source, target, uuid.New(), 40)
+
+	assert.NoError(t, err)
+	f.assertBalance(t, source, 60)
+	f.assertBalance(t, target, 40)
+}
+
+func TestTransferAcrossShardsIsIdempotent(t *testing.T) {
+	f := newShardingFixture(WithCrossShardTransfers(eventstore.NewInMemorySagaStore(), time.Minute))
+	source, target := f.accountsInDifferentShards(t, 100)
+	txId := uuid.New()
+
+	assert.NoError(t, f.service.Transfer(context.Background(), source, target, txId, 40))
+	assert.NoError(t, f.service.Transfer(context.Background(), source, target, txId, 40))
+
+	f.assertBalance(t, source, 60)
+	f.assertBalance(t, target, 40)
+}
+
+func TestTransferAcrossShardsFailsWithInsufficientBalance(t *testing.T) {
+	f := newShardingFixture(WithCrossShardTransfers(eventstore.NewInMemorySagaStore(), time.Minute))
+	source, target := f.accountsInDifferentShards(t, 10)
+
+	err := f.service.Transfer(context.Background(), source, target, uuid.New(), 11)
+
+	assert.Equal(t, account.InsufficientBalance, err)
+	f.assertBalance(t, source, 10)
+	f.assertBalance(t, target, 0)
+}
+
+func TestTransferAcrossShardsToMissingAccountIsRefunded(t *testing.T) {
+	f := newShardingFixture(WithCrossShardTransfers(eventstore.NewInMemorySagaStore(), time.Minute))
+	source := f.openAccount(t, 10)
+	target := account.NewID()
+	for f.store.SameShard(source, target) {
+		target = account.NewID()
+	}
+
+	err := f.service.Transfer(context.Background(), source, target, uuid.New(), 3)
+
+	assert.Equal(t, account.NotFound, err)
+	f.assertBalance(t, source, 10)
+}
+
+func TestTransferAcrossShardsRequiresSagas(t *testing.T) {
+	f := newShardingFixture()
+	source, target := f.accountsInDifferentShards(t, 10)
+
+	err := f.service.Transfer(context.Background(), source, target, uuid.New(), 1)
+
+	assert.Equal(t, CrossShardTransaction, err)
+	f.assertBalance(t, source, 10)
+}
+
+// racingSagaStore fails the steps of sagas after their start as if another process kept taking them while it races
+type racingSagaStore struct {
+	SagaStore
+	racing bool
+}
+
+func (s *racingSagaStore) AppendSagaEvents(ctx context.Context, events []eventstore.SequencedSagaEvent) error {
+	if s.racing && events[0].Seq > 1 {
+		return account.ConcurrentModification
+	}
+	return s.SagaStore.AppendSagaEvents(ctx, events)
+}
+
+func TestTransferAcrossShardsLosingRacesIsLeftToResume(t *testing.T) {
+	sagas := &racingSagaStore{SagaStore: eventstore.NewInMemorySagaStore(), racing: true}
+	f := newShardingFixture(WithCrossShardTransfers(sagas, time.Minute))
+	source, target := f.accountsInDifferentShards(t, 100)
+
+	err := f.service.Transfer(context.Background(), source, target, uuid.New(), 40)
+
+	assert.Equal(t, account.ConcurrentModification, err)
+	sagas.racing = false
+	assert.NoError(t, f.service.ResumeTransfers(context.Background()))
+	f.assertBalance(t, source, 60)
+	f.assertBalance(t, target, 40)
+}
@@ -0,0 +1,172 @@
+package eventsourcing
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/eventstore"
+	"github.com/rieske/event-sourced-account-go/internal/telemetry"
+)
+
+const (
+	DepositEntry     = "deposit"
+	WithdrawalEntry  = "withdrawal"
+	TransferInEntry  = "transfer in"
+	TransferOutEntry = "transfer out"
+)
+
+// Statement lists the money movements of an account within [From, To)
+// together with the balances before and after the period.
+type Statement struct {
+	AccountID      account.ID       `json:"accountId"`
+	From           time.Time        `json:"from"`
+	To             time.Time        `json:"to"`
+	OpeningBalance int64            `json:"openingBalance"`
+	Transactions   []StatementEntry `json:"transactions"`
+	ClosingBalance int64            `json:"closingBalance"`
+}
+
+type StatementEntry struct {
+	Seq           int         `json:"seq"`
+	Timestamp     time.Time   `json:"timestamp"`
+	TransactionID uuid.UUID   `json:"transactionId"`
+	Type          string      `json:"type"`
+	Amount        int64       `json:"amount"`
+	Balance       int64       `json:"balance"`
+	Counterparty  *account.ID `json:"counterparty,omitempty"`
+}
+
+// counterpartyResolver maps the transactions to their counterparties, leaving out those without one
+type counterpartyResolver func(txIds []uuid.UUID) (map[uuid.UUID]account.ID, error)
+
+func (s AccountService) Statement(ctx context.Context, id account.ID, from, to time.Time) (_ *Statement, err error) {
+	ctx, span := tracer.StartSpan(ctx, "Statement", telemetry.AccountAttribute(id))
+	defer func() { telemetry.EndSpan(span, err) }()
+
+	events, err := s.queries.store.TimestampedEvents(ctx, id, 0)
+	if err != nil {
+		return nil, err
+	}
+	return buildStatement(id, from, to, events, s.transactionCounterparties(ctx, id))
+}
+
+// transactionCounterparties resolves the other accounts taking part in the same transactions - only transfers have one.
+func (s AccountService) transactionCounterparties(ctx context.Context, id account.ID) counterpartyResolver {
+	return func(txIds []uuid.UUID) (map[uuid.UUID]account.ID, error) {
+		participants, err := s.queries.store.TransactionParticipants(ctx, txIds)
+		if err != nil {
+			return nil, err
+		}
+		counterparties := map[uuid.UUID]account.ID{}
+		for txId, ids := range participants {
+			for _, participant := range ids {
+				if participant != id {
+					counterparties[txId] = participant
+					break
+				}
+			}
+		}
+		return counterparties, nil
+	}
+}
+
+func buildStatement(id account.ID, from, to time.Time, events []eventstore.TimestampedEvent, counterparties counterpartyResolver) (*Statement, error) {
+	if len(events) == 0 {
+		return nil, account.NotFound
+	}
+
+	statement := Statement{AccountID: id, From: from, To: to, Transactions: []StatementEntry{}}
+	var balance int64
+	// streams written before transfers had their own events only reveal the counterparty via the transaction,
+	// the entries are resolved all at once after the events are read
+	var unresolved []int
+	var unresolvedTransactions []uuid.UUID
+	for _, e := range events {
+		if !e.Timestamp.Before(to) {
+			break
+		}
+		amount, newBalance, ok := balanceChange(e.Event)
+		if !ok {
+			continue
+		}
+		balance = newBalance
+		if e.Timestamp.Before(from) {
+			statement.OpeningBalance = balance
+			continue
+		}
+
+		entry := StatementEntry{
+			Seq:           e.Seq,
+			Timestamp:     e.Timestamp,
+			TransactionID: e.TransactionId,
+			Amount:        amount,
+			Balance:       balance,
+		}
+		if cp, ok := transferCounterparty(e.Event); ok {
+			entry.Counterparty = cp
+		} else {
+			unresolved = append(unresolved, len(statement.Transactions))
+			unresolvedTransactions = append(unresolvedTransactions, e.TransactionId)
+		}
+		entry.Type = entryType(amount, entry.Counterparty)
+		statement.Transactions = append(statement.Transactions, entry)
+	}
+	statement.ClosingBalance = balance
+
+	if len(unresolved) != 0 {
+		resolved, err := counterparties(unresolvedTransactions)
+		if err != nil {
+			return nil, err
+		}
+		for _, i := range unresolved {
+			entry := &statement.Transactions[i]
+			if cp, ok := resolved[entry.TransactionID]; ok {
+				entry.Counterparty = &cp
+				entry.Type = entryType(entry.Amount, entry.Counterparty)
+			}
+		}
+	}
+
+	return &statement, nil
+}
+
+func balanceChange(event account.Event) (amount int64, balance int64, ok bool) {
+	switch e := event.(type) {
+	case account.MoneyDepositedEvent:
+		return e.AmountDeposited, e.Balance, true
+	case account.MoneyWithdrawnEvent:
+		return -e.AmountWithdrawn, e.Balance, true
+	case account.TransferReceivedEvent:
+		return e.AmountTransferred, e.Balance, true
+	case account.TransferSentEvent:
+		return -e.AmountTransferred, e.Balance, true
+	default:
+		return 0, 0, false
+	}
+}
+
+func transferCounterparty(event account.Event) (*account.ID, bool) {
+	switch e := event.(type) {
+	case account.TransferReceivedEvent:
+		return &e.SourceAccountID, true
+	case account.TransferSentEvent:
+		return &e.TargetAccountID, true
+	default:
+		return nil, false
+	}
+}
+
+func entryType(amount int64, counterparty *account.ID) string {
+	switch {
+	case counterparty != nil && amount < 0:
+		return TransferOutEntry
+	case counterparty != nil:
+		return TransferInEntry
+	case amount < 0:
+		return WithdrawalEntry
+	default:
+		return DepositEntry
+	}
+}
@@ -0,0 +1,118 @@
+package eventsourcing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/eventstore"
+	"github.com/stretchr/testify/assert"
+)
+
+func timestamped(e eventstore.SequencedEvent, txId uuid.UUID, timestamp time.Time) eventstore.TimestampedEvent {
+	return eventstore.TimestampedEvent{SequencedEvent: e, TransactionId: txId, Timestamp: timestamp}
+}
+
+func noCounterparty(txIds []uuid.UUID) (map[uuid.UUID]account.ID, error) {
+	return nil, nil
+}
+
+func day(d int) time.Time {
+	return time.Date(2020, time.March, d, 12, 0, 0, 0, time.UTC)
+}
+
+func TestStatementOfNonExistentAccount(t *testing.T) {
+	statement, err := buildStatement(account.NewID(), day(1), day(2), nil, noCounterparty)
+
+	assert.Nil(t, statement)
+	assert.Equal(t, account.NotFound, err)
+}
+
+func TestStatementWithinPeriod(t *testing.T) {
+	id, ownerID := account.NewID(), account.NewOwnerID()
+	depositTx, withdrawalTx := uuid.New(), uuid.New()
+	events := []eventstore.TimestampedEvent{
+		timestamped(eventstore.SequencedEvent{id, 1, account.AccountOpenedEvent{id, ownerID}}, uuid.New(), day(1)),
+		timestamped(eventstore.SequencedEvent{id, 2, account.MoneyDepositedEvent{100, 100}}, uuid.New(), day(2)),
+		timestamped(eventstore.SequencedEvent{id, 3, account.MoneyDepositedEvent{20, 120}}, depositTx, day(3)),
+		timestamped(eventstore.SequencedEvent{id, 4, account.MoneyWithdrawnEvent{50, 70}}, withdrawalTx, day(4)),
+		timestamped(eventstore.SequencedEvent{id, 5, account.MoneyDepositedEvent{1, 71}}, uuid.New(), day(5)),
+	}
+
+	statement, err := buildStatement(id, day(3), day(5), events, noCounterparty)
+
+	assert.NoError(t, err)
+	assert.Equal(t, &Statement{
+		AccountID:      id,
+		From:           day(3),
+		To:             day(5),
+		OpeningBalance: 100,
+		Transactions: []StatementEntry{
+			{Seq: 3, Timestamp: day(3), TransactionID: depositTx, Type: DepositEntry, Amount: 20, Balance: 120},
+			{Seq: 4, Timestamp: day(4), TransactionID: withdrawalTx, Type: WithdrawalEntry, Amount: -50, Balance: 70},
+		},
+		ClosingBalance: 70,
+	}, statement)
+}
+
+func TestStatementWithoutTransactionsInPeriod(t *testing.T) {
+	id, ownerID := account.NewID(), account.NewOwnerID()
+	events := []eventstore.TimestampedEvent{
+		timestamped(eventstore.SequencedEvent{id, 1, account.AccountOpenedEvent{id, ownerID}}, uuid.New(), day(1)),
+		timestamped(eventstore.SequencedEvent{id, 2, account.MoneyDepositedEvent{100, 100}}, uuid.New(), day(2)),
+	}
+
+	statement, err := buildStatement(id, day(10), day(20), events, noCounterparty)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100), statement.OpeningBalance)
+	assert.Empty(t, statement.Transactions)
+	assert.Equal(t, int64(100), statement.ClosingBalance)
+}
+
+func TestStatementResolvesTransferCounterpartiesAtOnce(t *testing.T) {
+	id, ownerID, sender, recipient := account.NewID(), account.NewOwnerID(), account.NewID(), account.NewID()
+	depositTx, transferInTx, transferOutTx := uuid.New(), uuid.New(), uuid.New()
+	events := []eventstore.TimestampedEvent{
+		timestamped(eventstore.SequencedEvent{id, 1, account.AccountOpenedEvent{id, ownerID}}, uuid.New(), day(1)),
+		timestamped(eventstore.SequencedEvent{id, 2, account.MoneyDepositedEvent{100, 100}}, depositTx, day(2)),
+		timestamped(eventstore.SequencedEvent{id, 3, account.MoneyDepositedEvent{10, 110}}, transferInTx, day(3)),
+		timestamped(eventstore.SequencedEvent{id, 4, account.MoneyWithdrawnEvent{30, 80}}, transferOutTx, day(3)),
+	}
+	var resolved [][]uuid.UUID
+	resolver := func(txIds []uuid.UUID) (map[uuid.UUID]account.ID, error) {
+		resolved = append(resolved, txIds)
+		return map[uuid.UUID]account.ID{transferInTx: sender, transferOutTx: recipient}, nil
+	}
+
+	statement, err := buildStatement(id, day(1), day(4), events, resolver)
+
+	assert.NoError(t, err)
+	assert.Equal(t, [][]uuid.UUID{{depositTx, transferInTx, transferOutTx}}, resolved)
+	assert.Len(t, statement.Transactions, 3)
+	assert.Equal(t, DepositEntry, statement.Transactions[0].Type)
+	assert.Nil(t, statement.Transactions[0].Counterparty)
+	assert.Equal(t, TransferInEntry, statement.Transactions[1].Type)
+	assert.Equal(t, &sender, statement.Transactions[1].Counterparty)
+	assert.Equal(t, TransferOutEntry, statement.Transactions[2].Type)
+	assert.Equal(t, &recipient, statement.Transactions[2].Counterparty)
+}
+
+func TestStatementWithTransferEventsResolvesNoCounterparties(t *testing.T) {
+	id, ownerID, counterparty := account.NewID(), account.NewOwnerID(), account.NewID()
+	events := []eventstore.TimestampedEvent{
+		timestamped(eventstore.SequencedEvent{id, 1, account.AccountOpenedEvent{id, ownerID}}, uuid.New(), day(1)),
+		timestamped(eventstore.SequencedEvent{id, 2, account.TransferReceivedEvent{uuid.New(), counterparty, 100, 100}}, uuid.New(), day(2)),
+	}
+	resolver := func(txIds []uuid.UUID) (map[uuid.UUID]account.ID, error) {
+		t.Fatalf("resolved %v", txIds)
+		return nil, nil
+	}
+
+	statement, err := buildStatement(id, day(1), day(4), events, resolver)
+
+	assert.NoError(t, err)
+	assert.Equal(t, TransferInEntry, statement.Transactions[0].Type)
+	assert.Equal(t, &counterparty, statement.Transactions[0].Counterparty)
+}
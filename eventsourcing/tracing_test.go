@@ -0,0 +1,102 @@
+package eventsourcing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/eventstore"
+	"github.com/rieske/event-sourced-account-go/internal/telemetry"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// spans records the spans of all the tests, the global tracer provider can only be installed once
+var spans = tracetest.NewSpanRecorder()
+
+func init() {
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+}
+
+// traced runs the operation within a trace of its own and returns the spans that it ended
+func traced(operation func(ctx context.Context)) []sdktrace.ReadOnlySpan {
+	ctx, root := otel.Tracer("test").Start(context.Background(), "test")
+	operation(ctx)
+	root.End()
+
+	var traceSpans []sdktrace.ReadOnlySpan
+	for _, span := range spans.Ended() {
+		if span.SpanContext().TraceID() == root.SpanContext().TraceID() && span.SpanContext().SpanID() != root.SpanContext().SpanID() {
+			traceSpans = append(traceSpans, span)
+		}
+	}
+	return traceSpans
+}
+
+func spanNamed(spans []sdktrace.ReadOnlySpan, name string) sdktrace.ReadOnlySpan {
+	for _, span := range spans {
+		if span.Name() == name {
+			return span
+		}
+	}
+	return nil
+}
+
+func TestCommandsAreTracedThroughTheEventStream(t *testing.T) {
+	service := NewAccountService(eventstore.NewInMemoryStore(), 0)
+	id := account.NewID()
+	assert.NoError(t, service.OpenAccount(context.Background(), id, account.NewOwnerID()))
+
+	traceSpans := traced(func(ctx context.Context) {
+		assert.NoError(t, service.Deposit(ctx, id, uuid.New(), 42))
+	})
+
+	deposit := spanNamed(traceSpans, "deposit")
+	if !assert.NotNil(t, deposit) {
+		return
+	}
+	assert.Equal(t, codes.Unset, deposit.Status().Code)
+	for _, name := range []string{"eventStream.replayTransaction", "eventStream.commit"} {
+		span := spanNamed(traceSpans, name)
+		if assert.NotNil(t, span, name) {
+			assert.Equal(t, deposit.SpanContext().SpanID(), span.Parent().SpanID(), name)
+		}
+	}
+}
+
+func TestDomainErrorsDoNotFailSpans(t *testing.T) {
+	service := NewAccountService(eventstore.NewInMemoryStore(), 0)
+	id := account.NewID()
+	assert.NoError(t, service.OpenAccount(context.Background(), id, account.NewOwnerID()))
+
+	traceSpans := traced(func(ctx context.Context) {
+		assert.Equal(t, account.InsufficientBalance, service.Withdraw(ctx, id, uuid.New(), 42))
+	})
+
+	withdraw := spanNamed(traceSpans, "withdraw")
+	if assert.NotNil(t, withdraw) {
+		assert.Equal(t, codes.Unset, withdraw.Status().Code)
+		assert.Len(t, withdraw.Events(), 1)
+	}
+}
+
+func TestQueriesOfMissingAccountsAreTraced(t *testing.T) {
+	service := NewAccountService(eventstore.NewInMemoryStore(), 0)
+	id := account.NewID()
+
+	traceSpans := traced(func(ctx context.Context) {
+		_, err := service.QueryAccount(ctx, id)
+		assert.Equal(t, account.NotFound, err)
+	})
+
+	query := spanNamed(traceSpans, "QueryAccount")
+	if assert.NotNil(t, query) {
+		assert.Contains(t, query.Attributes(), telemetry.AccountAttribute(id))
+		assert.Equal(t, trace.SpanKindInternal, query.SpanKind())
+	}
+}
@@ -0,0 +1,246 @@
+package eventsourcing
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/eventstore"
+)
+
+const transferTimedOut = "transfer timed out"
+
+// transferAttempts bounds how many times a transfer is run in a row when its steps lose races, WatchTransfers
+// completes the transfers that run out of attempts
+const transferAttempts = 3
+
+type TransferStarted struct {
+	TransferID      uuid.UUID
+	SourceAccountID account.ID
+	TargetAccountID account.ID
+	Amount          int64
+	Deadline        time.Time
+}
+
+// TransferDebited records that the money has left the source account
+type TransferDebited struct{}
+
+// TransferCredited records that the money has arrived to the target account
+type TransferCredited struct{}
+
+// TransferRejected records that the money could not leave the source account
+type TransferRejected struct {
+	Reason string
+}
+
+// TransferCreditFailed records that the money could not arrive to the target account and has to be refunded
+type TransferCreditFailed struct {
+	Reason string
+}
+
+// TransferCompensated records that the money has been refunded to the source account
+type TransferCompensated struct{}
+
+// TransferCompensationFailed records that the refund was not possible and the transfer needs manual attention
+type TransferCompensationFailed struct {
+	Reason string
+}
+
+func (e TransferStarted) Final() bool            { return false }
+func (e TransferDebited) Final() bool            { return false }
+func (e TransferCredited) Final() bool           { return true }
+func (e TransferRejected) Final() bool           { return true }
+func (e TransferCreditFailed) Final() bool       { return false }
+func (e TransferCompensated) Final() bool        { return true }
+func (e TransferCompensationFailed) Final() bool { return true }
+
+// TransferSagaEvents names the events of transfer sagas in saga stores that serialize them
+var TransferSagaEvents = eventstore.SagaEventTypes{
+	"TransferStarted":            TransferStarted{},
+	"TransferDebited":            TransferDebited{},
+	"TransferCredited":           TransferCredited{},
+	"TransferRejected":           TransferRejected{},
+	"TransferCreditFailed":       TransferCreditFailed{},
+	"TransferCompensated":        TransferCompensated{},
+	"TransferCompensationFailed": TransferCompensationFailed{},
+}
+
+// AccountServiceResolver returns the service that owns the given account
+type AccountServiceResolver func(id account.ID) *AccountService
+
+// transferSaga withdraws the money from the source account and then deposits it to the target account,
+// refunding the source account if the deposit fails or does not happen before the deadline.
+// Each step is executed with a transaction id derived from the transfer id, so repeating a step has no effect.
+type transferSaga struct {
+	services     AccountServiceResolver
+	started      TransferStarted
+	debited      bool
+	creditFailed bool
+}
+
+// NewTransferProcessManager creates a process manager for transfers between accounts that may live in different stores
+func NewTransferProcessManager(store SagaStore, services AccountServiceResolver) *ProcessManager {
+	return NewProcessManager(store, func() Saga {
+		return &transferSaga{services: services}
+	})
+}
+
+// StartTransfer starts a transfer saga identified by the transfer id that has to complete within the timeout
+func StartTransfer(ctx context.Context, pm *ProcessManager, sourceAccountId, targetAccountId account.ID, transferId uuid.UUID, amount int64, timeout time.Duration) error {
+	if sourceAccountId == targetAccountId {
+		return account.SelfTransfer
+	}
+	if err := requireTransactionID(transferId); err != nil {
+		return err
+	}
+	return pm.Start(ctx, transferId, TransferStarted{
+		TransferID:      transferId,
+		SourceAccountID: sourceAccountId,
+		TargetAccountID: targetAccountId,
+		Amount:          amount,
+		Deadline:        pm.now().Add(timeout),
+	})
+}
+
+// shardedStore is implemented by stores that keep accounts in shards that can not share a transaction
+type shardedStore interface {
+	SameShard(first, second account.ID) bool
+}
+
+func (s AccountService) acrossShards(sourceAccountId, targetAccountId account.ID) bool {
+	sharded, ok := capability[shardedStore](s.repo.store)
+	return ok && !sharded.SameShard(sourceAccountId, targetAccountId)
+}
+
+// transferAcrossShards runs the transfer as a saga and returns its outcome as if it was a single transaction
+func (s AccountService) transferAcrossShards(ctx context.Context, c Transfer) error {
+	if s.transfers == nil {
+		return CrossShardTransaction
+	}
+	err := StartTransfer(ctx, s.transfers, c.SourceAccountID, c.TargetAccountID, c.TransactionID, c.Amount, s.transferTimeout)
+	// the steps are idempotent - a step that lost a race is attempted again rather than leaving the transfer half done
+	for attempt := 1; err == account.ConcurrentModification && attempt < transferAttempts; attempt++ {
+		err = s.transfers.Run(ctx, c.TransactionID)
+	}
+	if err != nil {
+		return err
+	}
+	events, err := s.transfers.store.SagaEvents(ctx, c.TransactionID)
+	if err != nil {
+		return err
+	}
+	return transferOutcome(events)
+}
+
+// transferOutcome is nil if the money arrived to the target account, otherwise the reason why it did not
+func transferOutcome(events []eventstore.SequencedSagaEvent) error {
+	var reason string
+	for _, e := range events {
+		switch e := e.Event.(type) {
+		case TransferCredited:
+			return nil
+		case TransferRejected:
+			reason = e.Reason
+		case TransferCreditFailed:
+			reason = e.Reason
+		case TransferCompensationFailed:
+			reason = e.Reason
+		}
+	}
+	return account.Error(reason)
+}
+
+func (s *transferSaga) Apply(e eventstore.SagaEvent) {
+	switch e := e.(type) {
+	case TransferStarted:
+		s.started = e
+	case TransferDebited:
+		s.debited = true
+	case TransferCreditFailed:
+		s.creditFailed = true
+	}
+}
+
+func (s *transferSaga) Next(ctx context.Context, now time.Time) (eventstore.SagaEvent, error) {
+	switch {
+	case !s.debited:
+		return s.debit(ctx)
+	case !s.creditFailed:
+		return s.credit(ctx, now)
+	default:
+		return s.refund(ctx)
+	}
+}
+
+// debit is not bound by the deadline either - an earlier attempt might still be debiting the account, and only
+// debiting it with the same transaction id tells for sure whether the money left it. A transfer debited after the
+// deadline is refunded as its credit times out.
+func (s *transferSaga) debit(ctx context.Context) (eventstore.SagaEvent, error) {
+	source := s.services(s.started.SourceAccountID)
+	txId := s.stepTransactionID("debit")
+	err := source.Dispatch(ctx, SendTransfer{
+		AccountID:       s.started.SourceAccountID,
+		TargetAccountID: s.started.TargetAccountID,
+		TransferID:      s.started.TransferID,
+		TransactionID:   txId,
+		Amount:          s.started.Amount,
+	})
+	if err == nil {
+		return TransferDebited{}, nil
+	}
+	if isFinalOutcome(err) {
+		return TransferRejected{err.Error()}, nil
+	}
+	return nil, err
+}
+
+func (s *transferSaga) credit(ctx context.Context, now time.Time) (eventstore.SagaEvent, error) {
+	target := s.services(s.started.TargetAccountID)
+	txId := s.stepTransactionID("credit")
+	if now.After(s.started.Deadline) {
+		// an earlier attempt might have credited the account without recording it in the saga
+		credited, err := target.repo.store.TransactionExists(ctx, s.started.TargetAccountID, txId)
+		if err != nil {
+			return nil, err
+		}
+		if credited {
+			return TransferCredited{}, nil
+		}
+		return TransferCreditFailed{transferTimedOut}, nil
+	}
+	err := target.Dispatch(ctx, ReceiveTransfer{
+		AccountID:       s.started.TargetAccountID,
+		SourceAccountID: s.started.SourceAccountID,
+		TransferID:      s.started.TransferID,
+		TransactionID:   txId,
+		Amount:          s.started.Amount,
+	})
+	if err == nil {
+		return TransferCredited{}, nil
+	}
+	if isFinalOutcome(err) {
+		return TransferCreditFailed{err.Error()}, nil
+	}
+	return nil, err
+}
+
+// refund is not bound by the deadline - the money has already left the source account and has to be returned
+func (s *transferSaga) refund(ctx context.Context) (eventstore.SagaEvent, error) {
+	err := s.services(s.started.SourceAccountID).Dispatch(ctx, Deposit{
+		AccountID:     s.started.SourceAccountID,
+		TransactionID: s.stepTransactionID("refund"),
+		Amount:        s.started.Amount,
+	})
+	if err == nil {
+		return TransferCompensated{}, nil
+	}
+	if isFinalOutcome(err) {
+		return TransferCompensationFailed{err.Error()}, nil
+	}
+	return nil, err
+}
+
+func (s *transferSaga) stepTransactionID(step string) uuid.UUID {
+	return uuid.NewSHA1(s.started.TransferID, []byte(step))
+}
@@ -0,0 +1,235 @@
+package eventsourcing
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/eventstore"
+	"github.com/stretchr/testify/assert"
+)
+
+var errStoreUnavailable = errors.New("store unavailable")
+
+// unavailableStore fails appends while it is down
+type unavailableStore struct {
+	EventStore
+	down bool
+}
+
+func (s *unavailableStore) Append(ctx context.Context, events []eventstore.SequencedEvent, snapshots map[account.ID]eventstore.SequencedEvent, txId uuid.UUID) error {
+	if s.down {
+		return errStoreUnavailable
+	}
+	return s.EventStore.Append(ctx, events, snapshots, txId)
+}
+
+type transferFixture struct {
+	source, target               *AccountService
+	targetStore                  *unavailableStore
+	sagas                        SagaStore
+	sourceAccount, targetAccount account.ID
+}
+
+func newTransferFixture(t *testing.T) *transferFixture {
+	f := &transferFixture{
+		source:        NewAccountService(eventstore.NewInMemoryStore(), 0),
+		targetStore:   &unavailableStore{EventStore: eventstore.NewInMemoryStore()},
+		sagas:         eventstore.NewInMemorySagaStore(),
+		sourceAccount: account.NewID(),
+		targetAccount: account.NewID(),
+	}
+	f.target = NewAccountService(f.targetStore, 0)
+
+	ctx := context.Background()
+	assert.NoError(t, f.source.OpenAccount(ctx, f.sourceAccount, account.NewOwnerID()))
+	assert.NoError(t, f.source.Deposit(ctx, f.sourceAccount, uuid.New(), 100))
+	assert.NoError(t, f.target.OpenAccount(ctx, f.targetAccount, account.NewOwnerID()))
+	return f
+}
+
+func (f *transferFixture) processManager() *ProcessManager {
+	return NewTransferProcessManager(f.sagas, func(id account.ID) *AccountService {
+		if id == f.sourceAccount {
+			return f.source
+		}
+		return f.target
+	})
+}
+
+func (f *transferFixture) assertBalances(t *testing.T, source, target int64) {
+	snapshot, err := f.source.QueryAccount(context.Background(), f.sourceAccount)
+	assert.NoError(t, err)
+	assert.Equal(t, source, snapshot.Balance)
+	snapshot, err = f.target.QueryAccount(context.Background(), f.targetAccount)
+	assert.NoError(t, err)
+	assert.Equal(t, target, snapshot.Balance)
+}
+
+func (f *transferFixture) lastSagaEvent(t *testing.T, sagaId uuid.UUID) eventstore.SagaEvent {
+	events, err := f.sagas.SagaEvents(context.Background(), sagaId)
+	assert.NoError(t, err)
+	return events[len(events)-1].Event
+}
+
+func TestTransferSagaMovesMoneyAcrossStores(t *testing.T) {
+	f := newTransferFixture(t)
+	transferId := uuid.New()
+
+	err := StartTransfer(context.Background(), f.processManager(), f.sourceAccount, f.targetAccount, transferId, 40, time.Minute)
+
+	assert.NoError(t, err)
+	f.assertBalances(t, 60, 40)
+	assert.Equal(t, TransferCredited{}, f.lastSagaEvent(t, transferId))
+}
+
+func TestTransferSagaIsNotRepeated(t *testing.T) {
+	f := newTransferFixture(t)
+	pm := f.processManager()
+	transferId := uuid.New()
+
+	assert.NoError(t, StartTransfer(context.Background(), pm, f.sourceAccount, f.targetAccount, transferId, 40, time.Minute))
+	assert.NoError(t, StartTransfer(context.Background(), pm, f.sourceAccount, f.targetAccount, transferId, 40, time.Minute))
+
+	f.assertBalances(t, 60, 40)
+}
+
+func TestTransferSagaRejectsInsufficientFunds(t *testing.T) {
+	f := newTransferFixture(t)
+	transferId := uuid.New()
+
+	err := StartTransfer(context.Background(), f.processManager(), f.sourceAccount, f.targetAccount, transferId, 101, time.Minute)
+
+	assert.NoError(t, err)
+	f.assertBalances(t, 100, 0)
+	assert.Equal(t, TransferRejected{string(account.InsufficientBalance)}, f.lastSagaEvent(t, transferId))
+}
+
+func TestTransferSagaRefundsWhenTargetAccountDoesNotExist(t *testing.T) {
+	f := newTransferFixture(t)
+	f.targetAccount = account.NewID()
+	transferId := uuid.New()
+
+	err := StartTransfer(context.Background(), f.processManager(), f.sourceAccount, f.targetAccount, transferId, 40, time.Minute)
+
+	assert.NoError(t, err)
+	snapshot, err := f.source.QueryAccount(context.Background(), f.sourceAccount)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100), snapshot.Balance)
+	assert.Equal(t, TransferCompensated{}, f.lastSagaEvent(t, transferId))
+}
+
+func TestTransferSagaResumesAfterRestart(t *testing.T) {
+	f := newTransferFixture(t)
+	transferId := uuid.New()
+	f.targetStore.down = true
+
+	err := StartTransfer(context.Background(), f.processManager(), f.sourceAccount, f.targetAccount, transferId, 40, time.Minute)
+
+	assert.Equal(t, errStoreUnavailable, err)
+	f.assertBalances(t, 60, 0)
+	assert.Equal(t, TransferDebited{}, f.lastSagaEvent(t, transferId))
+
+	f.targetStore.down = false
+	err = f.processManager().Resume(context.Background())
+
+	assert.NoError(t, err)
+	f.assertBalances(t, 60, 40)
+	assert.Equal(t, TransferCredited{}, f.lastSagaEvent(t, transferId))
+	active, err := f.sagas.ActiveSagas(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, active)
+}
+
+func TestTransferSagaRefundsAfterTimeout(t *testing.T) {
+	f := newTransferFixture(t)
+	transferId := uuid.New()
+	f.targetStore.down = true
+	pm := f.processManager()
+
+	assert.Error(t, StartTransfer(context.Background(), pm, f.sourceAccount, f.targetAccount, transferId, 40, time.Minute))
+
+	pm.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	err := pm.Resume(context.Background())
+
+	assert.NoError(t, err)
+	f.targetStore.down = false
+	f.assertBalances(t, 100, 0)
+	assert.Equal(t, TransferCompensated{}, f.lastSagaEvent(t, transferId))
+}
+
+func TestTransferSagaDoesNotRefundCreditedTransferAfterTimeout(t *testing.T) {
+	f := newTransferFixture(t)
+	transferId := uuid.New()
+	pm := f.processManager()
+	saga := pm.newSaga()
+	started := TransferStarted{transferId, f.sourceAccount, f.targetAccount, 40, time.Now().Add(time.Minute)}
+	saga.Apply(started)
+	saga.Apply(TransferDebited{})
+	assert.NoError(t, f.sagas.AppendSagaEvents(context.Background(), []eventstore.SequencedSagaEvent{{transferId, 1, started}}))
+	// the process stopped after crediting the target account but before recording it
+	_, err := saga.Next(context.Background(), time.Now())
+	assert.NoError(t, err)
+	assert.NoError(t, f.sagas.AppendSagaEvents(context.Background(), []eventstore.SequencedSagaEvent{{transferId, 2, TransferDebited{}}}))
+
+	pm.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	assert.NoError(t, pm.Resume(context.Background()))
+
+	assert.Equal(t, TransferCredited{}, f.lastSagaEvent(t, transferId))
+}
+
+// startedTransfer records a transfer that did not run any of its steps yet and a saga that is about to debit it
+func (f *transferFixture) startedTransfer(t *testing.T, pm *ProcessManager, transferId uuid.UUID) Saga {
+	started := TransferStarted{transferId, f.sourceAccount, f.targetAccount, 40, time.Now().Add(time.Minute)}
+	assert.NoError(t, f.sagas.AppendSagaEvents(context.Background(), []eventstore.SequencedSagaEvent{{SagaId: transferId, Seq: 1, Event: started}}))
+	saga := pm.newSaga()
+	saga.Apply(started)
+	return saga
+}
+
+func TestTransferSagaTimingOutBeforeDebitFencesLateDebit(t *testing.T) {
+	f := newTransferFixture(t)
+	transferId := uuid.New()
+	pm := f.processManager()
+	late := f.startedTransfer(t, pm, transferId)
+
+	pm.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	assert.NoError(t, pm.Resume(context.Background()))
+	// the attempt that was debiting when the transfer timed out completes after it was refunded
+	next, err := late.Next(context.Background(), time.Now())
+
+	assert.NoError(t, err)
+	assert.Equal(t, TransferDebited{}, next)
+	err = f.sagas.AppendSagaEvents(context.Background(), []eventstore.SequencedSagaEvent{{SagaId: transferId, Seq: 2, Event: next}})
+	assert.Equal(t, account.ConcurrentModification, err)
+	f.assertBalances(t, 100, 0)
+	assert.Equal(t, TransferCompensated{}, f.lastSagaEvent(t, transferId))
+}
+
+func TestTransferSagaRefundsDebitThatCompletedAfterTimeout(t *testing.T) {
+	f := newTransferFixture(t)
+	transferId := uuid.New()
+	pm := f.processManager()
+	late := f.startedTransfer(t, pm, transferId)
+	// the attempt that was debiting when the transfer timed out completes before it is resumed, without recording it
+	_, err := late.Next(context.Background(), time.Now())
+	assert.NoError(t, err)
+	f.assertBalances(t, 60, 0)
+
+	pm.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	assert.NoError(t, pm.Resume(context.Background()))
+
+	f.assertBalances(t, 100, 0)
+	assert.Equal(t, TransferCompensated{}, f.lastSagaEvent(t, transferId))
+}
+
+func TestStartTransferRejectsSelfTransfer(t *testing.T) {
+	f := newTransferFixture(t)
+
+	err := StartTransfer(context.Background(), f.processManager(), f.sourceAccount, f.sourceAccount, uuid.New(), 1, time.Minute)
+
+	assert.Equal(t, account.SelfTransfer, err)
+}
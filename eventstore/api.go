@@ -1,9 +1,81 @@
 package eventstore
 
-import "github.com/rieske/event-sourced-account-go/account"
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rieske/event-sourced-account-go/account"
+)
+
+// StopStreaming can be returned by the handler of streamed events to stop reading without an error
+var StopStreaming = errors.New("stop streaming")
 
 type SequencedEvent struct {
 	AggregateId account.ID
 	Seq         int
 	Event       account.Event
 }
+
+// TimestampedEvent is a SequencedEvent together with the transaction that produced it
+// and the time it was appended to the store.
+type TimestampedEvent struct {
+	SequencedEvent
+	TransactionId uuid.UUID
+	Timestamp     time.Time
+}
+
+// LoadedAggregate is what a command on an aggregate needs, read in one go: the latest snapshot unless the caller
+// already had a newer version, the events that follow and whether the command's transaction already touched the aggregate
+type LoadedAggregate struct {
+	// Snapshot has no Event if there is no newer snapshot
+	Snapshot          SequencedEvent
+	Events            []SequencedEvent
+	TransactionExists bool
+}
+
+// CommandResult is the recorded outcome of a command, keyed by its transaction id.
+// Fingerprint identifies the command parameters and Error is empty if the command succeeded.
+type CommandResult struct {
+	TransactionId uuid.UUID
+	Operation     string
+	Fingerprint   string
+	Error         string
+}
+
+// SagaEvent records a step taken by a long running process
+type SagaEvent interface {
+	// Final tells whether the process is over once the event happened
+	Final() bool
+}
+
+type SequencedSagaEvent struct {
+	SagaId uuid.UUID
+	Seq    int
+	Event  SagaEvent
+}
+
+// IntegrityReport is the outcome of verifying the hash chain of an aggregate's events
+type IntegrityReport struct {
+	AggregateId account.ID
+	// Events is the number of events in the chain
+	Events int
+	// BrokenAt is the sequence number of the first event that does not match its hash or does not follow
+	// the previous event, 0 if the chain is intact
+	BrokenAt int
+}
+
+func (r IntegrityReport) Intact() bool {
+	return r.BrokenAt == 0
+}
+
+// IntegrityViolation is returned when reading events from a broken hash chain in strict mode
+type IntegrityViolation struct {
+	AggregateId account.ID
+	Seq         int
+}
+
+func (e IntegrityViolation) Error() string {
+	return fmt.Sprintf("hash chain of aggregate %v is broken at event %d", e.AggregateId, e.Seq)
+}
@@ -0,0 +1,43 @@
+package eventstore
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+type pendingCommandResultKey struct{}
+
+// pendingCommandResult is the outcome of a command that is recorded together with the events the command appends
+type pendingCommandResult struct {
+	result   CommandResult
+	recorded bool
+}
+
+// WithCommandResult makes an Append within the returned context record the result in the same transaction as the
+// events, when they are appended with the result's transaction id. The returned function tells whether it was recorded -
+// the result has to be stored on its own otherwise, for example when the command appended no events.
+func WithCommandResult(ctx context.Context, result CommandResult) (context.Context, func() bool) {
+	pending := &pendingCommandResult{result: result}
+	return context.WithValue(ctx, pendingCommandResultKey{}, pending), func() bool {
+		return pending.recorded
+	}
+}
+
+// WithoutCommandResult keeps an Append within the returned context from recording a result, for stores that can not
+// record it in the same transaction as the events
+func WithoutCommandResult(ctx context.Context) context.Context {
+	return context.WithValue(ctx, pendingCommandResultKey{}, (*pendingCommandResult)(nil))
+}
+
+// PendingCommandResult returns the result to record together with the events of the transaction, if any, and the
+// function to call once it was recorded
+func PendingCommandResult(ctx context.Context, txId uuid.UUID) (*CommandResult, func()) {
+	pending, _ := ctx.Value(pendingCommandResultKey{}).(*pendingCommandResult)
+	if pending == nil || pending.result.TransactionId != txId {
+		return nil, func() {}
+	}
+	return &pending.result, func() {
+		pending.recorded = true
+	}
+}
@@ -3,15 +3,17 @@ package eventstore
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/rieske/event-sourced-account-go/account"
 )
 
 type inmemoryStore struct {
-	events       []SequencedEvent
+	events       []TimestampedEvent
 	snapshots    map[account.ID]SequencedEvent
 	transactions map[account.ID][]uuid.UUID
+	results      map[uuid.UUID]CommandResult
 	mutex        sync.RWMutex
 }
 
@@ -19,11 +21,45 @@ func NewInMemoryStore() *inmemoryStore {
 	return &inmemoryStore{
 		snapshots:    map[account.ID]SequencedEvent{},
 		transactions: map[account.ID][]uuid.UUID{},
+		results:      map[uuid.UUID]CommandResult{},
 	}
 }
 
 func (es *inmemoryStore) Events(ctx context.Context, id account.ID, version int) ([]SequencedEvent, error) {
 	events := make([]SequencedEvent, 0, len(es.events))
+	for _, e := range es.events {
+		if e.AggregateId == id && e.Seq > version {
+			events = append(events, e.SequencedEvent)
+		}
+	}
+	return events, nil
+}
+
+// StreamEvents hands the events of the aggregate following the version to handle one at a time
+func (es *inmemoryStore) StreamEvents(ctx context.Context, id account.ID, version int, handle func(SequencedEvent) error) error {
+	es.mutex.RLock()
+	// events are only ever appended, the ones seen here stay as they are
+	events := es.events
+	es.mutex.RUnlock()
+
+	for _, e := range events {
+		if e.AggregateId == id && e.Seq > version {
+			if err := handle(e.SequencedEvent); err != nil {
+				if err == StopStreaming {
+					return nil
+				}
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (es *inmemoryStore) TimestampedEvents(ctx context.Context, id account.ID, version int) ([]TimestampedEvent, error) {
+	es.mutex.RLock()
+	defer es.mutex.RUnlock()
+
+	events := make([]TimestampedEvent, 0, len(es.events))
 	for _, e := range es.events {
 		if e.AggregateId == id && e.Seq > version {
 			events = append(events, e)
@@ -32,6 +68,35 @@ func (es *inmemoryStore) Events(ctx context.Context, id account.ID, version int)
 	return events, nil
 }
 
+// VerifyIntegrity reports the chain of events in memory as intact - they can not be edited past the store
+func (es *inmemoryStore) VerifyIntegrity(ctx context.Context, id account.ID) (IntegrityReport, error) {
+	es.mutex.RLock()
+	defer es.mutex.RUnlock()
+
+	report := IntegrityReport{AggregateId: id}
+	for _, e := range es.events {
+		if e.AggregateId == id {
+			report.Events++
+		}
+	}
+	return report, nil
+}
+
+func (es *inmemoryStore) TransactionParticipants(ctx context.Context, txIds []uuid.UUID) (map[uuid.UUID][]account.ID, error) {
+	es.mutex.RLock()
+	defer es.mutex.RUnlock()
+
+	participants := map[uuid.UUID][]account.ID{}
+	for id, transactions := range es.transactions {
+		for _, txId := range txIds {
+			if transactionExists, _ := es.transactionExists(transactions, txId); transactionExists {
+				participants[txId] = append(participants[txId], id)
+			}
+		}
+	}
+	return participants, nil
+}
+
 func (es *inmemoryStore) LoadSnapshot(ctx context.Context, id account.ID) (SequencedEvent, error) {
 	es.mutex.RLock()
 	defer es.mutex.RUnlock()
@@ -46,6 +111,41 @@ func (es *inmemoryStore) TransactionExists(ctx context.Context, id account.ID, t
 	return es.transactionExists(es.transactions[id], txId)
 }
 
+// Archive keeps the tombstone as the snapshot of the aggregate. There is no colder storage than memory,
+// so the events stay where they are.
+func (es *inmemoryStore) Archive(ctx context.Context, tombstone SequencedEvent) error {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+
+	if tombstone.Seq != es.latestVersion(tombstone.AggregateId) {
+		return account.ConcurrentModification
+	}
+	es.snapshots[tombstone.AggregateId] = tombstone
+	return nil
+}
+
+func (es *inmemoryStore) LoadCommandResult(ctx context.Context, txId uuid.UUID) (*CommandResult, error) {
+	es.mutex.RLock()
+	defer es.mutex.RUnlock()
+
+	if result, ok := es.results[txId]; ok {
+		return &result, nil
+	}
+	return nil, nil
+}
+
+// StoreCommandResult records the result unless one already exists for the transaction and returns the recorded one
+func (es *inmemoryStore) StoreCommandResult(ctx context.Context, result CommandResult) (CommandResult, error) {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+
+	if existing, ok := es.results[result.TransactionId]; ok {
+		return existing, nil
+	}
+	es.results[result.TransactionId] = result
+	return result, nil
+}
+
 // the mutex here simulates what a persistence engine of choice should do - ensure consistency
 // Events can only be written in sequence per aggregate.
 // One way to ensure this in RDB - primary key on (aggregateId, sequenceNumber)
@@ -59,13 +159,20 @@ func (es *inmemoryStore) Append(ctx context.Context, events []SequencedEvent, sn
 		return err
 	}
 
+	timestamp := time.Now().UTC()
 	for _, e := range events {
-		es.events = append(es.events, e)
+		es.events = append(es.events, TimestampedEvent{SequencedEvent: e, TransactionId: txId, Timestamp: timestamp})
 		es.transactions[e.AggregateId] = append(es.transactions[e.AggregateId], txId)
 	}
 	for id, snapshot := range snapshots {
 		es.snapshots[id] = snapshot
 	}
+	if result, recorded := PendingCommandResult(ctx, txId); result != nil {
+		if _, ok := es.results[txId]; !ok {
+			es.results[txId] = *result
+		}
+		recorded()
+	}
 	return nil
 }
 
@@ -0,0 +1,62 @@
+package eventstore
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/rieske/event-sourced-account-go/account"
+)
+
+type inmemorySagaStore struct {
+	events map[uuid.UUID][]SequencedSagaEvent
+	mutex  sync.RWMutex
+}
+
+func NewInMemorySagaStore() *inmemorySagaStore {
+	return &inmemorySagaStore{events: map[uuid.UUID][]SequencedSagaEvent{}}
+}
+
+func (s *inmemorySagaStore) SagaEvents(ctx context.Context, sagaId uuid.UUID) ([]SequencedSagaEvent, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	events := make([]SequencedSagaEvent, len(s.events[sagaId]))
+	copy(events, s.events[sagaId])
+	return events, nil
+}
+
+// AppendSagaEvents writes events in sequence per saga, either all or none of them
+func (s *inmemorySagaStore) AppendSagaEvents(ctx context.Context, events []SequencedSagaEvent) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	versions := map[uuid.UUID]int{}
+	for _, e := range events {
+		version, ok := versions[e.SagaId]
+		if !ok {
+			version = len(s.events[e.SagaId])
+		}
+		if e.Seq != version+1 {
+			return account.ConcurrentModification
+		}
+		versions[e.SagaId] = e.Seq
+	}
+	for _, e := range events {
+		s.events[e.SagaId] = append(s.events[e.SagaId], e)
+	}
+	return nil
+}
+
+func (s *inmemorySagaStore) ActiveSagas(ctx context.Context) ([]uuid.UUID, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var active []uuid.UUID
+	for id, events := range s.events {
+		if len(events) != 0 && !events[len(events)-1].Event.Final() {
+			active = append(active, id)
+		}
+	}
+	return active, nil
+}
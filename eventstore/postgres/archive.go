@@ -0,0 +1,73 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/eventstore"
+)
+
+const (
+	selectArchivedEventsSql = "SELECT sequenceNumber, transactionId, hash, eventType, schemaVersion, serializerId, " + payloadColumn + " FROM EventArchive " +
+		"WHERE aggregateId = $1 AND sequenceNumber >= $2 ORDER BY sequenceNumber ASC LIMIT $3"
+	selectArchivedTimestampedEventsSql = "SELECT sequenceNumber, transactionId, createdAt, eventType, schemaVersion, serializerId, " + payloadColumn + " FROM EventArchive " +
+		"WHERE aggregateId = $1 AND sequenceNumber > $2 ORDER BY sequenceNumber ASC"
+
+	// the events are moved in one statement so that exactly the deleted ones are archived,
+	// the highest archived sequence number tells whether the tombstone is still the latest state
+	archiveEventsSql = "WITH moved AS (DELETE FROM Event WHERE aggregateId = $1 RETURNING *), " +
+		"archived AS (INSERT INTO EventArchive SELECT * FROM moved RETURNING sequenceNumber) " +
+		"SELECT COALESCE(max(sequenceNumber), 0) FROM archived"
+
+	// aggregates whose latest event is of the closing type and older than the cutoff
+	selectClosedAggregatesSql = "SELECT e.aggregateId FROM Event e " +
+		"WHERE e.eventType = $1 AND e.createdAt < $2 AND e.aggregateId > $3 " +
+		"AND NOT EXISTS (SELECT 1 FROM Event l WHERE l.aggregateId = e.aggregateId AND l.sequenceNumber > e.sequenceNumber) " +
+		"ORDER BY e.aggregateId LIMIT $4"
+)
+
+// Archive moves the events of the aggregate from the Event table to the EventArchive table and stores the tombstone
+// as its snapshot, in one transaction. The tombstone has to be the state at the latest event, otherwise nothing is
+// moved and account.ConcurrentModification is returned. Archiving an aggregate that has no events left in the
+// Event table does nothing. Archived events are read back, re-encrypted and rechained like the others.
+func (es EventStore) Archive(ctx context.Context, tombstone eventstore.SerializedEvent) error {
+	return withTransaction(ctx, es.db, func(tx *sql.Tx) error {
+		var archivedVersion int
+		if err := tx.StmtContext(ctx, es.archiveEventsStmt).QueryRowContext(ctx, tombstone.AggregateId).Scan(&archivedVersion); err != nil {
+			return err
+		}
+		if archivedVersion == 0 {
+			return nil
+		}
+		if archivedVersion != tombstone.Seq {
+			return account.ConcurrentModification
+		}
+		return es.updateSnapshots(ctx, tx, []eventstore.SerializedEvent{tombstone})
+	})
+}
+
+// ClosedAggregates lists up to limit ids of aggregates, in order and starting after the given one, whose latest event
+// is of the closing event type and was appended before the cutoff
+func (es EventStore) ClosedAggregates(ctx context.Context, closingEventType int, cutoff time.Time, after account.ID, limit int) ([]account.ID, error) {
+	var ids []account.ID
+
+	err := sqlSelect(
+		ctx,
+		es.selectClosedAggregatesStmt,
+		func(rows *sql.Rows) error {
+			for rows.Next() {
+				var id account.ID
+				if err := rows.Scan(&id); err != nil {
+					return err
+				}
+				ids = append(ids, id)
+			}
+			return nil
+		},
+		closingEventType, cutoff, after, limit,
+	)
+
+	return ids, err
+}
@@ -0,0 +1,72 @@
+// +build integration
+
+package postgres_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/eventsourcing"
+	"github.com/rieske/event-sourced-account-go/eventstore"
+	"github.com/rieske/event-sourced-account-go/eventstore/postgres"
+	"github.com/rieske/event-sourced-account-go/serialization"
+	"github.com/rieske/event-sourced-account-go/test"
+)
+
+func BenchmarkPostgresConsistency(b *testing.B) {
+	eventStore := eventstore.NewSerializingEventStore(store, serialization.NewMsgpackEventSerializer())
+	test.RunConsistencyBenchmarks(b, 8, eventsourcing.NewAccountService(eventStore, 5))
+}
+
+func BenchmarkPostgresSingleRoundTripConsistency(b *testing.B) {
+	eventStore := eventstore.NewSerializingAggregateStore(postgres.NewSingleRoundTripEventStore(database), serialization.NewMsgpackEventSerializer())
+	test.RunConsistencyBenchmarks(b, 8, eventsourcing.NewAccountService(eventStore, 5))
+}
+
+// BenchmarkPostgresDeposit compares the latency of a single deposit, one at a time, of the default store and the one
+// using a single round trip per read and append
+func BenchmarkPostgresDeposit(b *testing.B) {
+	stores := []struct {
+		name  string
+		store eventsourcing.EventStore
+	}{
+		{"default", eventstore.NewSerializingEventStore(store, serialization.NewMsgpackEventSerializer())},
+		{"single-round-trip", eventstore.NewSerializingAggregateStore(postgres.NewSingleRoundTripEventStore(database), serialization.NewMsgpackEventSerializer())},
+	}
+	for _, s := range stores {
+		b.Run(s.name, func(b *testing.B) {
+			ctx := context.Background()
+			service := eventsourcing.NewAccountService(s.store, 5)
+			id := account.NewID()
+			if err := service.OpenAccount(ctx, id, account.NewOwnerID()); err != nil {
+				b.Fatal(err)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := service.Deposit(ctx, id, uuid.New(), 1); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkPostgresAppend(b *testing.B) {
+	for _, batchSize := range []int{1, 10, 100} {
+		b.Run(fmt.Sprintf("events=%d", batchSize), func(b *testing.B) {
+			events := make([]eventstore.SerializedEvent, batchSize)
+			for i := 0; i < b.N; i++ {
+				id := account.NewID()
+				for j := range events {
+					events[j] = eventstore.SerializedEvent{AggregateId: id, Seq: j + 1, Payload: []byte("benchmark"), EventType: 1, SchemaVersion: 1, SerializerId: 1}
+				}
+				if err := store.Append(context.Background(), events, events[batchSize-1:], uuid.New()); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package postgres
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"errors"
@@ -17,23 +18,104 @@ import (
 )
 
 type EventStore struct {
-	db                    *sql.DB
-	selectEventsStmt      *sql.Stmt
-	selectSnapshotStmt    *sql.Stmt
-	selectTransactionStmt *sql.Stmt
-	storeSnapshotStmt     *sql.Stmt
-	appendEventStmt       *sql.Stmt
+	db                                  *sql.DB
+	selectEventsStmt                    *sql.Stmt
+	selectTimestampedEventsStmt         *sql.Stmt
+	selectSnapshotStmt                  *sql.Stmt
+	selectTransactionStmt               *sql.Stmt
+	selectTransactionParticipantsStmt   *sql.Stmt
+	storeSnapshotStmt                   *sql.Stmt
+	appendEventStmt                     *sql.Stmt
+	selectCommandResultStmt             *sql.Stmt
+	storeCommandResultStmt              *sql.Stmt
+	selectSnapshotPayloadsStmt          *sql.Stmt
+	updateSnapshotPayloadStmt           *sql.Stmt
+	selectAggregatesStmt                *sql.Stmt
+	selectArchivedEventsStmt            *sql.Stmt
+	selectArchivedTimestampedEventsStmt *sql.Stmt
+	archiveEventsStmt                   *sql.Stmt
+	selectClosedAggregatesStmt          *sql.Stmt
+	eventTable                          eventTable
+	archiveTable                        eventTable
+	jsonb                               bool
+	strictIntegrity                     bool
+	// primary is the store that reads fall back to when this one reads from a lagging replica
+	primary *EventStore
+	// selectPrimaryVersionStmt reads the latest version of an aggregate from the primary
+	selectPrimaryVersionStmt *sql.Stmt
 }
 
+// errReplicaLags is returned when the replica does not have the event that reading is requested to follow yet
+var errReplicaLags = errors.New("replica lags behind the requested version")
+
 const (
-	appendEventSql  = "INSERT INTO Event(aggregateId, sequenceNumber, transactionId, eventType, payload) VALUES($1, $2, $3, $4, $5)"
-	selectEventsSql = "SELECT sequenceNumber, eventType, payload FROM Event WHERE aggregateId = $1 AND sequenceNumber > $2 ORDER BY sequenceNumber ASC"
+	// payloads are stored either as bytes or as JSONB and are read back as bytes regardless
+	payloadColumn = "COALESCE(payload, convert_to(jsonPayload::text, 'UTF8'))"
+
+	// events are appended with one statement per transaction. The hash of an event chains it to the previous event of
+	// the aggregate, see chainHash - events that follow each other within the batch are chained by the statement itself
+	// as they are not visible to it in the table yet
+	appendEventsSql = "WITH RECURSIVE batch AS (" +
+		"SELECT * FROM unnest($1::uuid[], $2::bigint[], $4::integer[], $5::integer[], $6::smallint[], $7::%[1]s[]) " +
+		"AS b(aggregateId, sequenceNumber, eventType, schemaVersion, serializerId, payload)" +
+		"), chain AS (" +
+		"SELECT b.*, sha256(COALESCE((SELECT hash FROM Event e WHERE e.aggregateId = b.aggregateId AND e.sequenceNumber = b.sequenceNumber - 1), '') || " +
+		"int8send(b.sequenceNumber) || uuid_send($3::uuid) || %[2]s) AS hash FROM batch b " +
+		"WHERE NOT EXISTS (SELECT 1 FROM batch p WHERE p.aggregateId = b.aggregateId AND p.sequenceNumber = b.sequenceNumber - 1) " +
+		"UNION ALL " +
+		"SELECT b.*, sha256(c.hash || int8send(b.sequenceNumber) || uuid_send($3::uuid) || %[2]s) " +
+		"FROM batch b JOIN chain c ON b.aggregateId = c.aggregateId AND b.sequenceNumber = c.sequenceNumber + 1" +
+		") " +
+		"INSERT INTO Event(aggregateId, sequenceNumber, transactionId, eventType, schemaVersion, serializerId, %[3]s, hash) " +
+		"SELECT aggregateId, sequenceNumber, $3::uuid, eventType, schemaVersion, serializerId, payload, hash FROM chain"
+	// the event at the requested version is read as well to anchor the hash chain of the following ones
+	selectEventsSql = "SELECT sequenceNumber, transactionId, hash, eventType, schemaVersion, serializerId, " + payloadColumn + " FROM Event " +
+		"WHERE aggregateId = $1 AND sequenceNumber >= $2 ORDER BY sequenceNumber ASC LIMIT $3"
+	selectChainForUpdateSql = "SELECT sequenceNumber, transactionId, hash, eventType, schemaVersion, serializerId, " + payloadColumn + " FROM %[1]s " +
+		"WHERE aggregateId = $1 AND sequenceNumber >= $2 ORDER BY sequenceNumber ASC FOR UPDATE"
+
+	selectTimestampedEventsSql = "SELECT sequenceNumber, transactionId, createdAt, eventType, schemaVersion, serializerId, " + payloadColumn + " FROM Event " +
+		"WHERE aggregateId = $1 AND sequenceNumber > $2 ORDER BY sequenceNumber ASC"
+
+	storeSnapshotsSql = "INSERT INTO Snapshot(aggregateId, sequenceNumber, eventType, schemaVersion, serializerId, payload) " +
+		"SELECT * FROM unnest($1::uuid[], $2::bigint[], $3::integer[], $4::integer[], $5::smallint[], $6::bytea[]) " +
+		"ON CONFLICT (aggregateId) DO UPDATE SET sequenceNumber=EXCLUDED.sequenceNumber, eventType=EXCLUDED.eventType, " +
+		"schemaVersion=EXCLUDED.schemaVersion, serializerId=EXCLUDED.serializerId, payload=EXCLUDED.payload, jsonPayload=NULL"
+	storeJsonbSnapshotsSql = "INSERT INTO Snapshot(aggregateId, sequenceNumber, eventType, schemaVersion, serializerId, jsonPayload) " +
+		"SELECT * FROM unnest($1::uuid[], $2::bigint[], $3::integer[], $4::integer[], $5::smallint[], $6::jsonb[]) " +
+		"ON CONFLICT (aggregateId) DO UPDATE SET sequenceNumber=EXCLUDED.sequenceNumber, eventType=EXCLUDED.eventType, " +
+		"schemaVersion=EXCLUDED.schemaVersion, serializerId=EXCLUDED.serializerId, payload=NULL, jsonPayload=EXCLUDED.jsonPayload"
+	selectSnapshotSql = "SELECT sequenceNumber, eventType, schemaVersion, serializerId, " + payloadColumn + " FROM Snapshot WHERE aggregateId = $1"
+
+	selectTransactionSql = "SELECT aggregateId FROM Event WHERE aggregateId = $1 AND transactionId = $2 " +
+		"UNION ALL SELECT aggregateId FROM EventArchive WHERE aggregateId = $1 AND transactionId = $2 LIMIT 1"
+
+	selectTransactionParticipantsSql = "SELECT transactionId, aggregateId FROM Event WHERE transactionId = ANY($1::uuid[]) " +
+		"UNION SELECT transactionId, aggregateId FROM EventArchive WHERE transactionId = ANY($1::uuid[])"
+
+	selectCommandResultSql = "SELECT operation, fingerprint, error FROM CommandResult WHERE transactionId = $1"
+	storeCommandResultSql  = "INSERT INTO CommandResult(transactionId, operation, fingerprint, error) VALUES($1, $2, $3, $4) " +
+		"ON CONFLICT (transactionId) DO NOTHING"
+
+	// binary payloads are paged through by their keys to be rewritten in place, events both in the Event and the
+	// EventArchive table
+	selectEventPayloadsSql = "SELECT aggregateId, sequenceNumber, eventType, schemaVersion, serializerId, payload FROM %[1]s " +
+		"WHERE payload IS NOT NULL AND (aggregateId, sequenceNumber) > ($1, $2) ORDER BY aggregateId, sequenceNumber LIMIT $3"
+	selectSnapshotPayloadsSql = "SELECT aggregateId, sequenceNumber, eventType, schemaVersion, serializerId, payload FROM Snapshot " +
+		"WHERE payload IS NOT NULL AND aggregateId > $1 ORDER BY aggregateId LIMIT $2"
+	updateEventPayloadSql    = "UPDATE %[1]s SET payload = $3, hash = $4 WHERE aggregateId = $1 AND sequenceNumber = $2"
+	updateEventHashSql       = "UPDATE %[1]s SET hash = $3 WHERE aggregateId = $1 AND sequenceNumber = $2"
+	updateSnapshotPayloadSql = "UPDATE Snapshot SET payload = $3 WHERE aggregateId = $1 AND sequenceNumber = $2 AND payload = $4"
 
-	storeSnapshotSql = "INSERT INTO Snapshot(aggregateId, sequenceNumber, eventType, payload) VALUES($1, $2, $3, $4) " +
-		"ON CONFLICT (aggregateId) DO UPDATE SET sequenceNumber=$2, eventType=$3, payload=$4"
-	selectSnapshotSql = "SELECT sequenceNumber, eventType, payload FROM Snapshot WHERE aggregateId = $1"
+	selectPrimaryVersionSql = "SELECT GREATEST(" +
+		"(SELECT COALESCE(max(sequenceNumber), 0) FROM Event WHERE aggregateId = $1), " +
+		"(SELECT COALESCE(max(sequenceNumber), 0) FROM EventArchive WHERE aggregateId = $1))"
 
-	selectTransactionSql = "SELECT aggregateId FROM Event WHERE aggregateId = $1 AND transactionId = $2"
+	selectAggregatesSql = "SELECT aggregateId FROM Event WHERE aggregateId > $1 " +
+		"UNION SELECT aggregateId FROM EventArchive WHERE aggregateId > $1 ORDER BY aggregateId LIMIT $2"
+
+	rewritePageSize = 100
+	streamPageSize  = 500
 )
 
 func MigrateSchema(db *sql.DB, schemaLocation string) {
@@ -46,19 +128,88 @@ func MigrateSchema(db *sql.DB, schemaLocation string) {
 		log.Panic(err)
 	}
 
-	if err := m.Migrate(2); err != nil && err != migrate.ErrNoChange {
+	if err := m.Migrate(SchemaVersion); err != nil && err != migrate.ErrNoChange {
 		log.Panic(err)
 	}
 }
 
 func NewEventStore(db *sql.DB) *EventStore {
+	return newEventStore(db, false)
+}
+
+// NewJsonbEventStore creates a store that keeps payloads in a JSONB column, where they can be queried with SQL.
+// The payloads have to be serialized as JSON.
+func NewJsonbEventStore(db *sql.DB) *EventStore {
+	return newEventStore(db, true)
+}
+
+func newEventStore(db *sql.DB, jsonb bool) *EventStore {
+	appendSql, snapshotSql := fmt.Sprintf(appendEventsSql, "bytea", "b.payload", "payload"), storeSnapshotsSql
+	if jsonb {
+		appendSql, snapshotSql = fmt.Sprintf(appendEventsSql, "jsonb", "convert_to(b.payload::text, 'UTF8')", "jsonPayload"), storeJsonbSnapshotsSql
+	}
 	return &EventStore{
-		db:                    db,
-		selectEventsStmt:      prepareStatementOrPanic(db, selectEventsSql),
-		selectSnapshotStmt:    prepareStatementOrPanic(db, selectSnapshotSql),
-		selectTransactionStmt: prepareStatementOrPanic(db, selectTransactionSql),
-		storeSnapshotStmt:     prepareStatementOrPanic(db, storeSnapshotSql),
-		appendEventStmt:       prepareStatementOrPanic(db, appendEventSql),
+		db:                                  db,
+		selectEventsStmt:                    prepareStatementOrPanic(db, selectEventsSql),
+		selectTimestampedEventsStmt:         prepareStatementOrPanic(db, selectTimestampedEventsSql),
+		selectSnapshotStmt:                  prepareStatementOrPanic(db, selectSnapshotSql),
+		selectTransactionStmt:               prepareStatementOrPanic(db, selectTransactionSql),
+		selectTransactionParticipantsStmt:   prepareStatementOrPanic(db, selectTransactionParticipantsSql),
+		storeSnapshotStmt:                   prepareStatementOrPanic(db, snapshotSql),
+		appendEventStmt:                     prepareStatementOrPanic(db, appendSql),
+		selectCommandResultStmt:             prepareStatementOrPanic(db, selectCommandResultSql),
+		storeCommandResultStmt:              prepareStatementOrPanic(db, storeCommandResultSql),
+		selectSnapshotPayloadsStmt:          prepareStatementOrPanic(db, selectSnapshotPayloadsSql),
+		updateSnapshotPayloadStmt:           prepareStatementOrPanic(db, updateSnapshotPayloadSql),
+		selectAggregatesStmt:                prepareStatementOrPanic(db, selectAggregatesSql),
+		selectArchivedEventsStmt:            prepareStatementOrPanic(db, selectArchivedEventsSql),
+		selectArchivedTimestampedEventsStmt: prepareStatementOrPanic(db, selectArchivedTimestampedEventsSql),
+		archiveEventsStmt:                   prepareStatementOrPanic(db, archiveEventsSql),
+		selectClosedAggregatesStmt:          prepareStatementOrPanic(db, selectClosedAggregatesSql),
+		eventTable:                          prepareEventTable(db, "Event"),
+		archiveTable:                        prepareEventTable(db, "EventArchive"),
+		jsonb:                               jsonb,
+	}
+}
+
+// WithStrictIntegrity makes reading events from a broken hash chain fail with eventstore.IntegrityViolation
+// instead of only logging it
+func (es EventStore) WithStrictIntegrity() *EventStore {
+	es.strictIntegrity = true
+	return &es
+}
+
+// WithReadReplica makes the store read events, snapshots and transaction participants from the replica while
+// appends, transaction checks and command results stay with this store. Each read of events first looks up the latest
+// version of the aggregate in this store and reads the events that the replica does not have yet from this store, so
+// that reads return at least what was appended before they started, however far behind the replica is.
+func (es EventStore) WithReadReplica(replica *sql.DB) *EventStore {
+	primary := es
+	es.primary = &primary
+	es.selectPrimaryVersionStmt = prepareStatementOrPanic(es.db, selectPrimaryVersionSql)
+	es.selectEventsStmt = prepareStatementOrPanic(replica, selectEventsSql)
+	es.selectTimestampedEventsStmt = prepareStatementOrPanic(replica, selectTimestampedEventsSql)
+	es.selectSnapshotStmt = prepareStatementOrPanic(replica, selectSnapshotSql)
+	es.selectTransactionParticipantsStmt = prepareStatementOrPanic(replica, selectTransactionParticipantsSql)
+	es.selectArchivedEventsStmt = prepareStatementOrPanic(replica, selectArchivedEventsSql)
+	es.selectArchivedTimestampedEventsStmt = prepareStatementOrPanic(replica, selectArchivedTimestampedEventsSql)
+	return &es
+}
+
+// eventTable holds the statements that rewrite the payloads of the events in one table
+type eventTable struct {
+	selectPayloadsStmt       *sql.Stmt
+	selectChainForUpdateStmt *sql.Stmt
+	updatePayloadStmt        *sql.Stmt
+	updateHashStmt           *sql.Stmt
+}
+
+func prepareEventTable(db *sql.DB, table string) eventTable {
+	return eventTable{
+		selectPayloadsStmt:       prepareStatementOrPanic(db, fmt.Sprintf(selectEventPayloadsSql, table)),
+		selectChainForUpdateStmt: prepareStatementOrPanic(db, fmt.Sprintf(selectChainForUpdateSql, table)),
+		updatePayloadStmt:        prepareStatementOrPanic(db, fmt.Sprintf(updateEventPayloadSql, table)),
+		updateHashStmt:           prepareStatementOrPanic(db, fmt.Sprintf(updateEventHashSql, table)),
 	}
 }
 
@@ -72,14 +223,236 @@ func prepareStatementOrPanic(db *sql.DB, sql string) *sql.Stmt {
 
 func (es EventStore) Events(ctx context.Context, id account.ID, version int) ([]eventstore.SerializedEvent, error) {
 	var events []eventstore.SerializedEvent
+	err := es.StreamEvents(ctx, id, version, func(event eventstore.SerializedEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// StreamEvents hands the events of the aggregate following the version to handle one at a time while verifying
+// their hash chain. Events are read in pages so that long histories are neither held in memory nor in one long query.
+func (es EventStore) StreamEvents(ctx context.Context, id account.ID, version int, handle func(eventstore.SerializedEvent) error) error {
+	latest, err := es.primaryVersion(ctx, id)
+	if err != nil {
+		return err
+	}
+	chain, err := es.followChain(ctx, id, version, func(event chainedEvent, chain *hashChain) error {
+		if es.lagsBehind(chain, version) {
+			return errReplicaLags
+		}
+		if err := es.checkIntegrity(chain, event.Seq, id); err != nil {
+			return err
+		}
+		return handle(event.SerializedEvent)
+	})
+	if err == nil && es.lagsBehind(chain, version) {
+		err = errReplicaLags
+	}
+	switch err {
+	case errReplicaLags:
+		return es.primary.StreamEvents(ctx, id, version, handle)
+	case eventstore.StopStreaming:
+		return nil
+	case nil:
+		if chain.seq < latest {
+			return es.primary.StreamEvents(ctx, id, chain.seq, handle)
+		}
+	}
+	return err
+}
+
+// lagsBehind tells whether the replica did not have the event at the version to anchor the chain at
+func (es EventStore) lagsBehind(chain *hashChain, version int) bool {
+	return es.primary != nil && version > 0 && chain.anchorHash == nil
+}
+
+// primaryVersion reads the latest version of the aggregate from the primary when the store reads from a replica,
+// otherwise it is 0 as the store reads what there is
+func (es EventStore) primaryVersion(ctx context.Context, id account.ID) (int, error) {
+	if es.primary == nil {
+		return 0, nil
+	}
+	var version int
+	if err := es.selectPrimaryVersionStmt.QueryRowContext(ctx, id).Scan(&version); err != nil {
+		return 0, fmt.Errorf("could not read the version of aggregate %v from the primary: %w", id, err)
+	}
+	return version, nil
+}
+
+// checkIntegrity reports the chain being broken at the event just followed, as an error in strict mode
+func (es EventStore) checkIntegrity(chain *hashChain, seq int, id account.ID) error {
+	if chain.intact() || chain.brokenAt != seq {
+		return nil
+	}
+	violation := eventstore.IntegrityViolation{AggregateId: id, Seq: chain.brokenAt}
+	if es.strictIntegrity {
+		return violation
+	}
+	log.Printf("Warning: %v\n", violation)
+	return nil
+}
+
+// VerifyIntegrity follows the hash chain of all events of the aggregate
+func (es EventStore) VerifyIntegrity(ctx context.Context, id account.ID) (eventstore.IntegrityReport, error) {
+	report := eventstore.IntegrityReport{AggregateId: id}
+	chain, err := es.followChain(ctx, id, 0, func(chainedEvent, *hashChain) error {
+		report.Events++
+		return nil
+	})
+	if err != nil {
+		return eventstore.IntegrityReport{}, err
+	}
+	report.BrokenAt = chain.brokenAt
+	return report, nil
+}
+
+// followChain reads the events of the aggregate following the version page by page and hands each of them to handle
+// once it was followed in the hash chain. The events of archived aggregates are read from the archive.
+func (es EventStore) followChain(
+	ctx context.Context,
+	id account.ID,
+	version int,
+	handle func(event chainedEvent, chain *hashChain) error,
+) (*hashChain, error) {
+	chain := &hashChain{seq: version}
+	stmt := es.selectEventsStmt
+	for {
+		// each page starts with the last event of the previous one to anchor the chain
+		from := chain.seq
+		rows, err := es.readChain(ctx, stmt, chain, id, from, func(event chainedEvent) error {
+			return handle(event, chain)
+		}, id, from, streamPageSize)
+		if err == nil && rows == 0 && from == version && stmt == es.selectEventsStmt {
+			// archived aggregates have nothing left in the Event table, not even the event at the version
+			stmt = es.selectArchivedEventsStmt
+			continue
+		}
+		if err != nil || rows < streamPageSize {
+			return chain, err
+		}
+	}
+}
+
+// chainedEvents reads all events of the aggregate following the version while verifying their hash chain
+func (es EventStore) chainedEvents(ctx context.Context, stmt *sql.Stmt, id account.ID, version int) ([]chainedEvent, *hashChain, error) {
+	var events []chainedEvent
+	chain := &hashChain{seq: version}
+	_, err := es.readChain(ctx, stmt, chain, id, version, func(event chainedEvent) error {
+		events = append(events, event)
+		return nil
+	}, id, version)
+	return events, chain, err
+}
+
+// readChain follows the events selected by the statement in the chain, the event at the version anchors the chain.
+// The rows are read before any of the events is handed to handle, so that handle does not run while the rows hold
+// a connection of the pool that it might need itself. Returns the number of rows read.
+func (es EventStore) readChain(
+	ctx context.Context,
+	stmt *sql.Stmt,
+	chain *hashChain,
+	id account.ID,
+	version int,
+	handle func(event chainedEvent) error,
+	args ...interface{},
+) (int, error) {
+	var events []chainedEvent
+	err := sqlSelect(
+		ctx,
+		stmt,
+		func(rows *sql.Rows) error {
+			for rows.Next() {
+				event := chainedEvent{SerializedEvent: eventstore.SerializedEvent{AggregateId: id}}
+				err := rows.Scan(&event.Seq, &event.txId, &event.hash, &event.EventType, &event.SchemaVersion, &event.SerializerId, &event.Payload)
+				if err != nil {
+					return err
+				}
+				events = append(events, event)
+			}
+			return nil
+		},
+		args...,
+	)
+	if err != nil {
+		return len(events), err
+	}
+	for _, event := range events {
+		if event.Seq == version {
+			chain.anchor(event.hash)
+			continue
+		}
+		chain.follow(event)
+		if err := handle(event); err != nil {
+			return len(events), err
+		}
+	}
+	return len(events), nil
+}
+
+// Aggregates lists up to limit ids of aggregates with events, in order, starting after the given one
+func (es EventStore) Aggregates(ctx context.Context, after account.ID, limit int) ([]account.ID, error) {
+	var ids []account.ID
 
 	err := sqlSelect(
 		ctx,
-		es.selectEventsStmt,
+		es.selectAggregatesStmt,
+		func(rows *sql.Rows) error {
+			for rows.Next() {
+				var id account.ID
+				if err := rows.Scan(&id); err != nil {
+					return err
+				}
+				ids = append(ids, id)
+			}
+			return nil
+		},
+		after, limit,
+	)
+
+	return ids, err
+}
+
+// TimestampedEvents reads the events of the aggregate following the version, from the archive if the aggregate was archived
+func (es EventStore) TimestampedEvents(ctx context.Context, id account.ID, version int) ([]eventstore.SerializedEvent, error) {
+	latest, err := es.primaryVersion(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	events, err := es.timestampedEvents(ctx, es.selectTimestampedEventsStmt, id, version)
+	if err == nil && len(events) == 0 {
+		events, err = es.timestampedEvents(ctx, es.selectArchivedTimestampedEventsStmt, id, version)
+	}
+	if err != nil {
+		return nil, err
+	}
+	read := version
+	if len(events) != 0 {
+		read = events[len(events)-1].Seq
+	}
+	if read >= latest {
+		return events, nil
+	}
+	missing, err := es.primary.TimestampedEvents(ctx, id, read)
+	if err != nil {
+		return nil, err
+	}
+	return append(events, missing...), nil
+}
+
+func (es EventStore) timestampedEvents(ctx context.Context, stmt *sql.Stmt, id account.ID, version int) ([]eventstore.SerializedEvent, error) {
+	var events []eventstore.SerializedEvent
+
+	err := sqlSelect(
+		ctx,
+		stmt,
 		func(rows *sql.Rows) error {
 			for rows.Next() {
 				event := eventstore.SerializedEvent{AggregateId: id}
-				err := rows.Scan(&event.Seq, &event.EventType, &event.Payload)
+				err := rows.Scan(&event.Seq, &event.TransactionId, &event.Timestamp, &event.EventType, &event.SchemaVersion, &event.SerializerId, &event.Payload)
 				if err != nil {
 					return err
 				}
@@ -102,7 +475,7 @@ func (es EventStore) LoadSnapshot(ctx context.Context, id account.ID) (*eventsto
 		func(rows *sql.Rows) error {
 			if rows.Next() {
 				event := eventstore.SerializedEvent{AggregateId: id}
-				err := rows.Scan(&event.Seq, &event.EventType, &event.Payload)
+				err := rows.Scan(&event.Seq, &event.EventType, &event.SchemaVersion, &event.SerializerId, &event.Payload)
 				if err != nil {
 					return err
 				}
@@ -132,15 +505,297 @@ func (es EventStore) TransactionExists(ctx context.Context, id account.ID, txId
 	return transactionExists, err
 }
 
+// TransactionParticipants reads the participants of all the transactions in a single query
+func (es EventStore) TransactionParticipants(ctx context.Context, txIds []uuid.UUID) (map[uuid.UUID][]account.ID, error) {
+	participants := map[uuid.UUID][]account.ID{}
+	ids := make([]string, len(txIds))
+	for i, txId := range txIds {
+		ids[i] = txId.String()
+	}
+
+	err := sqlSelect(
+		ctx,
+		es.selectTransactionParticipantsStmt,
+		func(rows *sql.Rows) error {
+			for rows.Next() {
+				var txId uuid.UUID
+				var id account.ID
+				if err := rows.Scan(&txId, &id); err != nil {
+					return err
+				}
+				participants[txId] = append(participants[txId], id)
+			}
+			return nil
+		},
+		pq.Array(ids),
+	)
+	if err != nil || es.primary == nil {
+		return participants, err
+	}
+
+	// all transactions have participants, those missing were not replicated yet
+	var missing []uuid.UUID
+	for _, txId := range txIds {
+		if _, ok := participants[txId]; !ok {
+			missing = append(missing, txId)
+		}
+	}
+	if len(missing) == 0 {
+		return participants, nil
+	}
+	fromPrimary, err := es.primary.TransactionParticipants(ctx, missing)
+	for txId, ids := range fromPrimary {
+		participants[txId] = ids
+	}
+	return participants, err
+}
+
+func (es EventStore) LoadCommandResult(ctx context.Context, txId uuid.UUID) (*eventstore.CommandResult, error) {
+	var result *eventstore.CommandResult
+
+	err := sqlSelect(
+		ctx,
+		es.selectCommandResultStmt,
+		func(rows *sql.Rows) error {
+			if rows.Next() {
+				r := eventstore.CommandResult{TransactionId: txId}
+				if err := rows.Scan(&r.Operation, &r.Fingerprint, &r.Error); err != nil {
+					return err
+				}
+				result = &r
+			}
+			return nil
+		},
+		txId,
+	)
+
+	return result, err
+}
+
+// StoreCommandResult records the result unless one already exists for the transaction and returns the recorded one
+func (es EventStore) StoreCommandResult(ctx context.Context, result eventstore.CommandResult) (eventstore.CommandResult, error) {
+	if _, err := es.storeCommandResultStmt.ExecContext(ctx, result.TransactionId, result.Operation, result.Fingerprint, result.Error); err != nil {
+		return eventstore.CommandResult{}, err
+	}
+	stored, err := es.LoadCommandResult(ctx, result.TransactionId)
+	if err != nil {
+		return eventstore.CommandResult{}, err
+	}
+	if stored == nil {
+		return eventstore.CommandResult{}, fmt.Errorf("command result for transaction %v was not stored", result.TransactionId)
+	}
+	return *stored, nil
+}
+
+// RewritePayloads calls rewrite for every binary event, archived event and snapshot payload and replaces it with the
+// returned one unless it is nil, rechaining the events that follow a replaced one.
+// Payloads that changed since they were read are left as they are. Returns the number of replaced payloads.
+func (es EventStore) RewritePayloads(ctx context.Context, rewrite func(eventstore.SerializedEvent) ([]byte, error)) (int, error) {
+	rewritten := 0
+	for _, table := range []eventTable{es.eventTable, es.archiveTable} {
+		count, err := es.rewriteTablePayloads(ctx, table, rewrite)
+		rewritten += count
+		if err != nil {
+			return rewritten, err
+		}
+	}
+
+	var lastId account.ID
+	for {
+		page, err := es.selectPayloads(ctx, es.selectSnapshotPayloadsStmt, lastId, rewritePageSize)
+		if err != nil {
+			return rewritten, err
+		}
+		count, err := es.rewritePayloads(ctx, es.updateSnapshotPayloadStmt, page, rewrite)
+		rewritten += count
+		if err != nil || len(page) < rewritePageSize {
+			return rewritten, err
+		}
+		lastId = page[len(page)-1].AggregateId
+	}
+}
+
+// rewriteTablePayloads rewrites the payloads of the events in the table page by page
+func (es EventStore) rewriteTablePayloads(ctx context.Context, table eventTable, rewrite func(eventstore.SerializedEvent) ([]byte, error)) (int, error) {
+	rewritten := 0
+	var lastId account.ID
+	lastSeq := 0
+	for {
+		page, err := es.selectPayloads(ctx, table.selectPayloadsStmt, lastId, lastSeq, rewritePageSize)
+		if err != nil {
+			return rewritten, err
+		}
+		count, err := es.rewriteEventPayloads(ctx, table, page, rewrite)
+		rewritten += count
+		if err != nil || len(page) < rewritePageSize {
+			return rewritten, err
+		}
+		lastId, lastSeq = page[len(page)-1].AggregateId, page[len(page)-1].Seq
+	}
+}
+
+func (es EventStore) selectPayloads(ctx context.Context, stmt *sql.Stmt, args ...interface{}) ([]eventstore.SerializedEvent, error) {
+	var page []eventstore.SerializedEvent
+
+	err := sqlSelect(
+		ctx,
+		stmt,
+		func(rows *sql.Rows) error {
+			for rows.Next() {
+				var event eventstore.SerializedEvent
+				err := rows.Scan(&event.AggregateId, &event.Seq, &event.EventType, &event.SchemaVersion, &event.SerializerId, &event.Payload)
+				if err != nil {
+					return err
+				}
+				page = append(page, event)
+			}
+			return nil
+		},
+		args...,
+	)
+
+	return page, err
+}
+
+// rewriteEventPayloads replaces the payloads of events and rechains the hashes of the following events of the same
+// aggregate. Aggregates whose chain is already broken are left as they are, so that rewriting does not hide tampering.
+func (es EventStore) rewriteEventPayloads(
+	ctx context.Context,
+	table eventTable,
+	page []eventstore.SerializedEvent,
+	rewrite func(eventstore.SerializedEvent) ([]byte, error),
+) (int, error) {
+	rewritten := 0
+	for len(page) != 0 {
+		aggregate := page
+		for i := range page {
+			if page[i].AggregateId != page[0].AggregateId {
+				aggregate = page[:i]
+				break
+			}
+		}
+		page = page[len(aggregate):]
+
+		payloads := map[int][]byte{}
+		for _, event := range aggregate {
+			payload, err := rewrite(event)
+			if err != nil {
+				return rewritten, fmt.Errorf("could not rewrite payload %d of aggregate %v: %w", event.Seq, event.AggregateId, err)
+			}
+			if payload != nil {
+				payloads[event.Seq] = payload
+			}
+		}
+		if len(payloads) == 0 {
+			continue
+		}
+
+		count, err := es.rechain(ctx, table, aggregate, payloads)
+		rewritten += count
+		var violation eventstore.IntegrityViolation
+		if errors.As(err, &violation) {
+			log.Printf("Warning: not rewriting payloads, %v\n", violation)
+			continue
+		}
+		if err != nil {
+			return rewritten, err
+		}
+	}
+	return rewritten, nil
+}
+
+// rechain replaces the payloads of the events unless they changed since they were read and recomputes the hashes
+// of the events from the first of them on
+func (es EventStore) rechain(ctx context.Context, table eventTable, read []eventstore.SerializedEvent, payloads map[int][]byte) (int, error) {
+	id, version := read[0].AggregateId, read[0].Seq-1
+	readPayloads := map[int][]byte{}
+	for _, event := range read {
+		readPayloads[event.Seq] = event.Payload
+	}
+
+	rewritten := 0
+	err := withTransaction(ctx, es.db, func(tx *sql.Tx) error {
+		events, chain, err := es.chainedEvents(ctx, tx.StmtContext(ctx, table.selectChainForUpdateStmt), id, version)
+		if err != nil {
+			return err
+		}
+		if !chain.intact() {
+			return eventstore.IntegrityViolation{AggregateId: id, Seq: chain.brokenAt}
+		}
+
+		updatePayloadStmt := tx.StmtContext(ctx, table.updatePayloadStmt)
+		updateHashStmt := tx.StmtContext(ctx, table.updateHashStmt)
+		previous := chain.anchorHash
+		for _, event := range events {
+			payload, ok := payloads[event.Seq]
+			if ok && bytes.Equal(event.Payload, readPayloads[event.Seq]) {
+				hash := chainHash(previous, event.Seq, event.txId, payload)
+				if _, err := updatePayloadStmt.ExecContext(ctx, id, event.Seq, payload, hash); err != nil {
+					return err
+				}
+				rewritten++
+				previous = hash
+				continue
+			}
+			hash := chainHash(previous, event.Seq, event.txId, event.Payload)
+			if !bytes.Equal(hash, event.hash) {
+				if _, err := updateHashStmt.ExecContext(ctx, id, event.Seq, hash); err != nil {
+					return err
+				}
+			}
+			previous = hash
+		}
+		return nil
+	})
+	return rewritten, err
+}
+
+func (es EventStore) rewritePayloads(
+	ctx context.Context,
+	updateStmt *sql.Stmt,
+	page []eventstore.SerializedEvent,
+	rewrite func(eventstore.SerializedEvent) ([]byte, error),
+) (int, error) {
+	rewritten := 0
+	for _, event := range page {
+		payload, err := rewrite(event)
+		if err != nil {
+			return rewritten, fmt.Errorf("could not rewrite payload %d of aggregate %v: %w", event.Seq, event.AggregateId, err)
+		}
+		if payload == nil {
+			continue
+		}
+		result, err := updateStmt.ExecContext(ctx, event.AggregateId, event.Seq, payload, event.Payload)
+		if err != nil {
+			return rewritten, err
+		}
+		if updated, err := result.RowsAffected(); err == nil && updated == 1 {
+			rewritten++
+		}
+	}
+	return rewritten, nil
+}
+
+// Append appends the events and snapshots, together with the result of the command that is pending in the context
 func (es EventStore) Append(ctx context.Context, events []eventstore.SerializedEvent, snapshots []eventstore.SerializedEvent, txId uuid.UUID) error {
-	if err := es.append(ctx, events, snapshots, txId); err != nil {
+	result, recorded := eventstore.PendingCommandResult(ctx, txId)
+	if err := es.append(ctx, events, snapshots, result, txId); err != nil {
 		return toConcurrentModification(err)
 	}
+	if result != nil {
+		recorded()
+	}
 	return nil
 }
 
-func (es EventStore) append(ctx context.Context, events []eventstore.SerializedEvent, snapshots []eventstore.SerializedEvent, txId uuid.UUID) error {
-	return es.withTransaction(ctx, func(tx *sql.Tx) error {
+func (es EventStore) append(
+	ctx context.Context,
+	events []eventstore.SerializedEvent,
+	snapshots []eventstore.SerializedEvent,
+	result *eventstore.CommandResult,
+	txId uuid.UUID,
+) error {
+	return withTransaction(ctx, es.db, func(tx *sql.Tx) error {
 		if err := es.insertEvents(ctx, tx, events, txId); err != nil {
 			return err
 		}
@@ -149,12 +804,16 @@ func (es EventStore) append(ctx context.Context, events []eventstore.SerializedE
 				return err
 			}
 		}
+		if result != nil {
+			_, err := tx.StmtContext(ctx, es.storeCommandResultStmt).ExecContext(ctx, result.TransactionId, result.Operation, result.Fingerprint, result.Error)
+			return err
+		}
 		return nil
 	})
 }
 
-func (es EventStore) withTransaction(ctx context.Context, doInTx func(tx *sql.Tx) error) error {
-	tx, err := es.db.BeginTx(ctx, nil)
+func withTransaction(ctx context.Context, db *sql.DB, doInTx func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
@@ -191,25 +850,68 @@ func sqlSelect(
 }
 
 func (es EventStore) insertEvents(ctx context.Context, tx *sql.Tx, events []eventstore.SerializedEvent, txId uuid.UUID) error {
-	insertEventsStmt := tx.StmtContext(ctx, es.appendEventStmt)
-
-	for _, event := range events {
-		if _, err := insertEventsStmt.ExecContext(ctx, event.AggregateId, event.Seq, txId, event.EventType, event.Payload); err != nil {
-			return err
-		}
+	if len(events) == 0 {
+		return nil
 	}
-	return nil
+	columns := newBatchColumns(events)
+	_, err := tx.StmtContext(ctx, es.appendEventStmt).ExecContext(
+		ctx,
+		pq.Array(columns.ids), pq.Array(columns.seqs), txId, pq.Array(columns.eventTypes), pq.Array(columns.schemaVersions),
+		pq.Array(columns.serializerIds), es.payloads(columns),
+	)
+	return err
 }
 
 func (es EventStore) updateSnapshots(ctx context.Context, tx *sql.Tx, snapshots []eventstore.SerializedEvent) error {
-	insertSnapshotsStmt := tx.StmtContext(ctx, es.storeSnapshotStmt)
+	columns := newBatchColumns(snapshots)
+	_, err := tx.StmtContext(ctx, es.storeSnapshotStmt).ExecContext(
+		ctx,
+		pq.Array(columns.ids), pq.Array(columns.seqs), pq.Array(columns.eventTypes), pq.Array(columns.schemaVersions),
+		pq.Array(columns.serializerIds), es.payloads(columns),
+	)
+	return err
+}
 
-	for _, snapshot := range snapshots {
-		if _, err := insertSnapshotsStmt.ExecContext(ctx, snapshot.AggregateId, snapshot.Seq, snapshot.EventType, snapshot.Payload); err != nil {
-			return err
-		}
+// batchColumns holds the fields of events column by column to be bound as arrays
+type batchColumns struct {
+	ids            []string
+	seqs           []int64
+	eventTypes     []int64
+	schemaVersions []int64
+	serializerIds  []int64
+	payloads       [][]byte
+}
+
+func newBatchColumns(events []eventstore.SerializedEvent) batchColumns {
+	c := batchColumns{
+		ids:            make([]string, 0, len(events)),
+		seqs:           make([]int64, 0, len(events)),
+		eventTypes:     make([]int64, 0, len(events)),
+		schemaVersions: make([]int64, 0, len(events)),
+		serializerIds:  make([]int64, 0, len(events)),
+		payloads:       make([][]byte, 0, len(events)),
 	}
-	return nil
+	for _, e := range events {
+		c.ids = append(c.ids, e.AggregateId.String())
+		c.seqs = append(c.seqs, int64(e.Seq))
+		c.eventTypes = append(c.eventTypes, int64(e.EventType))
+		c.schemaVersions = append(c.schemaVersions, int64(e.SchemaVersion))
+		c.serializerIds = append(c.serializerIds, int64(e.SerializerId))
+		c.payloads = append(c.payloads, e.Payload)
+	}
+	return c
+}
+
+// payloads binds the payloads as text for the JSONB column, bytes are bound as bytea
+func (es EventStore) payloads(c batchColumns) interface{} {
+	if !es.jsonb {
+		return pq.Array(c.payloads)
+	}
+	payloads := make([]string, 0, len(c.payloads))
+	for _, payload := range c.payloads {
+		payloads = append(payloads, string(payload))
+	}
+	return pq.Array(payloads)
 }
 
 func toConcurrentModification(err error) error {
@@ -10,6 +10,7 @@ import (
 	"github.com/rieske/event-sourced-account-go/account"
 	"github.com/rieske/event-sourced-account-go/eventstore"
 	"github.com/rieske/event-sourced-account-go/eventstore/postgres"
+	"github.com/rieske/event-sourced-account-go/serialization"
 	"github.com/stretchr/testify/assert"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
@@ -17,16 +18,26 @@ import (
 	"log"
 	"os"
 	"testing"
+	"time"
 
 	_ "github.com/lib/pq"
 )
 
 var store *postgres.EventStore
+var jsonbStore *postgres.EventStore
+var ownerKeys *postgres.OwnerKeyStore
+var database *sql.DB
+
+// postgresContainer runs the databases, for tests that need connections of their own
+var postgresContainer testcontainers.Container
+
+// replica is a separate database that events are copied to by replicate to simulate a lagging read replica
+var replica *sql.DB
 
 func TestMain(m *testing.M) {
 	ctx := context.Background()
-	postgresContainer := startPostgresContainer(ctx)
-	db, err := openDatabase(postgresContainer, ctx)
+	postgresContainer = startPostgresContainer(ctx)
+	db, err := openDatabase(postgresContainer, ctx, "event_store")
 	if err != nil {
 		log.Panic(err)
 	}
@@ -34,10 +45,21 @@ func TestMain(m *testing.M) {
 		log.Panic(err)
 	}
 	postgres.MigrateSchema(db, "../../infrastructure/schema/postgres")
+	if _, err := db.Exec("CREATE DATABASE replica"); err != nil {
+		log.Panic(err)
+	}
+	if replica, err = openDatabase(postgresContainer, ctx, "replica"); err != nil {
+		log.Panic(err)
+	}
+	postgres.MigrateSchema(replica, "../../infrastructure/schema/postgres")
 	store = postgres.NewEventStore(db)
+	jsonbStore = postgres.NewJsonbEventStore(db)
+	ownerKeys = postgres.NewOwnerKeyStore(db)
+	database = db
 
 	code := m.Run()
 
+	closeResource(replica)
 	closeResource(db)
 	terminateContainer(postgresContainer, ctx)
 
@@ -76,13 +98,13 @@ func startPostgresContainer(ctx context.Context) testcontainers.Container {
 	return container
 }
 
-func openDatabase(postgres testcontainers.Container, ctx context.Context) (*sql.DB, error) {
+func openDatabase(postgres testcontainers.Container, ctx context.Context, dbname string) (*sql.DB, error) {
 	port, err := postgres.MappedPort(ctx, "5432")
 	if err != nil {
 		log.Panic(err)
 	}
 
-	psqlInfo := fmt.Sprintf("host=127.0.0.1 port=%v user=test password=test dbname=event_store sslmode=disable", port.Port())
+	psqlInfo := fmt.Sprintf("host=127.0.0.1 port=%v user=test password=test dbname=%s sslmode=disable", port.Port(), dbname)
 
 	return sql.Open("postgres", psqlInfo)
 }
@@ -101,6 +123,24 @@ func TestSqlStore_Events_Empty(t *testing.T) {
 	assert.Empty(t, events)
 }
 
+func TestSqlStore_Events_SchemaVersion(t *testing.T) {
+	id := account.NewID()
+	expectedEvents := []eventstore.SerializedEvent{{
+		AggregateId:   id,
+		Seq:           1,
+		Payload:       []byte("test"),
+		EventType:     42,
+		SchemaVersion: 2,
+	}}
+	err := store.Append(context.Background(), expectedEvents, nil, uuid.New())
+	assert.NoError(t, err)
+
+	events, err := store.Events(context.Background(), id, 0)
+
+	assert.NoError(t, err)
+	assert.Equal(t, expectedEvents, events)
+}
+
 func TestSqlStore_Events_SingleEvent(t *testing.T) {
 	id := account.NewID()
 	expectedEvents := []eventstore.SerializedEvent{{
@@ -207,3 +247,926 @@ func TestSqlStore_ConcurrentModificationErrorOnDuplicateEventSequence(t *testing
 	assert.NoError(t, err)
 	assert.Equal(t, expectedEvents, events)
 }
+
+func TestSqlStore_TimestampedEvents(t *testing.T) {
+	id := account.NewID()
+	txId := uuid.New()
+	err := store.Append(context.Background(), []eventstore.SerializedEvent{{
+		AggregateId: id,
+		Seq:         1,
+		Payload:     []byte("test"),
+		EventType:   42,
+	}}, nil, txId)
+	assert.NoError(t, err)
+
+	events, err := store.TimestampedEvents(context.Background(), id, 0)
+
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, txId, events[0].TransactionId)
+	assert.WithinDuration(t, time.Now(), events[0].Timestamp, time.Minute)
+	assert.Equal(t, []byte("test"), events[0].Payload)
+}
+
+func TestSqlStore_TransactionParticipants(t *testing.T) {
+	sourceAccount := account.NewID()
+	targetAccount := account.NewID()
+	txId, depositTxId := uuid.New(), uuid.New()
+	err := store.Append(context.Background(), []eventstore.SerializedEvent{
+		{AggregateId: sourceAccount, Seq: 1, Payload: []byte("test1"), EventType: 2},
+		{AggregateId: targetAccount, Seq: 1, Payload: []byte("test2"), EventType: 2},
+	}, nil, txId)
+	assert.NoError(t, err)
+	err = store.Append(context.Background(), []eventstore.SerializedEvent{
+		{AggregateId: sourceAccount, Seq: 2, Payload: []byte("test3"), EventType: 2},
+	}, nil, depositTxId)
+	assert.NoError(t, err)
+
+	participants, err := store.TransactionParticipants(context.Background(), []uuid.UUID{txId, depositTxId, uuid.New()})
+
+	assert.NoError(t, err)
+	assert.Len(t, participants, 2)
+	assert.ElementsMatch(t, []account.ID{sourceAccount, targetAccount}, participants[txId])
+	assert.Equal(t, []account.ID{sourceAccount}, participants[depositTxId])
+}
+
+func TestSqlStore_NoCommandResult(t *testing.T) {
+	result, err := store.LoadCommandResult(context.Background(), uuid.New())
+
+	assert.NoError(t, err)
+	assert.Nil(t, result)
+}
+
+func TestSqlStore_FirstStoredCommandResultWins(t *testing.T) {
+	txId := uuid.New()
+	first := eventstore.CommandResult{TransactionId: txId, Operation: "deposit", Fingerprint: "first", Error: ""}
+	second := eventstore.CommandResult{TransactionId: txId, Operation: "deposit", Fingerprint: "second", Error: "insufficient balance"}
+
+	stored, err := store.StoreCommandResult(context.Background(), first)
+	assert.NoError(t, err)
+	assert.Equal(t, first, stored)
+
+	stored, err = store.StoreCommandResult(context.Background(), second)
+	assert.NoError(t, err)
+	assert.Equal(t, first, stored)
+
+	loaded, err := store.LoadCommandResult(context.Background(), txId)
+	assert.NoError(t, err)
+	assert.Equal(t, &first, loaded)
+}
+
+func TestSqlStore_AppendRecordsPendingCommandResult(t *testing.T) {
+	type appender interface {
+		Append(ctx context.Context, events []eventstore.SerializedEvent, snapshots []eventstore.SerializedEvent, txId uuid.UUID) error
+	}
+	for _, es := range []appender{store, postgres.NewSingleRoundTripEventStore(database)} {
+		id, txId := account.NewID(), uuid.New()
+		result := eventstore.CommandResult{TransactionId: txId, Operation: "deposit", Fingerprint: "fingerprint"}
+		ctx, recorded := eventstore.WithCommandResult(context.Background(), result)
+		event := eventstore.SerializedEvent{AggregateId: id, Seq: 1, Payload: []byte("event"), EventType: 1, SchemaVersion: 1, SerializerId: 1}
+
+		assert.NoError(t, es.Append(ctx, []eventstore.SerializedEvent{event}, nil, txId))
+
+		assert.True(t, recorded())
+		loaded, err := store.LoadCommandResult(context.Background(), txId)
+		assert.NoError(t, err)
+		assert.Equal(t, &result, loaded)
+	}
+}
+
+func TestSqlStore_FailedAppendDoesNotRecordPendingCommandResult(t *testing.T) {
+	id, txId := account.NewID(), uuid.New()
+	appendChain(t, store, id, "event")
+	ctx, recorded := eventstore.WithCommandResult(context.Background(), eventstore.CommandResult{TransactionId: txId, Operation: "deposit"})
+	event := eventstore.SerializedEvent{AggregateId: id, Seq: 1, Payload: []byte("event"), EventType: 1, SchemaVersion: 1, SerializerId: 1}
+
+	err := store.Append(ctx, []eventstore.SerializedEvent{event}, nil, txId)
+
+	assert.Equal(t, account.ConcurrentModification, err)
+	assert.False(t, recorded())
+	loaded, err := store.LoadCommandResult(context.Background(), txId)
+	assert.NoError(t, err)
+	assert.Nil(t, loaded)
+}
+
+func TestSqlStore_JsonbPayload(t *testing.T) {
+	id := account.NewID()
+	expectedEvents := []eventstore.SerializedEvent{{
+		AggregateId:   id,
+		Seq:           1,
+		Payload:       []byte(`{"amountDeposited":5,"balance":10}`),
+		EventType:     42,
+		SchemaVersion: 1,
+	}}
+	err := jsonbStore.Append(context.Background(), expectedEvents, expectedEvents, uuid.New())
+	assert.NoError(t, err)
+
+	events, err := store.Events(context.Background(), id, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, events, 1) {
+		assertJsonbEvent(t, expectedEvents[0], events[0])
+	}
+
+	snapshot, err := store.LoadSnapshot(context.Background(), id)
+	assert.NoError(t, err)
+	if assert.NotNil(t, snapshot) {
+		assertJsonbEvent(t, expectedEvents[0], *snapshot)
+	}
+}
+
+// assertJsonbEvent compares the payloads as JSON, JSONB does not keep the formatting nor the order of keys
+func assertJsonbEvent(t *testing.T, expected, actual eventstore.SerializedEvent) {
+	assert.JSONEq(t, string(expected.Payload), string(actual.Payload))
+	expected.Payload, actual.Payload = nil, nil
+	assert.Equal(t, expected, actual)
+}
+
+func TestSqlStore_RewritePayloads(t *testing.T) {
+	id := account.NewID()
+	events := []eventstore.SerializedEvent{
+		{AggregateId: id, Seq: 1, Payload: []byte("first"), EventType: 1, SchemaVersion: 1, SerializerId: 1},
+		{AggregateId: id, Seq: 2, Payload: []byte("second"), EventType: 1, SchemaVersion: 1, SerializerId: 1},
+	}
+	err := store.Append(context.Background(), events, events[1:], uuid.New())
+	assert.NoError(t, err)
+
+	_, err = store.RewritePayloads(context.Background(), func(event eventstore.SerializedEvent) ([]byte, error) {
+		if event.AggregateId != id || string(event.Payload) == "first" {
+			return nil, nil
+		}
+		return append([]byte("rewritten "), event.Payload...), nil
+	})
+	assert.NoError(t, err)
+
+	rewrittenEvents, err := store.Events(context.Background(), id, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "first", string(rewrittenEvents[0].Payload))
+	assert.Equal(t, "rewritten second", string(rewrittenEvents[1].Payload))
+	snapshot, err := store.LoadSnapshot(context.Background(), id)
+	assert.NoError(t, err)
+	assert.Equal(t, "rewritten second", string(snapshot.Payload))
+
+	report, err := store.VerifyIntegrity(context.Background(), id)
+	assert.NoError(t, err)
+	assert.True(t, report.Intact())
+}
+
+func appendChain(t *testing.T, es *postgres.EventStore, id account.ID, payloads ...string) {
+	for i, payload := range payloads {
+		event := eventstore.SerializedEvent{AggregateId: id, Seq: i + 1, Payload: []byte(payload), EventType: 1, SchemaVersion: 1, SerializerId: 1}
+		assert.NoError(t, es.Append(context.Background(), []eventstore.SerializedEvent{event}, nil, uuid.New()))
+	}
+}
+
+func tamper(t *testing.T, id account.ID, seq int, payload string) {
+	_, err := database.Exec("UPDATE Event SET payload = $3 WHERE aggregateId = $1 AND sequenceNumber = $2", id, seq, []byte(payload))
+	assert.NoError(t, err)
+}
+
+func TestSqlStore_HashChainIntact(t *testing.T) {
+	for _, es := range []*postgres.EventStore{store, jsonbStore} {
+		id := account.NewID()
+		appendChain(t, es, id, `{"n":1}`, `{"n":2}`, `{"n":3}`)
+
+		report, err := es.VerifyIntegrity(context.Background(), id)
+
+		assert.NoError(t, err)
+		assert.Equal(t, eventstore.IntegrityReport{AggregateId: id, Events: 3}, report)
+		assert.True(t, report.Intact())
+	}
+}
+
+func TestSqlStore_TamperedEventBreaksChain(t *testing.T) {
+	id := account.NewID()
+	appendChain(t, store, id, "first", "second", "third")
+	tamper(t, id, 2, "edited")
+
+	report, err := store.VerifyIntegrity(context.Background(), id)
+
+	assert.NoError(t, err)
+	assert.Equal(t, eventstore.IntegrityReport{AggregateId: id, Events: 3, BrokenAt: 2}, report)
+}
+
+func TestSqlStore_DeletedEventBreaksChain(t *testing.T) {
+	id := account.NewID()
+	appendChain(t, store, id, "first", "second", "third")
+	_, err := database.Exec("DELETE FROM Event WHERE aggregateId = $1 AND sequenceNumber = 2", id)
+	assert.NoError(t, err)
+
+	report, err := store.VerifyIntegrity(context.Background(), id)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, report.BrokenAt)
+}
+
+func TestSqlStore_StrictIntegrityFailsReadingBrokenChain(t *testing.T) {
+	id := account.NewID()
+	appendChain(t, store, id, "first", "second", "third")
+	tamper(t, id, 3, "edited")
+
+	events, err := store.Events(context.Background(), id, 0)
+	assert.NoError(t, err)
+	assert.Len(t, events, 3)
+
+	_, err = store.WithStrictIntegrity().Events(context.Background(), id, 1)
+	assert.Equal(t, eventstore.IntegrityViolation{AggregateId: id, Seq: 3}, err)
+
+	events, err = store.WithStrictIntegrity().Events(context.Background(), id, 3)
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+}
+
+func TestSqlStore_RewritePayloadsLeavesBrokenChain(t *testing.T) {
+	id := account.NewID()
+	appendChain(t, store, id, "first", "second")
+	tamper(t, id, 1, "edited")
+
+	_, err := store.RewritePayloads(context.Background(), func(event eventstore.SerializedEvent) ([]byte, error) {
+		if event.AggregateId != id {
+			return nil, nil
+		}
+		return append([]byte("rewritten "), event.Payload...), nil
+	})
+	assert.NoError(t, err)
+
+	events, err := store.Events(context.Background(), id, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "edited", string(events[0].Payload))
+}
+
+func TestOwnerKeyStore_CreatesKeyOncePerOwner(t *testing.T) {
+	ownerID := account.NewOwnerID()
+
+	keyId, key, err := ownerKeys.OwnerKey(context.Background(), ownerID)
+	assert.NoError(t, err)
+	assert.Len(t, key, 32)
+
+	sameKeyId, sameKey, err := ownerKeys.OwnerKey(context.Background(), ownerID)
+	assert.NoError(t, err)
+	assert.Equal(t, keyId, sameKeyId)
+	assert.Equal(t, key, sameKey)
+
+	dataKey, err := ownerKeys.DataKey(context.Background(), keyId)
+	assert.NoError(t, err)
+	assert.Equal(t, key, dataKey)
+}
+
+func TestOwnerKeyStore_DeleteOwnerKey(t *testing.T) {
+	ownerID := account.NewOwnerID()
+	keyId, _, err := ownerKeys.OwnerKey(context.Background(), ownerID)
+	assert.NoError(t, err)
+
+	deleted, err := ownerKeys.DeleteOwnerKey(context.Background(), ownerID)
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+
+	dataKey, err := ownerKeys.DataKey(context.Background(), keyId)
+	assert.NoError(t, err)
+	assert.Nil(t, dataKey)
+
+	deleted, err = ownerKeys.DeleteOwnerKey(context.Background(), ownerID)
+	assert.NoError(t, err)
+	assert.False(t, deleted)
+
+	_, _, err = ownerKeys.OwnerKey(context.Background(), ownerID)
+	assert.ErrorIs(t, err, serialization.OwnerForgotten)
+
+	forgotten, err := ownerKeys.ForgottenOwners(context.Background(), time.Minute)
+	assert.NoError(t, err)
+	assert.Contains(t, forgotten, ownerID)
+}
+
+func TestSqlStore_Aggregates(t *testing.T) {
+	first, second := account.NewID(), account.NewID()
+	appendChain(t, store, first, "first", "second")
+	appendChain(t, store, second, "first")
+
+	var ids []account.ID
+	var last account.ID
+	for {
+		page, err := store.Aggregates(context.Background(), last, 2)
+		assert.NoError(t, err)
+		ids = append(ids, page...)
+		if len(page) < 2 {
+			break
+		}
+		last = page[len(page)-1]
+	}
+
+	assert.Contains(t, ids, first)
+	assert.Contains(t, ids, second)
+	assert.Len(t, ids, len(uniqueIds(ids)))
+}
+
+func uniqueIds(ids []account.ID) map[account.ID]bool {
+	unique := map[account.ID]bool{}
+	for _, id := range ids {
+		unique[id] = true
+	}
+	return unique
+}
+
+func TestSqlStore_StreamEventsAcrossPages(t *testing.T) {
+	id := account.NewID()
+	payloads := make([]string, 1200)
+	for i := range payloads {
+		payloads[i] = fmt.Sprintf("event %d", i+1)
+	}
+	appendChain(t, store, id, payloads...)
+
+	seq := 300
+	err := store.WithStrictIntegrity().StreamEvents(context.Background(), id, seq, func(event eventstore.SerializedEvent) error {
+		seq++
+		assert.Equal(t, seq, event.Seq)
+		assert.Equal(t, fmt.Sprintf("event %d", seq), string(event.Payload))
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1200, seq)
+
+	report, err := store.VerifyIntegrity(context.Background(), id)
+	assert.NoError(t, err)
+	assert.Equal(t, eventstore.IntegrityReport{AggregateId: id, Events: 1200}, report)
+}
+
+func TestSqlStore_StreamEventsHandlesEventsWithoutHoldingAConnection(t *testing.T) {
+	id := account.NewID()
+	appendChain(t, store, id, "event 1", "event 2", "event 3")
+	// with a single connection in the pool, handle can only query while the stream does not hold it
+	database.SetMaxOpenConns(1)
+	defer database.SetMaxOpenConns(0)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	streamed := 0
+	err := store.StreamEvents(ctx, id, 0, func(event eventstore.SerializedEvent) error {
+		streamed++
+		_, err := store.LoadSnapshot(ctx, id)
+		return err
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, streamed)
+}
+
+func TestSqlStore_BatchAppendChainsEventsOfEachAggregate(t *testing.T) {
+	for _, es := range []*postgres.EventStore{store, jsonbStore} {
+		first, second := account.NewID(), account.NewID()
+		appendChain(t, es, first, `{"n":1}`)
+		batch := []eventstore.SerializedEvent{
+			{AggregateId: first, Seq: 2, Payload: []byte(`{"n":2}`), EventType: 1, SchemaVersion: 1, SerializerId: 1},
+			{AggregateId: second, Seq: 1, Payload: []byte(`{"n":1}`), EventType: 1, SchemaVersion: 1, SerializerId: 1},
+			{AggregateId: first, Seq: 3, Payload: []byte(`{"n":3}`), EventType: 1, SchemaVersion: 1, SerializerId: 1},
+			{AggregateId: second, Seq: 2, Payload: []byte(`{"n":2}`), EventType: 1, SchemaVersion: 1, SerializerId: 1},
+		}
+
+		err := es.Append(context.Background(), batch, []eventstore.SerializedEvent{batch[2], batch[3]}, uuid.New())
+		assert.NoError(t, err)
+
+		for _, id := range []account.ID{first, second} {
+			report, err := es.VerifyIntegrity(context.Background(), id)
+			assert.NoError(t, err)
+			assert.True(t, report.Intact())
+		}
+		firstEvents, err := es.Events(context.Background(), first, 0)
+		assert.NoError(t, err)
+		assert.Len(t, firstEvents, 3)
+		snapshot, err := es.LoadSnapshot(context.Background(), second)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, snapshot.Seq)
+	}
+}
+
+func TestSqlStore_ConcurrentModificationErrorOnDuplicateEventSequenceInBatch(t *testing.T) {
+	id := account.NewID()
+	batch := []eventstore.SerializedEvent{
+		{AggregateId: id, Seq: 1, Payload: []byte("first"), EventType: 1},
+		{AggregateId: id, Seq: 1, Payload: []byte("second"), EventType: 1},
+	}
+
+	err := store.Append(context.Background(), batch, nil, uuid.New())
+
+	assert.Equal(t, account.ConcurrentModification, err)
+	events, err := store.Events(context.Background(), id, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+}
+
+func TestSingleRoundTripStore_LoadAggregate(t *testing.T) {
+	es := postgres.NewSingleRoundTripEventStore(database)
+	id, txId := account.NewID(), uuid.New()
+	appendChain(t, store, id, "first", "second", "third")
+	snapshot := eventstore.SerializedEvent{AggregateId: id, Seq: 2, Payload: []byte("snapshot"), EventType: 2, SchemaVersion: 1, SerializerId: 1}
+	assert.NoError(t, store.Append(context.Background(), nil, []eventstore.SerializedEvent{snapshot}, uuid.New()))
+
+	loaded, err := es.LoadAggregate(context.Background(), id, 0, txId)
+
+	assert.NoError(t, err)
+	assert.False(t, loaded.TransactionExists)
+	assert.Equal(t, &snapshot, loaded.Snapshot)
+	assert.Len(t, loaded.Events, 1)
+	assert.Equal(t, 3, loaded.Events[0].Seq)
+	assert.Equal(t, "third", string(loaded.Events[0].Payload))
+}
+
+func TestSingleRoundTripStore_LoadAggregateFollowingVersion(t *testing.T) {
+	es := postgres.NewSingleRoundTripEventStore(database)
+	id := account.NewID()
+	appendChain(t, store, id, "first", "second", "third")
+	snapshot := eventstore.SerializedEvent{AggregateId: id, Seq: 1, Payload: []byte("snapshot"), EventType: 2, SchemaVersion: 1, SerializerId: 1}
+	assert.NoError(t, store.Append(context.Background(), nil, []eventstore.SerializedEvent{snapshot}, uuid.New()))
+
+	loaded, err := es.LoadAggregate(context.Background(), id, 2, uuid.New())
+
+	assert.NoError(t, err)
+	assert.Nil(t, loaded.Snapshot)
+	assert.Len(t, loaded.Events, 1)
+	assert.Equal(t, 3, loaded.Events[0].Seq)
+}
+
+func TestSingleRoundTripStore_LoadMissingAggregate(t *testing.T) {
+	es := postgres.NewSingleRoundTripEventStore(database)
+
+	loaded, err := es.LoadAggregate(context.Background(), account.NewID(), 0, uuid.New())
+
+	assert.NoError(t, err)
+	assert.Equal(t, eventstore.SerializedAggregate{}, loaded)
+}
+
+func TestSingleRoundTripStore_LoadAggregateOfExistingTransaction(t *testing.T) {
+	es := postgres.NewSingleRoundTripEventStore(database)
+	id, txId := account.NewID(), uuid.New()
+	event := eventstore.SerializedEvent{AggregateId: id, Seq: 1, Payload: []byte("first"), EventType: 1, SchemaVersion: 1, SerializerId: 1}
+	assert.NoError(t, es.Append(context.Background(), []eventstore.SerializedEvent{event}, nil, txId))
+
+	loaded, err := es.LoadAggregate(context.Background(), id, 0, txId)
+
+	assert.NoError(t, err)
+	assert.True(t, loaded.TransactionExists)
+}
+
+func TestSingleRoundTripStore_AppendChainsEventsAndStoresSnapshots(t *testing.T) {
+	es := postgres.NewSingleRoundTripEventStore(database)
+	id := account.NewID()
+	appendChain(t, store, id, "first")
+	events := []eventstore.SerializedEvent{
+		{AggregateId: id, Seq: 2, Payload: []byte("second"), EventType: 1, SchemaVersion: 1, SerializerId: 1},
+		{AggregateId: id, Seq: 3, Payload: []byte("third"), EventType: 1, SchemaVersion: 1, SerializerId: 1},
+	}
+
+	err := es.Append(context.Background(), events, events[1:], uuid.New())
+
+	assert.NoError(t, err)
+	report, err := store.VerifyIntegrity(context.Background(), id)
+	assert.NoError(t, err)
+	assert.Equal(t, eventstore.IntegrityReport{AggregateId: id, Events: 3}, report)
+	snapshot, err := store.LoadSnapshot(context.Background(), id)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, snapshot.Seq)
+}
+
+func TestSingleRoundTripStore_RepeatedTransactionIsConcurrentModification(t *testing.T) {
+	es := postgres.NewSingleRoundTripEventStore(database)
+	id, txId := account.NewID(), uuid.New()
+	event := eventstore.SerializedEvent{AggregateId: id, Seq: 1, Payload: []byte("first"), EventType: 1, SchemaVersion: 1, SerializerId: 1}
+	assert.NoError(t, es.Append(context.Background(), []eventstore.SerializedEvent{event}, nil, txId))
+
+	event = eventstore.SerializedEvent{AggregateId: id, Seq: 2, Payload: []byte("second"), EventType: 1, SchemaVersion: 1, SerializerId: 1}
+	err := es.Append(context.Background(), []eventstore.SerializedEvent{event}, nil, txId)
+
+	assert.Equal(t, account.ConcurrentModification, err)
+	events, err := store.Events(context.Background(), id, 0)
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+}
+
+func TestSingleRoundTripStore_StrictIntegrityFailsLoadingBrokenChain(t *testing.T) {
+	id := account.NewID()
+	appendChain(t, store, id, "first", "second")
+	tamper(t, id, 2, "edited")
+
+	_, err := postgres.NewSingleRoundTripEventStore(database).WithStrictIntegrity().LoadAggregate(context.Background(), id, 0, uuid.New())
+
+	assert.Equal(t, eventstore.IntegrityViolation{AggregateId: id, Seq: 2}, err)
+}
+
+func replicate(t *testing.T, id account.ID, upTo int) {
+	rows, err := database.Query("SELECT sequenceNumber, transactionId, eventType, schemaVersion, serializerId, payload, hash FROM Event "+
+		"WHERE aggregateId = $1 AND sequenceNumber <= $2 ORDER BY sequenceNumber", id, upTo)
+	assert.NoError(t, err)
+	defer closeResource(rows)
+	for rows.Next() {
+		var seq, eventType, schemaVersion, serializerId int
+		var txId uuid.UUID
+		var payload, hash []byte
+		assert.NoError(t, rows.Scan(&seq, &txId, &eventType, &schemaVersion, &serializerId, &payload, &hash))
+		_, err := replica.Exec("INSERT INTO Event(aggregateId, sequenceNumber, transactionId, eventType, schemaVersion, serializerId, payload, hash) "+
+			"VALUES($1, $2, $3, $4, $5, $6, $7, $8)", id, seq, txId, eventType, schemaVersion, serializerId, payload, hash)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, rows.Err())
+}
+
+func TestReplicaStore_ReadsEventsFromReplica(t *testing.T) {
+	id := account.NewID()
+	appendChain(t, store, id, "first", "second")
+	replicate(t, id, 2)
+	// only the replica still has the original payload
+	tamper(t, id, 1, "edited")
+
+	events, err := store.WithReadReplica(replica).Events(context.Background(), id, 0)
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, "first", string(events[0].Payload))
+
+	events, err = store.WithReadReplica(replica).Events(context.Background(), id, 1)
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, "second", string(events[0].Payload))
+}
+
+// without a cached version, queries load the snapshot from the replica, which does not have one yet, and then read the
+// events from version 0 on
+func TestReplicaStore_ReadsEventsThatLaggingReplicaDoesNotHaveFromPrimary(t *testing.T) {
+	id := account.NewID()
+	appendChain(t, store, id, "first", "second", "third")
+	snapshot := eventstore.SerializedEvent{AggregateId: id, Seq: 3, Payload: []byte("snapshot"), EventType: 1, SchemaVersion: 1, SerializerId: 1}
+	assert.NoError(t, store.Append(context.Background(), nil, []eventstore.SerializedEvent{snapshot}, uuid.New()))
+	replicate(t, id, 2)
+	replicaStore := store.WithReadReplica(replica)
+
+	loaded, err := replicaStore.LoadSnapshot(context.Background(), id)
+	assert.NoError(t, err)
+	assert.Nil(t, loaded)
+	events, err := replicaStore.Events(context.Background(), id, 0)
+
+	assert.NoError(t, err)
+	assert.Len(t, events, 3)
+	assert.Equal(t, "third", string(events[2].Payload))
+}
+
+func TestReplicaStore_ReadsStatementEventsThatLaggingReplicaDoesNotHaveFromPrimary(t *testing.T) {
+	id := account.NewID()
+	appendChain(t, store, id, "first", "second", "third")
+	replicate(t, id, 1)
+	replicaStore := store.WithReadReplica(replica)
+
+	events, err := replicaStore.TimestampedEvents(context.Background(), id, 0)
+
+	assert.NoError(t, err)
+	assert.Len(t, events, 3)
+	assert.Equal(t, []int{1, 2, 3}, []int{events[0].Seq, events[1].Seq, events[2].Seq})
+	txIds := []uuid.UUID{events[0].TransactionId, events[2].TransactionId}
+	participants, err := replicaStore.TransactionParticipants(context.Background(), txIds)
+	assert.NoError(t, err)
+	assert.Equal(t, map[uuid.UUID][]account.ID{txIds[0]: {id}, txIds[1]: {id}}, participants)
+}
+
+func TestReplicaStore_FallsBackToPrimaryWhenReplicaLagsBehindVersion(t *testing.T) {
+	id := account.NewID()
+	appendChain(t, store, id, "first", "second", "third")
+	replicate(t, id, 1)
+
+	events, err := store.WithReadReplica(replica).Events(context.Background(), id, 2)
+
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, "third", string(events[0].Payload))
+}
+
+func TestReplicaStore_FallsBackToPrimaryWhenReplicaHasNoEventsPastVersion(t *testing.T) {
+	id := account.NewID()
+	appendChain(t, store, id, "first", "second")
+
+	events, err := store.WithReadReplica(replica).Events(context.Background(), id, 1)
+
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, "second", string(events[0].Payload))
+}
+
+func TestReplicaStore_AppendsToPrimary(t *testing.T) {
+	id := account.NewID()
+
+	appendChain(t, store.WithReadReplica(replica), id, "first")
+
+	events, err := store.Events(context.Background(), id, 0)
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+}
+
+func TestMoveAggregate_MovesEventsAndSnapshot(t *testing.T) {
+	id := account.NewID()
+	appendChain(t, store, id, "first", "second")
+	snapshot := eventstore.SerializedEvent{AggregateId: id, Seq: 2, Payload: []byte("snapshot"), EventType: 42}
+	assert.NoError(t, store.Append(context.Background(), []eventstore.SerializedEvent{}, []eventstore.SerializedEvent{snapshot}, uuid.New()))
+	timestamped, err := store.TimestampedEvents(context.Background(), id, 0)
+	assert.NoError(t, err)
+
+	moved, err := postgres.MoveAggregate(context.Background(), database, replica, id)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, moved)
+	target := postgres.NewEventStore(replica)
+	movedEvents, err := target.TimestampedEvents(context.Background(), id, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, timestamped, movedEvents)
+	movedSnapshot, err := target.LoadSnapshot(context.Background(), id)
+	assert.NoError(t, err)
+	assert.Equal(t, &snapshot, movedSnapshot)
+	report, err := target.VerifyIntegrity(context.Background(), id)
+	assert.NoError(t, err)
+	assert.True(t, report.Intact())
+
+	events, err := store.Events(context.Background(), id, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+	remainingSnapshot, err := store.LoadSnapshot(context.Background(), id)
+	assert.NoError(t, err)
+	assert.Nil(t, remainingSnapshot)
+}
+
+func TestMoveAggregate_CompletesInterruptedMove(t *testing.T) {
+	id := account.NewID()
+	appendChain(t, store, id, "first", "second")
+	replicate(t, id, 1)
+
+	moved, err := postgres.MoveAggregate(context.Background(), database, replica, id)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, moved)
+	events, err := postgres.NewEventStore(replica).Events(context.Background(), id, 0)
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+}
+
+func TestMoveAggregate_FailsWhenTargetHasOtherEvents(t *testing.T) {
+	id := account.NewID()
+	appendChain(t, store, id, "first")
+	appendChain(t, postgres.NewEventStore(replica), id, "other")
+
+	_, err := postgres.MoveAggregate(context.Background(), database, replica, id)
+
+	assert.Error(t, err)
+	events, err := store.Events(context.Background(), id, 0)
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+}
+
+func TestMoveAggregate_RejectsAppendsOnceMoved(t *testing.T) {
+	id := account.NewID()
+	appendChain(t, store, id, "first")
+	_, err := postgres.MoveAggregate(context.Background(), database, replica, id)
+	assert.NoError(t, err)
+
+	event := eventstore.SerializedEvent{AggregateId: id, Seq: 2, Payload: []byte("second"), EventType: 1, SchemaVersion: 1, SerializerId: 1}
+	err = store.Append(context.Background(), []eventstore.SerializedEvent{event}, nil, uuid.New())
+
+	assert.Error(t, err)
+	assert.Equal(t, 0, countEvents(t, "Event", id))
+}
+
+func TestMoveAggregate_WaitsForAppendInFlight(t *testing.T) {
+	id := account.NewID()
+	appendChain(t, store, id, "first")
+	tx, err := database.Begin()
+	assert.NoError(t, err)
+	_, err = tx.Exec("INSERT INTO Event(aggregateId, sequenceNumber, transactionId, eventType, schemaVersion, serializerId, payload, hash) "+
+		"VALUES($1, 2, $2, 1, 1, 1, 'second'::bytea, ''::bytea)", id, uuid.New())
+	assert.NoError(t, err)
+
+	moves := make(chan int, 1)
+	go func() {
+		moved, err := postgres.MoveAggregate(context.Background(), database, replica, id)
+		assert.NoError(t, err)
+		moves <- moved
+	}()
+	time.Sleep(100 * time.Millisecond)
+	assert.Empty(t, moves)
+	assert.NoError(t, tx.Commit())
+
+	assert.Equal(t, 2, <-moves)
+	assert.Equal(t, 0, countEvents(t, "Event", id))
+}
+
+func TestMoveAggregate_MovesBack(t *testing.T) {
+	id := account.NewID()
+	appendChain(t, store, id, "first")
+	_, err := postgres.MoveAggregate(context.Background(), database, replica, id)
+	assert.NoError(t, err)
+
+	moved, err := postgres.MoveAggregate(context.Background(), replica, database, id)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, moved)
+	event := eventstore.SerializedEvent{AggregateId: id, Seq: 2, Payload: []byte("second"), EventType: 1, SchemaVersion: 1, SerializerId: 1}
+	assert.NoError(t, store.Append(context.Background(), []eventstore.SerializedEvent{event}, nil, uuid.New()))
+}
+
+func TestMoveCommandResult(t *testing.T) {
+	txId := uuid.New()
+	result := eventstore.CommandResult{TransactionId: txId, Operation: "deposit", Fingerprint: "fingerprint", Error: ""}
+	_, err := store.StoreCommandResult(context.Background(), result)
+	assert.NoError(t, err)
+
+	assert.NoError(t, postgres.MoveCommandResult(context.Background(), database, replica, txId))
+
+	moved, err := postgres.NewEventStore(replica).LoadCommandResult(context.Background(), txId)
+	assert.NoError(t, err)
+	assert.Equal(t, &result, moved)
+	remaining, err := store.LoadCommandResult(context.Background(), txId)
+	assert.NoError(t, err)
+	assert.Nil(t, remaining)
+}
+
+func TestCommandResultTransactions(t *testing.T) {
+	txIds := []uuid.UUID{uuid.New(), uuid.New()}
+	for _, txId := range txIds {
+		_, err := store.StoreCommandResult(context.Background(), eventstore.CommandResult{TransactionId: txId, Operation: "deposit"})
+		assert.NoError(t, err)
+	}
+
+	var listed []uuid.UUID
+	var last uuid.UUID
+	for {
+		page, err := postgres.CommandResultTransactions(context.Background(), database, last, 1)
+		assert.NoError(t, err)
+		if len(page) == 0 {
+			break
+		}
+		listed = append(listed, page...)
+		last = page[len(page)-1]
+	}
+
+	assert.Subset(t, listed, txIds)
+}
+
+func countEvents(t *testing.T, table string, id account.ID) int {
+	var count int
+	assert.NoError(t, database.QueryRow("SELECT count(*) FROM "+table+" WHERE aggregateId = $1", id).Scan(&count))
+	return count
+}
+
+func TestSqlStore_ArchiveMovesEventsAndKeepsTombstone(t *testing.T) {
+	id := account.NewID()
+	appendChain(t, store, id, "first", "second", "third")
+	tombstone := eventstore.SerializedEvent{AggregateId: id, Seq: 3, Payload: []byte("tombstone"), EventType: 1}
+
+	assert.NoError(t, store.Archive(context.Background(), tombstone))
+
+	assert.Equal(t, 0, countEvents(t, "Event", id))
+	assert.Equal(t, 3, countEvents(t, "EventArchive", id))
+	snapshot, err := store.LoadSnapshot(context.Background(), id)
+	assert.NoError(t, err)
+	assert.Equal(t, &tombstone, snapshot)
+}
+
+func TestSqlStore_ReadsArchivedEvents(t *testing.T) {
+	id := account.NewID()
+	appendChain(t, store, id, "first", "second", "third")
+	assert.NoError(t, store.Archive(context.Background(), eventstore.SerializedEvent{AggregateId: id, Seq: 3, Payload: []byte("tombstone"), EventType: 1}))
+
+	events, err := store.Events(context.Background(), id, 1)
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, "second", string(events[0].Payload))
+
+	events, err = store.Events(context.Background(), id, 3)
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+
+	timestamped, err := store.TimestampedEvents(context.Background(), id, 0)
+	assert.NoError(t, err)
+	assert.Len(t, timestamped, 3)
+
+	report, err := store.VerifyIntegrity(context.Background(), id)
+	assert.NoError(t, err)
+	assert.Equal(t, eventstore.IntegrityReport{AggregateId: id, Events: 3}, report)
+
+	aggregates, err := store.Aggregates(context.Background(), account.ID{UUID: uuid.Nil}, 1000000)
+	assert.NoError(t, err)
+	assert.Contains(t, aggregates, id)
+}
+
+func TestSqlStore_RewritePayloadsOfArchivedEvents(t *testing.T) {
+	id := account.NewID()
+	appendChain(t, store, id, "first", "second", "third")
+	assert.NoError(t, store.Archive(context.Background(), eventstore.SerializedEvent{AggregateId: id, Seq: 3, Payload: []byte("tombstone"), EventType: 1}))
+
+	_, err := store.RewritePayloads(context.Background(), func(event eventstore.SerializedEvent) ([]byte, error) {
+		if event.AggregateId != id || string(event.Payload) != "second" {
+			return nil, nil
+		}
+		return []byte("rewritten second"), nil
+	})
+	assert.NoError(t, err)
+
+	events, err := store.WithStrictIntegrity().Events(context.Background(), id, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, events, 3) {
+		assert.Equal(t, "rewritten second", string(events[1].Payload))
+	}
+	report, err := store.VerifyIntegrity(context.Background(), id)
+	assert.NoError(t, err)
+	assert.Equal(t, eventstore.IntegrityReport{AggregateId: id, Events: 3}, report)
+}
+
+func TestSqlStore_TransactionOfArchivedEventsExists(t *testing.T) {
+	id, txId := account.NewID(), uuid.New()
+	event := eventstore.SerializedEvent{AggregateId: id, Seq: 1, Payload: []byte("first"), EventType: 1, SchemaVersion: 1, SerializerId: 1}
+	assert.NoError(t, store.Append(context.Background(), []eventstore.SerializedEvent{event}, nil, txId))
+	assert.NoError(t, store.Archive(context.Background(), eventstore.SerializedEvent{AggregateId: id, Seq: 1, Payload: []byte("tombstone"), EventType: 1}))
+
+	exists, err := store.TransactionExists(context.Background(), id, txId)
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	loaded, err := postgres.NewSingleRoundTripEventStore(database).LoadAggregate(context.Background(), id, 0, txId)
+	assert.NoError(t, err)
+	assert.True(t, loaded.TransactionExists)
+}
+
+func TestSqlStore_ArchiveFailsWithStaleTombstone(t *testing.T) {
+	id := account.NewID()
+	appendChain(t, store, id, "first", "second")
+
+	err := store.Archive(context.Background(), eventstore.SerializedEvent{AggregateId: id, Seq: 1, Payload: []byte("tombstone"), EventType: 1})
+
+	assert.Equal(t, account.ConcurrentModification, err)
+	assert.Equal(t, 2, countEvents(t, "Event", id))
+	assert.Equal(t, 0, countEvents(t, "EventArchive", id))
+}
+
+func TestSqlStore_ClosedAggregates(t *testing.T) {
+	closed, reopened := account.NewID(), account.NewID()
+	for _, id := range []account.ID{closed, reopened} {
+		assert.NoError(t, store.Append(context.Background(), []eventstore.SerializedEvent{
+			{AggregateId: id, Seq: 1, Payload: []byte("opened"), EventType: 2},
+			{AggregateId: id, Seq: 2, Payload: []byte("closed"), EventType: 5},
+		}, nil, uuid.New()))
+	}
+	deposited := eventstore.SerializedEvent{AggregateId: reopened, Seq: 3, Payload: []byte("deposited"), EventType: 3}
+	assert.NoError(t, store.Append(context.Background(), []eventstore.SerializedEvent{deposited}, nil, uuid.New()))
+
+	ids, err := store.ClosedAggregates(context.Background(), 5, time.Now().Add(time.Minute), account.ID{UUID: uuid.Nil}, 1000000)
+	assert.NoError(t, err)
+	assert.Contains(t, ids, closed)
+	assert.NotContains(t, ids, reopened)
+
+	ids, err = store.ClosedAggregates(context.Background(), 5, time.Now().Add(-time.Minute), account.ID{UUID: uuid.Nil}, 1000000)
+	assert.NoError(t, err)
+	assert.NotContains(t, ids, closed)
+}
+
+func TestMoveAggregate_MovesArchivedEvents(t *testing.T) {
+	id := account.NewID()
+	appendChain(t, store, id, "first", "second")
+	assert.NoError(t, store.Archive(context.Background(), eventstore.SerializedEvent{AggregateId: id, Seq: 2, Payload: []byte("tombstone"), EventType: 1}))
+
+	moved, err := postgres.MoveAggregate(context.Background(), database, replica, id)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, moved)
+	assert.Equal(t, 0, countEvents(t, "EventArchive", id))
+	events, err := postgres.NewEventStore(replica).Events(context.Background(), id, 0)
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+}
+
+func TestCheckSchemaVersion(t *testing.T) {
+	assert.NoError(t, postgres.CheckSchemaVersion(context.Background(), database))
+}
+
+func TestProbeWriteUpdatesTheSingleProbeRow(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, postgres.ProbeWrite(ctx, database))
+	var first time.Time
+	assert.NoError(t, database.QueryRow("SELECT probedAt FROM HealthProbe").Scan(&first))
+
+	assert.NoError(t, postgres.ProbeWrite(ctx, database))
+
+	var rows int
+	var second time.Time
+	assert.NoError(t, database.QueryRow("SELECT count(*), max(probedAt) FROM HealthProbe").Scan(&rows, &second))
+	assert.Equal(t, 1, rows)
+	assert.True(t, second.After(first))
+}
+
+func TestProbeWriteFailsWhenTransactionsAreReadOnly(t *testing.T) {
+	ctx := context.Background()
+	readOnly, err := openDatabase(postgresContainer, ctx, "event_store")
+	assert.NoError(t, err)
+	defer closeResource(readOnly)
+	// the setting holds for the session, so all queries have to run on the same connection
+	readOnly.SetMaxOpenConns(1)
+	_, err = readOnly.Exec("SET default_transaction_read_only = on")
+	assert.NoError(t, err)
+
+	err = postgres.ProbeWrite(ctx, readOnly)
+
+	assert.ErrorContains(t, err, "database does not take writes: pq: cannot execute INSERT in a read-only transaction")
+}
+
+func TestCheckReplicationLagOfDatabaseThatIsNoReplica(t *testing.T) {
+	assert.NoError(t, postgres.CheckReplicationLag(context.Background(), replica, 0))
+}
@@ -0,0 +1,70 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const (
+	// SchemaVersion is the version of the latest migration that the event store relies on
+	SchemaVersion = 17
+
+	selectSchemaVersionSql = "SELECT version, dirty FROM schema_migrations"
+
+	upsertHealthProbeSql = "INSERT INTO HealthProbe (id, probedAt) VALUES (1, now()) ON CONFLICT (id) DO UPDATE SET probedAt = excluded.probedAt"
+
+	// a replica is in recovery for as long as it replays the primary
+	selectInRecoverySql = "SELECT pg_is_in_recovery()"
+
+	// a replica that replayed all it received is not behind, no matter how long ago the primary was last written to.
+	// A database that is not a replica has no replay position and is not behind either.
+	selectReplicationLagSql = "SELECT CASE WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0 " +
+		"ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0) END"
+)
+
+// CheckSchemaVersion fails unless the schema of the database was migrated to SchemaVersion completely
+func CheckSchemaVersion(ctx context.Context, db *sql.DB) error {
+	var version int
+	var dirty bool
+	if err := db.QueryRowContext(ctx, selectSchemaVersionSql).Scan(&version, &dirty); err != nil {
+		return fmt.Errorf("could not read schema version: %w", err)
+	}
+	if dirty {
+		return fmt.Errorf("migration to schema version %d did not complete", version)
+	}
+	if version != SchemaVersion {
+		return fmt.Errorf("schema version is %d, expected %d", version, SchemaVersion)
+	}
+	return nil
+}
+
+// ProbeWrite fails unless the database commits a write, which a replica, a read only session or a database out of disk
+// space does not. Each probe updates the single row of the HealthProbe table, so that probing often does not grow it.
+func ProbeWrite(ctx context.Context, db *sql.DB) error {
+	err := withTransaction(ctx, db, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, upsertHealthProbeSql)
+		return err
+	})
+	if err == nil {
+		return nil
+	}
+	var inRecovery bool
+	if recoveryErr := db.QueryRowContext(ctx, selectInRecoverySql).Scan(&inRecovery); recoveryErr == nil && inRecovery {
+		return fmt.Errorf("database is a replica in recovery: %w", err)
+	}
+	return fmt.Errorf("database does not take writes: %w", err)
+}
+
+// CheckReplicationLag fails when the replica did not replay what the primary wrote during the last maxLag
+func CheckReplicationLag(ctx context.Context, replica *sql.DB, maxLag time.Duration) error {
+	var seconds float64
+	if err := replica.QueryRowContext(ctx, selectReplicationLagSql).Scan(&seconds); err != nil {
+		return fmt.Errorf("could not read replication lag: %w", err)
+	}
+	if lag := time.Duration(seconds * float64(time.Second)); lag > maxLag {
+		return fmt.Errorf("replica lags %v behind the primary, more than %v", lag.Round(time.Millisecond), maxLag)
+	}
+	return nil
+}
@@ -3,11 +3,19 @@
 package postgres_test
 
 import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/eventsourcing"
 	"github.com/rieske/event-sourced-account-go/eventstore"
+	"github.com/rieske/event-sourced-account-go/eventstore/postgres"
 	"github.com/rieske/event-sourced-account-go/serialization"
 	"github.com/rieske/event-sourced-account-go/test"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 	"testing"
+	"time"
 )
 
 func TestPostgresIntegration(t *testing.T) {
@@ -25,3 +33,157 @@ func TestPostgresIntegration(t *testing.T) {
 		suite.Run(t, test.NewConsistencyTestSuite(10, 8, 5, eventStore))
 	})
 }
+
+func TestPostgresJsonbIntegration(t *testing.T) {
+	eventStore := eventstore.NewSerializingEventStore(jsonbStore, serialization.NewJsonEventSerializer())
+
+	t.Run("EventsourcingTestSuite", func(t *testing.T) {
+		suite.Run(t, test.NewEventsourcingTestSuite(eventStore, 0))
+	})
+
+	t.Run("ConsistencyTestSuiteWithSnapshotting", func(t *testing.T) {
+		suite.Run(t, test.NewConsistencyTestSuite(10, 8, 5, eventStore))
+	})
+}
+
+func TestPostgresProtobufIntegration(t *testing.T) {
+	eventStore := eventstore.NewSerializingEventStore(store, serialization.NewProtobufEventSerializer())
+
+	t.Run("EventsourcingTestSuite", func(t *testing.T) {
+		suite.Run(t, test.NewEventsourcingTestSuite(eventStore, 0))
+	})
+
+	t.Run("ConsistencyTestSuiteWithSnapshotting", func(t *testing.T) {
+		suite.Run(t, test.NewConsistencyTestSuite(10, 8, 5, eventStore))
+	})
+}
+
+func TestPostgresSingleRoundTripIntegration(t *testing.T) {
+	eventStore := eventstore.NewSerializingAggregateStore(postgres.NewSingleRoundTripEventStore(database), serialization.NewMsgpackEventSerializer())
+
+	t.Run("EventsourcingTestSuite", func(t *testing.T) {
+		suite.Run(t, test.NewEventsourcingTestSuite(eventStore, 0))
+	})
+
+	t.Run("ConsistencyTestSuite", func(t *testing.T) {
+		suite.Run(t, test.NewConsistencyTestSuite(10, 8, 0, eventStore))
+	})
+
+	t.Run("ConsistencyTestSuiteWithSnapshotting", func(t *testing.T) {
+		suite.Run(t, test.NewConsistencyTestSuite(10, 8, 5, eventStore))
+	})
+}
+
+func TestPostgresArchivedAccountIsReadTransparently(t *testing.T) {
+	ctx := context.Background()
+	for _, eventStore := range []eventsourcing.EventStore{
+		eventstore.NewSerializingEventStore(store, serialization.NewMsgpackEventSerializer()),
+		eventstore.NewSerializingAggregateStore(postgres.NewSingleRoundTripEventStore(database), serialization.NewMsgpackEventSerializer()),
+	} {
+		service := eventsourcing.NewAccountService(eventStore, 0)
+		id, ownerID := account.NewID(), account.NewOwnerID()
+		assert.NoError(t, service.OpenAccount(ctx, id, ownerID))
+		assert.NoError(t, service.Deposit(ctx, id, uuid.New(), 10))
+		assert.NoError(t, service.Withdraw(ctx, id, uuid.New(), 10))
+		assert.NoError(t, service.CloseAccount(ctx, id))
+
+		assert.NoError(t, service.Archive(ctx, id))
+
+		snapshot, err := service.QueryAccount(ctx, id)
+		assert.NoError(t, err)
+		assert.Equal(t, account.Snapshot{ID: id, OwnerID: ownerID}, *snapshot)
+		events, err := service.Events(ctx, id)
+		assert.NoError(t, err)
+		assert.Len(t, events, 4)
+		assert.Equal(t, account.NotOpen, service.Deposit(ctx, id, uuid.New(), 1))
+		assert.Equal(t, account.Exists, service.OpenAccount(ctx, id, ownerID))
+	}
+}
+
+func TestPostgresReadsEventsWrittenByEachSerializer(t *testing.T) {
+	ctx := context.Background()
+	id := account.NewID()
+	msgpackStore := eventstore.NewSerializingEventStore(store, serialization.NewMsgpackEventSerializer())
+	assert.NoError(t, msgpackStore.Append(ctx, []eventstore.SequencedEvent{
+		{id, 1, account.AccountOpenedEvent{id, account.NewOwnerID()}},
+	}, nil, uuid.New()))
+	jsonStore := eventstore.NewSerializingEventStore(jsonbStore, serialization.NewJsonEventSerializer())
+	assert.NoError(t, jsonStore.Append(ctx, []eventstore.SequencedEvent{
+		{id, 2, account.MoneyDepositedEvent{5, 5}},
+	}, nil, uuid.New()))
+
+	protobufStore := eventstore.NewSerializingEventStore(
+		store,
+		serialization.NewProtobufEventSerializer(),
+		serialization.NewMsgpackEventSerializer(),
+		serialization.NewJsonEventSerializer(),
+	)
+	assert.NoError(t, protobufStore.Append(ctx, []eventstore.SequencedEvent{
+		{id, 3, account.MoneyWithdrawnEvent{2, 3}},
+	}, nil, uuid.New()))
+
+	events, err := protobufStore.Events(ctx, id, 0)
+
+	assert.NoError(t, err)
+	assert.Len(t, events, 3)
+	assert.Equal(t, account.MoneyDepositedEvent{5, 5}, events[1].Event)
+	assert.Equal(t, account.MoneyWithdrawnEvent{2, 3}, events[2].Event)
+}
+
+var errStoreUnavailable = errors.New("store unavailable")
+
+// unavailableStore fails appends while it is down
+type unavailableStore struct {
+	eventsourcing.EventStore
+	down bool
+}
+
+func (s *unavailableStore) Append(ctx context.Context, events []eventstore.SequencedEvent, snapshots map[account.ID]eventstore.SequencedEvent, txId uuid.UUID) error {
+	if s.down {
+		return errStoreUnavailable
+	}
+	return s.EventStore.Append(ctx, events, snapshots, txId)
+}
+
+func TestPostgresSagaStoreResumesTransferAfterRestart(t *testing.T) {
+	ctx := context.Background()
+	source := eventsourcing.NewAccountService(eventstore.NewInMemoryStore(), 0)
+	targetStore := &unavailableStore{EventStore: eventstore.NewInMemoryStore()}
+	target := eventsourcing.NewAccountService(targetStore, 0)
+	sourceAccount, targetAccount := account.NewID(), account.NewID()
+	assert.NoError(t, source.OpenAccount(ctx, sourceAccount, account.NewOwnerID()))
+	assert.NoError(t, source.Deposit(ctx, sourceAccount, uuid.New(), 100))
+	assert.NoError(t, target.OpenAccount(ctx, targetAccount, account.NewOwnerID()))
+	// each process manager has a store of its own over the same database, as if it ran in another process
+	newProcessManager := func() *eventsourcing.ProcessManager {
+		sagas := eventstore.NewSerializingSagaStore(postgres.NewSagaStore(database), eventsourcing.TransferSagaEvents)
+		return eventsourcing.NewTransferProcessManager(sagas, func(id account.ID) *eventsourcing.AccountService {
+			if id == sourceAccount {
+				return source
+			}
+			return target
+		})
+	}
+	transferId := uuid.New()
+	targetStore.down = true
+
+	err := eventsourcing.StartTransfer(ctx, newProcessManager(), sourceAccount, targetAccount, transferId, 40, time.Minute)
+
+	assert.Equal(t, errStoreUnavailable, err)
+	targetStore.down = false
+	assert.NoError(t, newProcessManager().Resume(ctx))
+
+	sourceSnapshot, err := source.QueryAccount(ctx, sourceAccount)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(60), sourceSnapshot.Balance)
+	targetSnapshot, err := target.QueryAccount(ctx, targetAccount)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(40), targetSnapshot.Balance)
+	sagaStore := postgres.NewSagaStore(database)
+	events, err := sagaStore.SagaEvents(ctx, transferId)
+	assert.NoError(t, err)
+	assert.Equal(t, "TransferCredited", events[len(events)-1].EventType)
+	active, err := sagaStore.ActiveSagas(ctx)
+	assert.NoError(t, err)
+	assert.NotContains(t, active, transferId)
+}
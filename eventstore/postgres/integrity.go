@@ -0,0 +1,61 @@
+package postgres
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/google/uuid"
+	"github.com/rieske/event-sourced-account-go/eventstore"
+)
+
+// chainedEvent is a stored event together with the fields its hash is chained by
+type chainedEvent struct {
+	eventstore.SerializedEvent
+	txId uuid.UUID
+	hash []byte
+}
+
+// hashChain follows the events of an aggregate in sequence and remembers the first one
+// that does not match its hash or does not follow the previous event
+type hashChain struct {
+	seq        int
+	hash       []byte
+	anchorHash []byte
+	brokenAt   int
+}
+
+// anchor starts the chain at the hash of an event that was verified before, unless the chain already started
+func (c *hashChain) anchor(hash []byte) {
+	if c.hash == nil {
+		c.hash = hash
+		c.anchorHash = hash
+	}
+}
+
+func (c *hashChain) follow(event chainedEvent) {
+	if c.brokenAt == 0 {
+		expected := chainHash(c.hash, event.Seq, event.txId, event.Payload)
+		if event.Seq != c.seq+1 || !bytes.Equal(expected, event.hash) {
+			c.brokenAt = event.Seq
+		}
+	}
+	c.seq, c.hash = event.Seq, event.hash
+}
+
+func (c hashChain) intact() bool {
+	return c.brokenAt == 0
+}
+
+// chainHash is sha256(previous hash || sequence number || transaction id || payload) - the same hash that the
+// append statement computes in the database
+func chainHash(previous []byte, seq int, txId uuid.UUID, payload []byte) []byte {
+	h := sha256.New()
+	h.Write(previous)
+	var s [8]byte
+	binary.BigEndian.PutUint64(s[:], uint64(seq))
+	h.Write(s[:])
+	h.Write(txId[:])
+	h.Write(payload)
+	return h.Sum(nil)
+}
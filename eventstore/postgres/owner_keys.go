@@ -0,0 +1,139 @@
+package postgres
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/serialization"
+)
+
+const (
+	// a key is not created for a forgotten owner, and a key that was created concurrently with forgetting the owner
+	// is not handed out as the tombstone is checked whenever a key is read
+	insertOwnerKeySql = "INSERT INTO OwnerKey(ownerId, keyId, key) SELECT $1, $2, $3 " +
+		"WHERE NOT EXISTS (SELECT 1 FROM ForgottenOwner WHERE ownerId = $1) ON CONFLICT (ownerId) DO NOTHING"
+	selectOwnerKeySql = "SELECT EXISTS (SELECT 1 FROM ForgottenOwner WHERE ownerId = $1), " +
+		"(SELECT keyId FROM OwnerKey WHERE ownerId = $1), (SELECT key FROM OwnerKey WHERE ownerId = $1)"
+	selectDataKeySql = "SELECT k.key FROM OwnerKey k WHERE k.keyId = $1 " +
+		"AND NOT EXISTS (SELECT 1 FROM ForgottenOwner f WHERE f.ownerId = k.ownerId)"
+	deleteOwnerKeySql        = "DELETE FROM OwnerKey WHERE ownerId = $1"
+	insertForgottenOwnerSql  = "INSERT INTO ForgottenOwner(ownerId) VALUES($1) ON CONFLICT (ownerId) DO NOTHING"
+	selectForgottenOwnersSql = "SELECT ownerId FROM ForgottenOwner WHERE forgottenAt > now() - make_interval(secs => $1)"
+)
+
+// OwnerKeyStore keeps a data encryption key per owner in the OwnerKey table and a tombstone per forgotten owner in the
+// ForgottenOwner table
+type OwnerKeyStore struct {
+	db                        *sql.DB
+	insertOwnerKeyStmt        *sql.Stmt
+	selectOwnerKeyStmt        *sql.Stmt
+	selectDataKeyStmt         *sql.Stmt
+	deleteOwnerKeyStmt        *sql.Stmt
+	insertForgottenOwnerStmt  *sql.Stmt
+	selectForgottenOwnersStmt *sql.Stmt
+}
+
+func NewOwnerKeyStore(db *sql.DB) *OwnerKeyStore {
+	return &OwnerKeyStore{
+		db:                        db,
+		insertOwnerKeyStmt:        prepareStatementOrPanic(db, insertOwnerKeySql),
+		selectOwnerKeyStmt:        prepareStatementOrPanic(db, selectOwnerKeySql),
+		selectDataKeyStmt:         prepareStatementOrPanic(db, selectDataKeySql),
+		deleteOwnerKeyStmt:        prepareStatementOrPanic(db, deleteOwnerKeySql),
+		insertForgottenOwnerStmt:  prepareStatementOrPanic(db, insertForgottenOwnerSql),
+		selectForgottenOwnersStmt: prepareStatementOrPanic(db, selectForgottenOwnersSql),
+	}
+}
+
+// OwnerKey returns the data key of the owner, creating one if the owner has none, or serialization.OwnerForgotten
+// if the owner was forgotten. Concurrent callers for the same owner all get the key that was stored first.
+func (s OwnerKeyStore) OwnerKey(ctx context.Context, owner account.OwnerID) (uuid.UUID, []byte, error) {
+	keyId, key, err := s.selectOwnerKey(ctx, owner)
+	if err != nil || key != nil {
+		return keyId, key, err
+	}
+
+	key = make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return uuid.Nil, nil, err
+	}
+	if _, err := s.insertOwnerKeyStmt.ExecContext(ctx, owner.UUID, uuid.New(), key); err != nil {
+		return uuid.Nil, nil, err
+	}
+	return s.selectOwnerKey(ctx, owner)
+}
+
+func (s OwnerKeyStore) selectOwnerKey(ctx context.Context, owner account.OwnerID) (uuid.UUID, []byte, error) {
+	var forgotten bool
+	var keyId uuid.NullUUID
+	var key []byte
+	if err := s.selectOwnerKeyStmt.QueryRowContext(ctx, owner.UUID).Scan(&forgotten, &keyId, &key); err != nil {
+		return uuid.Nil, nil, err
+	}
+	if forgotten {
+		return uuid.Nil, nil, serialization.OwnerForgotten
+	}
+	return keyId.UUID, key, nil
+}
+
+// DataKey returns the data key with the id, or nil if it was deleted
+func (s OwnerKeyStore) DataKey(ctx context.Context, keyId uuid.UUID) (key []byte, err error) {
+	err = sqlSelect(
+		ctx,
+		s.selectDataKeyStmt,
+		func(rows *sql.Rows) error {
+			if rows.Next() {
+				return rows.Scan(&key)
+			}
+			return nil
+		},
+		keyId,
+	)
+	return
+}
+
+// DeleteOwnerKey deletes the data key of the owner, making their personal data in stored events unrecoverable, and
+// leaves a tombstone so that no key is created for the owner again. Tells whether the owner had a key.
+func (s OwnerKeyStore) DeleteOwnerKey(ctx context.Context, owner account.OwnerID) (bool, error) {
+	var deleted int64
+	err := withTransaction(ctx, s.db, func(tx *sql.Tx) error {
+		if _, err := tx.StmtContext(ctx, s.insertForgottenOwnerStmt).ExecContext(ctx, owner.UUID); err != nil {
+			return err
+		}
+		res, err := tx.StmtContext(ctx, s.deleteOwnerKeyStmt).ExecContext(ctx, owner.UUID)
+		if err != nil {
+			return err
+		}
+		deleted, err = res.RowsAffected()
+		return err
+	})
+	return deleted > 0, err
+}
+
+// ForgottenOwners lists the owners forgotten within the duration before now, by the clock of the database
+func (s OwnerKeyStore) ForgottenOwners(ctx context.Context, within time.Duration) ([]account.OwnerID, error) {
+	var owners []account.OwnerID
+
+	err := sqlSelect(
+		ctx,
+		s.selectForgottenOwnersStmt,
+		func(rows *sql.Rows) error {
+			for rows.Next() {
+				var owner account.OwnerID
+				if err := rows.Scan(&owner.UUID); err != nil {
+					return err
+				}
+				owners = append(owners, owner)
+			}
+			return nil
+		},
+		within.Seconds(),
+	)
+
+	return owners, err
+}
@@ -0,0 +1,225 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rieske/event-sourced-account-go/account"
+)
+
+// the statements on events are formatted with the table the events are in, Event or EventArchive
+const (
+	selectAggregateEventsSql = "SELECT sequenceNumber, transactionId, eventType, schemaVersion, serializerId, payload, jsonPayload, hash, createdAt " +
+		"FROM %[1]s WHERE aggregateId = $1 ORDER BY sequenceNumber FOR UPDATE"
+	// an event that is already there is only accepted if it is the same one, left behind by an interrupted move
+	copyEventSql = "INSERT INTO %[1]s(aggregateId, sequenceNumber, transactionId, eventType, schemaVersion, serializerId, payload, jsonPayload, hash, createdAt) " +
+		"VALUES($1, $2, $3, $4, $5, $6, $7, $8::jsonb, $9, $10) " +
+		"ON CONFLICT (aggregateId, sequenceNumber) DO UPDATE SET hash = %[1]s.hash WHERE %[1]s.hash = EXCLUDED.hash"
+	// only the copied events are deleted, an event appended meanwhile is left in place and fails the move
+	deleteAggregateEventsSql = "DELETE FROM %[1]s WHERE aggregateId = $1 AND sequenceNumber <= $2"
+	countAggregateEventsSql  = "SELECT count(*) FROM %[1]s WHERE aggregateId = $1"
+
+	// the same lock that appends to the aggregate take shared, see 012_moved_aggregate.up.sql
+	lockAggregateSql = "SELECT pg_advisory_xact_lock(hashtextextended($1::uuid::text, 0))"
+	markMovedSql     = "INSERT INTO MovedAggregate(aggregateId) VALUES($1) ON CONFLICT (aggregateId) DO UPDATE SET movedAt = now()"
+	unmarkMovedSql   = "DELETE FROM MovedAggregate WHERE aggregateId = $1"
+
+	selectAggregateSnapshotSql = "SELECT sequenceNumber, eventType, schemaVersion, serializerId, payload, jsonPayload FROM Snapshot WHERE aggregateId = $1 FOR UPDATE"
+	copySnapshotSql            = "INSERT INTO Snapshot(aggregateId, sequenceNumber, eventType, schemaVersion, serializerId, payload, jsonPayload) " +
+		"VALUES($1, $2, $3, $4, $5, $6, $7::jsonb) " +
+		"ON CONFLICT (aggregateId) DO UPDATE SET sequenceNumber=EXCLUDED.sequenceNumber, eventType=EXCLUDED.eventType, " +
+		"schemaVersion=EXCLUDED.schemaVersion, serializerId=EXCLUDED.serializerId, payload=EXCLUDED.payload, jsonPayload=EXCLUDED.jsonPayload " +
+		"WHERE Snapshot.sequenceNumber <= EXCLUDED.sequenceNumber"
+	deleteAggregateSnapshotSql = "DELETE FROM Snapshot WHERE aggregateId = $1 AND sequenceNumber <= $2"
+
+	selectCommandResultTransactionsSql = "SELECT transactionId FROM CommandResult WHERE transactionId > $1 ORDER BY transactionId LIMIT $2"
+	selectCommandResultForUpdateSql    = "SELECT operation, fingerprint, error, createdAt FROM CommandResult WHERE transactionId = $1 FOR UPDATE"
+	copyCommandResultSql               = "INSERT INTO CommandResult(transactionId, operation, fingerprint, error, createdAt) VALUES($1, $2, $3, $4, $5) " +
+		"ON CONFLICT (transactionId) DO NOTHING"
+	deleteCommandResultSql = "DELETE FROM CommandResult WHERE transactionId = $1"
+)
+
+type storedEvent struct {
+	seq                                    int
+	txId                                   uuid.UUID
+	eventType, schemaVersion, serializerId int
+	payload                                []byte
+	jsonPayload                            sql.NullString
+	hash                                   []byte
+	createdAt                              time.Time
+}
+
+// eventTables are the tables that the events of an aggregate can be in
+var eventTables = []string{"Event", "EventArchive"}
+
+// MoveAggregate moves the events, archived ones included, and the snapshot of the aggregate from one database to
+// another, for example when the aggregate moves to another shard. Events keep their transaction ids, timestamps and
+// hashes, so the moved stream reads and verifies the same. Appends to the aggregate wait for the move to complete and
+// are rejected by the source database afterwards, so an instance that still routes the aggregate there fails instead
+// of writing events that would be lost. A move that was interrupted after copying can be run again.
+// Returns the number of events moved.
+func MoveAggregate(ctx context.Context, from, to *sql.DB, id account.ID) (int, error) {
+	source, err := from.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer source.Rollback()
+	if _, err := source.ExecContext(ctx, lockAggregateSql, id); err != nil {
+		return 0, err
+	}
+
+	target, err := to.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer target.Rollback()
+	// the aggregate may be moving back to a database it was moved away from before
+	if _, err := target.ExecContext(ctx, unmarkMovedSql, id); err != nil {
+		return 0, err
+	}
+
+	moved := 0
+	copiedUpTo := map[string]int{}
+	for _, table := range eventTables {
+		events, err := lockAggregateEvents(ctx, source, table, id)
+		if err != nil {
+			return 0, err
+		}
+		if err := copyEvents(ctx, target, table, id, events); err != nil {
+			return 0, err
+		}
+		if len(events) != 0 {
+			copiedUpTo[table] = events[len(events)-1].seq
+		}
+		moved += len(events)
+	}
+	snapshotSeq, err := copySnapshot(ctx, source, target, id)
+	if err != nil {
+		return 0, err
+	}
+	if err := target.Commit(); err != nil {
+		return 0, err
+	}
+
+	for _, table := range eventTables {
+		if _, err := source.ExecContext(ctx, fmt.Sprintf(deleteAggregateEventsSql, table), id, copiedUpTo[table]); err != nil {
+			return 0, err
+		}
+		var remaining int
+		if err := source.QueryRowContext(ctx, fmt.Sprintf(countAggregateEventsSql, table), id).Scan(&remaining); err != nil {
+			return 0, err
+		}
+		if remaining != 0 {
+			return 0, fmt.Errorf("%d events of aggregate %v were appended to %s while it moved", remaining, id, table)
+		}
+	}
+	if _, err := source.ExecContext(ctx, deleteAggregateSnapshotSql, id, snapshotSeq); err != nil {
+		return 0, err
+	}
+	if _, err := source.ExecContext(ctx, markMovedSql, id); err != nil {
+		return 0, err
+	}
+	return moved, source.Commit()
+}
+
+func copyEvents(ctx context.Context, target *sql.Tx, table string, id account.ID, events []storedEvent) error {
+	for _, e := range events {
+		result, err := target.ExecContext(ctx, fmt.Sprintf(copyEventSql, table),
+			id, e.seq, e.txId, e.eventType, e.schemaVersion, e.serializerId, e.payload, e.jsonPayload, e.hash, e.createdAt)
+		if err != nil {
+			return err
+		}
+		copied, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if copied == 0 {
+			return fmt.Errorf("could not move event %d of aggregate %v, the target has another event in its place", e.seq, id)
+		}
+	}
+	return nil
+}
+
+func lockAggregateEvents(ctx context.Context, tx *sql.Tx, table string, id account.ID) ([]storedEvent, error) {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(selectAggregateEventsSql, table), id)
+	if err != nil {
+		return nil, err
+	}
+	defer closeResource(rows)
+
+	var events []storedEvent
+	for rows.Next() {
+		var e storedEvent
+		err := rows.Scan(&e.seq, &e.txId, &e.eventType, &e.schemaVersion, &e.serializerId, &e.payload, &e.jsonPayload, &e.hash, &e.createdAt)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// copySnapshot copies the snapshot of the aggregate, if it has one, and returns its sequence number
+func copySnapshot(ctx context.Context, source, target *sql.Tx, id account.ID) (int, error) {
+	var seq, eventType, schemaVersion, serializerId int
+	var payload []byte
+	var jsonPayload sql.NullString
+	err := source.QueryRowContext(ctx, selectAggregateSnapshotSql, id).Scan(&seq, &eventType, &schemaVersion, &serializerId, &payload, &jsonPayload)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	_, err = target.ExecContext(ctx, copySnapshotSql, id, seq, eventType, schemaVersion, serializerId, payload, jsonPayload)
+	return seq, err
+}
+
+// CommandResultTransactions lists up to limit transaction ids of recorded command results, in order, starting after the given one
+func CommandResultTransactions(ctx context.Context, db *sql.DB, after uuid.UUID, limit int) ([]uuid.UUID, error) {
+	rows, err := db.QueryContext(ctx, selectCommandResultTransactionsSql, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer closeResource(rows)
+
+	var txIds []uuid.UUID
+	for rows.Next() {
+		var txId uuid.UUID
+		if err := rows.Scan(&txId); err != nil {
+			return nil, err
+		}
+		txIds = append(txIds, txId)
+	}
+	return txIds, rows.Err()
+}
+
+// MoveCommandResult moves the recorded result of the transaction from one database to another,
+// the result already recorded in the target wins
+func MoveCommandResult(ctx context.Context, from, to *sql.DB, txId uuid.UUID) error {
+	source, err := from.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer source.Rollback()
+
+	var operation, fingerprint, errorMessage string
+	var createdAt time.Time
+	err = source.QueryRowContext(ctx, selectCommandResultForUpdateSql, txId).Scan(&operation, &fingerprint, &errorMessage, &createdAt)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := to.ExecContext(ctx, copyCommandResultSql, txId, operation, fingerprint, errorMessage, createdAt); err != nil {
+		return err
+	}
+	if _, err := source.ExecContext(ctx, deleteCommandResultSql, txId); err != nil {
+		return err
+	}
+	return source.Commit()
+}
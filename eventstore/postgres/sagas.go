@@ -0,0 +1,99 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/rieske/event-sourced-account-go/eventstore"
+)
+
+const (
+	selectSagaEventsSql = "SELECT sequenceNumber, eventType, payload FROM SagaEvent WHERE sagaId = $1 ORDER BY sequenceNumber"
+	insertSagaEventSql  = "INSERT INTO SagaEvent(sagaId, sequenceNumber, eventType, payload) VALUES($1, $2, $3, $4::jsonb)"
+	// a saga is active from its first event on until its final one
+	insertActiveSagaSql = "INSERT INTO ActiveSaga(sagaId) VALUES($1) ON CONFLICT (sagaId) DO NOTHING"
+	deleteActiveSagaSql = "DELETE FROM ActiveSaga WHERE sagaId = $1"
+	selectActiveSagaSql = "SELECT sagaId FROM ActiveSaga"
+)
+
+// SagaStore keeps the events of sagas in the SagaEvent table, so that sagas are resumed after a restart
+type SagaStore struct {
+	db                   *sql.DB
+	selectSagaEventsStmt *sql.Stmt
+	insertSagaEventStmt  *sql.Stmt
+	insertActiveSagaStmt *sql.Stmt
+	deleteActiveSagaStmt *sql.Stmt
+	selectActiveSagaStmt *sql.Stmt
+}
+
+func NewSagaStore(db *sql.DB) *SagaStore {
+	return &SagaStore{
+		db:                   db,
+		selectSagaEventsStmt: prepareStatementOrPanic(db, selectSagaEventsSql),
+		insertSagaEventStmt:  prepareStatementOrPanic(db, insertSagaEventSql),
+		insertActiveSagaStmt: prepareStatementOrPanic(db, insertActiveSagaSql),
+		deleteActiveSagaStmt: prepareStatementOrPanic(db, deleteActiveSagaSql),
+		selectActiveSagaStmt: prepareStatementOrPanic(db, selectActiveSagaSql),
+	}
+}
+
+func (s SagaStore) SagaEvents(ctx context.Context, sagaId uuid.UUID) ([]eventstore.SerializedSagaEvent, error) {
+	var events []eventstore.SerializedSagaEvent
+	err := sqlSelect(
+		ctx,
+		s.selectSagaEventsStmt,
+		func(rows *sql.Rows) error {
+			for rows.Next() {
+				event := eventstore.SerializedSagaEvent{SagaId: sagaId}
+				if err := rows.Scan(&event.Seq, &event.EventType, &event.Payload); err != nil {
+					return err
+				}
+				events = append(events, event)
+			}
+			return nil
+		},
+		sagaId,
+	)
+	return events, err
+}
+
+// AppendSagaEvents writes events in sequence per saga, either all or none of them.
+// An event that is already there fails the append with account.ConcurrentModification.
+func (s SagaStore) AppendSagaEvents(ctx context.Context, events []eventstore.SerializedSagaEvent) error {
+	err := withTransaction(ctx, s.db, func(tx *sql.Tx) error {
+		for _, e := range events {
+			if _, err := tx.StmtContext(ctx, s.insertSagaEventStmt).ExecContext(ctx, e.SagaId, e.Seq, e.EventType, string(e.Payload)); err != nil {
+				return err
+			}
+			activeStmt := s.insertActiveSagaStmt
+			if e.Final {
+				activeStmt = s.deleteActiveSagaStmt
+			}
+			if _, err := tx.StmtContext(ctx, activeStmt).ExecContext(ctx, e.SagaId); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return toConcurrentModification(err)
+}
+
+func (s SagaStore) ActiveSagas(ctx context.Context) ([]uuid.UUID, error) {
+	var active []uuid.UUID
+	err := sqlSelect(
+		ctx,
+		s.selectActiveSagaStmt,
+		func(rows *sql.Rows) error {
+			for rows.Next() {
+				var sagaId uuid.UUID
+				if err := rows.Scan(&sagaId); err != nil {
+					return err
+				}
+				active = append(active, sagaId)
+			}
+			return nil
+		},
+	)
+	return active, err
+}
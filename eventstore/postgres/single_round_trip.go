@@ -0,0 +1,130 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/eventstore"
+)
+
+const (
+	loadAggregateSql = "SELECT kind, sequenceNumber, transactionId, hash, eventType, schemaVersion, serializerId, payload " +
+		"FROM load_aggregate($1, $2, $3)"
+	appendEventsFunctionSql = "SELECT append_events($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)"
+
+	// kinds of rows returned by load_aggregate
+	snapshotRow          = 0
+	eventRow             = 1
+	transactionExistsRow = 2
+)
+
+// SingleRoundTripEventStore is an EventStore that loads what a command needs and appends its outcome using one
+// server side function call each, instead of a query per snapshot, events and transaction check and a transaction
+// around the appends. Payloads have to be binary.
+type SingleRoundTripEventStore struct {
+	*EventStore
+	loadAggregateStmt *sql.Stmt
+	appendEventsStmt  *sql.Stmt
+}
+
+func NewSingleRoundTripEventStore(db *sql.DB) *SingleRoundTripEventStore {
+	return &SingleRoundTripEventStore{
+		EventStore:        NewEventStore(db),
+		loadAggregateStmt: prepareStatementOrPanic(db, loadAggregateSql),
+		appendEventsStmt:  prepareStatementOrPanic(db, appendEventsFunctionSql),
+	}
+}
+
+// WithStrictIntegrity makes reading events from a broken hash chain fail with eventstore.IntegrityViolation
+// instead of only logging it
+func (es SingleRoundTripEventStore) WithStrictIntegrity() *SingleRoundTripEventStore {
+	es.EventStore = es.EventStore.WithStrictIntegrity()
+	return &es
+}
+
+// LoadAggregate reads the latest snapshot unless it is not past the version, the events following the snapshot or
+// the version and whether the transaction already touched the aggregate, all in one query
+func (es SingleRoundTripEventStore) LoadAggregate(ctx context.Context, id account.ID, version int, txId uuid.UUID) (eventstore.SerializedAggregate, error) {
+	var aggregate eventstore.SerializedAggregate
+	chain := &hashChain{seq: version}
+
+	err := sqlSelect(
+		ctx,
+		es.loadAggregateStmt,
+		func(rows *sql.Rows) error {
+			for rows.Next() {
+				var kind int
+				var seq, eventType, schemaVersion, serializerId sql.NullInt64
+				var rowTxId uuid.NullUUID
+				var hash, payload []byte
+				if err := rows.Scan(&kind, &seq, &rowTxId, &hash, &eventType, &schemaVersion, &serializerId, &payload); err != nil {
+					return err
+				}
+				event := eventstore.SerializedEvent{
+					AggregateId:   id,
+					Seq:           int(seq.Int64),
+					Payload:       payload,
+					EventType:     int(eventType.Int64),
+					SchemaVersion: int(schemaVersion.Int64),
+					SerializerId:  int(serializerId.Int64),
+				}
+
+				switch kind {
+				case snapshotRow:
+					aggregate.Snapshot = &event
+					chain.seq = event.Seq
+				case eventRow:
+					if event.Seq == chain.seq {
+						chain.anchor(hash)
+						continue
+					}
+					chain.follow(chainedEvent{SerializedEvent: event, txId: rowTxId.UUID, hash: hash})
+					if err := es.checkIntegrity(chain, event.Seq, id); err != nil {
+						return err
+					}
+					aggregate.Events = append(aggregate.Events, event)
+				case transactionExistsRow:
+					aggregate.TransactionExists = true
+				}
+			}
+			return nil
+		},
+		id, version, txId,
+	)
+
+	return aggregate, err
+}
+
+// Append appends the events and snapshots, together with the result of the command that is pending in the context,
+// unless the transaction already touched one of the aggregates, in which case it is a concurrent modification - the
+// transaction completed since the aggregates were loaded
+func (es SingleRoundTripEventStore) Append(ctx context.Context, events []eventstore.SerializedEvent, snapshots []eventstore.SerializedEvent, txId uuid.UUID) error {
+	e, s := newBatchColumns(events), newBatchColumns(snapshots)
+	var operation, fingerprint, commandError sql.NullString
+	result, recorded := eventstore.PendingCommandResult(ctx, txId)
+	if result != nil {
+		operation = sql.NullString{String: result.Operation, Valid: true}
+		fingerprint = sql.NullString{String: result.Fingerprint, Valid: true}
+		commandError = sql.NullString{String: result.Error, Valid: true}
+	}
+	var appended bool
+	err := es.appendEventsStmt.QueryRowContext(
+		ctx,
+		pq.Array(e.ids), pq.Array(e.seqs), txId, pq.Array(e.eventTypes), pq.Array(e.schemaVersions), pq.Array(e.serializerIds), pq.Array(e.payloads),
+		pq.Array(s.ids), pq.Array(s.seqs), pq.Array(s.eventTypes), pq.Array(s.schemaVersions), pq.Array(s.serializerIds), pq.Array(s.payloads),
+		operation, fingerprint, commandError,
+	).Scan(&appended)
+	if err != nil {
+		return toConcurrentModification(err)
+	}
+	if !appended {
+		return account.ConcurrentModification
+	}
+	if result != nil {
+		recorded()
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package eventstore
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/internal/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// SerializedAggregate is a LoadedAggregate as read from the store
+type SerializedAggregate struct {
+	Snapshot          *SerializedEvent
+	Events            []SerializedEvent
+	TransactionExists bool
+}
+
+type aggregateStore interface {
+	eventStore
+	LoadAggregate(ctx context.Context, id account.ID, version int, txId uuid.UUID) (SerializedAggregate, error)
+}
+
+// serializingAggregateStore is a serializingEventStore over a store that can load aggregates in a single round trip
+type serializingAggregateStore struct {
+	*serializingEventStore
+	loader aggregateStore
+}
+
+func NewSerializingAggregateStore(store aggregateStore, serializer eventSerializer, readers ...eventSerializer) *serializingAggregateStore {
+	return &serializingAggregateStore{
+		serializingEventStore: NewSerializingEventStore(store, serializer, readers...),
+		loader:                store,
+	}
+}
+
+func (s serializingAggregateStore) LoadAggregate(ctx context.Context, id account.ID, version int, txId uuid.UUID) (_ LoadedAggregate, err error) {
+	ctx, span := tracer.StartSpan(ctx, "eventStore.LoadAggregate",
+		telemetry.AccountAttribute(id), attribute.Int("eventStore.version", version), attribute.String("transaction.id", txId.String()))
+	defer func() { telemetry.EndSpan(span, err) }()
+
+	serialized, err := s.loader.LoadAggregate(ctx, id, version, txId)
+	if err != nil {
+		return LoadedAggregate{}, err
+	}
+
+	loaded := LoadedAggregate{TransactionExists: serialized.TransactionExists}
+	if serialized.Snapshot != nil {
+		snapshot, err := s.deserializeAll(ctx, []SerializedEvent{*serialized.Snapshot})
+		if err != nil {
+			return LoadedAggregate{}, err
+		}
+		loaded.Snapshot = snapshot[0]
+	}
+	if loaded.Events, err = s.deserializeAll(ctx, serialized.Events); err != nil {
+		return LoadedAggregate{}, err
+	}
+	return loaded, nil
+}
@@ -2,9 +2,13 @@ package eventstore
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/internal/telemetry"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type SerializedEvent struct {
@@ -12,40 +16,99 @@ type SerializedEvent struct {
 	Seq         int
 	Payload     []byte
 	EventType   int
+	// SchemaVersion is the version of the payload shape of the event type
+	SchemaVersion int
+	// SerializerId identifies the serializer that wrote the payload
+	SerializerId int
+	// TransactionId and Timestamp are only populated when reading timestamped events
+	TransactionId uuid.UUID
+	Timestamp     time.Time
 }
 
 type eventSerializer interface {
-	SerializeEvent(e SequencedEvent) (SerializedEvent, error)
-	DeserializeEvent(s SerializedEvent) (SequencedEvent, error)
+	SerializerId() int
+	SerializeEvent(ctx context.Context, e SequencedEvent) (SerializedEvent, error)
+	DeserializeEvent(ctx context.Context, s SerializedEvent) (SequencedEvent, error)
 }
 
 type eventStore interface {
 	Events(ctx context.Context, id account.ID, version int) ([]SerializedEvent, error)
+	StreamEvents(ctx context.Context, id account.ID, version int, handle func(SerializedEvent) error) error
+	TimestampedEvents(ctx context.Context, id account.ID, version int) ([]SerializedEvent, error)
 	Append(ctx context.Context, events []SerializedEvent, snapshots []SerializedEvent, txId uuid.UUID) error
 	LoadSnapshot(ctx context.Context, id account.ID) (*SerializedEvent, error)
 	TransactionExists(ctx context.Context, id account.ID, txId uuid.UUID) (bool, error)
+	TransactionParticipants(ctx context.Context, txIds []uuid.UUID) (map[uuid.UUID][]account.ID, error)
+	VerifyIntegrity(ctx context.Context, id account.ID) (IntegrityReport, error)
+	Archive(ctx context.Context, tombstone SerializedEvent) error
+	LoadCommandResult(ctx context.Context, txId uuid.UUID) (*CommandResult, error)
+	StoreCommandResult(ctx context.Context, result CommandResult) (CommandResult, error)
 }
 
 type serializingEventStore struct {
 	store      eventStore
 	serializer eventSerializer
+	readers    map[int]eventSerializer
 }
 
-func NewSerializingEventStore(store eventStore, serializer eventSerializer) *serializingEventStore {
-	return &serializingEventStore{
+// NewSerializingEventStore creates a store that writes events with the given serializer.
+// Events are read with the serializer that wrote them, which has to be either the given one or one of the readers.
+func NewSerializingEventStore(store eventStore, serializer eventSerializer, readers ...eventSerializer) *serializingEventStore {
+	s := &serializingEventStore{
 		store:      store,
 		serializer: serializer,
+		readers:    map[int]eventSerializer{},
 	}
+	for _, reader := range readers {
+		s.readers[reader.SerializerId()] = reader
+	}
+	// the writer takes precedence over a reader with the same id
+	s.readers[serializer.SerializerId()] = serializer
+	return s
 }
 
-func (s serializingEventStore) Events(ctx context.Context, id account.ID, version int) ([]SequencedEvent, error) {
-	serializedEvents, err := s.store.Events(ctx, id, version)
-	if err != nil {
-		return nil, err
+func (s serializingEventStore) serialize(ctx context.Context, e SequencedEvent) (SerializedEvent, error) {
+	serialized, err := s.serializer.SerializeEvent(ctx, e)
+	serialized.SerializerId = s.serializer.SerializerId()
+	return serialized, err
+}
+
+func (s serializingEventStore) deserialize(ctx context.Context, se SerializedEvent) (SequencedEvent, error) {
+	if se.SerializerId == 0 {
+		// the serializer is not known, assuming the current one
+		return s.serializer.DeserializeEvent(ctx, se)
+	}
+	reader, ok := s.readers[se.SerializerId]
+	if !ok {
+		return SequencedEvent{}, fmt.Errorf("no serializer with id %d to read event %d of aggregate %v", se.SerializerId, se.Seq, se.AggregateId)
+	}
+	return reader.DeserializeEvent(ctx, se)
+}
+
+// serializeAll serializes the events in order
+func (s serializingEventStore) serializeAll(ctx context.Context, events []SequencedEvent) (_ []SerializedEvent, err error) {
+	ctx, span := tracer.StartSpan(ctx, "serializer.serialize", attribute.Int("serializer.id", s.serializer.SerializerId()), attribute.Int("serializer.events", len(events)))
+	defer func() { telemetry.EndSpan(span, err) }()
+
+	serializedEvents := make([]SerializedEvent, 0, len(events))
+	for _, event := range events {
+		serializedEvent, err := s.serialize(ctx, event)
+		if err != nil {
+			return nil, err
+		}
+		serializedEvents = append(serializedEvents, serializedEvent)
 	}
+	return serializedEvents, nil
+}
+
+// deserializeAll deserializes the events in order
+func (s serializingEventStore) deserializeAll(ctx context.Context, serializedEvents []SerializedEvent) (_ []SequencedEvent, err error) {
+	ctx, span := tracer.StartSpan(ctx, "serializer.deserialize", attribute.Int("serializer.events", len(serializedEvents)))
+	defer func() { telemetry.EndSpan(span, err) }()
+
 	events := make([]SequencedEvent, 0, len(serializedEvents))
 	for _, serializedEvent := range serializedEvents {
-		event, err := s.serializer.DeserializeEvent(serializedEvent)
+		event, err := s.deserialize(ctx, serializedEvent)
 		if err != nil {
 			return nil, err
 		}
@@ -54,38 +117,136 @@ func (s serializingEventStore) Events(ctx context.Context, id account.ID, versio
 	return events, nil
 }
 
-func (s serializingEventStore) Append(ctx context.Context, events []SequencedEvent, snapshots map[account.ID]SequencedEvent, txId uuid.UUID) error {
-	serializedEvents := make([]SerializedEvent, 0, len(events))
-	for _, event := range events {
-		serializedEvent, err := s.serializer.SerializeEvent(event)
+func (s serializingEventStore) Events(ctx context.Context, id account.ID, version int) (_ []SequencedEvent, err error) {
+	ctx, span := tracer.StartSpan(ctx, "eventStore.Events", telemetry.AccountAttribute(id), attribute.Int("eventStore.version", version))
+	defer func() { telemetry.EndSpan(span, err) }()
+
+	serializedEvents, err := s.store.Events(ctx, id, version)
+	if err != nil {
+		return nil, err
+	}
+	return s.deserializeAll(ctx, serializedEvents)
+}
+
+// StreamEvents decodes the events of the aggregate following the version one at a time and hands them to handle.
+// The events are deserialized as they are read, so their count is recorded on the span of the call instead of a span of
+// their own.
+func (s serializingEventStore) StreamEvents(ctx context.Context, id account.ID, version int, handle func(SequencedEvent) error) (err error) {
+	ctx, span := tracer.StartSpan(ctx, "eventStore.StreamEvents", telemetry.AccountAttribute(id), attribute.Int("eventStore.version", version))
+	deserialized := 0
+	defer func() {
+		span.SetAttributes(attribute.Int("serializer.events", deserialized))
+		telemetry.EndSpan(span, err)
+	}()
+
+	return s.store.StreamEvents(ctx, id, version, func(serializedEvent SerializedEvent) error {
+		event, err := s.deserialize(ctx, serializedEvent)
 		if err != nil {
 			return err
 		}
-		serializedEvents = append(serializedEvents, serializedEvent)
+		deserialized++
+		return handle(event)
+	})
+}
+
+func (s serializingEventStore) TimestampedEvents(ctx context.Context, id account.ID, version int) (_ []TimestampedEvent, err error) {
+	ctx, span := tracer.StartSpan(ctx, "eventStore.TimestampedEvents", telemetry.AccountAttribute(id), attribute.Int("eventStore.version", version))
+	defer func() { telemetry.EndSpan(span, err) }()
+
+	serializedEvents, err := s.store.TimestampedEvents(ctx, id, version)
+	if err != nil {
+		return nil, err
+	}
+	sequencedEvents, err := s.deserializeAll(ctx, serializedEvents)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]TimestampedEvent, 0, len(serializedEvents))
+	for i, serializedEvent := range serializedEvents {
+		events = append(events, TimestampedEvent{
+			SequencedEvent: sequencedEvents[i],
+			TransactionId:  serializedEvent.TransactionId,
+			Timestamp:      serializedEvent.Timestamp,
+		})
+	}
+	return events, nil
+}
+
+func (s serializingEventStore) Append(ctx context.Context, events []SequencedEvent, snapshots map[account.ID]SequencedEvent, txId uuid.UUID) (err error) {
+	ctx, span := tracer.StartSpan(ctx, "eventStore.Append",
+		attribute.String("transaction.id", txId.String()),
+		attribute.Int("eventStore.events", len(events)),
+		attribute.Int("eventStore.snapshots", len(snapshots)))
+	defer func() { telemetry.EndSpan(span, err) }()
+
+	serializedEvents, err := s.serializeAll(ctx, events)
+	if err != nil {
+		return err
 	}
-	serializedSnapshots := make([]SerializedEvent, 0, len(snapshots))
+	snapshotEvents := make([]SequencedEvent, 0, len(snapshots))
 	for _, snapshot := range snapshots {
-		serializedSnapshot, err := s.serializer.SerializeEvent(snapshot)
-		if err != nil {
-			return err
-		}
-		serializedSnapshots = append(serializedSnapshots, serializedSnapshot)
+		snapshotEvents = append(snapshotEvents, snapshot)
+	}
+	serializedSnapshots, err := s.serializeAll(ctx, snapshotEvents)
+	if err != nil {
+		return err
 	}
 	return s.store.Append(ctx, serializedEvents, serializedSnapshots, txId)
 }
 
-func (s serializingEventStore) LoadSnapshot(ctx context.Context, id account.ID) (SequencedEvent, error) {
+func (s serializingEventStore) LoadSnapshot(ctx context.Context, id account.ID) (_ SequencedEvent, err error) {
+	ctx, span := tracer.StartSpan(ctx, "eventStore.LoadSnapshot", telemetry.AccountAttribute(id))
+	defer func() { telemetry.EndSpan(span, err) }()
+
 	serializedSnapshot, err := s.store.LoadSnapshot(ctx, id)
 	if err != nil || serializedSnapshot == nil {
 		return SequencedEvent{}, err
 	}
-	snapshot, err := s.serializer.DeserializeEvent(*serializedSnapshot)
+	snapshot, err := s.deserializeAll(ctx, []SerializedEvent{*serializedSnapshot})
 	if err != nil {
 		return SequencedEvent{}, err
 	}
-	return snapshot, nil
+	return snapshot[0], nil
 }
 
-func (s serializingEventStore) TransactionExists(ctx context.Context, id account.ID, txId uuid.UUID) (bool, error) {
+func (s serializingEventStore) TransactionExists(ctx context.Context, id account.ID, txId uuid.UUID) (_ bool, err error) {
+	ctx, span := tracer.StartSpan(ctx, "eventStore.TransactionExists", telemetry.AccountAttribute(id), attribute.String("transaction.id", txId.String()))
+	defer func() { telemetry.EndSpan(span, err) }()
 	return s.store.TransactionExists(ctx, id, txId)
 }
+
+func (s serializingEventStore) TransactionParticipants(ctx context.Context, txIds []uuid.UUID) (_ map[uuid.UUID][]account.ID, err error) {
+	ctx, span := tracer.StartSpan(ctx, "eventStore.TransactionParticipants", attribute.Int("eventStore.transactions", len(txIds)))
+	defer func() { telemetry.EndSpan(span, err) }()
+	return s.store.TransactionParticipants(ctx, txIds)
+}
+
+func (s serializingEventStore) VerifyIntegrity(ctx context.Context, id account.ID) (_ IntegrityReport, err error) {
+	ctx, span := tracer.StartSpan(ctx, "eventStore.VerifyIntegrity", telemetry.AccountAttribute(id))
+	defer func() { telemetry.EndSpan(span, err) }()
+	return s.store.VerifyIntegrity(ctx, id)
+}
+
+// Archive moves the events of the aggregate out of the hot store, leaving the tombstone as its snapshot
+func (s serializingEventStore) Archive(ctx context.Context, tombstone SequencedEvent) (err error) {
+	ctx, span := tracer.StartSpan(ctx, "eventStore.Archive", telemetry.AccountAttribute(tombstone.AggregateId))
+	defer func() { telemetry.EndSpan(span, err) }()
+
+	serializedTombstone, err := s.serializeAll(ctx, []SequencedEvent{tombstone})
+	if err != nil {
+		return err
+	}
+	return s.store.Archive(ctx, serializedTombstone[0])
+}
+
+func (s serializingEventStore) LoadCommandResult(ctx context.Context, txId uuid.UUID) (_ *CommandResult, err error) {
+	ctx, span := tracer.StartSpan(ctx, "eventStore.LoadCommandResult", attribute.String("transaction.id", txId.String()))
+	defer func() { telemetry.EndSpan(span, err) }()
+	return s.store.LoadCommandResult(ctx, txId)
+}
+
+func (s serializingEventStore) StoreCommandResult(ctx context.Context, result CommandResult) (_ CommandResult, err error) {
+	ctx, span := tracer.StartSpan(ctx, "eventStore.StoreCommandResult", attribute.String("transaction.id", result.TransactionId.String()))
+	defer func() { telemetry.EndSpan(span, err) }()
+	return s.store.StoreCommandResult(ctx, result)
+}
@@ -0,0 +1,86 @@
+package eventstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/google/uuid"
+)
+
+// SerializedSagaEvent is a SequencedSagaEvent as stored, with a JSON payload
+type SerializedSagaEvent struct {
+	SagaId    uuid.UUID
+	Seq       int
+	EventType string
+	Payload   []byte
+	// Final tells whether the saga is over with this event, so that the store can tell the active sagas apart
+	Final bool
+}
+
+type sagaEventStore interface {
+	SagaEvents(ctx context.Context, sagaId uuid.UUID) ([]SerializedSagaEvent, error)
+	AppendSagaEvents(ctx context.Context, events []SerializedSagaEvent) error
+	ActiveSagas(ctx context.Context) ([]uuid.UUID, error)
+}
+
+// SagaEventTypes names the events of a saga in storage, mapping each name to a zero value of the event
+type SagaEventTypes map[string]SagaEvent
+
+type serializingSagaStore struct {
+	store sagaEventStore
+	types SagaEventTypes
+	names map[reflect.Type]string
+}
+
+// NewSerializingSagaStore creates a saga store that keeps the events of the given types as JSON in the store
+func NewSerializingSagaStore(store sagaEventStore, types SagaEventTypes) *serializingSagaStore {
+	names := map[reflect.Type]string{}
+	for name, event := range types {
+		names[reflect.TypeOf(event)] = name
+	}
+	return &serializingSagaStore{store: store, types: types, names: names}
+}
+
+func (s serializingSagaStore) SagaEvents(ctx context.Context, sagaId uuid.UUID) ([]SequencedSagaEvent, error) {
+	serializedEvents, err := s.store.SagaEvents(ctx, sagaId)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]SequencedSagaEvent, 0, len(serializedEvents))
+	for _, serializedEvent := range serializedEvents {
+		zero, ok := s.types[serializedEvent.EventType]
+		if !ok {
+			return nil, fmt.Errorf("unknown event type %s of saga %v", serializedEvent.EventType, sagaId)
+		}
+		event := reflect.New(reflect.TypeOf(zero))
+		if err := json.Unmarshal(serializedEvent.Payload, event.Interface()); err != nil {
+			return nil, fmt.Errorf("could not read event %d of saga %v: %w", serializedEvent.Seq, sagaId, err)
+		}
+		events = append(events, SequencedSagaEvent{SagaId: sagaId, Seq: serializedEvent.Seq, Event: event.Elem().Interface().(SagaEvent)})
+	}
+	return events, nil
+}
+
+func (s serializingSagaStore) AppendSagaEvents(ctx context.Context, events []SequencedSagaEvent) error {
+	serializedEvents := make([]SerializedSagaEvent, 0, len(events))
+	for _, e := range events {
+		name, ok := s.names[reflect.TypeOf(e.Event)]
+		if !ok {
+			return fmt.Errorf("unknown saga event %T", e.Event)
+		}
+		payload, err := json.Marshal(e.Event)
+		if err != nil {
+			return err
+		}
+		serializedEvents = append(serializedEvents, SerializedSagaEvent{
+			SagaId: e.SagaId, Seq: e.Seq, EventType: name, Payload: payload, Final: e.Event.Final(),
+		})
+	}
+	return s.store.AppendSagaEvents(ctx, serializedEvents)
+}
+
+func (s serializingSagaStore) ActiveSagas(ctx context.Context) ([]uuid.UUID, error) {
+	return s.store.ActiveSagas(ctx)
+}
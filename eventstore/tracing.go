@@ -0,0 +1,5 @@
+package eventstore
+
+import "github.com/rieske/event-sourced-account-go/internal/telemetry"
+
+var tracer = telemetry.NewTracer("github.com/rieske/event-sourced-account-go/eventstore")
@@ -0,0 +1,3 @@
+ALTER TABLE Event ADD COLUMN createdAt TIMESTAMPTZ NOT NULL DEFAULT now();
+
+CREATE INDEX idx_transaction_participants ON Event (transactionId);
@@ -0,0 +1,8 @@
+CREATE TABLE CommandResult(
+    transactionId UUID NOT NULL,
+    operation VARCHAR(32) NOT NULL,
+    fingerprint VARCHAR(64) NOT NULL,
+    error TEXT NOT NULL,
+    createdAt TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (transactionId)
+);
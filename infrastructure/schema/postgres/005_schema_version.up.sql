@@ -0,0 +1,2 @@
+ALTER TABLE Event ADD COLUMN schemaVersion INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE Snapshot ADD COLUMN schemaVersion INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,7 @@
+ALTER TABLE Event ALTER COLUMN payload DROP NOT NULL;
+ALTER TABLE Event ADD COLUMN jsonPayload JSONB;
+ALTER TABLE Event ADD CONSTRAINT event_payload_present CHECK (payload IS NOT NULL OR jsonPayload IS NOT NULL);
+
+ALTER TABLE Snapshot ALTER COLUMN payload DROP NOT NULL;
+ALTER TABLE Snapshot ADD COLUMN jsonPayload JSONB;
+ALTER TABLE Snapshot ADD CONSTRAINT snapshot_payload_present CHECK (payload IS NOT NULL OR jsonPayload IS NOT NULL);
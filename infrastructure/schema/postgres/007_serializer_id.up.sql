@@ -0,0 +1,8 @@
+-- rows written before serializer ids were recorded are msgpack unless they are stored as JSONB
+ALTER TABLE Event ADD COLUMN serializerId SMALLINT;
+UPDATE Event SET serializerId = CASE WHEN jsonPayload IS NULL THEN 1 ELSE 2 END;
+ALTER TABLE Event ALTER COLUMN serializerId SET NOT NULL;
+
+ALTER TABLE Snapshot ADD COLUMN serializerId SMALLINT;
+UPDATE Snapshot SET serializerId = CASE WHEN jsonPayload IS NULL THEN 1 ELSE 2 END;
+ALTER TABLE Snapshot ALTER COLUMN serializerId SET NOT NULL;
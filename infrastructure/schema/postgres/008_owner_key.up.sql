@@ -0,0 +1,8 @@
+CREATE TABLE OwnerKey(
+    ownerId UUID NOT NULL,
+    keyId UUID NOT NULL,
+    key BYTEA NOT NULL,
+    createdAt TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (ownerId),
+    UNIQUE (keyId)
+);
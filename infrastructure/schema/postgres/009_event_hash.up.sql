@@ -0,0 +1,17 @@
+-- each event is chained to the previous event of its aggregate by
+-- sha256(previous hash || sequence number || transaction id || payload), the first event has no previous hash
+ALTER TABLE Event ADD COLUMN hash BYTEA;
+
+WITH RECURSIVE chain AS (
+    SELECT aggregateId, sequenceNumber,
+        sha256(int8send(sequenceNumber) || uuid_send(transactionId) || COALESCE(payload, convert_to(jsonPayload::text, 'UTF8'))) AS hash
+    FROM Event WHERE sequenceNumber = 1
+    UNION ALL
+    SELECT e.aggregateId, e.sequenceNumber,
+        sha256(c.hash || int8send(e.sequenceNumber) || uuid_send(e.transactionId) || COALESCE(e.payload, convert_to(e.jsonPayload::text, 'UTF8')))
+    FROM Event e JOIN chain c ON e.aggregateId = c.aggregateId AND e.sequenceNumber = c.sequenceNumber + 1
+)
+UPDATE Event SET hash = chain.hash FROM chain
+WHERE Event.aggregateId = chain.aggregateId AND Event.sequenceNumber = chain.sequenceNumber;
+
+ALTER TABLE Event ALTER COLUMN hash SET NOT NULL;
@@ -0,0 +1,63 @@
+-- reads what a command on an aggregate needs in one round trip: the latest snapshot unless it is not past the given
+-- version, the events from the snapshot or version on - starting with the event at it to anchor their hash chain -
+-- and whether the transaction already touched the aggregate, in this order
+CREATE FUNCTION load_aggregate(p_aggregateId UUID, p_version BIGINT, p_transactionId UUID)
+RETURNS TABLE(kind SMALLINT, sequenceNumber BIGINT, transactionId UUID, hash BYTEA, eventType INTEGER, schemaVersion INTEGER, serializerId SMALLINT, payload BYTEA)
+LANGUAGE sql STABLE AS $$
+    WITH snapshot AS (
+        SELECT s.sequenceNumber, s.eventType, s.schemaVersion, s.serializerId, COALESCE(s.payload, convert_to(s.jsonPayload::text, 'UTF8')) AS payload
+        FROM Snapshot s WHERE s.aggregateId = p_aggregateId AND s.sequenceNumber > p_version
+    ), origin AS (
+        SELECT GREATEST(p_version, COALESCE((SELECT sn.sequenceNumber FROM snapshot sn), 0)) AS version
+    )
+    SELECT 0::SMALLINT, sn.sequenceNumber, NULL::UUID, NULL::BYTEA, sn.eventType, sn.schemaVersion, sn.serializerId, sn.payload
+    FROM snapshot sn
+    UNION ALL
+    SELECT 1::SMALLINT, e.sequenceNumber, e.transactionId, e.hash, e.eventType, e.schemaVersion, e.serializerId,
+        COALESCE(e.payload, convert_to(e.jsonPayload::text, 'UTF8'))
+    FROM Event e, origin o WHERE e.aggregateId = p_aggregateId AND e.sequenceNumber >= o.version
+    UNION ALL
+    SELECT 2::SMALLINT, NULL, NULL, NULL, NULL, NULL, NULL, NULL
+    WHERE EXISTS (SELECT 1 FROM Event e WHERE e.aggregateId = p_aggregateId AND e.transactionId = p_transactionId)
+    ORDER BY 1, 2
+$$;
+
+-- appends the events of a transaction together with the snapshots taken with them unless the transaction already
+-- touched one of the aggregates and tells whether they were appended. Events are hash chained the same way as
+-- when appended with a plain statement.
+CREATE FUNCTION append_events(
+    p_aggregateIds UUID[], p_sequenceNumbers BIGINT[], p_transactionId UUID, p_eventTypes INTEGER[],
+    p_schemaVersions INTEGER[], p_serializerIds SMALLINT[], p_payloads BYTEA[],
+    p_snapshotAggregateIds UUID[], p_snapshotSequenceNumbers BIGINT[], p_snapshotEventTypes INTEGER[],
+    p_snapshotSchemaVersions INTEGER[], p_snapshotSerializerIds SMALLINT[], p_snapshotPayloads BYTEA[]
+) RETURNS BOOLEAN
+LANGUAGE plpgsql AS $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM Event e WHERE e.aggregateId = ANY(p_aggregateIds) AND e.transactionId = p_transactionId) THEN
+        RETURN FALSE;
+    END IF;
+
+    WITH RECURSIVE batch AS (
+        SELECT * FROM unnest(p_aggregateIds, p_sequenceNumbers, p_eventTypes, p_schemaVersions, p_serializerIds, p_payloads)
+            AS b(aggregateId, sequenceNumber, eventType, schemaVersion, serializerId, payload)
+    ), chain AS (
+        SELECT b.*, sha256(COALESCE((SELECT e.hash FROM Event e WHERE e.aggregateId = b.aggregateId AND e.sequenceNumber = b.sequenceNumber - 1), '') ||
+            int8send(b.sequenceNumber) || uuid_send(p_transactionId) || b.payload) AS hash
+        FROM batch b
+        WHERE NOT EXISTS (SELECT 1 FROM batch p WHERE p.aggregateId = b.aggregateId AND p.sequenceNumber = b.sequenceNumber - 1)
+        UNION ALL
+        SELECT b.*, sha256(c.hash || int8send(b.sequenceNumber) || uuid_send(p_transactionId) || b.payload)
+        FROM batch b JOIN chain c ON b.aggregateId = c.aggregateId AND b.sequenceNumber = c.sequenceNumber + 1
+    )
+    INSERT INTO Event(aggregateId, sequenceNumber, transactionId, eventType, schemaVersion, serializerId, payload, hash)
+    SELECT c.aggregateId, c.sequenceNumber, p_transactionId, c.eventType, c.schemaVersion, c.serializerId, c.payload, c.hash FROM chain c;
+
+    INSERT INTO Snapshot(aggregateId, sequenceNumber, eventType, schemaVersion, serializerId, payload)
+    SELECT * FROM unnest(p_snapshotAggregateIds, p_snapshotSequenceNumbers, p_snapshotEventTypes,
+        p_snapshotSchemaVersions, p_snapshotSerializerIds, p_snapshotPayloads)
+    ON CONFLICT (aggregateId) DO UPDATE SET sequenceNumber=EXCLUDED.sequenceNumber, eventType=EXCLUDED.eventType,
+        schemaVersion=EXCLUDED.schemaVersion, serializerId=EXCLUDED.serializerId, payload=EXCLUDED.payload, jsonPayload=NULL;
+
+    RETURN TRUE;
+END;
+$$;
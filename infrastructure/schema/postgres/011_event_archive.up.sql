@@ -0,0 +1,3 @@
+-- events of accounts that were closed long enough ago are moved here to keep the Event table small,
+-- a tombstone snapshot of the closed account stays in the Snapshot table
+CREATE TABLE EventArchive (LIKE Event INCLUDING ALL);
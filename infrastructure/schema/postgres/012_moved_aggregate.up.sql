@@ -0,0 +1,21 @@
+-- aggregates that were moved to another database, appends to them are rejected so that an instance that still
+-- routes them here can not write events that would never be read
+CREATE TABLE MovedAggregate (
+    aggregateId UUID PRIMARY KEY,
+    movedAt TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- each appended event takes a shared lock on its aggregate that a move takes exclusively, so an aggregate is not
+-- written to while it moves and not at all once it moved
+CREATE FUNCTION fence_moved_aggregate() RETURNS TRIGGER
+LANGUAGE plpgsql AS $$
+BEGIN
+    PERFORM pg_advisory_xact_lock_shared(hashtextextended(NEW.aggregateId::text, 0));
+    IF EXISTS (SELECT 1 FROM MovedAggregate m WHERE m.aggregateId = NEW.aggregateId) THEN
+        RAISE EXCEPTION 'aggregate % was moved to another database', NEW.aggregateId;
+    END IF;
+    RETURN NEW;
+END;
+$$;
+
+CREATE TRIGGER fence_moved_aggregate BEFORE INSERT ON Event FOR EACH ROW EXECUTE FUNCTION fence_moved_aggregate();
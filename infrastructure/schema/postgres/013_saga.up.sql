@@ -0,0 +1,14 @@
+-- events of long running processes, like transfers between shards, that are resumed from them after a restart
+CREATE TABLE SagaEvent (
+    sagaId UUID NOT NULL,
+    sequenceNumber BIGINT NOT NULL,
+    eventType TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    createdAt TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (sagaId, sequenceNumber)
+);
+
+-- sagas that did not reach a final event yet
+CREATE TABLE ActiveSaga (
+    sagaId UUID PRIMARY KEY
+);
@@ -0,0 +1,26 @@
+-- appends the events of a transaction like append_events and records the result of the command that produced them
+-- in the same transaction, unless the operation is null
+CREATE FUNCTION append_events(
+    p_aggregateIds UUID[], p_sequenceNumbers BIGINT[], p_transactionId UUID, p_eventTypes INTEGER[],
+    p_schemaVersions INTEGER[], p_serializerIds SMALLINT[], p_payloads BYTEA[],
+    p_snapshotAggregateIds UUID[], p_snapshotSequenceNumbers BIGINT[], p_snapshotEventTypes INTEGER[],
+    p_snapshotSchemaVersions INTEGER[], p_snapshotSerializerIds SMALLINT[], p_snapshotPayloads BYTEA[],
+    p_operation VARCHAR(32), p_fingerprint VARCHAR(64), p_error TEXT
+) RETURNS BOOLEAN
+LANGUAGE plpgsql AS $$
+BEGIN
+    IF NOT append_events(p_aggregateIds, p_sequenceNumbers, p_transactionId, p_eventTypes, p_schemaVersions,
+        p_serializerIds, p_payloads, p_snapshotAggregateIds, p_snapshotSequenceNumbers, p_snapshotEventTypes,
+        p_snapshotSchemaVersions, p_snapshotSerializerIds, p_snapshotPayloads) THEN
+        RETURN FALSE;
+    END IF;
+
+    IF p_operation IS NOT NULL THEN
+        INSERT INTO CommandResult(transactionId, operation, fingerprint, error)
+        VALUES (p_transactionId, p_operation, p_fingerprint, p_error)
+        ON CONFLICT (transactionId) DO NOTHING;
+    END IF;
+
+    RETURN TRUE;
+END;
+$$;
@@ -0,0 +1,22 @@
+-- transactions of archived aggregates are recognized when loading an aggregate like those of the others
+CREATE OR REPLACE FUNCTION load_aggregate(p_aggregateId UUID, p_version BIGINT, p_transactionId UUID)
+RETURNS TABLE(kind SMALLINT, sequenceNumber BIGINT, transactionId UUID, hash BYTEA, eventType INTEGER, schemaVersion INTEGER, serializerId SMALLINT, payload BYTEA)
+LANGUAGE sql STABLE AS $$
+    WITH snapshot AS (
+        SELECT s.sequenceNumber, s.eventType, s.schemaVersion, s.serializerId, COALESCE(s.payload, convert_to(s.jsonPayload::text, 'UTF8')) AS payload
+        FROM Snapshot s WHERE s.aggregateId = p_aggregateId AND s.sequenceNumber > p_version
+    ), origin AS (
+        SELECT GREATEST(p_version, COALESCE((SELECT sn.sequenceNumber FROM snapshot sn), 0)) AS version
+    )
+    SELECT 0::SMALLINT, sn.sequenceNumber, NULL::UUID, NULL::BYTEA, sn.eventType, sn.schemaVersion, sn.serializerId, sn.payload
+    FROM snapshot sn
+    UNION ALL
+    SELECT 1::SMALLINT, e.sequenceNumber, e.transactionId, e.hash, e.eventType, e.schemaVersion, e.serializerId,
+        COALESCE(e.payload, convert_to(e.jsonPayload::text, 'UTF8'))
+    FROM Event e, origin o WHERE e.aggregateId = p_aggregateId AND e.sequenceNumber >= o.version
+    UNION ALL
+    SELECT 2::SMALLINT, NULL, NULL, NULL, NULL, NULL, NULL, NULL
+    WHERE EXISTS (SELECT 1 FROM Event e WHERE e.aggregateId = p_aggregateId AND e.transactionId = p_transactionId)
+        OR EXISTS (SELECT 1 FROM EventArchive e WHERE e.aggregateId = p_aggregateId AND e.transactionId = p_transactionId)
+    ORDER BY 1, 2
+$$;
@@ -0,0 +1,5 @@
+-- the single row that the write probe of the health checks updates, so that a database only passes it by committing a write
+CREATE TABLE HealthProbe (
+    id SMALLINT PRIMARY KEY CHECK (id = 1),
+    probedAt TIMESTAMPTZ NOT NULL
+);
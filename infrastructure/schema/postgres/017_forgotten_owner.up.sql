@@ -0,0 +1,8 @@
+-- owners whose key was deleted to erase their personal data. No key is created for them again, and running instances
+-- poll the owners forgotten lately to drop what they cached of them
+CREATE TABLE ForgottenOwner (
+    ownerId UUID PRIMARY KEY,
+    forgottenAt TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_forgotten_at ON ForgottenOwner (forgottenAt);
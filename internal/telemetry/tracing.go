@@ -0,0 +1,45 @@
+// Package telemetry traces the work of the packages of the service with the globally installed OpenTelemetry
+// providers, spans are not recorded until one is installed
+package telemetry
+
+import (
+	"context"
+	"errors"
+
+	"github.com/rieske/event-sourced-account-go/account"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracer starts the spans of one package
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// NewTracer creates the tracer of the package with the given import path
+func NewTracer(name string) Tracer {
+	return Tracer{tracer: otel.Tracer(name)}
+}
+
+func (t Tracer) StartSpan(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return t.tracer.Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+func AccountAttribute(id account.ID) attribute.KeyValue {
+	return attribute.String("account.id", id.String())
+}
+
+// EndSpan ends the span with the error, if any. Domain errors, like concurrent modifications, are expected outcomes
+// and do not fail the span.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		var domainErr account.Error
+		if !errors.As(err, &domainErr) {
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}
+	span.End()
+}
@@ -0,0 +1,41 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func endedSpan(err error) sdktrace.ReadOnlySpan {
+	spans := tracetest.NewSpanRecorder()
+	_, span := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)).Tracer("test").Start(context.Background(), "test")
+	EndSpan(span, err)
+	return spans.Ended()[0]
+}
+
+func TestEndSpanFailsSpanWithError(t *testing.T) {
+	span := endedSpan(errors.New("connection refused"))
+
+	assert.Equal(t, codes.Error, span.Status().Code)
+	assert.Len(t, span.Events(), 1)
+}
+
+func TestEndSpanRecordsDomainErrorWithoutFailingSpan(t *testing.T) {
+	span := endedSpan(account.ConcurrentModification)
+
+	assert.Equal(t, codes.Unset, span.Status().Code)
+	assert.Len(t, span.Events(), 1)
+}
+
+func TestEndSpanWithoutError(t *testing.T) {
+	span := endedSpan(nil)
+
+	assert.Equal(t, codes.Unset, span.Status().Code)
+	assert.Empty(t, span.Events())
+}
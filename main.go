@@ -1,26 +1,33 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	_ "expvar"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
-	zipkinsql "github.com/jcchavezs/zipkin-instrumentation-sql"
-	"github.com/openzipkin/zipkin-go"
-	zipkinhttp "github.com/openzipkin/zipkin-go/middleware/http"
-	"github.com/openzipkin/zipkin-go/reporter"
-	zipkinreporter "github.com/openzipkin/zipkin-go/reporter/http"
+	"github.com/XSAM/otelsql"
 	"github.com/rieske/event-sourced-account-go/eventstore/postgres"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rieske/event-sourced-account-go/account"
 	"github.com/rieske/event-sourced-account-go/eventsourcing"
 	"github.com/rieske/event-sourced-account-go/eventstore"
 	"github.com/rieske/event-sourced-account-go/rest"
@@ -28,139 +35,489 @@ import (
 )
 
 var (
-	inUseConnections = promauto.NewGauge(prometheus.GaugeOpts{
+	inUseConnections = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "db_conn_in_use",
 		Help: "Number of in-use database connections",
-	})
-	idleConnections = promauto.NewGauge(prometheus.GaugeOpts{
+	}, []string{"database"})
+	idleConnections = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "db_conn_idle",
 		Help: "Number of idle database connections",
-	})
-	openConnections = promauto.NewGauge(prometheus.GaugeOpts{
+	}, []string{"database"})
+	openConnections = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "db_conn_open",
 		Help: "Number of open database connections",
-	})
-	maxOpenConnections = promauto.NewGauge(prometheus.GaugeOpts{
+	}, []string{"database"})
+	maxOpenConnections = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "db_conn_max",
 		Help: "Number of max open database connections",
-	})
+	}, []string{"database"})
 )
 
-type handlerDecorator func(http.Handler) http.Handler
+// telemetryShutdownTimeout is how long the spans and metrics that were not exported yet have to be flushed when stopping
+const telemetryShutdownTimeout = 5 * time.Second
 
 type schemaMigrator func(db *sql.DB, schemaLocation string)
 
-func noTracingHttpHandler(h http.Handler) http.Handler {
-	return h
+// replicas follow the schema of the primary
+func noSchemaMigration(*sql.DB, string) {
 }
 
 func main() {
-	var tracingHandler handlerDecorator
-	var rep reporter.Reporter
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		runAdminCommand(os.Args[1:])
+		return
+	}
+	cfg := mustLoadConfig(os.Args[1:])
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	background := newWorkers(ctx)
 
-	if zipkinURL, ok := os.LookupEnv("ZIPKIN_URL"); ok {
-		rep = zipkinreporter.NewReporter(zipkinURL)
-		defer closeResource(rep)
+	shutdownTelemetry, err := startTelemetry(cfg.Tracing)
+	if err != nil {
+		log.Fatal(err)
 	}
 
+	cache := newAggregateCache(cfg.AggregateCache)
+	serviceOptions := []eventsourcing.Option{eventsourcing.WithAggregateCache(cache)}
+	var readinessChecks []rest.HealthCheck
+
 	var eventStore eventsourcing.EventStore
-	if postgresHost, ok := os.LookupEnv("POSTGRES_HOST"); ok {
-		posrgresPort := requireEnvVariable("POSTGRES_PORT")
-		posrgresUser := requireEnvVariable("POSTGRES_USER")
-		posrgresPassword := requireEnvVariable("POSTGRES_PASSWORD")
-		posrgresDB := requireEnvVariable("POSTGRES_DB")
-
-		psqlInfo := fmt.Sprintf("host=%s port=%v user=%s password=%s dbname=%s sslmode=disable",
-			postgresHost,
-			posrgresPort,
-			posrgresUser,
-			posrgresPassword,
-			posrgresDB,
-		)
-		driverName := "postgres"
-		tracingHandler, driverName = buildTracingHandler(driverName, rep)
-		db := initDB(driverName, psqlInfo, "infrastructure/schema/postgres", postgres.MigrateSchema)
-		defer closeResource(db)
-
-		sqlStore := postgres.NewEventStore(db)
-		log.Println("Using postgres event store")
-		eventStore = eventstore.NewSerializingEventStore(sqlStore, serialization.NewMsgpackEventSerializer())
+	psqlInfo, usePostgres := postgresDataSource()
+	shards, useShards := shardDataSources(cfg.Sharding.Shards)
+	if usePostgres || useShards {
+		driverName := registerTracingDriver("postgres")
+		if useShards {
+			sagaShard := postgresSagaShard(cfg.Sharding, shards)
+			var sagaDB *sql.DB
+			var shardStores []eventsourcing.Shard
+			for _, shard := range shards {
+				db := initDB(driverName, shard.dsn, "infrastructure/schema/postgres", postgres.MigrateSchema, cfg.Database)
+				defer closeResource(db)
+				dbMetrics(background, db, shard.name)
+				readinessChecks = append(readinessChecks, databaseChecks(shard.name, db)...)
+				stores := newSerializingEventStores(cfg.EventStore, db, nil)
+				stores.startReEncryption(background)
+				stores.watchForgottenOwners(background, cache)
+				shardStores = append(shardStores, eventsourcing.Shard{Name: shard.name, Store: stores.store})
+				if shard.name == sagaShard {
+					sagaDB = db
+				}
+			}
+			log.Printf("Sharding accounts across %d postgres databases, keeping transfers between them in %s\n", len(shards), sagaShard)
+			eventStore = eventsourcing.NewShardedEventStore(shardStores...)
+			sagas := eventstore.NewSerializingSagaStore(postgres.NewSagaStore(sagaDB), eventsourcing.TransferSagaEvents)
+			serviceOptions = append(serviceOptions, eventsourcing.WithCrossShardTransfers(sagas, cfg.Sharding.TransferTimeout))
+		} else {
+			db := initDB(driverName, psqlInfo, "infrastructure/schema/postgres", postgres.MigrateSchema, cfg.Database)
+			defer closeResource(db)
+			dbMetrics(background, db, "primary")
+			readinessChecks = append(readinessChecks, databaseChecks("primary", db)...)
+			var replica *sql.DB
+			if replicaInfo, ok := postgresReplicaDataSource(); ok {
+				log.Println("Reading queries from postgres replica")
+				replica = initDB(driverName, replicaInfo, "", noSchemaMigration, cfg.Database)
+				defer closeResource(replica)
+				dbMetrics(background, replica, "replica")
+				readinessChecks = append(readinessChecks, replicaChecks(replica, cfg.Health.MaxReplicaLag)...)
+			}
+
+			stores := newSerializingEventStores(cfg.EventStore, db, replica)
+			stores.startReEncryption(background)
+			stores.watchForgottenOwners(background, cache)
+			eventStore = stores.store
+			if stores.queryStore != nil {
+				serviceOptions = append(serviceOptions, eventsourcing.WithQueryStore(stores.queryStore))
+			}
+		}
 	} else {
 		log.Println("Using in-memory event store")
 		eventStore = eventstore.NewInMemoryStore()
-		tracingHandler = noTracingHttpHandler
 	}
 
-	startServer(tracingHandler, eventStore)
-}
+	accountService := eventsourcing.NewAccountService(eventStore, cfg.SnapshotFrequency, serviceOptions...)
+	// transfers interrupted by a restart complete before new ones start, the watch retries those that fail again
+	if err := accountService.ResumeTransfers(ctx); err != nil {
+		log.Printf("Could not resume transfers between shards: %v\n", err)
+	}
+	background.start(func(ctx context.Context) {
+		accountService.WatchTransfers(ctx, cfg.Sharding.TransferTimeout)
+	})
+	handler := rest.NewAccountServiceHandler(accountService, rest.WithReadinessChecks(cfg.Health.CheckTimeout, readinessChecks...))
+	startServer(ctx, cfg.HTTP, otelhttp.NewHandler(handler, "account-api"))
 
-func initDB(driverName, url, schemaLocation string, migrator schemaMigrator) *sql.DB {
-	db, err := sql.Open(driverName, url)
-	if err != nil {
-		log.Panic(err)
+	// the databases are closed by the deferred calls once the background work is done
+	stop()
+	background.wait()
+	flushCtx, cancel := context.WithTimeout(context.Background(), telemetryShutdownTimeout)
+	defer cancel()
+	if err := shutdownTelemetry(flushCtx); err != nil {
+		log.Printf("Could not flush telemetry: %v\n", err)
 	}
-	db.SetMaxOpenConns(5)
-	db.SetMaxIdleConns(5)
-	waitForDBConnection(db)
-	migrator(db, schemaLocation)
+	log.Println("Stopped")
+}
 
-	dbMetrics(db)
+// workers runs background loops until the context they were started with is done
+type workers struct {
+	ctx context.Context
+	wg  sync.WaitGroup
+}
 
-	return db
+func newWorkers(ctx context.Context) *workers {
+	return &workers{ctx: ctx}
 }
 
-func startServer(tracingHandler handlerDecorator, eventStore eventsourcing.EventStore) {
-	shutdown := make(chan bool)
-	http.Handle("/prometheus", promhttp.Handler())
+func (w *workers) start(work func(ctx context.Context)) {
+	w.wg.Add(1)
 	go func() {
-		log.Print(http.ListenAndServe(":8081", nil))
-		shutdown <- true
+		defer w.wg.Done()
+		work(w.ctx)
 	}()
+}
 
-	servicePort := "8080"
-	s := &http.Server{
-		ReadTimeout:  1 * time.Second,
-		WriteTimeout: 1 * time.Second,
-		IdleTimeout:  20 * time.Second,
-		Addr:         ":" + servicePort,
-		Handler:      tracingHandler(rest.NewRestHandler(eventStore, 50)),
+// wait blocks until all the loops returned
+func (w *workers) wait() {
+	w.wg.Wait()
+}
+
+func postgresDataSource() (string, bool) {
+	postgresHost, ok := os.LookupEnv("POSTGRES_HOST")
+	if !ok {
+		return "", false
 	}
-	go func() {
-		log.Printf("Starting http server on port %v\n", servicePort)
-		log.Print(s.ListenAndServe())
-		shutdown <- true
-	}()
+	return postgresDSN(postgresHost, requireEnvVariable("POSTGRES_PORT")), true
+}
 
-	if _, ok := os.LookupEnv("CPU_PROFILE"); ok {
-		go func() {
-			http.ListenAndServe("0.0.0.0:6060", nil)
-		}()
+// postgresReplicaDataSource points to a read only replica of the primary database, with the same credentials
+func postgresReplicaDataSource() (string, bool) {
+	replicaHost, ok := os.LookupEnv("POSTGRES_REPLICA_HOST")
+	if !ok {
+		return "", false
+	}
+	replicaPort, ok := os.LookupEnv("POSTGRES_REPLICA_PORT")
+	if !ok {
+		replicaPort = requireEnvVariable("POSTGRES_PORT")
 	}
+	return postgresDSN(replicaHost, replicaPort), true
+}
 
-	<-shutdown
+type shardDataSource struct {
+	name string
+	dsn  string
 }
 
-func buildTracingHandler(driverName string, reporter reporter.Reporter) (func(http.Handler) http.Handler, string) {
-	if reporter == nil {
-		return noTracingHttpHandler, driverName
+// postgresSagaShard is the shard, sharding.sagaShard or else the first one, that keeps the state of transfers between shards
+func postgresSagaShard(c shardingConfig, shards []shardDataSource) string {
+	if c.SagaShard != "" {
+		return c.SagaShard
 	}
+	return shards[0].name
+}
 
-	endpoint, err := zipkin.NewEndpoint("account-go", ":0")
+// shardDataSources connects to the databases of a list of shards in the format of sharding.shards, all with the same
+// credentials. Shard names place the shards on the ring and must stay the same when shards are added.
+func shardDataSources(list string) ([]shardDataSource, bool) {
+	addresses, err := parseShards(list)
 	if err != nil {
-		log.Fatalf("unable to create local endpoint: %v", err)
+		log.Fatal(err)
+	}
+	if len(addresses) == 0 {
+		return nil, false
+	}
+	var shards []shardDataSource
+	for _, address := range addresses {
+		port := address.port
+		if port == "" {
+			port = requireEnvVariable("POSTGRES_PORT")
+		}
+		shards = append(shards, shardDataSource{name: address.name, dsn: postgresDSN(address.host, port)})
 	}
+	return shards, true
+}
 
-	tracer, err := zipkin.NewTracer(reporter, zipkin.WithLocalEndpoint(endpoint))
+func shardRing(shards []shardDataSource) *eventsourcing.ShardRing {
+	names := make([]string, 0, len(shards))
+	for _, shard := range shards {
+		names = append(names, shard.name)
+	}
+	return eventsourcing.NewShardRing(names...)
+}
+
+func postgresDSN(host, port string) string {
+	posrgresUser := requireEnvVariable("POSTGRES_USER")
+	posrgresPassword := requireEnvVariable("POSTGRES_PASSWORD")
+	posrgresDB := requireEnvVariable("POSTGRES_DB")
+
+	return fmt.Sprintf("host=%s port=%v user=%s password=%s dbname=%s sslmode=disable",
+		host,
+		port,
+		posrgresUser,
+		posrgresPassword,
+		posrgresDB,
+	)
+}
+
+// postgresStores are the stores of a database - the one commands use, the one queries read from given a replica and,
+// when payloads are encrypted, the store that re-encrypts them with the current key every reEncryptionInterval.
+// When personal data is encrypted, forgottenOwners lists the owners forgotten by forget-owner and invalidateOwnerKeys
+// drops the cached owner keys.
+type postgresStores struct {
+	store                      eventsourcing.EventStore
+	queryStore                 eventsourcing.EventStore
+	rewriter                   serialization.PayloadRewriter
+	keyring                    serialization.KeyProvider
+	reEncryptionInterval       time.Duration
+	forgottenOwners            serialization.ForgottenOwnerLog
+	invalidateOwnerKeys        func()
+	forgottenOwnerPollInterval time.Duration
+}
+
+// newSerializingEventStores creates the stores of the primary database without starting any background work, so that
+// one-off commands can use them too
+func newSerializingEventStores(c eventStoreConfig, db, replica *sql.DB) postgresStores {
+	format, codec := c.Serialization, c.Compression
+	serializer, err := serialization.NewEventSerializer(format)
 	if err != nil {
-		log.Fatalf("unable to create tracer: %v", err)
+		log.Fatalf("invalid eventStore.serialization: %v", err)
 	}
 
-	driverName, err = zipkinsql.Register(driverName, tracer, zipkinsql.WithAllTraceOptions(), zipkinsql.WithAllowRootSpan(false))
+	var keyring serialization.KeyProvider
+	if c.EncryptionKeyring != "" {
+		if keyring, err = serialization.NewFileKeyring(c.EncryptionKeyring); err != nil {
+			log.Fatalf("invalid eventStore.encryptionKeyring: %v", err)
+		}
+	}
+
+	stores := postgresStores{
+		keyring:                    keyring,
+		reEncryptionInterval:       c.ReEncryptionInterval,
+		invalidateOwnerKeys:        func() {},
+		forgottenOwnerPollInterval: c.ForgottenOwnerPollInterval,
+	}
+	var ownerKeys serialization.OwnerKeyStore
+	if c.PersonalDataEncryption {
+		sqlOwnerKeys := postgres.NewOwnerKeyStore(db)
+		ownerKeys, stores.forgottenOwners = sqlOwnerKeys, sqlOwnerKeys
+		if c.PersonalDataKeyCacheTTL > 0 {
+			cachingOwnerKeys := serialization.NewCachingOwnerKeyStore(sqlOwnerKeys, c.PersonalDataKeyCacheTTL)
+			ownerKeys, stores.invalidateOwnerKeys = cachingOwnerKeys, cachingOwnerKeys.Invalidate
+		}
+	}
+
+	// payloads are compressed before personal data is sealed and the whole payload is encrypted
+	wrap := func(serializer serialization.EventSerializer, codec string) serialization.EventSerializer {
+		compressed, err := serialization.NewCompressingEventSerializer(serializer, codec, c.CompressionThreshold)
+		if err != nil {
+			log.Fatalf("invalid eventStore.compression: %v", err)
+		}
+		var wrapped serialization.EventSerializer = compressed
+		if ownerKeys != nil {
+			wrapped = serialization.NewPersonalDataSerializer(wrapped, ownerKeys)
+		}
+		if keyring == nil {
+			return wrapped
+		}
+		return serialization.NewEncryptingEventSerializer(wrapped, keyring)
+	}
+
+	singleRoundTrip, strictIntegrity := c.SingleRoundTrip, c.StrictIntegrity
+
+	writer := wrap(serializer, codec)
+	msgpackReader := wrap(serialization.NewMsgpackEventSerializer(), serialization.NoCompression)
+	jsonReader := serialization.NewJsonEventSerializer()
+	protobufReader := wrap(serialization.NewProtobufEventSerializer(), serialization.NoCompression)
+	log.Printf("Using postgres event store with %s serialization, %s compression, encryption %v, personal data encryption %v and single round trip %v\n",
+		format, codec, keyring != nil, ownerKeys != nil, singleRoundTrip)
+
+	serializing := func(store *postgres.EventStore) eventsourcing.EventStore {
+		return eventstore.NewSerializingEventStore(store, writer, msgpackReader, jsonReader, protobufReader)
+	}
+	queryStore := func(store *postgres.EventStore) eventsourcing.EventStore {
+		if replica == nil {
+			return nil
+		}
+		return serializing(store.WithReadReplica(replica))
+	}
+
+	if singleRoundTrip {
+		sqlStore := postgres.NewSingleRoundTripEventStore(db)
+		if strictIntegrity {
+			sqlStore = sqlStore.WithStrictIntegrity()
+		}
+		stores.store = eventstore.NewSerializingAggregateStore(sqlStore, writer, msgpackReader, jsonReader, protobufReader)
+		stores.queryStore, stores.rewriter = queryStore(sqlStore.EventStore), sqlStore
+		return stores
+	}
+
+	sqlStore := postgres.NewEventStore(db)
+	if format == serialization.JsonFormat {
+		sqlStore = postgres.NewJsonbEventStore(db)
+	}
+	if strictIntegrity {
+		sqlStore = sqlStore.WithStrictIntegrity()
+	}
+	stores.store, stores.queryStore, stores.rewriter = serializing(sqlStore), queryStore(sqlStore), sqlStore
+	return stores
+}
+
+// startReEncryption encrypts stored payloads with the current key in the background so that rotated out keys can be
+// dropped, if payloads are encrypted
+func (s postgresStores) startReEncryption(background *workers) {
+	if s.keyring == nil {
+		return
+	}
+	background.start(func(ctx context.Context) {
+		serialization.RunReEncryption(ctx, s.rewriter, s.keyring, s.reEncryptionInterval)
+	})
+}
+
+// watchForgottenOwners drops the owner keys and the aggregates that the instance cached of the owners forgotten by
+// forget-owner in the background, if personal data is encrypted
+func (s postgresStores) watchForgottenOwners(background *workers, cache *eventsourcing.AggregateCache) {
+	if s.forgottenOwners == nil {
+		return
+	}
+	background.start(func(ctx context.Context) {
+		serialization.WatchForgottenOwners(ctx, s.forgottenOwners, s.forgottenOwnerPollInterval, func(owner account.OwnerID) {
+			s.invalidateOwnerKeys()
+			cache.InvalidateOwner(owner)
+		})
+	})
+}
+
+// newAggregateCache is nil, which caches nothing, unless the size of the cache is configured
+func newAggregateCache(c aggregateCacheConfig) *eventsourcing.AggregateCache {
+	if c.Size == 0 {
+		return nil
+	}
+	log.Printf("Caching up to %d aggregates for %v\n", c.Size, c.TTL)
+	return eventsourcing.NewAggregateCache(c.Size, c.TTL)
+}
+
+// databaseChecks tell whether the database can be reached, is migrated to the schema the service expects and takes
+// writes, with the check names prefixed by the name of the database
+func databaseChecks(name string, db *sql.DB) []rest.HealthCheck {
+	return []rest.HealthCheck{
+		{Name: name + ".ping", Check: db.PingContext},
+		{Name: name + ".schemaVersion", Check: func(ctx context.Context) error {
+			return postgres.CheckSchemaVersion(ctx, db)
+		}},
+		{Name: name + ".writeProbe", Check: func(ctx context.Context) error {
+			return postgres.ProbeWrite(ctx, db)
+		}},
+	}
+}
+
+// replicaChecks tell whether the read replica can be reached and follows the primary closely enough. Queries fall
+// back to the primary when the replica misses what they ask for, so only a replica lagging far behind is a problem.
+func replicaChecks(replica *sql.DB, maxLag time.Duration) []rest.HealthCheck {
+	return []rest.HealthCheck{
+		{Name: "replica.ping", Check: replica.PingContext},
+		{Name: "replica.lag", Check: func(ctx context.Context) error {
+			return postgres.CheckReplicationLag(ctx, replica, maxLag)
+		}},
+	}
+}
+
+func initDB(driverName, url, schemaLocation string, migrator schemaMigrator, c databaseConfig) *sql.DB {
+	db, err := sql.Open(driverName, url)
 	if err != nil {
-		log.Fatalf("unable to register zipkin driver: %v", err)
+		log.Panic(err)
 	}
+	db.SetMaxOpenConns(c.MaxOpenConns)
+	db.SetMaxIdleConns(c.MaxIdleConns)
+	db.SetConnMaxLifetime(c.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(c.ConnMaxIdleTime)
+	waitForDBConnection(db, c)
+	migrator(db, schemaLocation)
+
+	return db
+}
+
+// startServer serves the account API, the metrics and, if asked for, the profiling endpoints until the context is done
+// or one of them fails, then stops all of them, letting the requests in flight complete
+func startServer(ctx context.Context, c httpConfig, handler http.Handler) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	http.Handle("/prometheus", promhttp.Handler())
+	servers := []*http.Server{
+		{
+			ReadTimeout:  c.ReadTimeout,
+			WriteTimeout: c.WriteTimeout,
+			IdleTimeout:  c.IdleTimeout,
+			Addr:         fmt.Sprintf(":%d", c.Port),
+			Handler:      handler,
+		},
+		{Addr: fmt.Sprintf(":%d", c.MetricsPort)},
+	}
+	if _, ok := os.LookupEnv("CPU_PROFILE"); ok {
+		servers = append(servers, &http.Server{Addr: fmt.Sprintf("0.0.0.0:%d", c.ProfilingPort)})
+	}
+
+	var wg sync.WaitGroup
+	for _, s := range servers {
+		l, err := net.Listen("tcp", s.Addr)
+		if err != nil {
+			log.Printf("Could not listen on %s: %v\n", s.Addr, err)
+			cancel()
+			continue
+		}
+		log.Printf("Starting http server on %s\n", s.Addr)
+		wg.Add(1)
+		go func(s *http.Server) {
+			defer wg.Done()
+			// one server stopping stops the others
+			defer cancel()
+			if err := serve(ctx, s, l, c.ShutdownTimeout); err != nil {
+				log.Printf("Http server on %s stopped: %v\n", s.Addr, err)
+			}
+		}(s)
+	}
+	wg.Wait()
+}
 
-	return zipkinhttp.NewServerMiddleware(tracer, zipkinhttp.TagResponseSize(true)), driverName
+// serve runs the server on the listener until the context is done, then stops accepting connections and waits up to
+// the timeout for the requests in flight to complete
+func serve(ctx context.Context, s *http.Server, l net.Listener, shutdownTimeout time.Duration) error {
+	failed := make(chan error, 1)
+	go func() {
+		failed <- s.Serve(l)
+	}()
+
+	select {
+	case err := <-failed:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := s.Shutdown(shutdownCtx); err != nil {
+		// the requests that did not complete in time are cut off
+		_ = s.Close()
+		return err
+	}
+	return nil
+}
+
+// registerTracingDriver registers a driver that spans the database calls made within traces of the service
+// and returns its name
+func registerTracingDriver(driverName string) string {
+	driverName, err := otelsql.Register(driverName,
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			OmitConnResetSession: true,
+			// connection pool upkeep and the background work outside of any trace is left out
+			SpanFilter: func(ctx context.Context, _ otelsql.Method, _ string, _ []driver.NamedValue) bool {
+				return trace.SpanContextFromContext(ctx).IsValid()
+			},
+		}),
+	)
+	if err != nil {
+		log.Fatalf("unable to register tracing driver: %v", err)
+	}
+	return driverName
 }
 
 func requireEnvVariable(v string) string {
@@ -171,27 +528,37 @@ func requireEnvVariable(v string) string {
 	return ""
 }
 
-func dbMetrics(db *sql.DB) {
-	go func() {
+func dbMetrics(background *workers, db *sql.DB, database string) {
+	background.start(func(ctx context.Context) {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
 		for {
 			s := db.Stats()
-			inUseConnections.Set(float64(s.InUse))
-			idleConnections.Set(float64(s.Idle))
-			openConnections.Set(float64(s.OpenConnections))
-			maxOpenConnections.Set(float64(s.MaxOpenConnections))
-			time.Sleep(1 * time.Second)
+			inUseConnections.WithLabelValues(database).Set(float64(s.InUse))
+			idleConnections.WithLabelValues(database).Set(float64(s.Idle))
+			openConnections.WithLabelValues(database).Set(float64(s.OpenConnections))
+			maxOpenConnections.WithLabelValues(database).Set(float64(s.MaxOpenConnections))
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
 		}
-	}()
+	})
 }
 
-func waitForDBConnection(db *sql.DB) {
+func waitForDBConnection(db *sql.DB, c databaseConfig) {
 	var err error
-	for i := 0; i < 30; i++ {
+	backoff := c.ConnectBackoff
+	for i := 0; i < c.ConnectAttempts; i++ {
 		err = db.Ping()
 		if err == nil {
 			break
 		}
-		time.Sleep(time.Second * 1)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > c.MaxConnectBackoff {
+			backoff = c.MaxConnectBackoff
+		}
 	}
 	if err != nil {
 		log.Panic(err)
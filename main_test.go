@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServeCompletesRequestInFlightWhenStopped(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	inFlight, release := make(chan struct{}), make(chan struct{})
+	s := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(inFlight)
+		<-release
+		io.WriteString(w, "completed")
+	})}
+	ctx, stop := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, s, l, 5*time.Second)
+	}()
+	responses := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + l.Addr().String())
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		responses <- string(body)
+	}()
+
+	<-inFlight
+	stop()
+	assert.Eventually(t, func() bool {
+		c, err := net.Dial("tcp", l.Addr().String())
+		if err == nil {
+			c.Close()
+		}
+		return err != nil
+	}, time.Second, 10*time.Millisecond, "new connections are still accepted")
+	close(release)
+
+	assert.Equal(t, "completed", <-responses)
+	assert.NoError(t, <-served)
+}
+
+func TestServeGivesUpOnRequestInFlightAfterShutdownTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	inFlight, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	s := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(inFlight)
+		<-release
+	})}
+	ctx, stop := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, s, l, 50*time.Millisecond)
+	}()
+	go http.Get("http://" + l.Addr().String())
+
+	<-inFlight
+	stop()
+
+	assert.Equal(t, context.DeadlineExceeded, <-served)
+}
@@ -3,8 +3,10 @@ package rest
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/rieske/event-sourced-account-go/account"
 	"github.com/rieske/event-sourced-account-go/eventsourcing"
@@ -28,7 +30,7 @@ func (r *accountResource) handle(res http.ResponseWriter, req *http.Request) res
 		return r.post(req.Context(), account.ID{accountID}, req.URL.Query())
 	case http.MethodGet:
 		head, req.URL.Path = shiftPath(req.URL.Path)
-		return r.get(req.Context(), head, account.ID{accountID})
+		return r.get(req.Context(), head, account.ID{accountID}, req.URL.Query())
 	case http.MethodPut:
 		head, req.URL.Path = shiftPath(req.URL.Path)
 		return r.put(req.Context(), head, account.ID{accountID}, req.URL.Query())
@@ -44,19 +46,23 @@ func (r *accountResource) post(ctx context.Context, accountID account.ID, query
 		return *response
 	}
 
-	if err := r.accountService.OpenAccount(ctx, accountID, account.OwnerID{ownerID}); err != nil {
+	if err := r.accountService.Dispatch(ctx, eventsourcing.OpenAccount{AccountID: accountID, OwnerID: account.OwnerID{ownerID}}); err != nil {
 		return handleDomainError(err)
 	}
 
 	return locationResponse(http.StatusCreated, "/api/account/"+accountID.String())
 }
 
-func (r *accountResource) get(ctx context.Context, action string, id account.ID) response {
+func (r *accountResource) get(ctx context.Context, action string, id account.ID, query url.Values) response {
 	switch action {
 	case "":
 		return r.queryAccount(ctx, id)
 	case "events":
 		return r.queryEvents(ctx, id)
+	case "statement":
+		return r.queryStatement(ctx, id, query)
+	case "integrity":
+		return r.verifyIntegrity(ctx, id)
 	default:
 		return actionNotSupported()
 	}
@@ -105,6 +111,60 @@ func (r *accountResource) queryEvents(ctx context.Context, id account.ID) respon
 	return jsonResponse(http.StatusOK, response)
 }
 
+func (r *accountResource) queryStatement(ctx context.Context, id account.ID, query url.Values) response {
+	renderStatement, ok := statementRenderers[query.Get("format")]
+	if !ok {
+		return errorResponse(http.StatusBadRequest, fmt.Sprintf("unsupported statement format '%s'", query.Get("format")))
+	}
+	from, response := parseStatementDate(query.Get("from"), time.Time{}, false)
+	if response != nil {
+		return *response
+	}
+	to, response := parseStatementDate(query.Get("to"), time.Now().UTC(), true)
+	if response != nil {
+		return *response
+	}
+	if to.Before(from) {
+		return errorResponse(http.StatusBadRequest, "statement period can not end before it starts")
+	}
+
+	statement, err := r.accountService.Statement(ctx, id, from, to)
+	if err != nil {
+		return handleDomainError(err)
+	}
+
+	rendered, err := renderStatement(statement)
+	if err != nil {
+		return unhandledErrorResponse(err)
+	}
+	return rendered
+}
+
+type integrityResponse struct {
+	AccountID account.ID `json:"accountId"`
+	Events    int        `json:"events"`
+	Intact    bool       `json:"intact"`
+	BrokenAt  int        `json:"brokenAt,omitempty"`
+}
+
+func (r *accountResource) verifyIntegrity(ctx context.Context, id account.ID) response {
+	report, err := r.accountService.VerifyIntegrity(ctx, id)
+	if err != nil {
+		return handleDomainError(err)
+	}
+
+	response, err := json.Marshal(integrityResponse{
+		AccountID: report.AggregateId,
+		Events:    report.Events,
+		Intact:    report.Intact(),
+		BrokenAt:  report.BrokenAt,
+	})
+	if err != nil {
+		return unhandledErrorResponse(err)
+	}
+	return jsonResponse(http.StatusOK, response)
+}
+
 func (r *accountResource) deposit(ctx context.Context, id account.ID, query url.Values) response {
 	amount, response := parseAmount(query.Get("amount"))
 	if response != nil {
@@ -115,7 +175,7 @@ func (r *accountResource) deposit(ctx context.Context, id account.ID, query url.
 		return *response
 	}
 
-	err := r.accountService.Deposit(ctx, id, txId, amount)
+	err := r.accountService.Dispatch(ctx, eventsourcing.Deposit{AccountID: id, TransactionID: txId, Amount: amount})
 	return respond(noContentResponse, err)
 }
 
@@ -129,12 +189,12 @@ func (r *accountResource) withdraw(ctx context.Context, id account.ID, query url
 		return *response
 	}
 
-	err := r.accountService.Withdraw(ctx, id, txId, amount)
+	err := r.accountService.Dispatch(ctx, eventsourcing.Withdraw{AccountID: id, TransactionID: txId, Amount: amount})
 	return respond(noContentResponse, err)
 }
 
 func (r *accountResource) delete(ctx context.Context, id account.ID) response {
-	err := r.accountService.CloseAccount(ctx, id)
+	err := r.accountService.Dispatch(ctx, eventsourcing.CloseAccount{AccountID: id})
 	return respond(noContentResponse, err)
 }
 
@@ -152,7 +212,12 @@ func (r *accountResource) transfer(ctx context.Context, sourceAccountId account.
 		return *response
 	}
 
-	err := r.accountService.Transfer(ctx, sourceAccountId, account.ID{targetAccountId}, txId, amount)
+	err := r.accountService.Dispatch(ctx, eventsourcing.Transfer{
+		SourceAccountID: sourceAccountId,
+		TargetAccountID: account.ID{targetAccountId},
+		TransactionID:   txId,
+		Amount:          amount,
+	})
 	return respond(noContentResponse, err)
 }
 
@@ -175,8 +240,18 @@ func handleDomainError(err error) response {
 		return errorResponse(http.StatusBadRequest, err.Error())
 	case account.InsufficientBalance:
 		return errorResponse(http.StatusBadRequest, err.Error())
+	case account.MissingTransactionID:
+		return errorResponse(http.StatusBadRequest, err.Error())
+	case account.SelfTransfer:
+		return errorResponse(http.StatusBadRequest, err.Error())
+	case account.NotAuthorized:
+		return errorResponse(http.StatusForbidden, err.Error())
 	case account.ConcurrentModification:
 		return conflictResponse()
+	case account.TransactionConflict:
+		return errorResponse(http.StatusConflict, err.Error())
+	case account.TransactionMismatch:
+		return errorResponse(http.StatusUnprocessableEntity, err.Error())
 	default:
 		return unhandledErrorResponse(err)
 	}
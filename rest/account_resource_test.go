@@ -5,12 +5,14 @@ import (
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/eventsourcing"
 	"github.com/rieske/event-sourced-account-go/eventstore"
 	"github.com/rieske/event-sourced-account-go/rest"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -428,3 +430,198 @@ func TestQueryNonExistingAccountNoEvents(t *testing.T) {
 	assert.Equal(t, http.StatusOK, res.Code)
 	assert.Equal(t, `[]`, res.Body.String())
 }
+
+func (f accountResourceFixture) queryStatement(accountID account.ID, query string) eventsourcing.Statement {
+	res := f.get("/api/account/" + accountID.String() + "/statement" + query)
+	f.Equal(http.StatusOK, res.Code)
+	f.Equal("application/json", res.Header().Get("Content-Type"))
+
+	var statement eventsourcing.Statement
+	err := json.Unmarshal(res.Body.Bytes(), &statement)
+	f.NoError(err)
+	return statement
+}
+
+func TestQueryStatement(t *testing.T) {
+	f := newFixture(t)
+	accountID := account.NewID()
+	f.createAccount(accountID, account.NewOwnerID())
+	depositTx, withdrawalTx := uuid.New(), uuid.New()
+	f.deposit(accountID, 50, depositTx)
+	f.withdraw(accountID, 20, withdrawalTx)
+
+	statement := f.queryStatement(accountID, "")
+
+	assert.Equal(t, accountID, statement.AccountID)
+	assert.Equal(t, int64(0), statement.OpeningBalance)
+	assert.Equal(t, int64(30), statement.ClosingBalance)
+	assert.Len(t, statement.Transactions, 2)
+	assert.Equal(t, depositTx, statement.Transactions[0].TransactionID)
+	assert.Equal(t, eventsourcing.DepositEntry, statement.Transactions[0].Type)
+	assert.Equal(t, int64(50), statement.Transactions[0].Amount)
+	assert.Equal(t, int64(50), statement.Transactions[0].Balance)
+	assert.Equal(t, withdrawalTx, statement.Transactions[1].TransactionID)
+	assert.Equal(t, eventsourcing.WithdrawalEntry, statement.Transactions[1].Type)
+	assert.Equal(t, int64(-20), statement.Transactions[1].Amount)
+	assert.Equal(t, int64(30), statement.Transactions[1].Balance)
+}
+
+func TestStatementShowsTransferCounterparty(t *testing.T) {
+	f := newFixture(t)
+	sourceAccountID, targetAccountID := account.NewID(), account.NewID()
+	f.createAccount(sourceAccountID, account.NewOwnerID())
+	f.createAccount(targetAccountID, account.NewOwnerID())
+	f.deposit(sourceAccountID, 10, uuid.New())
+	f.transfer(sourceAccountID, targetAccountID, 4, uuid.New())
+
+	sourceStatement := f.queryStatement(sourceAccountID, "?format=json")
+	targetStatement := f.queryStatement(targetAccountID, "?format=json")
+
+	assert.Len(t, sourceStatement.Transactions, 2)
+	assert.Equal(t, eventsourcing.TransferOutEntry, sourceStatement.Transactions[1].Type)
+	assert.Equal(t, &targetAccountID, sourceStatement.Transactions[1].Counterparty)
+	assert.Len(t, targetStatement.Transactions, 1)
+	assert.Equal(t, eventsourcing.TransferInEntry, targetStatement.Transactions[0].Type)
+	assert.Equal(t, &sourceAccountID, targetStatement.Transactions[0].Counterparty)
+}
+
+func TestStatementForPeriodBeforeAccountActivity(t *testing.T) {
+	f := newFixture(t)
+	accountID := account.NewID()
+	f.createAccount(accountID, account.NewOwnerID())
+	f.deposit(accountID, 50, uuid.New())
+
+	statement := f.queryStatement(accountID, "?from=2000-01-01&to=2000-01-31")
+
+	assert.Equal(t, int64(0), statement.OpeningBalance)
+	assert.Empty(t, statement.Transactions)
+	assert.Equal(t, int64(0), statement.ClosingBalance)
+}
+
+func TestCsvStatement(t *testing.T) {
+	f := newFixture(t)
+	accountID := account.NewID()
+	f.createAccount(accountID, account.NewOwnerID())
+	txId := uuid.New()
+	f.deposit(accountID, 50, txId)
+
+	res := f.get("/api/account/" + accountID.String() + "/statement?format=csv&from=2000-01-01T00:00:00Z")
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "text/csv", res.Header().Get("Content-Type"))
+	lines := strings.Split(strings.TrimSpace(res.Body.String()), "\n")
+	assert.Len(t, lines, 4)
+	assert.Equal(t, "seq,timestamp,transactionId,type,amount,balance,counterparty", lines[0])
+	assert.Equal(t, ",2000-01-01T00:00:00Z,,opening balance,,0,", lines[1])
+	assert.Regexp(t, "^2,[^,]+,"+txId.String()+",deposit,50,50,$", lines[2])
+	assert.Regexp(t, "^,[^,]+,,closing balance,,50,$", lines[3])
+}
+
+func TestTextStatement(t *testing.T) {
+	f := newFixture(t)
+	accountID := account.NewID()
+	f.createAccount(accountID, account.NewOwnerID())
+	f.deposit(accountID, 50, uuid.New())
+
+	res := f.get("/api/account/" + accountID.String() + "/statement?format=text")
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "text/plain", res.Header().Get("Content-Type"))
+	assert.Contains(t, res.Body.String(), "Statement for account "+accountID.String())
+	assert.Contains(t, res.Body.String(), "Opening balance: 0")
+	assert.Regexp(t, "deposit +50 +50", res.Body.String())
+	assert.Contains(t, res.Body.String(), "Closing balance: 50")
+}
+
+func TestUnsupportedStatementFormat(t *testing.T) {
+	f := newFixture(t)
+	accountID := account.NewID()
+	f.createAccount(accountID, account.NewOwnerID())
+
+	res := f.get("/api/account/" + accountID.String() + "/statement?format=xml")
+
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.Equal(t, `{"message":"unsupported statement format 'xml'"}`, res.Body.String())
+}
+
+func TestInvalidStatementPeriod(t *testing.T) {
+	f := newFixture(t)
+	accountID := account.NewID()
+	f.createAccount(accountID, account.NewOwnerID())
+
+	res := f.get("/api/account/" + accountID.String() + "/statement?from=yesterday")
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.Equal(t, `{"message":"invalid date 'yesterday', expected RFC3339 or YYYY-MM-DD"}`, res.Body.String())
+
+	res = f.get("/api/account/" + accountID.String() + "/statement?from=2020-02-01&to=2020-01-01")
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.Equal(t, `{"message":"statement period can not end before it starts"}`, res.Body.String())
+}
+
+func Test404WhenQueryingStatementOfNonExistentAccount(t *testing.T) {
+	f := newFixture(t)
+
+	res := f.get("/api/account/" + account.NewID().String() + "/statement")
+
+	assert.Equal(t, http.StatusNotFound, res.Code)
+	assert.Equal(t, `{"message":"account not found"}`, res.Body.String())
+}
+
+func TestQueryIntegrity(t *testing.T) {
+	f := newFixture(t)
+	accountID := account.NewID()
+	f.createAccount(accountID, account.NewOwnerID())
+	f.deposit(accountID, 5, uuid.New())
+
+	res := f.get("/api/account/" + accountID.String() + "/integrity")
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, fmt.Sprintf(`{"accountId":"%s","events":2,"intact":true}`, accountID), res.Body.String())
+}
+
+func Test404WhenQueryingIntegrityOfNonExistentAccount(t *testing.T) {
+	f := newFixture(t)
+
+	res := f.get("/api/account/" + account.NewID().String() + "/integrity")
+
+	assert.Equal(t, http.StatusNotFound, res.Code)
+	assert.Equal(t, `{"message":"account not found"}`, res.Body.String())
+}
+
+func TestDepositReplayWithDifferentAmountIsUnprocessable(t *testing.T) {
+	f := newFixture(t)
+	accountID := account.NewID()
+	f.createAccount(accountID, account.NewOwnerID())
+	txId := uuid.New()
+	f.deposit(accountID, 42, txId)
+
+	res := f.put("/api/account/" + accountID.String() + "/deposit?amount=43&transactionId=" + txId.String())
+
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+	assert.Equal(t, `{"message":"transaction id already used with different parameters"}`, res.Body.String())
+}
+
+func TestTransactionIdReusedForAnotherOperationIsConflict(t *testing.T) {
+	f := newFixture(t)
+	accountID := account.NewID()
+	f.createAccount(accountID, account.NewOwnerID())
+	txId := uuid.New()
+	f.deposit(accountID, 42, txId)
+
+	res := f.put("/api/account/" + accountID.String() + "/withdraw?amount=42&transactionId=" + txId.String())
+
+	assert.Equal(t, http.StatusConflict, res.Code)
+	assert.Equal(t, `{"message":"transaction id already used for another operation"}`, res.Body.String())
+}
+
+func TestCanNotTransferToTheSameAccount(t *testing.T) {
+	f := newFixture(t)
+	accountID := account.NewID()
+	f.createAccount(accountID, account.NewOwnerID())
+	f.deposit(accountID, 10, uuid.New())
+
+	res := f.put("/api/account/" + accountID.String() + "/transfer?targetAccount=" + accountID.String() + "&amount=2&transactionId=" + uuid.New().String())
+
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.Equal(t, `{"message":"can not transfer to the same account"}`, res.Body.String())
+}
@@ -0,0 +1,110 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HealthCheck probes a dependency that the service needs to serve requests, failing with what is wrong with it
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+type Option func(*RootHandler)
+
+// WithReadinessChecks makes the service ready only while all the checks pass, each within the timeout
+func WithReadinessChecks(timeout time.Duration, checks ...HealthCheck) Option {
+	return func(h *RootHandler) {
+		h.healthResource = healthResource{timeout: timeout, checks: checks}
+	}
+}
+
+const (
+	statusUp   = "up"
+	statusDown = "down"
+)
+
+type healthResource struct {
+	timeout time.Duration
+	checks  []HealthCheck
+}
+
+type healthStatus struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkStatus `json:"checks,omitempty"`
+}
+
+type checkStatus struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+func (r *healthResource) handle(req *http.Request) response {
+	if req.Method != http.MethodGet {
+		return errorResponse(http.StatusMethodNotAllowed, "method not allowed")
+	}
+
+	var head string
+	head, req.URL.Path = shiftPath(req.URL.Path)
+	switch head {
+	case "live":
+		// the process answering is all there is to being alive, failing dependencies do not get fixed by a restart
+		return healthResponse(healthStatus{Status: statusUp})
+	case "ready":
+		return healthResponse(r.ready(req.Context()))
+	}
+	return notFoundResponse()
+}
+
+// ready runs all the checks at once and reports the service down if any of them failed
+func (r *healthResource) ready(ctx context.Context) healthStatus {
+	health := healthStatus{Status: statusUp, Checks: make(map[string]checkStatus, len(r.checks))}
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range r.checks {
+		wg.Add(1)
+		go func(c HealthCheck) {
+			defer wg.Done()
+			status := r.check(ctx, c)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			health.Checks[c.Name] = status
+			if status.Status != statusUp {
+				health.Status = statusDown
+			}
+		}(c)
+	}
+	wg.Wait()
+	return health
+}
+
+func (r *healthResource) check(ctx context.Context, c HealthCheck) checkStatus {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.Check(ctx)
+	status := checkStatus{Status: statusUp, Duration: time.Since(start).String()}
+	if err != nil {
+		status.Status, status.Error = statusDown, err.Error()
+	}
+	return status
+}
+
+func healthResponse(health healthStatus) response {
+	status := http.StatusOK
+	if health.Status != statusUp {
+		status = http.StatusServiceUnavailable
+	}
+	body, err := json.Marshal(health)
+	if err != nil {
+		return unhandledErrorResponse(err)
+	}
+	return jsonResponse(status, body)
+}
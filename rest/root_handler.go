@@ -3,16 +3,32 @@ package rest
 import (
 	"fmt"
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/rieske/event-sourced-account-go/eventsourcing"
+	"go.opentelemetry.io/otel/trace"
 	"log"
 	"net/http"
 	"path"
 	"strconv"
 	"strings"
+	"time"
+)
+
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Number of handled HTTP requests by resource, method and status code",
+	}, []string{"resource", "method", "status"})
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "http_request_duration_seconds",
+		Help: "Time taken to handle HTTP requests by resource and method",
+	}, []string{"resource", "method"})
 )
 
 type RootHandler struct {
 	accountResource accountResource
+	healthResource  healthResource
 }
 
 type response struct {
@@ -71,15 +87,26 @@ func unhandledErrorResponse(err error) response {
 }
 
 func NewRestHandler(store eventsourcing.EventStore, snapshottingFrequency int) *RootHandler {
-	return &RootHandler{
+	return NewAccountServiceHandler(eventsourcing.NewAccountService(store, snapshottingFrequency))
+}
+
+func NewAccountServiceHandler(accountService *eventsourcing.AccountService, options ...Option) *RootHandler {
+	h := &RootHandler{
 		accountResource: accountResource{
-			accountService: eventsourcing.NewAccountService(store, snapshottingFrequency),
+			accountService: accountService,
 		},
 	}
+	for _, option := range options {
+		option(h)
+	}
+	return h
 }
 
 func (s *RootHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	start := time.Now()
 	var head string
+	// paths that are not served are all counted as one resource to keep the number of metric series bounded
+	resource := "unknown"
 	r := notFoundResponse()
 	head, req.URL.Path = shiftPath(req.URL.Path)
 	switch head {
@@ -87,11 +114,23 @@ func (s *RootHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 		head, req.URL.Path = shiftPath(req.URL.Path)
 		switch head {
 		case "account":
+			resource = "account"
 			r = s.accountResource.handle(res, req)
 		}
 	case "ping":
+		resource = "ping"
 		r = responseWithBody(http.StatusOK, "text/plain", []byte("pong"))
+	case "health":
+		resource = "health"
+		r = s.healthResource.handle(req)
 	}
+	defer func() {
+		method := metricMethod(req.Method)
+		requestDuration.WithLabelValues(resource, method).Observe(time.Since(start).Seconds())
+		requestsTotal.WithLabelValues(resource, method, strconv.Itoa(r.status)).Inc()
+		// the span of the request is named after the resource as the path carries account ids
+		trace.SpanFromContext(req.Context()).SetName(method + " " + resource)
+	}()
 
 	for n, h := range r.headers {
 		res.Header().Set(n, h)
@@ -100,6 +139,15 @@ func (s *RootHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 	writeBody(res, r.body)
 }
 
+// metricMethod keeps the methods that are not served out of the metric labels, any token is a valid method
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete:
+		return method
+	}
+	return "other"
+}
+
 // shiftPath splits off the first component of p, which will be cleaned of
 // relative components before processing. head will never contain a slash and
 // tail will always be a rooted path without trailing slash.
@@ -1,12 +1,18 @@
 package rest_test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rieske/event-sourced-account-go/eventsourcing"
 	"github.com/rieske/event-sourced-account-go/eventstore"
 	"github.com/rieske/event-sourced-account-go/rest"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestPing(t *testing.T) {
@@ -21,3 +27,127 @@ func TestPing(t *testing.T) {
 	assert.Equal(t, http.StatusOK, recorder.Code)
 	assert.Equal(t, "pong", recorder.Body.String())
 }
+
+func getHealth(t *testing.T, server *rest.RootHandler, path string) (int, map[string]interface{}) {
+	req, err := http.NewRequest(http.MethodGet, path, nil)
+	assert.NoError(t, err)
+	recorder := httptest.NewRecorder()
+
+	server.ServeHTTP(recorder, req)
+
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	var health map[string]interface{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &health))
+	return recorder.Code, health
+}
+
+func TestLiveRegardlessOfChecks(t *testing.T) {
+	server := rest.NewAccountServiceHandler(
+		eventsourcing.NewAccountService(eventstore.NewInMemoryStore(), 0),
+		rest.WithReadinessChecks(time.Second, rest.HealthCheck{Name: "database", Check: func(ctx context.Context) error {
+			return errors.New("connection refused")
+		}}),
+	)
+
+	status, health := getHealth(t, server, "/health/live")
+
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, map[string]interface{}{"status": "up"}, health)
+}
+
+func TestReadyWithoutChecks(t *testing.T) {
+	server := rest.NewRestHandler(eventstore.NewInMemoryStore(), 0)
+
+	status, health := getHealth(t, server, "/health/ready")
+
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "up", health["status"])
+}
+
+func TestReadyWhenAllChecksPass(t *testing.T) {
+	pass := func(ctx context.Context) error { return nil }
+	server := rest.NewAccountServiceHandler(
+		eventsourcing.NewAccountService(eventstore.NewInMemoryStore(), 0),
+		rest.WithReadinessChecks(time.Second, rest.HealthCheck{Name: "database", Check: pass}, rest.HealthCheck{Name: "schema", Check: pass}),
+	)
+
+	status, health := getHealth(t, server, "/health/ready")
+
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "up", health["status"])
+	checks := health["checks"].(map[string]interface{})
+	assert.Len(t, checks, 2)
+	assert.Equal(t, "up", checks["database"].(map[string]interface{})["status"])
+	assert.Equal(t, "up", checks["schema"].(map[string]interface{})["status"])
+}
+
+func TestNotReadyWhenACheckFails(t *testing.T) {
+	server := rest.NewAccountServiceHandler(
+		eventsourcing.NewAccountService(eventstore.NewInMemoryStore(), 0),
+		rest.WithReadinessChecks(time.Second,
+			rest.HealthCheck{Name: "database", Check: func(ctx context.Context) error { return nil }},
+			rest.HealthCheck{Name: "schema", Check: func(ctx context.Context) error { return errors.New("schema version is 10, expected 11") }},
+		),
+	)
+
+	status, health := getHealth(t, server, "/health/ready")
+
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, "down", health["status"])
+	checks := health["checks"].(map[string]interface{})
+	assert.Equal(t, "up", checks["database"].(map[string]interface{})["status"])
+	assert.Equal(t, "down", checks["schema"].(map[string]interface{})["status"])
+	assert.Equal(t, "schema version is 10, expected 11", checks["schema"].(map[string]interface{})["error"])
+}
+
+func TestNotReadyWhenACheckTimesOut(t *testing.T) {
+	server := rest.NewAccountServiceHandler(
+		eventsourcing.NewAccountService(eventstore.NewInMemoryStore(), 0),
+		rest.WithReadinessChecks(10*time.Millisecond, rest.HealthCheck{Name: "database", Check: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}}),
+	)
+
+	status, health := getHealth(t, server, "/health/ready")
+
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, context.DeadlineExceeded.Error(), health["checks"].(map[string]interface{})["database"].(map[string]interface{})["error"])
+}
+
+// requestCount reads the number of requests counted with the labels from the default registry
+func requestCount(t *testing.T, resource, method, status string) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	assert.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != "http_requests_total" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels["resource"] == resource && labels["method"] == method && labels["status"] == status {
+				return m.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func TestCountsRequestsByResourceAndStatus(t *testing.T) {
+	server := rest.NewRestHandler(eventstore.NewInMemoryStore(), 0)
+	pings := requestCount(t, "ping", http.MethodGet, "200")
+	unknown := requestCount(t, "unknown", "other", "404")
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/ping", nil),
+		httptest.NewRequest("BREW", "/coffee", nil),
+	} {
+		server.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	assert.Equal(t, pings+1, requestCount(t, "ping", http.MethodGet, "200"))
+	assert.Equal(t, unknown+1, requestCount(t, "unknown", "other", "404"))
+}
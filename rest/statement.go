@@ -0,0 +1,114 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rieske/event-sourced-account-go/eventsourcing"
+)
+
+const dateLayout = "2006-01-02"
+
+type statementRenderer func(statement *eventsourcing.Statement) (response, error)
+
+var statementRenderers = map[string]statementRenderer{
+	"":     renderJsonStatement,
+	"json": renderJsonStatement,
+	"csv":  renderCsvStatement,
+	"text": renderTextStatement,
+}
+
+// parseStatementDate accepts either an RFC3339 timestamp or a plain date.
+// A plain date denotes the start of that day in UTC, unless it is the end of the period,
+// in which case the whole day is included.
+func parseStatementDate(dateStr string, defaultDate time.Time, endOfPeriod bool) (time.Time, *response) {
+	if dateStr == "" {
+		return defaultDate, nil
+	}
+	if date, err := time.Parse(time.RFC3339, dateStr); err == nil {
+		return date.UTC(), nil
+	}
+	date, err := time.Parse(dateLayout, dateStr)
+	if err != nil {
+		r := errorResponse(http.StatusBadRequest, fmt.Sprintf("invalid date '%s', expected RFC3339 or YYYY-MM-DD", dateStr))
+		return date, &r
+	}
+	if endOfPeriod {
+		date = date.AddDate(0, 0, 1)
+	}
+	return date, nil
+}
+
+func renderJsonStatement(statement *eventsourcing.Statement) (response, error) {
+	body, err := json.Marshal(statement)
+	if err != nil {
+		return response{}, err
+	}
+	return jsonResponse(http.StatusOK, body), nil
+}
+
+func renderCsvStatement(statement *eventsourcing.Statement) (response, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	records := [][]string{
+		{"seq", "timestamp", "transactionId", "type", "amount", "balance", "counterparty"},
+		{"", formatTimestamp(statement.From), "", "opening balance", "", strconv.FormatInt(statement.OpeningBalance, 10), ""},
+	}
+	for _, e := range statement.Transactions {
+		records = append(records, []string{
+			strconv.Itoa(e.Seq),
+			formatTimestamp(e.Timestamp),
+			e.TransactionID.String(),
+			e.Type,
+			strconv.FormatInt(e.Amount, 10),
+			strconv.FormatInt(e.Balance, 10),
+			formatCounterparty(e),
+		})
+	}
+	records = append(records, []string{"", formatTimestamp(statement.To), "", "closing balance", "", strconv.FormatInt(statement.ClosingBalance, 10), ""})
+
+	if err := w.WriteAll(records); err != nil {
+		return response{}, err
+	}
+	return responseWithBody(http.StatusOK, "text/csv", buf.Bytes()), nil
+}
+
+func renderTextStatement(statement *eventsourcing.Statement) (response, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Statement for account %s\n", statement.AccountID)
+	fmt.Fprintf(&buf, "Period: %s - %s\n\n", formatTimestamp(statement.From), formatTimestamp(statement.To))
+	fmt.Fprintf(&buf, "Opening balance: %d\n\n", statement.OpeningBalance)
+
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "Date\tType\tAmount\tBalance\tCounterparty\t")
+	for _, e := range statement.Transactions {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t\n", formatTimestamp(e.Timestamp), e.Type, e.Amount, e.Balance, formatCounterparty(e))
+	}
+	if err := w.Flush(); err != nil {
+		return response{}, err
+	}
+
+	fmt.Fprintf(&buf, "\nClosing balance: %d\n", statement.ClosingBalance)
+	return responseWithBody(http.StatusOK, "text/plain", buf.Bytes()), nil
+}
+
+func formatTimestamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func formatCounterparty(e eventsourcing.StatementEntry) string {
+	if e.Counterparty == nil {
+		return ""
+	}
+	return e.Counterparty.String()
+}
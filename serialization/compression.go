@@ -0,0 +1,154 @@
+package serialization
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/rieske/event-sourced-account-go/eventstore"
+)
+
+const (
+	NoCompression = "none"
+	Zstd          = "zstd"
+	Gzip          = "gzip"
+	Snappy        = "snappy"
+)
+
+// Compressed payloads start with a header byte marking the codec.
+// Payloads of the serializers never start with these bytes: msgpack events are maps,
+// json events are objects and protobuf tags of fields below 16 are single bytes below 0x80.
+const (
+	zstdHeader   byte = 0xc1
+	gzipHeader   byte = 0xc2
+	snappyHeader byte = 0xc3
+)
+
+var gzipWriters = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(nil)
+	},
+}
+
+// zstdDecoder is shared by all serializers, as the decoder runs goroutines of its own for as long as the process does.
+// DecodeAll can be called concurrently.
+var zstdDecoder = sync.OnceValues(func() (*zstd.Decoder, error) {
+	return zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+})
+
+// compressingEventSerializer compresses payloads of the wrapped serializer that are larger than the threshold.
+// Payloads without a codec header are passed to the wrapped serializer as they are,
+// so events written before compression was enabled can still be read.
+type compressingEventSerializer struct {
+	serializer EventSerializer
+	header     byte
+	threshold  int
+	zstdWriter *zstd.Encoder
+}
+
+// NewCompressingEventSerializer wraps the serializer to compress payloads larger than threshold bytes with the codec.
+// With NoCompression the serializer only decompresses payloads that were compressed before.
+func NewCompressingEventSerializer(serializer EventSerializer, codec string, threshold int) (*compressingEventSerializer, error) {
+	s := &compressingEventSerializer{serializer: serializer, threshold: threshold}
+	switch codec {
+	case NoCompression:
+	case Zstd:
+		s.header = zstdHeader
+	case Gzip:
+		s.header = gzipHeader
+	case Snappy:
+		s.header = snappyHeader
+	default:
+		return nil, fmt.Errorf("unsupported compression codec '%s'", codec)
+	}
+
+	if s.header == zstdHeader {
+		var err error
+		if s.zstdWriter, err = zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1)); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s compressingEventSerializer) SerializerId() int {
+	return s.serializer.SerializerId()
+}
+
+func (s compressingEventSerializer) SerializeEvent(ctx context.Context, e eventstore.SequencedEvent) (eventstore.SerializedEvent, error) {
+	event, err := s.serializer.SerializeEvent(ctx, e)
+	if err != nil {
+		return event, err
+	}
+	if s.header == 0 || (len(event.Payload) <= s.threshold && !hasCodecHeader(event.Payload)) {
+		return event, nil
+	}
+	// payloads that look compressed are compressed regardless of the threshold so that they are never mistaken for compressed ones
+	event.Payload, err = s.compress(event.Payload)
+	return event, err
+}
+
+func (s compressingEventSerializer) DeserializeEvent(ctx context.Context, se eventstore.SerializedEvent) (eventstore.SequencedEvent, error) {
+	if hasCodecHeader(se.Payload) {
+		payload, err := s.decompress(se.Payload)
+		if err != nil {
+			return eventstore.SequencedEvent{}, err
+		}
+		se.Payload = payload
+	}
+	return s.serializer.DeserializeEvent(ctx, se)
+}
+
+func hasCodecHeader(payload []byte) bool {
+	return len(payload) != 0 && (payload[0] == zstdHeader || payload[0] == gzipHeader || payload[0] == snappyHeader)
+}
+
+func (s compressingEventSerializer) compress(payload []byte) ([]byte, error) {
+	compressed := []byte{s.header}
+	switch s.header {
+	case zstdHeader:
+		return s.zstdWriter.EncodeAll(payload, compressed), nil
+	case snappyHeader:
+		return append(compressed, s2.EncodeSnappy(nil, payload)...), nil
+	default:
+		buffer := bytes.NewBuffer(compressed)
+		writer := gzipWriters.Get().(*gzip.Writer)
+		defer gzipWriters.Put(writer)
+		writer.Reset(buffer)
+		if _, err := writer.Write(payload); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		return buffer.Bytes(), nil
+	}
+}
+
+func (s compressingEventSerializer) decompress(payload []byte) ([]byte, error) {
+	switch payload[0] {
+	case zstdHeader:
+		decoder, err := zstdDecoder()
+		if err != nil {
+			return nil, err
+		}
+		return decoder.DecodeAll(payload[1:], nil)
+	case snappyHeader:
+		return s2.Decode(nil, payload[1:])
+	default:
+		reader, err := gzip.NewReader(bytes.NewReader(payload[1:]))
+		if err != nil {
+			return nil, err
+		}
+		decompressed, err := io.ReadAll(reader)
+		if closeErr := reader.Close(); err == nil {
+			err = closeErr
+		}
+		return decompressed, err
+	}
+}
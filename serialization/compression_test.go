@@ -0,0 +1,150 @@
+package serialization_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/eventstore"
+	"github.com/rieske/event-sourced-account-go/serialization"
+	"github.com/stretchr/testify/assert"
+)
+
+var codecs = []string{serialization.Zstd, serialization.Gzip, serialization.Snappy}
+
+func compressingSerializer(t testing.TB, serializer serialization.EventSerializer, codec string, threshold int) serialization.EventSerializer {
+	s, err := serialization.NewCompressingEventSerializer(serializer, codec, threshold)
+	assert.NoError(t, err)
+	return s
+}
+
+func snapshotEvent() eventstore.SequencedEvent {
+	accountID := account.NewID()
+	return eventstore.SequencedEvent{
+		AggregateId: accountID,
+		Seq:         42,
+		Event:       account.Snapshot{accountID, account.NewOwnerID(), 20, true},
+	}
+}
+
+func TestCompressionRoundTrip(t *testing.T) {
+	for _, codec := range codecs {
+		serializer := compressingSerializer(t, msgpackSerializer, codec, 0)
+		for _, e := range allEvents() {
+			event := eventstore.SequencedEvent{account.NewID(), 42, e}
+
+			serializedEvent, err := serializer.SerializeEvent(context.Background(), event)
+			assert.NoError(t, err)
+
+			deserializedEvent, err := serializer.DeserializeEvent(context.Background(), serializedEvent)
+			assert.NoError(t, err)
+			assert.Equal(t, event, deserializedEvent, codec)
+		}
+	}
+}
+
+func TestCompressionThreshold(t *testing.T) {
+	event := snapshotEvent()
+	raw, err := msgpackSerializer.SerializeEvent(context.Background(), event)
+	assert.NoError(t, err)
+
+	serializedEvent, err := compressingSerializer(t, msgpackSerializer, serialization.Zstd, len(raw.Payload)).SerializeEvent(context.Background(), event)
+
+	assert.NoError(t, err)
+	assert.Equal(t, raw, serializedEvent)
+}
+
+func TestCompressionMarksPayloadWithCodecHeader(t *testing.T) {
+	headers := map[string]byte{serialization.Zstd: 0xc1, serialization.Gzip: 0xc2, serialization.Snappy: 0xc3}
+	for codec, header := range headers {
+		serializedEvent, err := compressingSerializer(t, msgpackSerializer, codec, 0).SerializeEvent(context.Background(), snapshotEvent())
+
+		assert.NoError(t, err)
+		assert.Equal(t, header, serializedEvent.Payload[0])
+	}
+}
+
+func TestUncompressedPayloadsAreStillRead(t *testing.T) {
+	event := snapshotEvent()
+	for _, original := range []serialization.EventSerializer{msgpackSerializer, jsonSerializer, protobufSerializer} {
+		serializedEvent, err := original.SerializeEvent(context.Background(), event)
+		assert.NoError(t, err)
+
+		deserializedEvent, err := compressingSerializer(t, original, serialization.Zstd, 0).DeserializeEvent(context.Background(), serializedEvent)
+
+		assert.NoError(t, err)
+		assert.Equal(t, event, deserializedEvent)
+	}
+}
+
+func TestPayloadsCompressedWithAnyCodecAreRead(t *testing.T) {
+	event := snapshotEvent()
+	reader := compressingSerializer(t, protobufSerializer, serialization.NoCompression, 0)
+	for _, codec := range codecs {
+		serializedEvent, err := compressingSerializer(t, protobufSerializer, codec, 0).SerializeEvent(context.Background(), event)
+		assert.NoError(t, err)
+
+		deserializedEvent, err := reader.DeserializeEvent(context.Background(), serializedEvent)
+
+		assert.NoError(t, err)
+		assert.Equal(t, event, deserializedEvent)
+	}
+}
+
+func TestNoCompressionWritesRawPayloads(t *testing.T) {
+	event := snapshotEvent()
+	raw, err := msgpackSerializer.SerializeEvent(context.Background(), event)
+	assert.NoError(t, err)
+
+	serializedEvent, err := compressingSerializer(t, msgpackSerializer, serialization.NoCompression, 0).SerializeEvent(context.Background(), event)
+
+	assert.NoError(t, err)
+	assert.Equal(t, raw, serializedEvent)
+}
+
+func TestCompressionKeepsSerializerId(t *testing.T) {
+	assert.Equal(t, serialization.ProtobufSerializerId, compressingSerializer(t, protobufSerializer, serialization.Gzip, 0).SerializerId())
+}
+
+func TestUnsupportedCompressionCodec(t *testing.T) {
+	_, err := serialization.NewCompressingEventSerializer(msgpackSerializer, "lzma", 0)
+
+	assert.EqualError(t, err, "unsupported compression codec 'lzma'")
+}
+
+func benchmarkSerializer(b *testing.B, serializer serialization.EventSerializer) {
+	event := snapshotEvent()
+	serializedEvent, err := serializer.SerializeEvent(context.Background(), event)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		serializedEvent, err := serializer.SerializeEvent(context.Background(), event)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := serializer.DeserializeEvent(context.Background(), serializedEvent); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(len(serializedEvent.Payload)), "payload-bytes")
+}
+
+func BenchmarkRawMsgpack(b *testing.B) {
+	benchmarkSerializer(b, msgpackSerializer)
+}
+
+func BenchmarkZstdMsgpack(b *testing.B) {
+	benchmarkSerializer(b, compressingSerializer(b, msgpackSerializer, serialization.Zstd, 0))
+}
+
+func BenchmarkGzipMsgpack(b *testing.B) {
+	benchmarkSerializer(b, compressingSerializer(b, msgpackSerializer, serialization.Gzip, 0))
+}
+
+func BenchmarkSnappyMsgpack(b *testing.B) {
+	benchmarkSerializer(b, compressingSerializer(b, msgpackSerializer, serialization.Snappy, 0))
+}
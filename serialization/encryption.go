@@ -0,0 +1,197 @@
+package serialization
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/rieske/event-sourced-account-go/eventstore"
+)
+
+// encryptedHeader marks encrypted payloads, which are laid out as
+// header, key id length, key id, nonce, ciphertext
+const encryptedHeader byte = 0xc4
+
+// UnknownKeyError is returned when a payload is encrypted with a key that the key provider does not have
+type UnknownKeyError struct {
+	KeyId string
+}
+
+func (e UnknownKeyError) Error() string {
+	return fmt.Sprintf("encryption key '%s' is not known", e.KeyId)
+}
+
+// KeyProvider supplies AES keys of 16, 24 or 32 bytes by their ids
+type KeyProvider interface {
+	// CurrentKey returns the key that new payloads are encrypted with
+	CurrentKey() (keyId string, key []byte, err error)
+	// Key returns the key with the id or UnknownKeyError
+	Key(keyId string) ([]byte, error)
+}
+
+// encryptingEventSerializer encrypts payloads of the wrapped serializer with AES-GCM.
+// The ciphertext is bound to the aggregate, sequence number and event type of the event so it can not be moved to another one.
+// Payloads without the encryption header are passed to the wrapped serializer as they are,
+// so events written before encryption was enabled can still be read.
+type encryptingEventSerializer struct {
+	serializer EventSerializer
+	keys       KeyProvider
+}
+
+func NewEncryptingEventSerializer(serializer EventSerializer, keys KeyProvider) *encryptingEventSerializer {
+	return &encryptingEventSerializer{serializer: serializer, keys: keys}
+}
+
+func (s encryptingEventSerializer) SerializerId() int {
+	return s.serializer.SerializerId()
+}
+
+func (s encryptingEventSerializer) SerializeEvent(ctx context.Context, e eventstore.SequencedEvent) (eventstore.SerializedEvent, error) {
+	event, err := s.serializer.SerializeEvent(ctx, e)
+	if err != nil {
+		return event, err
+	}
+	event.Payload, err = s.encrypt(event, event.Payload)
+	return event, err
+}
+
+func (s encryptingEventSerializer) DeserializeEvent(ctx context.Context, se eventstore.SerializedEvent) (eventstore.SequencedEvent, error) {
+	if isEncrypted(se.Payload) {
+		payload, err := s.decrypt(se)
+		if err != nil {
+			return eventstore.SequencedEvent{}, err
+		}
+		se.Payload = payload
+	}
+	return s.serializer.DeserializeEvent(ctx, se)
+}
+
+func isEncrypted(payload []byte) bool {
+	return len(payload) != 0 && payload[0] == encryptedHeader
+}
+
+func (s encryptingEventSerializer) encrypt(se eventstore.SerializedEvent, plaintext []byte) ([]byte, error) {
+	keyId, key, err := s.keys.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+	if len(keyId) > 255 {
+		return nil, fmt.Errorf("encryption key id '%s' is longer than 255 bytes", keyId)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := append([]byte{encryptedHeader, byte(len(keyId))}, keyId...)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	payload = append(payload, nonce...)
+	return aead.Seal(payload, nonce, plaintext, additionalData(se)), nil
+}
+
+func (s encryptingEventSerializer) decrypt(se eventstore.SerializedEvent) ([]byte, error) {
+	keyId, sealed, err := splitEncryptedPayload(se.Payload)
+	if err != nil {
+		return nil, err
+	}
+	key, err := s.keys.Key(keyId)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("encrypted payload is truncated")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData(se))
+}
+
+func splitEncryptedPayload(payload []byte) (keyId string, sealed []byte, err error) {
+	if len(payload) < 2 || len(payload) < 2+int(payload[1]) {
+		return "", nil, errors.New("encrypted payload is truncated")
+	}
+	end := 2 + int(payload[1])
+	return string(payload[2:end]), payload[end:], nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func additionalData(se eventstore.SerializedEvent) []byte {
+	data := append([]byte{}, se.AggregateId.UUID[:]...)
+	data = binary.BigEndian.AppendUint64(data, uint64(se.Seq))
+	return binary.BigEndian.AppendUint64(data, uint64(se.EventType))
+}
+
+// reEncrypt returns the payload encrypted with the current key, or nil if it already is
+func (s encryptingEventSerializer) reEncrypt(se eventstore.SerializedEvent) ([]byte, error) {
+	currentKeyId, _, err := s.keys.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+	if isEncrypted(se.Payload) {
+		keyId, _, err := splitEncryptedPayload(se.Payload)
+		if err != nil {
+			return nil, err
+		}
+		if keyId == currentKeyId {
+			return nil, nil
+		}
+	}
+	plaintext := se.Payload
+	if isEncrypted(se.Payload) {
+		if plaintext, err = s.decrypt(se); err != nil {
+			return nil, err
+		}
+	}
+	return s.encrypt(se, plaintext)
+}
+
+// PayloadRewriter is implemented by stores that can replace stored payloads in place
+type PayloadRewriter interface {
+	// RewritePayloads calls rewrite for every stored binary payload and stores the returned payload unless it is nil
+	RewritePayloads(ctx context.Context, rewrite func(eventstore.SerializedEvent) ([]byte, error)) (int, error)
+}
+
+// ReEncrypt encrypts all stored payloads that are not encrypted with the current key with it and
+// returns the number of rewritten payloads. Keys that are rotated out can be removed once it completes.
+func ReEncrypt(ctx context.Context, store PayloadRewriter, keys KeyProvider) (int, error) {
+	return store.RewritePayloads(ctx, encryptingEventSerializer{keys: keys}.reEncrypt)
+}
+
+// RunReEncryption re-encrypts stored payloads periodically until the context is done
+func RunReEncryption(ctx context.Context, store PayloadRewriter, keys KeyProvider, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rewritten, err := ReEncrypt(ctx, store, keys)
+			if err != nil {
+				log.Printf("re-encryption failed after rewriting %d payloads: %v\n", rewritten, err)
+			} else if rewritten != 0 {
+				log.Printf("re-encrypted %d payloads\n", rewritten)
+			}
+		}
+	}
+}
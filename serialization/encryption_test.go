@@ -0,0 +1,176 @@
+package serialization_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/eventstore"
+	"github.com/rieske/event-sourced-account-go/serialization"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	key1 = bytes.Repeat([]byte{1}, 32)
+	key2 = bytes.Repeat([]byte{2}, 16)
+)
+
+func keyring(t *testing.T, content string) *serialization.FileKeyring {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	k, err := serialization.NewFileKeyring(path)
+	assert.NoError(t, err)
+	return k
+}
+
+func keyringWith(t *testing.T, current string, keys map[string][]byte) *serialization.FileKeyring {
+	content := `{"currentKeyId": "` + current + `", "keys": {`
+	separator := ""
+	for id, key := range keys {
+		content += separator + `"` + id + `": "` + base64.StdEncoding.EncodeToString(key) + `"`
+		separator = ", "
+	}
+	return keyring(t, content+"}}")
+}
+
+// inmemoryPayloads is a PayloadRewriter over serialized events
+type inmemoryPayloads []eventstore.SerializedEvent
+
+func (p inmemoryPayloads) RewritePayloads(ctx context.Context, rewrite func(eventstore.SerializedEvent) ([]byte, error)) (int, error) {
+	rewritten := 0
+	for i, event := range p {
+		payload, err := rewrite(event)
+		if err != nil {
+			return rewritten, err
+		}
+		if payload != nil {
+			p[i].Payload = payload
+			rewritten++
+		}
+	}
+	return rewritten, nil
+}
+
+func TestEncryptionRoundTrip(t *testing.T) {
+	serializer := serialization.NewEncryptingEventSerializer(msgpackSerializer, keyringWith(t, "k1", map[string][]byte{"k1": key1}))
+	for _, e := range allEvents() {
+		event := eventstore.SequencedEvent{account.NewID(), 42, e}
+
+		serializedEvent, err := serializer.SerializeEvent(context.Background(), event)
+		assert.NoError(t, err)
+
+		deserializedEvent, err := serializer.DeserializeEvent(context.Background(), serializedEvent)
+		assert.NoError(t, err)
+		assert.Equal(t, event, deserializedEvent)
+	}
+}
+
+func TestEncryptedPayloadCarriesKeyIdAndHidesData(t *testing.T) {
+	serializer := serialization.NewEncryptingEventSerializer(msgpackSerializer, keyringWith(t, "k1", map[string][]byte{"k1": key1}))
+	event := snapshotEvent()
+	ownerID := event.Event.(account.Snapshot).OwnerID
+
+	serializedEvent, err := serializer.SerializeEvent(context.Background(), event)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0xc4, 2, 'k', '1'}, serializedEvent.Payload[:4])
+	assert.False(t, bytes.Contains(serializedEvent.Payload, ownerID.UUID[:]))
+}
+
+func TestUnencryptedPayloadsAreStillRead(t *testing.T) {
+	serializer := serialization.NewEncryptingEventSerializer(msgpackSerializer, keyringWith(t, "k1", map[string][]byte{"k1": key1}))
+	event := snapshotEvent()
+	serializedEvent, err := msgpackSerializer.SerializeEvent(context.Background(), event)
+	assert.NoError(t, err)
+
+	deserializedEvent, err := serializer.DeserializeEvent(context.Background(), serializedEvent)
+
+	assert.NoError(t, err)
+	assert.Equal(t, event, deserializedEvent)
+}
+
+func TestEncryptedPayloadCanNotBeMovedToAnotherEvent(t *testing.T) {
+	serializer := serialization.NewEncryptingEventSerializer(msgpackSerializer, keyringWith(t, "k1", map[string][]byte{"k1": key1}))
+	serializedEvent, err := serializer.SerializeEvent(context.Background(), snapshotEvent())
+	assert.NoError(t, err)
+
+	serializedEvent.Seq++
+	_, err = serializer.DeserializeEvent(context.Background(), serializedEvent)
+
+	assert.Error(t, err)
+}
+
+func TestDecryptingWithUnknownKeyFails(t *testing.T) {
+	writer := serialization.NewEncryptingEventSerializer(msgpackSerializer, keyringWith(t, "k1", map[string][]byte{"k1": key1}))
+	reader := serialization.NewEncryptingEventSerializer(msgpackSerializer, keyringWith(t, "k2", map[string][]byte{"k2": key2}))
+	serializedEvent, err := writer.SerializeEvent(context.Background(), snapshotEvent())
+	assert.NoError(t, err)
+
+	_, err = reader.DeserializeEvent(context.Background(), serializedEvent)
+
+	var unknownKey serialization.UnknownKeyError
+	assert.True(t, errors.As(err, &unknownKey))
+	assert.Equal(t, "k1", unknownKey.KeyId)
+}
+
+func TestEncryptionOfCompressedPayloads(t *testing.T) {
+	compressing, err := serialization.NewCompressingEventSerializer(protobufSerializer, serialization.Zstd, 0)
+	assert.NoError(t, err)
+	serializer := serialization.NewEncryptingEventSerializer(compressing, keyringWith(t, "k1", map[string][]byte{"k1": key1}))
+	event := snapshotEvent()
+
+	serializedEvent, err := serializer.SerializeEvent(context.Background(), event)
+	assert.NoError(t, err)
+	deserializedEvent, err := serializer.DeserializeEvent(context.Background(), serializedEvent)
+
+	assert.NoError(t, err)
+	assert.Equal(t, event, deserializedEvent)
+	assert.Equal(t, serialization.ProtobufSerializerId, serializer.SerializerId())
+}
+
+func TestReEncryptionRotatesKeys(t *testing.T) {
+	oldKeys := keyringWith(t, "k1", map[string][]byte{"k1": key1})
+	rotatedKeys := keyringWith(t, "k2", map[string][]byte{"k1": key1, "k2": key2})
+	newKeys := keyringWith(t, "k2", map[string][]byte{"k2": key2})
+	event := snapshotEvent()
+	encrypted, err := serialization.NewEncryptingEventSerializer(msgpackSerializer, oldKeys).SerializeEvent(context.Background(), event)
+	assert.NoError(t, err)
+	plain, err := msgpackSerializer.SerializeEvent(context.Background(), event)
+	assert.NoError(t, err)
+	current, err := serialization.NewEncryptingEventSerializer(msgpackSerializer, rotatedKeys).SerializeEvent(context.Background(), event)
+	assert.NoError(t, err)
+	payloads := inmemoryPayloads{encrypted, plain, current}
+
+	rewritten, err := serialization.ReEncrypt(context.Background(), payloads, rotatedKeys)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, rewritten)
+	reader := serialization.NewEncryptingEventSerializer(msgpackSerializer, newKeys)
+	for _, serializedEvent := range payloads {
+		deserializedEvent, err := reader.DeserializeEvent(context.Background(), serializedEvent)
+		assert.NoError(t, err)
+		assert.Equal(t, event, deserializedEvent)
+	}
+}
+
+func TestKeyringValidation(t *testing.T) {
+	invalid := map[string]string{
+		"not json":        `{`,
+		"missing current": `{"currentKeyId": "k2", "keys": {"k1": "` + base64.StdEncoding.EncodeToString(key1) + `"}}`,
+		"short key":       `{"currentKeyId": "k1", "keys": {"k1": "` + base64.StdEncoding.EncodeToString([]byte("short")) + `"}}`,
+		"not base64":      `{"currentKeyId": "k1", "keys": {"k1": "?"}}`,
+	}
+	for name, content := range invalid {
+		path := filepath.Join(t.TempDir(), "keyring.json")
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0600))
+
+		_, err := serialization.NewFileKeyring(path)
+
+		assert.Error(t, err, name)
+	}
+}
@@ -0,0 +1,43 @@
+package serialization
+
+import (
+	"fmt"
+
+	"github.com/rieske/event-sourced-account-go/account"
+)
+
+// Codes of the account events as stored in the event type of serialized events
+const (
+	Snapshot         = 1
+	AccountOpened    = 2
+	MoneyDeposited   = 3
+	MoneyWithdrawn   = 4
+	AccountClosed    = 5
+	TransferSent     = 6
+	TransferReceived = 7
+)
+
+// AccountEvents is the registry of the account events
+var AccountEvents = NewRegistry()
+
+func init() {
+	AccountEvents.Register("Snapshot", Snapshot, account.Snapshot{})
+	AccountEvents.Register("AccountOpened", AccountOpened, account.AccountOpenedEvent{})
+	AccountEvents.Register("MoneyDeposited", MoneyDeposited, account.MoneyDepositedEvent{})
+	AccountEvents.Register("MoneyWithdrawn", MoneyWithdrawn, account.MoneyWithdrawnEvent{})
+	AccountEvents.Register("AccountClosed", AccountClosed, account.AccountClosedEvent{})
+	AccountEvents.Register("TransferSent", TransferSent, account.TransferSentEvent{})
+	AccountEvents.Register("TransferReceived", TransferReceived, account.TransferReceivedEvent{})
+}
+
+func deserializeEvent(payload []byte, code int, unmarshal func([]byte, interface{}) error) (account.Event, error) {
+	decoded, err := AccountEvents.Decode(code, payload, unmarshal)
+	if err != nil {
+		return nil, err
+	}
+	event, ok := decoded.(account.Event)
+	if !ok {
+		return nil, fmt.Errorf("event code %d is registered for %T which is not an account event", code, decoded)
+	}
+	return event, nil
+}
@@ -0,0 +1,51 @@
+package serialization
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/rieske/event-sourced-account-go/account"
+)
+
+// forgetCommitGrace is how much further back than the previous poll WatchForgottenOwners looks, so that owners
+// forgotten in transactions that started before the poll but committed after it are not missed
+const forgetCommitGrace = time.Minute
+
+// ForgottenOwnerLog lists the owners whose keys were deleted
+type ForgottenOwnerLog interface {
+	// ForgottenOwners lists the owners forgotten within the duration before now, by the clock of the log
+	ForgottenOwners(ctx context.Context, within time.Duration) ([]account.OwnerID, error)
+}
+
+// WatchForgottenOwners polls the log every interval until the context is done and hands each owner forgotten since
+// the watch started to forget once, so that instances drop what they cached of owners forgotten by another process
+func WatchForgottenOwners(ctx context.Context, owners ForgottenOwnerLog, interval time.Duration, forget func(account.OwnerID)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	polledAt := time.Now()
+	seen := map[account.OwnerID]bool{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pollStart := time.Now()
+			forgotten, err := owners.ForgottenOwners(ctx, pollStart.Sub(polledAt)+forgetCommitGrace)
+			if err != nil {
+				log.Printf("could not poll forgotten owners: %v\n", err)
+				continue
+			}
+			polledAt = pollStart
+			// the owners forgotten earlier than the window are not listed again and need not be remembered
+			recent := map[account.OwnerID]bool{}
+			for _, owner := range forgotten {
+				recent[owner] = true
+				if !seen[owner] {
+					forget(owner)
+				}
+			}
+			seen = recent
+		}
+	}
+}
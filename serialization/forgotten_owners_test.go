@@ -0,0 +1,37 @@
+package serialization_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/serialization"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchForgottenOwnersForgetsEachOwnerOnce(t *testing.T) {
+	keys := serialization.NewInMemoryOwnerKeyStore()
+	ownerID := account.NewOwnerID()
+	ctx, cancel := context.WithCancel(context.Background())
+	var forgotten []account.OwnerID
+	mutex := sync.Mutex{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		serialization.WatchForgottenOwners(ctx, keys, 10*time.Millisecond, func(owner account.OwnerID) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			forgotten = append(forgotten, owner)
+		})
+	}()
+
+	_, err := keys.DeleteOwnerKey(context.Background(), ownerID)
+	assert.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+
+	assert.Equal(t, []account.OwnerID{ownerID}, forgotten)
+}
@@ -0,0 +1,41 @@
+package serialization
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rieske/event-sourced-account-go/eventstore"
+)
+
+// Serializer ids are stored with each event to tell which serializer can read it back, they must never change
+const (
+	MsgpackSerializerId  = 1
+	JsonSerializerId     = 2
+	ProtobufSerializerId = 3
+)
+
+const (
+	MsgpackFormat  = "msgpack"
+	JsonFormat     = "json"
+	ProtobufFormat = "protobuf"
+)
+
+type EventSerializer interface {
+	SerializerId() int
+	SerializeEvent(ctx context.Context, e eventstore.SequencedEvent) (eventstore.SerializedEvent, error)
+	DeserializeEvent(ctx context.Context, s eventstore.SerializedEvent) (eventstore.SequencedEvent, error)
+}
+
+// NewEventSerializer creates a serializer writing events in the given format
+func NewEventSerializer(format string) (EventSerializer, error) {
+	switch format {
+	case MsgpackFormat:
+		return NewMsgpackEventSerializer(), nil
+	case JsonFormat:
+		return NewJsonEventSerializer(), nil
+	case ProtobufFormat:
+		return NewProtobufEventSerializer(), nil
+	default:
+		return nil, fmt.Errorf("unsupported serialization format '%s'", format)
+	}
+}
@@ -0,0 +1,59 @@
+package serialization
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/rieske/event-sourced-account-go/eventstore"
+)
+
+// jsonEventSerializer writes events using their json tags, making the payloads readable with plain SQL
+type jsonEventSerializer struct {
+	upcasters *Upcasters
+}
+
+func NewJsonEventSerializer() *jsonEventSerializer {
+	return NewUpcastingJsonEventSerializer(NewUpcasters())
+}
+
+// NewUpcastingJsonEventSerializer creates a serializer that brings payloads written with older schema versions
+// to the current shape before decoding them. The payloads are keyed by the json tags of the events.
+func NewUpcastingJsonEventSerializer(upcasters *Upcasters) *jsonEventSerializer {
+	return &jsonEventSerializer{upcasters: upcasters}
+}
+
+func (s jsonEventSerializer) SerializerId() int {
+	return JsonSerializerId
+}
+
+func (s jsonEventSerializer) SerializeEvent(ctx context.Context, e eventstore.SequencedEvent) (event eventstore.SerializedEvent, err error) {
+	event.AggregateId = e.AggregateId
+	event.Seq = e.Seq
+
+	event.Payload, err = json.Marshal(e.Event)
+	if err != nil {
+		return
+	}
+	event.EventType, err = AccountEvents.Code(e.Event)
+	event.SchemaVersion = s.upcasters.CurrentVersion(event.EventType)
+	return
+}
+
+func (s jsonEventSerializer) DeserializeEvent(ctx context.Context, se eventstore.SerializedEvent) (event eventstore.SequencedEvent, err error) {
+	event.AggregateId = se.AggregateId
+	event.Seq = se.Seq
+	payload, err := s.upcasters.upcastPayload(se, unmarshalJson, json.Marshal)
+	if err != nil {
+		return
+	}
+	event.Event, err = deserializeEvent(payload, se.EventType, unmarshalJson)
+	return
+}
+
+// unmarshalJson keeps numbers intact when decoding into untyped payloads for upcasting
+func unmarshalJson(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
@@ -0,0 +1,65 @@
+package serialization_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/eventstore"
+	"github.com/rieske/event-sourced-account-go/serialization"
+	"github.com/stretchr/testify/assert"
+)
+
+var jsonSerializer = serialization.NewJsonEventSerializer()
+
+func allEvents() []account.Event {
+	accountID := account.NewID()
+	return []account.Event{
+		account.Snapshot{accountID, account.NewOwnerID(), 20, true},
+		account.AccountOpenedEvent{accountID, account.NewOwnerID()},
+		account.MoneyDepositedEvent{5, 10},
+		account.MoneyWithdrawnEvent{5, 10},
+		account.TransferSentEvent{uuid.New(), account.NewID(), 5, 10},
+		account.TransferReceivedEvent{uuid.New(), account.NewID(), 5, 10},
+		account.AccountClosedEvent{},
+	}
+}
+
+func TestJsonRoundTrip(t *testing.T) {
+	for _, e := range allEvents() {
+		event := eventstore.SequencedEvent{account.NewID(), 42, e}
+
+		serializedEvent, err := jsonSerializer.SerializeEvent(context.Background(), event)
+		assert.NoError(t, err)
+
+		deserializedEvent, err := jsonSerializer.DeserializeEvent(context.Background(), serializedEvent)
+		assert.NoError(t, err)
+		assert.Equal(t, event, deserializedEvent)
+	}
+}
+
+func TestJsonUsesEventJsonTags(t *testing.T) {
+	serializedEvent, err := jsonSerializer.SerializeEvent(context.Background(), eventstore.SequencedEvent{account.NewID(), 1, account.MoneyDepositedEvent{5, 10}})
+
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"amountDeposited":5,"balance":10}`, string(serializedEvent.Payload))
+	assert.Equal(t, serialization.MoneyDeposited, serializedEvent.EventType)
+}
+
+func TestJsonUpcasting(t *testing.T) {
+	upcasters := serialization.NewUpcasters()
+	upcasters.Register(serialization.MoneyDeposited, 1, renameField("amount", "amountDeposited"))
+	serializer := serialization.NewUpcastingJsonEventSerializer(upcasters)
+
+	event, err := serializer.DeserializeEvent(context.Background(), eventstore.SerializedEvent{
+		AggregateId:   account.NewID(),
+		Seq:           1,
+		Payload:       []byte(`{"amount":9007199254740993,"balance":9007199254740993}`),
+		EventType:     serialization.MoneyDeposited,
+		SchemaVersion: 1,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, account.MoneyDepositedEvent{9007199254740993, 9007199254740993}, event.Event)
+}
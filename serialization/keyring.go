@@ -0,0 +1,72 @@
+package serialization
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// FileKeyring is a KeyProvider reading keys from a json file of the form
+//
+//	{"currentKeyId": "2024-02", "keys": {"2024-01": "<base64 key>", "2024-02": "<base64 key>"}}
+//
+// It is meant for local use, deployments should provide keys from a key management service.
+type FileKeyring struct {
+	currentKeyId string
+	keys         map[string][]byte
+}
+
+type keyringFile struct {
+	CurrentKeyId string            `json:"currentKeyId"`
+	Keys         map[string]string `json:"keys"`
+}
+
+func NewFileKeyring(path string) (*FileKeyring, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file keyringFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("invalid keyring %s: %w", path, err)
+	}
+
+	keyring := &FileKeyring{currentKeyId: file.CurrentKeyId, keys: map[string][]byte{}}
+	for keyId, encodedKey := range file.Keys {
+		key, err := base64.StdEncoding.DecodeString(encodedKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key '%s' in keyring %s: %w", keyId, path, err)
+		}
+		if err := keyring.add(keyId, key); err != nil {
+			return nil, fmt.Errorf("invalid keyring %s: %w", path, err)
+		}
+	}
+	if _, ok := keyring.keys[keyring.currentKeyId]; !ok {
+		return nil, fmt.Errorf("invalid keyring %s: current key '%s' is missing", path, keyring.currentKeyId)
+	}
+	return keyring, nil
+}
+
+func (k *FileKeyring) add(keyId string, key []byte) error {
+	if len(keyId) == 0 || len(keyId) > 255 {
+		return fmt.Errorf("key id '%s' has to be 1 to 255 bytes long", keyId)
+	}
+	if len(key) != 16 && len(key) != 24 && len(key) != 32 {
+		return fmt.Errorf("key '%s' has to be 16, 24 or 32 bytes long, got %d", keyId, len(key))
+	}
+	k.keys[keyId] = key
+	return nil
+}
+
+func (k *FileKeyring) CurrentKey() (string, []byte, error) {
+	return k.currentKeyId, k.keys[k.currentKeyId], nil
+}
+
+func (k *FileKeyring) Key(keyId string) ([]byte, error) {
+	key, ok := k.keys[keyId]
+	if !ok {
+		return nil, UnknownKeyError{keyId}
+	}
+	return key, nil
+}
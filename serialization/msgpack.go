@@ -1,48 +1,30 @@
 package serialization
 
 import (
-	"errors"
-	"fmt"
-
-	"github.com/rieske/event-sourced-account-go/account"
+	"context"
 	"github.com/rieske/event-sourced-account-go/eventstore"
 	"github.com/vmihailenco/msgpack/v4"
 )
 
 type msgpackEventSerializer struct {
+	upcasters *Upcasters
 }
 
 func NewMsgpackEventSerializer() *msgpackEventSerializer {
-	return &msgpackEventSerializer{}
+	return NewUpcastingMsgpackEventSerializer(NewUpcasters())
 }
 
-const (
-	Snapshot = iota + 1
-	AccountOpened
-	MoneyDeposited
-	MoneyWithdrawn
-	AccountClosed
-)
+// NewUpcastingMsgpackEventSerializer creates a serializer that brings payloads written with older schema versions
+// to the current shape before decoding them. The payloads are keyed by the field names of the events.
+func NewUpcastingMsgpackEventSerializer(upcasters *Upcasters) *msgpackEventSerializer {
+	return &msgpackEventSerializer{upcasters: upcasters}
+}
 
-func eventTypeAlias(event account.Event) (alias int, err error) {
-	switch t := event.(type) {
-	case account.Snapshot:
-		alias = Snapshot
-	case account.AccountOpenedEvent:
-		alias = AccountOpened
-	case account.MoneyDepositedEvent:
-		alias = MoneyDeposited
-	case account.MoneyWithdrawnEvent:
-		alias = MoneyWithdrawn
-	case account.AccountClosedEvent:
-		alias = AccountClosed
-	default:
-		err = errors.New(fmt.Sprintf("don't know how to alias %T", t))
-	}
-	return
+func (s msgpackEventSerializer) SerializerId() int {
+	return MsgpackSerializerId
 }
 
-func (s msgpackEventSerializer) SerializeEvent(e eventstore.SequencedEvent) (event eventstore.SerializedEvent, err error) {
+func (s msgpackEventSerializer) SerializeEvent(ctx context.Context, e eventstore.SequencedEvent) (event eventstore.SerializedEvent, err error) {
 	event.AggregateId = e.AggregateId
 	event.Seq = e.Seq
 
@@ -50,41 +32,18 @@ func (s msgpackEventSerializer) SerializeEvent(e eventstore.SequencedEvent) (eve
 	if err != nil {
 		return
 	}
-	event.EventType, err = eventTypeAlias(e.Event)
+	event.EventType, err = AccountEvents.Code(e.Event)
+	event.SchemaVersion = s.upcasters.CurrentVersion(event.EventType)
 	return
 }
 
-func (s msgpackEventSerializer) DeserializeEvent(se eventstore.SerializedEvent) (event eventstore.SequencedEvent, err error) {
+func (s msgpackEventSerializer) DeserializeEvent(ctx context.Context, se eventstore.SerializedEvent) (event eventstore.SequencedEvent, err error) {
 	event.AggregateId = se.AggregateId
 	event.Seq = se.Seq
-	event.Event, err = deserializeMsgpackEvent(se.Payload, se.EventType)
-	return
-}
-
-func deserializeMsgpackEvent(payload []byte, typeAlias int) (event account.Event, err error) {
-	switch typeAlias {
-	case Snapshot:
-		var e account.Snapshot
-		err = msgpack.Unmarshal(payload, &e)
-		event = e
-	case AccountOpened:
-		var e account.AccountOpenedEvent
-		err = msgpack.Unmarshal(payload, &e)
-		event = e
-	case MoneyDeposited:
-		var e account.MoneyDepositedEvent
-		err = msgpack.Unmarshal(payload, &e)
-		event = e
-	case MoneyWithdrawn:
-		var e account.MoneyWithdrawnEvent
-		err = msgpack.Unmarshal(payload, &e)
-		event = e
-	case AccountClosed:
-		var e account.AccountClosedEvent
-		err = msgpack.Unmarshal(payload, &e)
-		event = e
-	default:
-		err = errors.New(fmt.Sprintf("Don't know how to deserialize event with type alias %v", typeAlias))
+	payload, err := s.upcasters.upcastPayload(se, msgpack.Unmarshal, msgpack.Marshal)
+	if err != nil {
+		return
 	}
+	event.Event, err = deserializeEvent(payload, se.EventType, msgpack.Unmarshal)
 	return
 }
@@ -1,6 +1,8 @@
 package serialization_test
 
 import (
+	"context"
+	"github.com/google/uuid"
 	"github.com/rieske/event-sourced-account-go/account"
 	"github.com/rieske/event-sourced-account-go/eventstore"
 	"github.com/rieske/event-sourced-account-go/serialization"
@@ -23,10 +25,10 @@ func TestMsgpackSnapshot(t *testing.T) {
 		},
 	}
 
-	serializedEvent, err := msgpackSerializer.SerializeEvent(event)
+	serializedEvent, err := msgpackSerializer.SerializeEvent(context.Background(), event)
 	assert.NoError(t, err)
 
-	deserializedEvent, err := msgpackSerializer.DeserializeEvent(serializedEvent)
+	deserializedEvent, err := msgpackSerializer.DeserializeEvent(context.Background(), serializedEvent)
 	assert.Equal(t, event, deserializedEvent)
 }
 
@@ -41,10 +43,10 @@ func TestMsgpackAccountOpened(t *testing.T) {
 		},
 	}
 
-	serializedEvent, err := msgpackSerializer.SerializeEvent(event)
+	serializedEvent, err := msgpackSerializer.SerializeEvent(context.Background(), event)
 	assert.NoError(t, err)
 
-	deserializedEvent, err := msgpackSerializer.DeserializeEvent(serializedEvent)
+	deserializedEvent, err := msgpackSerializer.DeserializeEvent(context.Background(), serializedEvent)
 	assert.Equal(t, event, deserializedEvent)
 }
 
@@ -59,10 +61,10 @@ func TestMsgpackMoneyDeposited(t *testing.T) {
 		},
 	}
 
-	serializedEvent, err := msgpackSerializer.SerializeEvent(event)
+	serializedEvent, err := msgpackSerializer.SerializeEvent(context.Background(), event)
 	assert.NoError(t, err)
 
-	deserializedEvent, err := msgpackSerializer.DeserializeEvent(serializedEvent)
+	deserializedEvent, err := msgpackSerializer.DeserializeEvent(context.Background(), serializedEvent)
 	assert.Equal(t, event, deserializedEvent)
 }
 
@@ -77,10 +79,10 @@ func TestMsgpackMoneyWithdrawn(t *testing.T) {
 		},
 	}
 
-	serializedEvent, err := msgpackSerializer.SerializeEvent(event)
+	serializedEvent, err := msgpackSerializer.SerializeEvent(context.Background(), event)
 	assert.NoError(t, err)
 
-	deserializedEvent, err := msgpackSerializer.DeserializeEvent(serializedEvent)
+	deserializedEvent, err := msgpackSerializer.DeserializeEvent(context.Background(), serializedEvent)
 	assert.Equal(t, event, deserializedEvent)
 }
 
@@ -92,9 +94,49 @@ func TestMsgpackAccountClosed(t *testing.T) {
 		Event:       account.AccountClosedEvent{},
 	}
 
-	serializedEvent, err := msgpackSerializer.SerializeEvent(event)
+	serializedEvent, err := msgpackSerializer.SerializeEvent(context.Background(), event)
 	assert.NoError(t, err)
 
-	deserializedEvent, err := msgpackSerializer.DeserializeEvent(serializedEvent)
+	deserializedEvent, err := msgpackSerializer.DeserializeEvent(context.Background(), serializedEvent)
+	assert.Equal(t, event, deserializedEvent)
+}
+
+func TestMsgpackTransferSent(t *testing.T) {
+	accountID := account.NewID()
+	event := eventstore.SequencedEvent{
+		AggregateId: accountID,
+		Seq:         42,
+		Event: account.TransferSentEvent{
+			TransactionID:     uuid.New(),
+			TargetAccountID:   account.NewID(),
+			AmountTransferred: 5,
+			Balance:           10,
+		},
+	}
+
+	serializedEvent, err := msgpackSerializer.SerializeEvent(context.Background(), event)
+	assert.NoError(t, err)
+
+	deserializedEvent, err := msgpackSerializer.DeserializeEvent(context.Background(), serializedEvent)
+	assert.Equal(t, event, deserializedEvent)
+}
+
+func TestMsgpackTransferReceived(t *testing.T) {
+	accountID := account.NewID()
+	event := eventstore.SequencedEvent{
+		AggregateId: accountID,
+		Seq:         42,
+		Event: account.TransferReceivedEvent{
+			TransactionID:     uuid.New(),
+			SourceAccountID:   account.NewID(),
+			AmountTransferred: 5,
+			Balance:           10,
+		},
+	}
+
+	serializedEvent, err := msgpackSerializer.SerializeEvent(context.Background(), event)
+	assert.NoError(t, err)
+
+	deserializedEvent, err := msgpackSerializer.DeserializeEvent(context.Background(), serializedEvent)
 	assert.Equal(t, event, deserializedEvent)
 }
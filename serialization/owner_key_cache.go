@@ -0,0 +1,86 @@
+package serialization
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rieske/event-sourced-account-go/account"
+)
+
+// cachingOwnerKeyStore keeps the data keys read from the store for a while, so that reading the events of an account
+// does not look its owner's key up once per event. A key deleted through another process, like forget-owner, is
+// still served from the cache until it expires or the cache is invalidated, see WatchForgottenOwners.
+type cachingOwnerKeyStore struct {
+	OwnerKeyStore
+	ttl     time.Duration
+	now     func() time.Time
+	mutex   sync.Mutex
+	keys    map[uuid.UUID]cachedDataKey
+	sweptAt time.Time
+}
+
+type cachedDataKey struct {
+	key       []byte
+	expiresAt time.Time
+}
+
+// NewCachingOwnerKeyStore caches the data keys of the store, each for the ttl
+func NewCachingOwnerKeyStore(keys OwnerKeyStore, ttl time.Duration) *cachingOwnerKeyStore {
+	return &cachingOwnerKeyStore{OwnerKeyStore: keys, ttl: ttl, now: time.Now, keys: map[uuid.UUID]cachedDataKey{}}
+}
+
+func (s *cachingOwnerKeyStore) DataKey(ctx context.Context, keyId uuid.UUID) ([]byte, error) {
+	if key, ok := s.cached(keyId); ok {
+		return key, nil
+	}
+	key, err := s.OwnerKeyStore.DataKey(ctx, keyId)
+	if err != nil || key == nil {
+		return key, err
+	}
+	s.put(keyId, key)
+	return key, nil
+}
+
+// DeleteOwnerKey forgets all the cached keys, the cache does not know which of them belongs to the owner
+func (s *cachingOwnerKeyStore) DeleteOwnerKey(ctx context.Context, owner account.OwnerID) (bool, error) {
+	deleted, err := s.OwnerKeyStore.DeleteOwnerKey(ctx, owner)
+	s.Invalidate()
+	return deleted, err
+}
+
+// Invalidate forgets all the cached keys, so that keys deleted through another process are not served anymore
+func (s *cachingOwnerKeyStore) Invalidate() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.keys = map[uuid.UUID]cachedDataKey{}
+}
+
+func (s *cachingOwnerKeyStore) cached(keyId uuid.UUID) ([]byte, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry, ok := s.keys[keyId]
+	if !ok || !s.now().Before(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.key, true
+}
+
+func (s *cachingOwnerKeyStore) put(keyId uuid.UUID, key []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+	// expired keys are dropped once per ttl, so the cache holds no more than the keys used within two ttls
+	if now.Sub(s.sweptAt) >= s.ttl {
+		for id, entry := range s.keys {
+			if !now.Before(entry.expiresAt) {
+				delete(s.keys, id)
+			}
+		}
+		s.sweptAt = now
+	}
+	s.keys[keyId] = cachedDataKey{key: key, expiresAt: now.Add(s.ttl)}
+}
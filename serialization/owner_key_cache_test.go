@@ -0,0 +1,90 @@
+package serialization_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/eventstore"
+	"github.com/rieske/event-sourced-account-go/serialization"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingOwnerKeyStore counts the data keys read from it
+type countingOwnerKeyStore struct {
+	serialization.OwnerKeyStore
+	reads int
+}
+
+func (s *countingOwnerKeyStore) DataKey(ctx context.Context, keyId uuid.UUID) ([]byte, error) {
+	s.reads++
+	return s.OwnerKeyStore.DataKey(ctx, keyId)
+}
+
+func serializeHistory(t *testing.T, serializer serialization.EventSerializer, accountID account.ID, ownerID account.OwnerID) []eventstore.SerializedEvent {
+	var events []eventstore.SerializedEvent
+	for _, event := range accountHistory(accountID, ownerID) {
+		serializedEvent, err := serializer.SerializeEvent(context.Background(), event)
+		assert.NoError(t, err)
+		events = append(events, serializedEvent)
+	}
+	return events
+}
+
+func TestCachedDataKeysAreReadOnce(t *testing.T) {
+	keys := &countingOwnerKeyStore{OwnerKeyStore: serialization.NewInMemoryOwnerKeyStore()}
+	serializer := serialization.NewPersonalDataSerializer(msgpackSerializer, serialization.NewCachingOwnerKeyStore(keys, time.Minute))
+	accountID, ownerID := account.NewID(), account.NewOwnerID()
+	events := serializeHistory(t, serializer, accountID, ownerID)
+
+	assert.Equal(t, account.Snapshot{accountID, ownerID, 7, true}, replay(t, serializer, events))
+	assert.Equal(t, account.Snapshot{accountID, ownerID, 7, true}, replay(t, serializer, events))
+
+	assert.Equal(t, 1, keys.reads)
+}
+
+func TestDeletingOwnerKeyThroughTheCacheRedactsOwnerAtOnce(t *testing.T) {
+	keys := serialization.NewCachingOwnerKeyStore(serialization.NewInMemoryOwnerKeyStore(), time.Minute)
+	serializer := serialization.NewPersonalDataSerializer(msgpackSerializer, keys)
+	accountID, ownerID := account.NewID(), account.NewOwnerID()
+	events := serializeHistory(t, serializer, accountID, ownerID)
+	assert.Equal(t, account.Snapshot{accountID, ownerID, 7, true}, replay(t, serializer, events))
+
+	deleted, err := keys.DeleteOwnerKey(context.Background(), ownerID)
+
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+	assert.Equal(t, account.Snapshot{accountID, account.RedactedOwnerID, 7, true}, replay(t, serializer, events))
+}
+
+func TestOwnerKeyDeletedElsewhereIsRedactedOnceCachedKeyExpires(t *testing.T) {
+	keys := serialization.NewInMemoryOwnerKeyStore()
+	serializer := serialization.NewPersonalDataSerializer(msgpackSerializer, serialization.NewCachingOwnerKeyStore(keys, 50*time.Millisecond))
+	accountID, ownerID := account.NewID(), account.NewOwnerID()
+	events := serializeHistory(t, serializer, accountID, ownerID)
+	assert.Equal(t, account.Snapshot{accountID, ownerID, 7, true}, replay(t, serializer, events))
+
+	_, err := keys.DeleteOwnerKey(context.Background(), ownerID)
+	assert.NoError(t, err)
+
+	assert.Equal(t, account.Snapshot{accountID, ownerID, 7, true}, replay(t, serializer, events))
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, account.Snapshot{accountID, account.RedactedOwnerID, 7, true}, replay(t, serializer, events))
+}
+
+func TestInvalidatedCacheRedactsOwnerDeletedElsewhereAtOnce(t *testing.T) {
+	keys := serialization.NewInMemoryOwnerKeyStore()
+	cachingKeys := serialization.NewCachingOwnerKeyStore(keys, time.Minute)
+	serializer := serialization.NewPersonalDataSerializer(msgpackSerializer, cachingKeys)
+	accountID, ownerID := account.NewID(), account.NewOwnerID()
+	events := serializeHistory(t, serializer, accountID, ownerID)
+	assert.Equal(t, account.Snapshot{accountID, ownerID, 7, true}, replay(t, serializer, events))
+
+	_, err := keys.DeleteOwnerKey(context.Background(), ownerID)
+	assert.NoError(t, err)
+	cachingKeys.Invalidate()
+
+	assert.Equal(t, account.Snapshot{accountID, account.RedactedOwnerID, 7, true}, replay(t, serializer, events))
+}
@@ -0,0 +1,231 @@
+package serialization
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/eventstore"
+)
+
+// personalDataHeader marks payloads whose personal data is sealed in an envelope in front of the payload, laid out as
+// header, data key id, nonce, sealed owner id
+const (
+	personalDataHeader   byte = 0xc5
+	sealedOwnerLength         = 16 + 16
+	personalDataEnvelope      = 1 + 16 + 12 + sealedOwnerLength
+)
+
+// OwnerForgotten is returned for the key of an owner whose key was deleted
+var OwnerForgotten = errors.New("owner was forgotten")
+
+// OwnerKeyStore keeps a data encryption key per owner.
+// Deleting the key of an owner makes their personal data in stored events unrecoverable.
+type OwnerKeyStore interface {
+	// OwnerKey returns the data key of the owner, creating one if the owner has none, or OwnerForgotten if the
+	// owner's key was deleted
+	OwnerKey(ctx context.Context, owner account.OwnerID) (keyId uuid.UUID, key []byte, err error)
+	// DataKey returns the data key with the id, or nil if it was deleted
+	DataKey(ctx context.Context, keyId uuid.UUID) ([]byte, error)
+	// DeleteOwnerKey deletes the data key of the owner for good and tells whether there was one
+	DeleteOwnerKey(ctx context.Context, owner account.OwnerID) (bool, error)
+}
+
+// personalDataSerializer encrypts the owner of account events with the owner's data key, so that the owner can be
+// erased from the immutable events by deleting the key. Events of erased owners are read with account.RedactedOwnerID
+// as the owner while the rest of the event stays intact, and are written with it, like the snapshots of aggregates
+// that were cached before the owner was erased.
+type personalDataSerializer struct {
+	serializer EventSerializer
+	keys       OwnerKeyStore
+}
+
+func NewPersonalDataSerializer(serializer EventSerializer, keys OwnerKeyStore) *personalDataSerializer {
+	return &personalDataSerializer{serializer: serializer, keys: keys}
+}
+
+func (s personalDataSerializer) SerializerId() int {
+	return s.serializer.SerializerId()
+}
+
+func (s personalDataSerializer) SerializeEvent(ctx context.Context, e eventstore.SequencedEvent) (eventstore.SerializedEvent, error) {
+	owner := ownerOf(e.Event)
+	if owner == account.RedactedOwnerID {
+		return s.serializer.SerializeEvent(ctx, e)
+	}
+
+	e.Event = withOwner(e.Event, account.RedactedOwnerID)
+	event, err := s.serializer.SerializeEvent(ctx, e)
+	if err != nil {
+		return event, err
+	}
+
+	keyId, key, err := s.keys.OwnerKey(ctx, owner)
+	if errors.Is(err, OwnerForgotten) {
+		return event, nil
+	}
+	if err != nil {
+		return event, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return event, err
+	}
+	envelope := append([]byte{personalDataHeader}, keyId[:]...)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return event, err
+	}
+	envelope = append(envelope, nonce...)
+	envelope = aead.Seal(envelope, nonce, owner.UUID[:], additionalData(event))
+	event.Payload = append(envelope, event.Payload...)
+	return event, nil
+}
+
+func (s personalDataSerializer) DeserializeEvent(ctx context.Context, se eventstore.SerializedEvent) (eventstore.SequencedEvent, error) {
+	if len(se.Payload) == 0 || se.Payload[0] != personalDataHeader {
+		return s.serializer.DeserializeEvent(ctx, se)
+	}
+	if len(se.Payload) < personalDataEnvelope {
+		return eventstore.SequencedEvent{}, errors.New("personal data envelope is truncated")
+	}
+	envelope := se.Payload[:personalDataEnvelope]
+	se.Payload = se.Payload[personalDataEnvelope:]
+	event, err := s.serializer.DeserializeEvent(ctx, se)
+	if err != nil {
+		return event, err
+	}
+
+	keyId, err := uuid.FromBytes(envelope[1:17])
+	if err != nil {
+		return event, err
+	}
+	key, err := s.keys.DataKey(ctx, keyId)
+	if err != nil || key == nil {
+		// the owner was erased
+		return event, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return event, err
+	}
+	owner, err := aead.Open(nil, envelope[17:29], envelope[29:], additionalData(se))
+	if err != nil {
+		return event, err
+	}
+	ownerId, err := uuid.FromBytes(owner)
+	if err != nil {
+		return event, err
+	}
+	event.Event = withOwner(event.Event, account.OwnerID{UUID: ownerId})
+	return event, nil
+}
+
+func ownerOf(event account.Event) account.OwnerID {
+	switch e := event.(type) {
+	case account.Snapshot:
+		return e.OwnerID
+	case account.AccountOpenedEvent:
+		return e.OwnerID
+	default:
+		return account.RedactedOwnerID
+	}
+}
+
+func withOwner(event account.Event, owner account.OwnerID) account.Event {
+	switch e := event.(type) {
+	case account.Snapshot:
+		e.OwnerID = owner
+		return e
+	case account.AccountOpenedEvent:
+		e.OwnerID = owner
+		return e
+	default:
+		return event
+	}
+}
+
+type ownerKey struct {
+	keyId uuid.UUID
+	key   []byte
+}
+
+type inmemoryOwnerKeyStore struct {
+	byOwner   map[account.OwnerID]ownerKey
+	byId      map[uuid.UUID][]byte
+	forgotten map[account.OwnerID]time.Time
+	mutex     sync.Mutex
+}
+
+func NewInMemoryOwnerKeyStore() *inmemoryOwnerKeyStore {
+	return &inmemoryOwnerKeyStore{
+		byOwner:   map[account.OwnerID]ownerKey{},
+		byId:      map[uuid.UUID][]byte{},
+		forgotten: map[account.OwnerID]time.Time{},
+	}
+}
+
+func (s *inmemoryOwnerKeyStore) OwnerKey(ctx context.Context, owner account.OwnerID) (uuid.UUID, []byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.forgotten[owner]; ok {
+		return uuid.Nil, nil, OwnerForgotten
+	}
+	if k, ok := s.byOwner[owner]; ok {
+		return k.keyId, k.key, nil
+	}
+	key, err := NewDataKey()
+	if err != nil {
+		return uuid.Nil, nil, err
+	}
+	k := ownerKey{keyId: uuid.New(), key: key}
+	s.byOwner[owner] = k
+	s.byId[k.keyId] = k.key
+	return k.keyId, k.key, nil
+}
+
+func (s *inmemoryOwnerKeyStore) DataKey(ctx context.Context, keyId uuid.UUID) ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.byId[keyId], nil
+}
+
+func (s *inmemoryOwnerKeyStore) DeleteOwnerKey(ctx context.Context, owner account.OwnerID) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	k, ok := s.byOwner[owner]
+	delete(s.byOwner, owner)
+	delete(s.byId, k.keyId)
+	if _, forgotten := s.forgotten[owner]; !forgotten {
+		s.forgotten[owner] = time.Now()
+	}
+	return ok, nil
+}
+
+func (s *inmemoryOwnerKeyStore) ForgottenOwners(ctx context.Context, within time.Duration) ([]account.OwnerID, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var owners []account.OwnerID
+	for owner, forgottenAt := range s.forgotten {
+		if time.Since(forgottenAt) < within {
+			owners = append(owners, owner)
+		}
+	}
+	return owners, nil
+}
+
+// NewDataKey generates a random AES-256 key
+func NewDataKey() ([]byte, error) {
+	key := make([]byte, 32)
+	_, err := io.ReadFull(rand.Reader, key)
+	return key, err
+}
@@ -0,0 +1,171 @@
+package serialization_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/eventstore"
+	"github.com/rieske/event-sourced-account-go/serialization"
+	"github.com/stretchr/testify/assert"
+)
+
+func accountHistory(accountID account.ID, ownerID account.OwnerID) []eventstore.SequencedEvent {
+	return []eventstore.SequencedEvent{
+		{accountID, 1, account.AccountOpenedEvent{accountID, ownerID}},
+		{accountID, 2, account.MoneyDepositedEvent{10, 10}},
+		{accountID, 3, account.MoneyWithdrawnEvent{3, 7}},
+		{accountID, 3, account.Snapshot{accountID, ownerID, 7, true}},
+	}
+}
+
+func replay(t *testing.T, serializer serialization.EventSerializer, events []eventstore.SerializedEvent) account.Snapshot {
+	a := account.New(nil)
+	for _, se := range events {
+		event, err := serializer.DeserializeEvent(context.Background(), se)
+		assert.NoError(t, err)
+		event.Event.Apply(a)
+	}
+	return a.Snapshot()
+}
+
+func TestPersonalDataRoundTrip(t *testing.T) {
+	serializer := serialization.NewPersonalDataSerializer(msgpackSerializer, serialization.NewInMemoryOwnerKeyStore())
+	for _, e := range allEvents() {
+		event := eventstore.SequencedEvent{account.NewID(), 42, e}
+
+		serializedEvent, err := serializer.SerializeEvent(context.Background(), event)
+		assert.NoError(t, err)
+
+		deserializedEvent, err := serializer.DeserializeEvent(context.Background(), serializedEvent)
+		assert.NoError(t, err)
+		assert.Equal(t, event, deserializedEvent)
+	}
+}
+
+func TestPersonalDataIsNotStoredInClear(t *testing.T) {
+	serializer := serialization.NewPersonalDataSerializer(msgpackSerializer, serialization.NewInMemoryOwnerKeyStore())
+	accountID, ownerID := account.NewID(), account.NewOwnerID()
+
+	for _, event := range accountHistory(accountID, ownerID) {
+		serializedEvent, err := serializer.SerializeEvent(context.Background(), event)
+
+		assert.NoError(t, err)
+		assert.False(t, bytes.Contains(serializedEvent.Payload, ownerID.UUID[:]))
+	}
+}
+
+func TestEventsWithoutPersonalDataAreNotEnveloped(t *testing.T) {
+	serializer := serialization.NewPersonalDataSerializer(msgpackSerializer, serialization.NewInMemoryOwnerKeyStore())
+	event := eventstore.SequencedEvent{account.NewID(), 2, account.MoneyDepositedEvent{10, 10}}
+
+	serializedEvent, err := serializer.SerializeEvent(context.Background(), event)
+	assert.NoError(t, err)
+
+	plain, err := msgpackSerializer.SerializeEvent(context.Background(), event)
+	assert.NoError(t, err)
+	assert.Equal(t, plain, serializedEvent)
+}
+
+func TestPersonalDataSerializerReadsPlainEvents(t *testing.T) {
+	serializer := serialization.NewPersonalDataSerializer(msgpackSerializer, serialization.NewInMemoryOwnerKeyStore())
+	event := snapshotEvent()
+	plain, err := msgpackSerializer.SerializeEvent(context.Background(), event)
+	assert.NoError(t, err)
+
+	deserializedEvent, err := serializer.DeserializeEvent(context.Background(), plain)
+
+	assert.NoError(t, err)
+	assert.Equal(t, event, deserializedEvent)
+}
+
+func TestOwnersShareTheirKeyAcrossAccounts(t *testing.T) {
+	keys := serialization.NewInMemoryOwnerKeyStore()
+	ownerID := account.NewOwnerID()
+
+	keyId, key, err := keys.OwnerKey(context.Background(), ownerID)
+	assert.NoError(t, err)
+	sameKeyId, sameKey, err := keys.OwnerKey(context.Background(), ownerID)
+	assert.NoError(t, err)
+	otherKeyId, _, err := keys.OwnerKey(context.Background(), account.NewOwnerID())
+	assert.NoError(t, err)
+
+	assert.Equal(t, keyId, sameKeyId)
+	assert.Equal(t, key, sameKey)
+	assert.NotEqual(t, keyId, otherKeyId)
+}
+
+func TestReplayAfterOwnerKeyDeletionRedactsOwnerAndKeepsBalance(t *testing.T) {
+	keys := serialization.NewInMemoryOwnerKeyStore()
+	serializer := serialization.NewPersonalDataSerializer(msgpackSerializer, keys)
+	accountID, ownerID := account.NewID(), account.NewOwnerID()
+	otherAccountID, otherOwnerID := account.NewID(), account.NewOwnerID()
+
+	var events, otherEvents []eventstore.SerializedEvent
+	for _, event := range accountHistory(accountID, ownerID) {
+		serializedEvent, err := serializer.SerializeEvent(context.Background(), event)
+		assert.NoError(t, err)
+		events = append(events, serializedEvent)
+	}
+	for _, event := range accountHistory(otherAccountID, otherOwnerID) {
+		serializedEvent, err := serializer.SerializeEvent(context.Background(), event)
+		assert.NoError(t, err)
+		otherEvents = append(otherEvents, serializedEvent)
+	}
+	assert.Equal(t, account.Snapshot{accountID, ownerID, 7, true}, replay(t, serializer, events))
+
+	deleted, err := keys.DeleteOwnerKey(context.Background(), ownerID)
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+
+	assert.Equal(t, account.Snapshot{accountID, account.RedactedOwnerID, 7, true}, replay(t, serializer, events))
+	assert.Equal(t, account.Snapshot{otherAccountID, otherOwnerID, 7, true}, replay(t, serializer, otherEvents))
+}
+
+func TestDeletingUnknownOwnerKey(t *testing.T) {
+	deleted, err := serialization.NewInMemoryOwnerKeyStore().DeleteOwnerKey(context.Background(), account.NewOwnerID())
+
+	assert.NoError(t, err)
+	assert.False(t, deleted)
+}
+
+func TestForgottenOwnerIsNotGivenAKey(t *testing.T) {
+	keys := serialization.NewInMemoryOwnerKeyStore()
+	ownerID := account.NewOwnerID()
+	_, _, err := keys.OwnerKey(context.Background(), ownerID)
+	assert.NoError(t, err)
+
+	_, err = keys.DeleteOwnerKey(context.Background(), ownerID)
+	assert.NoError(t, err)
+
+	_, _, err = keys.OwnerKey(context.Background(), ownerID)
+	assert.ErrorIs(t, err, serialization.OwnerForgotten)
+}
+
+func TestSnapshotOfForgottenOwnerIsWrittenRedacted(t *testing.T) {
+	keys := serialization.NewInMemoryOwnerKeyStore()
+	serializer := serialization.NewPersonalDataSerializer(msgpackSerializer, keys)
+	accountID, ownerID := account.NewID(), account.NewOwnerID()
+	_, err := serializer.SerializeEvent(context.Background(), eventstore.SequencedEvent{accountID, 1, account.AccountOpenedEvent{accountID, ownerID}})
+	assert.NoError(t, err)
+	_, err = keys.DeleteOwnerKey(context.Background(), ownerID)
+	assert.NoError(t, err)
+
+	serializedEvent, err := serializer.SerializeEvent(context.Background(), eventstore.SequencedEvent{accountID, 2, account.Snapshot{accountID, ownerID, 7, true}})
+	assert.NoError(t, err)
+
+	assert.False(t, bytes.Contains(serializedEvent.Payload, ownerID.UUID[:]))
+	assert.Equal(t, account.Snapshot{accountID, account.RedactedOwnerID, 7, true}, replay(t, serializer, []eventstore.SerializedEvent{serializedEvent}))
+}
+
+func TestTamperedPersonalDataIsRejected(t *testing.T) {
+	serializer := serialization.NewPersonalDataSerializer(msgpackSerializer, serialization.NewInMemoryOwnerKeyStore())
+	serializedEvent, err := serializer.SerializeEvent(context.Background(), snapshotEvent())
+	assert.NoError(t, err)
+
+	serializedEvent.AggregateId = account.NewID()
+	_, err = serializer.DeserializeEvent(context.Background(), serializedEvent)
+
+	assert.Error(t, err)
+}
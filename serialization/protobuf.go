@@ -0,0 +1,210 @@
+package serialization
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/google/uuid"
+	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/eventstore"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// protobufEventSerializer writes events as the protocol buffer messages defined in proto/account_events.proto.
+// Payloads evolve by adding fields to the messages, so there are no upcasters for them.
+type protobufEventSerializer struct {
+}
+
+func NewProtobufEventSerializer() *protobufEventSerializer {
+	return &protobufEventSerializer{}
+}
+
+func (s protobufEventSerializer) SerializerId() int {
+	return ProtobufSerializerId
+}
+
+func (s protobufEventSerializer) SerializeEvent(ctx context.Context, e eventstore.SequencedEvent) (event eventstore.SerializedEvent, err error) {
+	event.AggregateId = e.AggregateId
+	event.Seq = e.Seq
+	event.SchemaVersion = 1
+
+	event.Payload, err = marshalProtobuf(e.Event)
+	if err != nil {
+		return
+	}
+	event.EventType, err = AccountEvents.Code(e.Event)
+	return
+}
+
+func (s protobufEventSerializer) DeserializeEvent(ctx context.Context, se eventstore.SerializedEvent) (event eventstore.SequencedEvent, err error) {
+	event.AggregateId = se.AggregateId
+	event.Seq = se.Seq
+	event.Event, err = unmarshalProtobuf(se.Payload, se.EventType)
+	return
+}
+
+func marshalProtobuf(event account.Event) ([]byte, error) {
+	var b []byte
+	switch e := event.(type) {
+	case account.Snapshot:
+		b = appendUUID(b, 1, e.ID.UUID)
+		b = appendUUID(b, 2, e.OwnerID.UUID)
+		b = appendInt64(b, 3, e.Balance)
+		b = appendBool(b, 4, e.Open)
+	case account.AccountOpenedEvent:
+		b = appendUUID(b, 1, e.AccountID.UUID)
+		b = appendUUID(b, 2, e.OwnerID.UUID)
+	case account.MoneyDepositedEvent:
+		b = appendInt64(b, 1, e.AmountDeposited)
+		b = appendInt64(b, 2, e.Balance)
+	case account.MoneyWithdrawnEvent:
+		b = appendInt64(b, 1, e.AmountWithdrawn)
+		b = appendInt64(b, 2, e.Balance)
+	case account.AccountClosedEvent:
+	case account.TransferSentEvent:
+		b = appendUUID(b, 1, e.TransactionID)
+		b = appendUUID(b, 2, e.TargetAccountID.UUID)
+		b = appendInt64(b, 3, e.AmountTransferred)
+		b = appendInt64(b, 4, e.Balance)
+	case account.TransferReceivedEvent:
+		b = appendUUID(b, 1, e.TransactionID)
+		b = appendUUID(b, 2, e.SourceAccountID.UUID)
+		b = appendInt64(b, 3, e.AmountTransferred)
+		b = appendInt64(b, 4, e.Balance)
+	default:
+		return nil, UnknownEventError{reflect.TypeOf(event)}
+	}
+	return b, nil
+}
+
+func unmarshalProtobuf(payload []byte, code int) (event account.Event, err error) {
+	f, err := parseProtobuf(payload)
+	if err != nil {
+		return nil, err
+	}
+	switch code {
+	case Snapshot:
+		event = account.Snapshot{
+			ID:      account.ID{UUID: f.uuid(1)},
+			OwnerID: account.OwnerID{UUID: f.uuid(2)},
+			Balance: f.int64(3),
+			Open:    f.bool(4),
+		}
+	case AccountOpened:
+		event = account.AccountOpenedEvent{
+			AccountID: account.ID{UUID: f.uuid(1)},
+			OwnerID:   account.OwnerID{UUID: f.uuid(2)},
+		}
+	case MoneyDeposited:
+		event = account.MoneyDepositedEvent{AmountDeposited: f.int64(1), Balance: f.int64(2)}
+	case MoneyWithdrawn:
+		event = account.MoneyWithdrawnEvent{AmountWithdrawn: f.int64(1), Balance: f.int64(2)}
+	case AccountClosed:
+		event = account.AccountClosedEvent{}
+	case TransferSent:
+		event = account.TransferSentEvent{
+			TransactionID:     f.uuid(1),
+			TargetAccountID:   account.ID{UUID: f.uuid(2)},
+			AmountTransferred: f.int64(3),
+			Balance:           f.int64(4),
+		}
+	case TransferReceived:
+		event = account.TransferReceivedEvent{
+			TransactionID:     f.uuid(1),
+			SourceAccountID:   account.ID{UUID: f.uuid(2)},
+			AmountTransferred: f.int64(3),
+			Balance:           f.int64(4),
+		}
+	default:
+		return nil, UnknownEventCodeError{code}
+	}
+	return event, f.err
+}
+
+// proto3 does not encode fields with default values
+
+func appendUUID(b []byte, num protowire.Number, id uuid.UUID) []byte {
+	if id == uuid.Nil {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, id[:])
+}
+
+func appendInt64(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+func appendBool(b []byte, num protowire.Number, v bool) []byte {
+	if !v {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, protowire.EncodeBool(v))
+}
+
+// protobufFields holds the scalar fields of a message, unknown fields are skipped
+type protobufFields struct {
+	varints map[protowire.Number]uint64
+	bytes   map[protowire.Number][]byte
+	err     error
+}
+
+func parseProtobuf(b []byte) (*protobufFields, error) {
+	f := &protobufFields{varints: map[protowire.Number]uint64{}, bytes: map[protowire.Number][]byte{}}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+		switch typ {
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			f.varints[num] = v
+			b = b[n:]
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			f.bytes[num] = v
+			b = b[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+	return f, nil
+}
+
+func (f *protobufFields) int64(num protowire.Number) int64 {
+	return int64(f.varints[num])
+}
+
+func (f *protobufFields) bool(num protowire.Number) bool {
+	return protowire.DecodeBool(f.varints[num])
+}
+
+func (f *protobufFields) uuid(num protowire.Number) uuid.UUID {
+	b, ok := f.bytes[num]
+	if !ok {
+		return uuid.Nil
+	}
+	id, err := uuid.FromBytes(b)
+	if err != nil && f.err == nil {
+		f.err = fmt.Errorf("field %d: %w", num, err)
+	}
+	return id
+}
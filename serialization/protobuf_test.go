@@ -0,0 +1,345 @@
+package serialization_test
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/eventstore"
+	"github.com/rieske/event-sourced-account-go/serialization"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+var protobufSerializer = serialization.NewProtobufEventSerializer()
+
+func TestProtobufSnapshot(t *testing.T) {
+	accountID := account.NewID()
+	event := eventstore.SequencedEvent{
+		AggregateId: accountID,
+		Seq:         42,
+		Event: account.Snapshot{
+			ID:      accountID,
+			OwnerID: account.NewOwnerID(),
+			Balance: 20,
+			Open:    true,
+		},
+	}
+
+	serializedEvent, err := protobufSerializer.SerializeEvent(context.Background(), event)
+	assert.NoError(t, err)
+
+	deserializedEvent, err := protobufSerializer.DeserializeEvent(context.Background(), serializedEvent)
+	assert.Equal(t, event, deserializedEvent)
+}
+
+func TestProtobufAccountOpened(t *testing.T) {
+	accountID := account.NewID()
+	event := eventstore.SequencedEvent{
+		AggregateId: accountID,
+		Seq:         42,
+		Event: account.AccountOpenedEvent{
+			AccountID: accountID,
+			OwnerID:   account.NewOwnerID(),
+		},
+	}
+
+	serializedEvent, err := protobufSerializer.SerializeEvent(context.Background(), event)
+	assert.NoError(t, err)
+
+	deserializedEvent, err := protobufSerializer.DeserializeEvent(context.Background(), serializedEvent)
+	assert.Equal(t, event, deserializedEvent)
+}
+
+func TestProtobufMoneyDeposited(t *testing.T) {
+	accountID := account.NewID()
+	event := eventstore.SequencedEvent{
+		AggregateId: accountID,
+		Seq:         42,
+		Event: account.MoneyDepositedEvent{
+			AmountDeposited: 5,
+			Balance:         10,
+		},
+	}
+
+	serializedEvent, err := protobufSerializer.SerializeEvent(context.Background(), event)
+	assert.NoError(t, err)
+
+	deserializedEvent, err := protobufSerializer.DeserializeEvent(context.Background(), serializedEvent)
+	assert.Equal(t, event, deserializedEvent)
+}
+
+func TestProtobufMoneyWithdrawn(t *testing.T) {
+	accountID := account.NewID()
+	event := eventstore.SequencedEvent{
+		AggregateId: accountID,
+		Seq:         42,
+		Event: account.MoneyWithdrawnEvent{
+			AmountWithdrawn: 5,
+			Balance:         10,
+		},
+	}
+
+	serializedEvent, err := protobufSerializer.SerializeEvent(context.Background(), event)
+	assert.NoError(t, err)
+
+	deserializedEvent, err := protobufSerializer.DeserializeEvent(context.Background(), serializedEvent)
+	assert.Equal(t, event, deserializedEvent)
+}
+
+func TestProtobufAccountClosed(t *testing.T) {
+	accountID := account.NewID()
+	event := eventstore.SequencedEvent{
+		AggregateId: accountID,
+		Seq:         42,
+		Event:       account.AccountClosedEvent{},
+	}
+
+	serializedEvent, err := protobufSerializer.SerializeEvent(context.Background(), event)
+	assert.NoError(t, err)
+
+	deserializedEvent, err := protobufSerializer.DeserializeEvent(context.Background(), serializedEvent)
+	assert.Equal(t, event, deserializedEvent)
+}
+
+func TestProtobufTransferSent(t *testing.T) {
+	accountID := account.NewID()
+	event := eventstore.SequencedEvent{
+		AggregateId: accountID,
+		Seq:         42,
+		Event: account.TransferSentEvent{
+			TransactionID:     uuid.New(),
+			TargetAccountID:   account.NewID(),
+			AmountTransferred: 5,
+			Balance:           10,
+		},
+	}
+
+	serializedEvent, err := protobufSerializer.SerializeEvent(context.Background(), event)
+	assert.NoError(t, err)
+
+	deserializedEvent, err := protobufSerializer.DeserializeEvent(context.Background(), serializedEvent)
+	assert.Equal(t, event, deserializedEvent)
+}
+
+func TestProtobufTransferReceived(t *testing.T) {
+	accountID := account.NewID()
+	event := eventstore.SequencedEvent{
+		AggregateId: accountID,
+		Seq:         42,
+		Event: account.TransferReceivedEvent{
+			TransactionID:     uuid.New(),
+			SourceAccountID:   account.NewID(),
+			AmountTransferred: 5,
+			Balance:           10,
+		},
+	}
+
+	serializedEvent, err := protobufSerializer.SerializeEvent(context.Background(), event)
+	assert.NoError(t, err)
+
+	deserializedEvent, err := protobufSerializer.DeserializeEvent(context.Background(), serializedEvent)
+	assert.Equal(t, event, deserializedEvent)
+}
+
+func TestProtobufNegativeAmounts(t *testing.T) {
+	event := eventstore.SequencedEvent{
+		AggregateId: account.NewID(),
+		Seq:         1,
+		Event: account.MoneyWithdrawnEvent{
+			AmountWithdrawn: 5,
+			Balance:         -10,
+		},
+	}
+
+	serializedEvent, err := protobufSerializer.SerializeEvent(context.Background(), event)
+	assert.NoError(t, err)
+
+	deserializedEvent, err := protobufSerializer.DeserializeEvent(context.Background(), serializedEvent)
+	assert.Equal(t, event, deserializedEvent)
+}
+
+// the payload is what protoc generated code writes for MoneyDepositedEvent{amount_deposited: 5, balance: 300}
+func TestProtobufWireFormat(t *testing.T) {
+	serializedEvent, err := protobufSerializer.SerializeEvent(context.Background(), eventstore.SequencedEvent{
+		AggregateId: account.NewID(),
+		Seq:         1,
+		Event:       account.MoneyDepositedEvent{AmountDeposited: 5, Balance: 300},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x08, 0x05, 0x10, 0xac, 0x02}, serializedEvent.Payload)
+	assert.Equal(t, serialization.MoneyDeposited, serializedEvent.EventType)
+}
+
+func TestProtobufSkipsUnknownFields(t *testing.T) {
+	event, err := protobufSerializer.DeserializeEvent(context.Background(), eventstore.SerializedEvent{
+		Payload:   []byte{0x08, 0x05, 0x1a, 0x02, 0x68, 0x69, 0x10, 0x0a},
+		EventType: serialization.MoneyDeposited,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, account.MoneyDepositedEvent{AmountDeposited: 5, Balance: 10}, event.Event)
+}
+
+func TestProtobufRejectsMalformedPayload(t *testing.T) {
+	_, err := protobufSerializer.DeserializeEvent(context.Background(), eventstore.SerializedEvent{
+		Payload:   []byte{0x08},
+		EventType: serialization.MoneyDeposited,
+	})
+
+	assert.Error(t, err)
+}
+
+func TestEventSerializerFormats(t *testing.T) {
+	formats := map[string]int{
+		serialization.MsgpackFormat:  serialization.MsgpackSerializerId,
+		serialization.JsonFormat:     serialization.JsonSerializerId,
+		serialization.ProtobufFormat: serialization.ProtobufSerializerId,
+	}
+	for format, id := range formats {
+		serializer, err := serialization.NewEventSerializer(format)
+		assert.NoError(t, err)
+		assert.Equal(t, id, serializer.SerializerId())
+	}
+
+	_, err := serialization.NewEventSerializer("xml")
+	assert.EqualError(t, err, "unsupported serialization format 'xml'")
+}
+
+var (
+	protoPackage = regexp.MustCompile(`^package ([\w.]+);$`)
+	protoMessage = regexp.MustCompile(`^message (\w+) \{$`)
+	protoField   = regexp.MustCompile(`^(bytes|int64|bool) (\w+) = (\d+);$`)
+	protoTypes   = map[string]descriptorpb.FieldDescriptorProto_Type{
+		"bytes": descriptorpb.FieldDescriptorProto_TYPE_BYTES,
+		"int64": descriptorpb.FieldDescriptorProto_TYPE_INT64,
+		"bool":  descriptorpb.FieldDescriptorProto_TYPE_BOOL,
+	}
+)
+
+// accountEventsProto compiles proto/account_events.proto, which declares messages of scalar fields only.
+// Any other declaration fails the test, so that changes to the file are checked here as well.
+func accountEventsProto(t *testing.T) protoreflect.FileDescriptor {
+	source, err := os.ReadFile("proto/account_events.proto")
+	require.NoError(t, err)
+
+	file := &descriptorpb.FileDescriptorProto{Name: proto.String("account_events.proto")}
+	var message *descriptorpb.DescriptorProto
+	for i, line := range strings.Split(string(source), "\n") {
+		line = strings.TrimSpace(strings.SplitN(line, "//", 2)[0])
+		switch {
+		case line == "":
+		case line == `syntax = "proto3";`:
+			file.Syntax = proto.String("proto3")
+		case protoPackage.MatchString(line):
+			file.Package = proto.String(protoPackage.FindStringSubmatch(line)[1])
+		case protoMessage.MatchString(line) && message == nil:
+			message = &descriptorpb.DescriptorProto{Name: proto.String(protoMessage.FindStringSubmatch(line)[1])}
+			file.MessageType = append(file.MessageType, message)
+		case protoField.MatchString(line) && message != nil:
+			field := protoField.FindStringSubmatch(line)
+			number, err := strconv.Atoi(field[3])
+			require.NoError(t, err)
+			message.Field = append(message.Field, &descriptorpb.FieldDescriptorProto{
+				Name:   proto.String(field[2]),
+				Number: proto.Int32(int32(number)),
+				Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				Type:   protoTypes[field[1]].Enum(),
+			})
+		case line == "}" && message != nil:
+			message = nil
+		default:
+			t.Fatalf("unsupported declaration on line %d of the proto file: %s", i+1, line)
+		}
+	}
+
+	descriptor, err := protodesc.NewFile(file, nil)
+	require.NoError(t, err)
+	return descriptor
+}
+
+// the messages are named after the events that they hold
+func TestProtobufPayloadsMatchTheProtoFile(t *testing.T) {
+	schema := accountEventsProto(t)
+	accountID, ownerID, txId := account.NewID(), account.NewOwnerID(), uuid.New()
+	events := []struct {
+		event  account.Event
+		fields map[string]interface{}
+	}{
+		{
+			account.Snapshot{ID: accountID, OwnerID: ownerID, Balance: 20, Open: true},
+			map[string]interface{}{"account_id": accountID.UUID[:], "owner_id": ownerID.UUID[:], "balance": int64(20), "open": true},
+		},
+		{
+			account.AccountOpenedEvent{AccountID: accountID, OwnerID: ownerID},
+			map[string]interface{}{"account_id": accountID.UUID[:], "owner_id": ownerID.UUID[:]},
+		},
+		{
+			account.MoneyDepositedEvent{AmountDeposited: 5, Balance: 10},
+			map[string]interface{}{"amount_deposited": int64(5), "balance": int64(10)},
+		},
+		{
+			account.MoneyWithdrawnEvent{AmountWithdrawn: 5, Balance: -10},
+			map[string]interface{}{"amount_withdrawn": int64(5), "balance": int64(-10)},
+		},
+		{
+			account.AccountClosedEvent{},
+			map[string]interface{}{},
+		},
+		{
+			account.TransferSentEvent{TransactionID: txId, TargetAccountID: accountID, AmountTransferred: 3, Balance: 7},
+			map[string]interface{}{"transaction_id": txId[:], "target_account_id": accountID.UUID[:], "amount_transferred": int64(3), "balance": int64(7)},
+		},
+		{
+			account.TransferReceivedEvent{TransactionID: txId, SourceAccountID: accountID, AmountTransferred: 3, Balance: 7},
+			map[string]interface{}{"transaction_id": txId[:], "source_account_id": accountID.UUID[:], "amount_transferred": int64(3), "balance": int64(7)},
+		},
+	}
+	assert.Equal(t, schema.Messages().Len(), len(events), "every message of the proto file has to be checked")
+
+	for _, e := range events {
+		name := reflect.TypeOf(e.event).Name()
+		t.Run(name, func(t *testing.T) {
+			descriptor := schema.Messages().ByName(protoreflect.Name(name))
+			require.NotNil(t, descriptor)
+			serializedEvent, err := protobufSerializer.SerializeEvent(context.Background(), eventstore.SequencedEvent{
+				AggregateId: accountID,
+				Seq:         1,
+				Event:       e.event,
+			})
+			require.NoError(t, err)
+
+			message := dynamicpb.NewMessage(descriptor)
+			err = proto.Unmarshal(serializedEvent.Payload, message)
+			require.NoError(t, err)
+			assert.Empty(t, message.GetUnknown())
+			fields := map[string]interface{}{}
+			message.Range(func(field protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+				fields[string(field.Name())] = value.Interface()
+				return true
+			})
+			assert.Equal(t, e.fields, fields)
+
+			payload, err := proto.Marshal(message)
+			require.NoError(t, err)
+			deserializedEvent, err := protobufSerializer.DeserializeEvent(context.Background(), eventstore.SerializedEvent{
+				Payload:   payload,
+				EventType: serializedEvent.EventType,
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, e.event, deserializedEvent.Event)
+		})
+	}
+}
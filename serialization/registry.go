@@ -0,0 +1,119 @@
+package serialization
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// UnknownEventError is returned when serializing an event of a type that is not registered
+type UnknownEventError struct {
+	Type reflect.Type
+}
+
+func (e UnknownEventError) Error() string {
+	return fmt.Sprintf("event type %v is not registered", e.Type)
+}
+
+// UnknownEventCodeError is returned when deserializing an event with a code that is not registered
+type UnknownEventCodeError struct {
+	Code int
+}
+
+func (e UnknownEventCodeError) Error() string {
+	return fmt.Sprintf("event code %d is not registered", e.Code)
+}
+
+type registration struct {
+	name      string
+	code      int
+	eventType reflect.Type
+}
+
+// Registry maps event types to the names and codes they are stored under.
+// The names and codes identify stored events, so they must never be changed or reused once registered.
+type Registry struct {
+	byName map[string]registration
+	byCode map[int]registration
+	byType map[reflect.Type]registration
+	mutex  sync.RWMutex
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		byName: map[string]registration{},
+		byCode: map[int]registration{},
+		byType: map[reflect.Type]registration{},
+	}
+}
+
+// Register adds the type of the given event value under the name and code.
+// Registering a name, code or event type twice panics.
+func (r *Registry) Register(name string, code int, event interface{}) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	eventType := reflect.TypeOf(event)
+	if _, ok := r.byName[name]; ok {
+		panic(fmt.Sprintf("event name '%s' is already registered", name))
+	}
+	if existing, ok := r.byCode[code]; ok {
+		panic(fmt.Sprintf("event code %d is already registered for '%s'", code, existing.name))
+	}
+	if existing, ok := r.byType[eventType]; ok {
+		panic(fmt.Sprintf("event type %v is already registered as '%s'", eventType, existing.name))
+	}
+	reg := registration{name: name, code: code, eventType: eventType}
+	r.byName[name] = reg
+	r.byCode[code] = reg
+	r.byType[eventType] = reg
+}
+
+// Code returns the code the type of the event is registered under
+func (r *Registry) Code(event interface{}) (int, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	reg, ok := r.byType[reflect.TypeOf(event)]
+	if !ok {
+		return 0, UnknownEventError{reflect.TypeOf(event)}
+	}
+	return reg.code, nil
+}
+
+// CodeOf returns the code registered under the name
+func (r *Registry) CodeOf(name string) (int, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	reg, ok := r.byName[name]
+	return reg.code, ok
+}
+
+// Name returns the name registered under the code
+func (r *Registry) Name(code int) (string, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	reg, ok := r.byCode[code]
+	if !ok {
+		return "", UnknownEventCodeError{code}
+	}
+	return reg.name, nil
+}
+
+// Decode creates an event of the type registered under the code and unmarshals the payload into it
+func (r *Registry) Decode(code int, payload []byte, unmarshal func([]byte, interface{}) error) (interface{}, error) {
+	r.mutex.RLock()
+	reg, ok := r.byCode[code]
+	r.mutex.RUnlock()
+	if !ok {
+		return nil, UnknownEventCodeError{code}
+	}
+
+	event := reflect.New(reg.eventType)
+	if err := unmarshal(payload, event.Interface()); err != nil {
+		return nil, err
+	}
+	return event.Elem().Interface(), nil
+}
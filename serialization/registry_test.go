@@ -0,0 +1,93 @@
+package serialization_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/eventstore"
+	"github.com/rieske/event-sourced-account-go/serialization"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack/v4"
+)
+
+type customerRegistered struct {
+	Name string
+}
+
+type customerRenamed struct {
+	Name string
+}
+
+type unregisteredEvent struct{}
+
+func (e unregisteredEvent) Apply(a *account.Account) {}
+
+// the codes are stored with the events and must not change
+func TestAccountEventCodesAreStable(t *testing.T) {
+	codes := map[string]int{
+		"Snapshot":         1,
+		"AccountOpened":    2,
+		"MoneyDeposited":   3,
+		"MoneyWithdrawn":   4,
+		"AccountClosed":    5,
+		"TransferSent":     6,
+		"TransferReceived": 7,
+	}
+	for name, expectedCode := range codes {
+		code, ok := serialization.AccountEvents.CodeOf(name)
+		assert.True(t, ok)
+		assert.Equal(t, expectedCode, code, name)
+
+		registeredName, err := serialization.AccountEvents.Name(code)
+		assert.NoError(t, err)
+		assert.Equal(t, name, registeredName)
+	}
+}
+
+func TestRegistryForOtherAggregate(t *testing.T) {
+	registry := serialization.NewRegistry()
+	registry.Register("CustomerRegistered", 1, customerRegistered{})
+	registry.Register("CustomerRenamed", 2, customerRenamed{})
+
+	code, err := registry.Code(customerRenamed{"Jane"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, code)
+
+	payload, err := msgpack.Marshal(customerRenamed{"Jane"})
+	assert.NoError(t, err)
+	event, err := registry.Decode(code, payload, msgpack.Unmarshal)
+	assert.NoError(t, err)
+	assert.Equal(t, customerRenamed{"Jane"}, event)
+}
+
+func TestDuplicateRegistrationPanics(t *testing.T) {
+	registry := serialization.NewRegistry()
+	registry.Register("CustomerRegistered", 1, customerRegistered{})
+
+	assert.Panics(t, func() { registry.Register("CustomerRegistered", 2, customerRenamed{}) })
+	assert.Panics(t, func() { registry.Register("CustomerRenamed", 1, customerRenamed{}) })
+	assert.Panics(t, func() { registry.Register("CustomerRenamed", 2, customerRegistered{}) })
+}
+
+func TestSerializingUnregisteredEventFails(t *testing.T) {
+	for _, serializer := range []interface {
+		SerializeEvent(ctx context.Context, e eventstore.SequencedEvent) (eventstore.SerializedEvent, error)
+	}{msgpackSerializer, jsonSerializer, protobufSerializer} {
+		_, err := serializer.SerializeEvent(context.Background(), eventstore.SequencedEvent{account.NewID(), 1, unregisteredEvent{}})
+
+		var unknownEvent serialization.UnknownEventError
+		assert.True(t, errors.As(err, &unknownEvent))
+	}
+}
+
+func TestDeserializingUnknownCodeFails(t *testing.T) {
+	for _, serializer := range []interface {
+		DeserializeEvent(ctx context.Context, e eventstore.SerializedEvent) (eventstore.SequencedEvent, error)
+	}{msgpackSerializer, jsonSerializer, protobufSerializer} {
+		_, err := serializer.DeserializeEvent(context.Background(), eventstore.SerializedEvent{Payload: []byte{}, EventType: 99})
+
+		assert.Equal(t, serialization.UnknownEventCodeError{99}, err)
+	}
+}
@@ -0,0 +1,90 @@
+package serialization
+
+import (
+	"fmt"
+
+	"github.com/rieske/event-sourced-account-go/eventstore"
+)
+
+// Payload is a decoded event payload keyed by field name
+type Payload map[string]interface{}
+
+// Upcaster transforms a payload of one schema version to the shape of the next version
+type Upcaster func(payload Payload) (Payload, error)
+
+type upcasterKey struct {
+	eventType int
+	version   int
+}
+
+// Upcasters holds the chains of upcasters per event type.
+// The current schema version of an event type is one above the last registered upcaster, or 1 if there are none.
+type Upcasters struct {
+	upcasters map[upcasterKey]Upcaster
+	current   map[int]int
+}
+
+func NewUpcasters() *Upcasters {
+	return &Upcasters{
+		upcasters: map[upcasterKey]Upcaster{},
+		current:   map[int]int{},
+	}
+}
+
+// Register adds the upcaster that takes payloads of the event type from the given schema version to the next one.
+// Upcasters have to be registered in version order starting with version 1.
+func (u *Upcasters) Register(eventType int, fromVersion int, upcaster Upcaster) {
+	if fromVersion != u.CurrentVersion(eventType) {
+		panic(fmt.Sprintf("upcaster for event type %d has to start at version %d, got %d", eventType, u.CurrentVersion(eventType), fromVersion))
+	}
+	u.upcasters[upcasterKey{eventType, fromVersion}] = upcaster
+	u.current[eventType] = fromVersion + 1
+}
+
+func (u *Upcasters) CurrentVersion(eventType int) int {
+	if version, ok := u.current[eventType]; ok {
+		return version
+	}
+	return 1
+}
+
+func (u *Upcasters) upcast(eventType int, version int, payload Payload) (Payload, error) {
+	for ; version < u.CurrentVersion(eventType); version++ {
+		var err error
+		payload, err = u.upcasters[upcasterKey{eventType, version}](payload)
+		if err != nil {
+			return nil, fmt.Errorf("could not upcast event type %d from version %d: %w", eventType, version, err)
+		}
+	}
+	return payload, nil
+}
+
+// upcastPayload brings the serialized payload to the current schema version of its event type
+func (u *Upcasters) upcastPayload(
+	se eventstore.SerializedEvent,
+	unmarshal func([]byte, interface{}) error,
+	marshal func(interface{}) ([]byte, error),
+) ([]byte, error) {
+	version := se.SchemaVersion
+	if version == 0 {
+		// written before schema versions were recorded
+		version = 1
+	}
+	current := u.CurrentVersion(se.EventType)
+	if version == current {
+		return se.Payload, nil
+	}
+	if version > current {
+		return nil, fmt.Errorf("schema version %d of event type %d is newer than the supported version %d", version, se.EventType, current)
+	}
+
+	var payload Payload
+	if err := unmarshal(se.Payload, &payload); err != nil {
+		return nil, err
+	}
+	payload, err := u.upcast(se.EventType, version, payload)
+	if err != nil {
+		return nil, err
+	}
+	return marshal(payload)
+}
@@ -0,0 +1,106 @@
+package serialization_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/eventstore"
+	"github.com/rieske/event-sourced-account-go/serialization"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack/v4"
+)
+
+func renameField(from, to string) serialization.Upcaster {
+	return func(payload serialization.Payload) (serialization.Payload, error) {
+		payload[to] = payload[from]
+		delete(payload, from)
+		return payload, nil
+	}
+}
+
+// v1 of MoneyDepositedEvent called the amount 'Amount', v2 calls it 'AmountDeposited'
+func depositUpcasters() *serialization.Upcasters {
+	upcasters := serialization.NewUpcasters()
+	upcasters.Register(serialization.MoneyDeposited, 1, renameField("Amount", "AmountDeposited"))
+	return upcasters
+}
+
+func v1MoneyDeposited(t *testing.T, schemaVersion int) eventstore.SerializedEvent {
+	payload, err := msgpack.Marshal(map[string]interface{}{"Amount": 5, "Balance": 10})
+	assert.NoError(t, err)
+	return eventstore.SerializedEvent{
+		AggregateId:   account.NewID(),
+		Seq:           42,
+		Payload:       payload,
+		EventType:     serialization.MoneyDeposited,
+		SchemaVersion: schemaVersion,
+	}
+}
+
+func TestUpcastV1PayloadToCurrentEvent(t *testing.T) {
+	serializer := serialization.NewUpcastingMsgpackEventSerializer(depositUpcasters())
+	serialized := v1MoneyDeposited(t, 1)
+
+	event, err := serializer.DeserializeEvent(context.Background(), serialized)
+
+	assert.NoError(t, err)
+	assert.Equal(t, eventstore.SequencedEvent{serialized.AggregateId, 42, account.MoneyDepositedEvent{5, 10}}, event)
+}
+
+func TestUnversionedPayloadIsTreatedAsV1(t *testing.T) {
+	serializer := serialization.NewUpcastingMsgpackEventSerializer(depositUpcasters())
+
+	event, err := serializer.DeserializeEvent(context.Background(), v1MoneyDeposited(t, 0))
+
+	assert.NoError(t, err)
+	assert.Equal(t, account.MoneyDepositedEvent{5, 10}, event.Event)
+}
+
+func TestUpcastersAreChained(t *testing.T) {
+	upcasters := depositUpcasters()
+	upcasters.Register(serialization.MoneyDeposited, 2, func(payload serialization.Payload) (serialization.Payload, error) {
+		payload["Balance"] = 11
+		return payload, nil
+	})
+	serializer := serialization.NewUpcastingMsgpackEventSerializer(upcasters)
+
+	event, err := serializer.DeserializeEvent(context.Background(), v1MoneyDeposited(t, 1))
+
+	assert.NoError(t, err)
+	assert.Equal(t, account.MoneyDepositedEvent{5, 11}, event.Event)
+}
+
+func TestSerializeWritesCurrentSchemaVersion(t *testing.T) {
+	serializer := serialization.NewUpcastingMsgpackEventSerializer(depositUpcasters())
+	event := eventstore.SequencedEvent{account.NewID(), 1, account.MoneyDepositedEvent{5, 10}}
+
+	serialized, err := serializer.SerializeEvent(context.Background(), event)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, serialized.SchemaVersion)
+
+	deserialized, err := serializer.DeserializeEvent(context.Background(), serialized)
+	assert.NoError(t, err)
+	assert.Equal(t, event, deserialized)
+}
+
+func TestEventsWithoutUpcastersAreAtV1(t *testing.T) {
+	serialized, err := msgpackSerializer.SerializeEvent(context.Background(), eventstore.SequencedEvent{account.NewID(), 1, account.AccountClosedEvent{}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, serialized.SchemaVersion)
+}
+
+func TestNewerSchemaVersionIsRejected(t *testing.T) {
+	_, err := msgpackSerializer.DeserializeEvent(context.Background(), v1MoneyDeposited(t, 2))
+
+	assert.EqualError(t, err, "schema version 2 of event type 3 is newer than the supported version 1")
+}
+
+func TestUpcastersHaveToBeRegisteredInOrder(t *testing.T) {
+	upcasters := serialization.NewUpcasters()
+
+	assert.Panics(t, func() {
+		upcasters.Register(serialization.MoneyDeposited, 2, renameField("Amount", "AmountDeposited"))
+	})
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	otelprometheus "go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+const serviceName = "account-go"
+
+// startTelemetry installs the OpenTelemetry providers that the instrumentation of the service reports to:
+// spans are exported as configured and metrics are served together with the prometheus ones.
+// Trace context is taken from W3C traceparent headers, or the B3 headers that the envoy load balancer sends.
+// The returned function flushes what was not exported yet and stops the providers.
+func startTelemetry(c tracingConfig) (func(ctx context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}, b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)),
+	))
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName)))
+	if err != nil {
+		return nil, fmt.Errorf("could not describe the service: %w", err)
+	}
+
+	// the exporter registers with the default prometheus registry, so OpenTelemetry metrics are served on /prometheus
+	metricExporter, err := otelprometheus.New()
+	if err != nil {
+		return nil, fmt.Errorf("could not export metrics to prometheus: %w", err)
+	}
+	meterProvider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(metricExporter), sdkmetric.WithResource(res))
+	otel.SetMeterProvider(meterProvider)
+	shutdown := []func(context.Context) error{meterProvider.Shutdown}
+
+	spanExporter, closeOutput, err := newSpanExporter(c)
+	if err != nil {
+		return nil, err
+	}
+	if spanExporter != nil {
+		tracerProvider := sdktrace.NewTracerProvider(
+			sdktrace.WithBatcher(spanExporter),
+			sdktrace.WithResource(res),
+			// traces started upstream are sampled as decided there
+			sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(c.SampleRatio))),
+		)
+		otel.SetTracerProvider(tracerProvider)
+		shutdown = append([]func(context.Context) error{tracerProvider.Shutdown}, shutdown...)
+		log.Printf("Exporting %v of traces with the %s exporter\n", c.SampleRatio, c.Exporter)
+	}
+	if closeOutput != nil {
+		shutdown = append(shutdown, func(context.Context) error {
+			return closeOutput.Close()
+		})
+	}
+
+	return func(ctx context.Context) error {
+		var errs []error
+		for _, s := range shutdown {
+			errs = append(errs, s(ctx))
+		}
+		return errors.Join(errs...)
+	}, nil
+}
+
+// newSpanExporter creates the exporter that the config asks for, nil if spans are not exported, together with the
+// file it writes to if it has to be closed
+func newSpanExporter(c tracingConfig) (sdktrace.SpanExporter, io.Closer, error) {
+	switch c.Exporter {
+	case tracingExporterOTLP:
+		var options []otlptracehttp.Option
+		if c.OTLPEndpoint != "" {
+			options = append(options, otlptracehttp.WithEndpointURL(c.OTLPEndpoint))
+		}
+		// the exporter connects lazily, an unreachable collector only loses spans
+		exporter, err := otlptracehttp.New(context.Background(), options...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not export traces to OTLP collector: %w", err)
+		}
+		return exporter, nil, nil
+	case tracingExporterStdout:
+		if c.File == "" {
+			exporter, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+			return exporter, nil, err
+		}
+		f, err := os.OpenFile(c.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not open tracing file: %w", err)
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			_ = f.Close()
+			return nil, nil, err
+		}
+		return exporter, f, nil
+	}
+	return nil, nil, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+func TestRequestsContinueTracesAndAreExportedToFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "spans.json")
+	shutdown, err := startTelemetry(tracingConfig{Exporter: tracingExporterStdout, File: file, SampleRatio: 0})
+	assert.NoError(t, err)
+	handler := otelhttp.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}), "account-api")
+
+	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	// sampled upstream, so the span is exported even though the service samples none of the traces it starts
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	assert.NoError(t, err)
+	var names []string
+	for _, family := range families {
+		names = append(names, family.GetName())
+	}
+	assert.Contains(t, strings.Join(names, " "), "http_server_duration_milliseconds")
+
+	assert.NoError(t, shutdown(context.Background()))
+	spans, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Contains(t, string(spans), "4bf92f3577b34da6a3ce929d0e0e4736")
+	assert.Contains(t, string(spans), "00f067aa0ba902b7")
+}
@@ -0,0 +1,53 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rieske/event-sourced-account-go/account"
+	"github.com/rieske/event-sourced-account-go/eventsourcing"
+)
+
+// RunConsistencyBenchmarks measures the workloads of the ConsistencyTestSuite, with each of the concurrent users
+// doing b.N operations
+func RunConsistencyBenchmarks(b *testing.B, concurrentUsers int, accountService *eventsourcing.AccountService) {
+	ctx := context.Background()
+
+	openAccount := func(b *testing.B, balance int64) account.ID {
+		id := account.NewID()
+		if err := accountService.OpenAccount(ctx, id, account.NewOwnerID()); err != nil {
+			b.Fatal(err)
+		}
+		if balance != 0 {
+			if err := accountService.Deposit(ctx, id, uuid.New(), balance); err != nil {
+				b.Fatal(err)
+			}
+		}
+		return id
+	}
+
+	b.Run("ConcurrentDeposits", func(b *testing.B) {
+		id := openAccount(b, 0)
+		b.ResetTimer()
+		doConcurrently(b.N, concurrentUsers, b.Errorf, func() error {
+			return accountService.Deposit(ctx, id, uuid.New(), 1)
+		})
+	})
+
+	b.Run("ConcurrentTransfers", func(b *testing.B) {
+		source, target := openAccount(b, int64(b.N*concurrentUsers)), openAccount(b, 0)
+		b.ResetTimer()
+		doConcurrently(b.N, concurrentUsers, b.Errorf, func() error {
+			return accountService.Transfer(ctx, source, target, uuid.New(), 1)
+		})
+	})
+
+	b.Run("ConcurrentIdempotentTransfers", func(b *testing.B) {
+		source, target := openAccount(b, int64(b.N)), openAccount(b, 0)
+		b.ResetTimer()
+		doConcurrentTransactions(b.N, concurrentUsers, b.Errorf, func(txId uuid.UUID) error {
+			return accountService.Transfer(ctx, source, target, txId, 1)
+		})
+	})
+}
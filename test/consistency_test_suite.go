@@ -18,42 +18,56 @@ type ConsistencyTestSuite struct {
 }
 
 func NewConsistencyTestSuite(opCount, concurrentUsers, snapshotFrequency int, store eventsourcing.EventStore) *ConsistencyTestSuite {
+	return NewServiceConsistencyTestSuite(opCount, concurrentUsers, eventsourcing.NewAccountService(store, snapshotFrequency))
+}
+
+func NewServiceConsistencyTestSuite(opCount, concurrentUsers int, accountService *eventsourcing.AccountService) *ConsistencyTestSuite {
 	return &ConsistencyTestSuite{
 		Suite:           suite.Suite{},
-		accountService:  eventsourcing.NewAccountService(store, snapshotFrequency),
+		accountService:  accountService,
 		operationCount:  opCount,
 		concurrentUsers: concurrentUsers,
 	}
 }
 
 func (suite *ConsistencyTestSuite) doConcurrently(action func(s *eventsourcing.AccountService) error) {
-	for i := 0; i < suite.operationCount; i++ {
+	doConcurrently(suite.operationCount, suite.concurrentUsers, suite.T().Errorf, func() error {
+		return action(suite.accountService)
+	})
+}
+
+func (suite *ConsistencyTestSuite) doConcurrentTransactions(action func(s *eventsourcing.AccountService, txId uuid.UUID) error) {
+	doConcurrentTransactions(suite.operationCount, suite.concurrentUsers, suite.T().Errorf, func(txId uuid.UUID) error {
+		return action(suite.accountService, txId)
+	})
+}
+
+func doConcurrently(operationCount, concurrentUsers int, errorf func(format string, args ...interface{}), action func() error) {
+	for i := 0; i < operationCount; i++ {
 		wg := sync.WaitGroup{}
-		wg.Add(suite.concurrentUsers)
-		for j := 0; j < suite.concurrentUsers; j++ {
-			go suite.withRetryOnConcurrentModification(&wg, i, j, func() error {
-				return action(suite.accountService)
-			})
+		wg.Add(concurrentUsers)
+		for j := 0; j < concurrentUsers; j++ {
+			go retryOnConcurrentModification(&wg, i, j, errorf, action)
 		}
 		wg.Wait()
 	}
 }
 
-func (suite *ConsistencyTestSuite) doConcurrentTransactions(action func(s *eventsourcing.AccountService, txId uuid.UUID) error) {
-	for i := 0; i < suite.operationCount; i++ {
+func doConcurrentTransactions(operationCount, concurrentUsers int, errorf func(format string, args ...interface{}), action func(txId uuid.UUID) error) {
+	for i := 0; i < operationCount; i++ {
 		var txId = uuid.New()
 		wg := sync.WaitGroup{}
-		wg.Add(suite.concurrentUsers)
-		for j := 0; j < suite.concurrentUsers; j++ {
-			go suite.withRetryOnConcurrentModification(&wg, i, j, func() error {
-				return action(suite.accountService, txId)
+		wg.Add(concurrentUsers)
+		for j := 0; j < concurrentUsers; j++ {
+			go retryOnConcurrentModification(&wg, i, j, errorf, func() error {
+				return action(txId)
 			})
 		}
 		wg.Wait()
 	}
 }
 
-func (suite *ConsistencyTestSuite) withRetryOnConcurrentModification(wg *sync.WaitGroup, iteration, threadNo int, operation func() error) {
+func retryOnConcurrentModification(wg *sync.WaitGroup, iteration, threadNo int, errorf func(format string, args ...interface{}), operation func() error) {
 	//fmt.Printf("thread %v\n", threadNo)
 	for {
 		err := operation()
@@ -62,7 +76,7 @@ func (suite *ConsistencyTestSuite) withRetryOnConcurrentModification(wg *sync.Wa
 		}
 		//fmt.Printf("thread %v retrying...\n", threadNo)
 		if err != account.ConcurrentModification {
-			suite.T().Errorf(
+			errorf(
 				"Expecting only concurrent modification errors, got %v, threadNo %v, iteration %v",
 				err, threadNo, iteration,
 			)
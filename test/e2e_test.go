@@ -23,9 +23,9 @@ const (
 	composeFile    = "../docker-compose.yml"
 )
 
-func waitForPing() {
+func waitForReadiness() {
 	for i := 0; i < 30; i++ {
-		res, err := http.Get(serviceUrl + "/ping")
+		res, err := http.Get(serviceUrl + "/health/ready")
 		if err == nil && res.StatusCode == http.StatusOK {
 			break
 		}
@@ -52,7 +52,7 @@ func composeDown() {
 
 func TestMain(m *testing.M) {
 	composeUp()
-	waitForPing()
+	waitForReadiness()
 
 	code := m.Run()
 	composeDown()
@@ -17,9 +17,13 @@ type EventsourcingTestSuite struct {
 }
 
 func NewEventsourcingTestSuite(store eventsourcing.EventStore, snapshotFrequency int) *EventsourcingTestSuite {
+	return NewServiceEventsourcingTestSuite(store, eventsourcing.NewAccountService(store, snapshotFrequency))
+}
+
+func NewServiceEventsourcingTestSuite(store eventsourcing.EventStore, service *eventsourcing.AccountService) *EventsourcingTestSuite {
 	return &EventsourcingTestSuite{
 		Suite:   suite.Suite{},
-		service: eventsourcing.NewAccountService(store, snapshotFrequency),
+		service: service,
 		store:   store,
 	}
 }
@@ -129,21 +133,61 @@ func (suite *EventsourcingTestSuite) TestTransferMoney() {
 	suite.NoError(err)
 
 	// when
-	err = suite.service.Transfer(context.Background(), sourceAccountId, targetAccountId, uuid.New(), 2)
+	txId := uuid.New()
+	err = suite.service.Transfer(context.Background(), sourceAccountId, targetAccountId, txId, 2)
 
 	// then
 	suite.NoError(err)
 	suite.expectEvents(sourceAccountId, []eventstore.SequencedEvent{
 		{sourceAccountId, 1, account.AccountOpenedEvent{sourceAccountId, sourceOwnerID}},
 		{sourceAccountId, 2, account.MoneyDepositedEvent{10, 10}},
-		{sourceAccountId, 3, account.MoneyWithdrawnEvent{2, 8}},
+		{sourceAccountId, 3, account.TransferSentEvent{txId, targetAccountId, 2, 8}},
 	})
 	suite.expectEvents(targetAccountId, []eventstore.SequencedEvent{
 		{targetAccountId, 1, account.AccountOpenedEvent{targetAccountId, targetOwnerID}},
-		{targetAccountId, 2, account.MoneyDepositedEvent{2, 2}},
+		{targetAccountId, 2, account.TransferReceivedEvent{txId, sourceAccountId, 2, 2}},
 	})
 }
 
+func (suite *EventsourcingTestSuite) TestReplayHistoricalTransfer() {
+	// given a transfer recorded before transfers had dedicated events
+	sourceAccountId, sourceOwnerID := account.NewID(), account.NewOwnerID()
+	targetAccountId, targetOwnerID := account.NewID(), account.NewOwnerID()
+	err := suite.store.Append(
+		context.Background(),
+		[]eventstore.SequencedEvent{
+			{sourceAccountId, 1, account.AccountOpenedEvent{sourceAccountId, sourceOwnerID}},
+			{sourceAccountId, 2, account.MoneyDepositedEvent{10, 10}},
+			{targetAccountId, 1, account.AccountOpenedEvent{targetAccountId, targetOwnerID}},
+		},
+		map[account.ID]eventstore.SequencedEvent{},
+		uuid.New(),
+	)
+	suite.NoError(err)
+	err = suite.store.Append(
+		context.Background(),
+		[]eventstore.SequencedEvent{
+			{sourceAccountId, 3, account.MoneyWithdrawnEvent{4, 6}},
+			{targetAccountId, 2, account.MoneyDepositedEvent{4, 4}},
+		},
+		map[account.ID]eventstore.SequencedEvent{},
+		uuid.New(),
+	)
+	suite.NoError(err)
+
+	// when
+	err = suite.service.Transfer(context.Background(), sourceAccountId, targetAccountId, uuid.New(), 1)
+
+	// then
+	suite.NoError(err)
+	snapshot, err := suite.service.QueryAccount(context.Background(), sourceAccountId)
+	suite.NoError(err)
+	suite.Equal(int64(5), snapshot.Balance)
+	snapshot, err = suite.service.QueryAccount(context.Background(), targetAccountId)
+	suite.NoError(err)
+	suite.Equal(int64(5), snapshot.Balance)
+}
+
 func (suite *EventsourcingTestSuite) TestTransferMoneyFailsWithInsufficientBalance() {
 	// given
 	sourceAccountId, sourceOwnerID := account.NewID(), account.NewOwnerID()
@@ -270,3 +314,109 @@ func (suite *EventsourcingTestSuite) TestTransferIdempotency() {
 	suite.NoError(err)
 	suite.Equal(int64(60), snapshot.Balance)
 }
+
+func (suite *EventsourcingTestSuite) TestDepositReplayWithDifferentAmountIsRejected() {
+	// given
+	id, ownerID := account.NewID(), account.NewOwnerID()
+	err := suite.service.OpenAccount(context.Background(), id, ownerID)
+	suite.NoError(err)
+	transactionId := uuid.New()
+	err = suite.service.Deposit(context.Background(), id, transactionId, 10)
+	suite.NoError(err)
+
+	// when
+	err = suite.service.Deposit(context.Background(), id, transactionId, 20)
+
+	// then
+	suite.Equal(account.TransactionMismatch, err)
+	snapshot, err := suite.service.QueryAccount(context.Background(), id)
+	suite.NoError(err)
+	suite.Equal(int64(10), snapshot.Balance)
+}
+
+func (suite *EventsourcingTestSuite) TestReplayOfFailedWithdrawalReturnsOriginalOutcome() {
+	// given
+	id, ownerID := account.NewID(), account.NewOwnerID()
+	err := suite.service.OpenAccount(context.Background(), id, ownerID)
+	suite.NoError(err)
+	transactionId := uuid.New()
+	err = suite.service.Withdraw(context.Background(), id, transactionId, 10)
+	suite.Equal(account.InsufficientBalance, err)
+	err = suite.service.Deposit(context.Background(), id, uuid.New(), 100)
+	suite.NoError(err)
+
+	// when
+	err = suite.service.Withdraw(context.Background(), id, transactionId, 10)
+
+	// then
+	suite.Equal(account.InsufficientBalance, err)
+	snapshot, err := suite.service.QueryAccount(context.Background(), id)
+	suite.NoError(err)
+	suite.Equal(int64(100), snapshot.Balance)
+}
+
+func (suite *EventsourcingTestSuite) TestTransactionIdCanNotBeReusedForAnotherOperation() {
+	// given
+	id, ownerID := account.NewID(), account.NewOwnerID()
+	err := suite.service.OpenAccount(context.Background(), id, ownerID)
+	suite.NoError(err)
+	transactionId := uuid.New()
+	err = suite.service.Deposit(context.Background(), id, transactionId, 10)
+	suite.NoError(err)
+
+	// when
+	err = suite.service.Withdraw(context.Background(), id, transactionId, 10)
+
+	// then
+	suite.Equal(account.TransactionConflict, err)
+	snapshot, err := suite.service.QueryAccount(context.Background(), id)
+	suite.NoError(err)
+	suite.Equal(int64(10), snapshot.Balance)
+}
+
+func (suite *EventsourcingTestSuite) TestStreamEventsFollowingVersion() {
+	id, ownerID := account.NewID(), account.NewOwnerID()
+	suite.NoError(suite.service.OpenAccount(context.Background(), id, ownerID))
+	suite.NoError(suite.service.Deposit(context.Background(), id, uuid.New(), 10))
+	suite.NoError(suite.service.Deposit(context.Background(), id, uuid.New(), 5))
+
+	var streamed []eventstore.SequencedEvent
+	err := suite.store.StreamEvents(context.Background(), id, 1, func(e eventstore.SequencedEvent) error {
+		streamed = append(streamed, e)
+		return nil
+	})
+
+	suite.NoError(err)
+	suite.Equal([]eventstore.SequencedEvent{
+		{id, 2, account.MoneyDepositedEvent{10, 10}},
+		{id, 3, account.MoneyDepositedEvent{5, 15}},
+	}, streamed)
+}
+
+func (suite *EventsourcingTestSuite) TestStopStreamingEvents() {
+	id, ownerID := account.NewID(), account.NewOwnerID()
+	suite.NoError(suite.service.OpenAccount(context.Background(), id, ownerID))
+	suite.NoError(suite.service.Deposit(context.Background(), id, uuid.New(), 10))
+
+	streamed := 0
+	err := suite.store.StreamEvents(context.Background(), id, 0, func(e eventstore.SequencedEvent) error {
+		streamed++
+		return eventstore.StopStreaming
+	})
+
+	suite.NoError(err)
+	suite.Equal(1, streamed)
+}
+
+func (suite *EventsourcingTestSuite) TestReplayLongHistory() {
+	id, ownerID := account.NewID(), account.NewOwnerID()
+	suite.NoError(suite.service.OpenAccount(context.Background(), id, ownerID))
+	for i := 0; i < 520; i++ {
+		suite.NoError(suite.service.Deposit(context.Background(), id, uuid.New(), 1))
+	}
+
+	snapshot, err := suite.service.QueryAccount(context.Background(), id)
+
+	suite.NoError(err)
+	suite.Equal(int64(520), snapshot.Balance)
+}